@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	activityCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "perform a dry run with no changes made")
+
+	rootCmd.AddCommand(activityCmd)
+}
+
+var activityCmd = &cobra.Command{
+	Use:   "activity",
+	Short: "Recalculate the activity of the indexed software.",
+	Long: `Calculate again the activity index and the vitality of the software in
+		ElasticSearch, with the current ACTIVITY_DAYS and VITALITY_BUCKET_DAYS,
+		and update only those fields. The repositories are cloned, or their
+		activity read from the API, but the publiccode.yml files are neither
+		downloaded nor validated again.
+		The software not recalculated are listed and the command exits with
+		status 1.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// The software is read from Elasticsearch also in dry run.
+		c := crawler.NewCrawler(dryRun)
+		if dryRun {
+			if err := c.ConnectElasticsearch(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := c.CheckGit(); err != nil {
+			log.Fatal(err)
+		}
+
+		results, err := c.RecalculateActivity(signalContext())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var data [][]string
+		for _, result := range results {
+			if result.Err != nil {
+				data = append(data, []string{result.URL, result.Err.Error()})
+			}
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Repository", "Error"})
+		table.SetFooter([]string{
+			"Recalculated: " + strconv.Itoa(len(results)-len(data)),
+			"Failed: " + strconv.Itoa(len(data)),
+		})
+		table.SetRowLine(true)
+		table.AppendBulk(data)
+		table.Render()
+
+		if len(data) > 0 {
+			os.Exit(1)
+		}
+	}}
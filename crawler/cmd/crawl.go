@@ -6,8 +6,17 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	preview    bool
+	reportFile string
+	resume     bool
+)
+
 func init() {
 	crawlCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "perform a dry run with no changes made")
+	crawlCmd.Flags().BoolVarP(&preview, "preview", "p", false, "crawl into the preview index, to be published with promote")
+	crawlCmd.Flags().BoolVar(&resume, "resume", false, "skip the repositories already processed by the previous crawl, if it didn't complete")
+	crawlCmd.Flags().StringVar(&reportFile, "report-file", "", "write the summary of the crawl as JSON to this file")
 
 	rootCmd.AddCommand(crawlCmd)
 }
@@ -15,22 +24,82 @@ func init() {
 var crawlCmd = &cobra.Command{
 	Use:   "crawl whitelist.yml whitelist/*.yml",
 	Short: "Crawl publiccode.yml files from given domains.",
-	Long:  `Crawl publiccode.yml files according to the supplied whitelist file(s).`,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Crawl publiccode.yml files according to the supplied whitelist file(s),
+		to the IndicePA index when PUBLISHERS_SOURCE is "index" or to the
+		whitelist at PUBLISHERS_URL when it's "url".`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		switch crawler.PublishersSource() {
+		case crawler.PublishersSourceIndex, crawler.PublishersSourceURL:
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		orgs := make(map[string]bool)
 		c := crawler.NewCrawler(dryRun)
+		if err := c.CheckGit(); err != nil {
+			log.Fatal(err)
+		}
+		if resume {
+			if err := c.Resume(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if preview {
+			if err := c.UsePreviewIndex(); err != nil {
+				log.Fatal(err)
+			}
+		}
 
-		// Read the supplied whitelists.
-		var publishers []crawler.PA
-		for id := range args {
-			readWhitelist, err := crawler.ReadAndParseWhitelist(args[id])
+		// Read the publishers from the supplied whitelists, the index or the URL.
+		var lists [][]crawler.PA
+		switch source := crawler.PublishersSource(); source {
+		case crawler.PublishersSourceWhitelist:
+			// All the invalid whitelists are reported before exiting.
+			invalid := false
+			for id := range args {
+				readWhitelist, err := crawler.ReadAndParseWhitelist(args[id])
+				if err != nil {
+					log.Fatal(err)
+				}
+				if err := crawler.ValidatePublishers(readWhitelist); err != nil {
+					log.Errorf("invalid publishers in %s: %v", args[id], err)
+					invalid = true
+				}
+				lists = append(lists, readWhitelist)
+			}
+			if invalid {
+				log.Fatal("Invalid whitelists, not crawling")
+			}
+		case crawler.PublishersSourceIndex:
+			// The publishers are read from Elasticsearch also in dry run.
+			if dryRun {
+				if err := c.ConnectElasticsearch(); err != nil {
+					log.Fatal(err)
+				}
+			}
+			indexed, err := c.ReadPublishersFromIndex()
 			if err != nil {
 				log.Fatal(err)
 			}
+			if err := crawler.ValidatePublishers(indexed); err != nil {
+				log.Fatalf("invalid publishers in the index: %v", err)
+			}
+			lists = append(lists, indexed)
+		case crawler.PublishersSourceURL:
+			remote, err := crawler.ReadPublishersFromURL()
+			if err != nil {
+				log.Fatal(err)
+			}
+			lists = append(lists, remote)
+		default:
+			log.Fatalf("Unknown PUBLISHERS_SOURCE %s", source)
+		}
 
+		var publishers []crawler.PA
+		for _, list := range lists {
 		Publisher:
-			for _, publisher := range readWhitelist {
+			for _, publisher := range list {
 				for _, org := range publisher.Organizations {
 					if orgs[org] {
 						log.Warnf("Skipping publisher '%s': organization '%s' already present", publisher.Name, org)
@@ -43,7 +112,7 @@ var crawlCmd = &cobra.Command{
 			}
 		}
 
-		toBeRemoved, err := c.CrawlPublishers(publishers)
+		toBeRemoved, err := c.CrawlPublishers(signalContext(), publishers)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -64,4 +133,10 @@ var crawlCmd = &cobra.Command{
 		if err != nil {
 			log.Errorf("Error while exporting data for Jekyll: %v", err)
 		}
+
+		if reportFile != "" {
+			if err := c.WriteReport(reportFile); err != nil {
+				log.Errorf("Error writing the crawl report: %v", err)
+			}
+		}
 	}}
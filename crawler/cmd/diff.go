@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var diffSave string
+
+func init() {
+	diffCmd.Flags().StringVar(&diffSave, "save", "", "also save the snapshot of the second argument to this .json file, to diff it with the next crawl")
+
+	rootCmd.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff FROM [TO]",
+	Short: "Print what changed between two crawls.",
+	Long: `Print as JSON the software added, removed and with a changed publiccode.yml
+		in TO compared to FROM.
+		Both are either a snapshot file, ending with .json, or the name of an index.
+		TO defaults to ELASTIC_PUBLICCODE_INDEX.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := crawler.NewCrawler(false)
+
+		to := viper.GetString("ELASTIC_PUBLICCODE_INDEX")
+		if len(args) > 1 {
+			to = args[1]
+		}
+
+		fromSnapshot, err := c.LoadSnapshot(args[0])
+		if err != nil {
+			log.Fatalf("Error while reading %s: %v", args[0], err)
+		}
+		toSnapshot, err := c.LoadSnapshot(to)
+		if err != nil {
+			log.Fatalf("Error while reading %s: %v", to, err)
+		}
+
+		if diffSave != "" {
+			if err := crawler.WriteSnapshot(toSnapshot, diffSave); err != nil {
+				log.Fatalf("Error while saving the snapshot: %v", err)
+			}
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(crawler.DiffSnapshots(fromSnapshot, toSnapshot)); err != nil {
+			log.Fatal(err)
+		}
+	}}
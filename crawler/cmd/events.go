@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/websocket"
+)
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+}
+
+var eventsCmd = &cobra.Command{
+	Use:   "events [ws url]",
+	Short: "Tail the events of a running crawl.",
+	Long: `Print the events of the repositories processed by a running crawl,
+		as they happen. Defaults to ws://localhost:8081/events.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		url := "ws://localhost:8081/events"
+		if len(args) > 0 {
+			url = args[0]
+		}
+
+		ws, err := websocket.Dial(url, "", "http://localhost/")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer ws.Close()
+
+		for {
+			var event string
+			if err := websocket.Message.Receive(ws, &event); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(event)
+		}
+	}}
@@ -1,12 +1,26 @@
 package cmd
 
 import (
+	"fmt"
+	"path"
+
 	"github.com/italia/developers-italia-backend/crawler/crawler"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	exportCategories []string
+	exportFormat     string
 )
 
 func init() {
+	exportCmd.Flags().StringSliceVarP(&exportCategories, "categories", "c", nil,
+		"only export a file per category with its software, in OUTPUT_DIR/categories")
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "yml",
+		"format of the category files: yml or json. ndjson exports the whole catalog in OUTPUT_DIR/software.ndjson")
+
 	rootCmd.AddCommand(exportCmd)
 }
 
@@ -14,9 +28,35 @@ var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Export YAML files.",
 	Long:  `Export YAML files for the front end.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// The format picks the export, don't fall back to another one.
+		switch {
+		case len(exportCategories) > 0 && exportFormat != "yml" && exportFormat != "json":
+			return fmt.Errorf("--format %s is not supported with --categories, use yml or json", exportFormat)
+		case len(exportCategories) == 0 && cmd.Flags().Changed("format") && exportFormat != "ndjson":
+			return fmt.Errorf("--format %s needs --categories, only ndjson exports the whole catalog", exportFormat)
+		}
+		return cobra.NoArgs(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		c := crawler.NewCrawler(false)
 
+		if len(exportCategories) > 0 {
+			err := c.ExportCategories(path.Join(viper.GetString("OUTPUT_DIR"), "categories"), exportCategories, exportFormat)
+			if err != nil {
+				log.Fatalf("Error while exporting the categories: %v", err)
+			}
+			return
+		}
+
+		if exportFormat == "ndjson" {
+			err := c.ExportNDJSON(path.Join(viper.GetString("OUTPUT_DIR"), "software.ndjson"))
+			if err != nil {
+				log.Fatalf("Error while exporting the catalog: %v", err)
+			}
+			return
+		}
+
 		// Generate the data files for Jekyll.
 		err := c.ExportForJekyll()
 		if err != nil {
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var fixAliasYes bool
+
+func init() {
+	fixAliasCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "only report the anomalies of the alias")
+	fixAliasCmd.Flags().BoolVarP(&fixAliasYes, "yes", "y", false, "repair the alias without asking for confirmation")
+
+	rootCmd.AddCommand(fixAliasCmd)
+}
+
+var fixAliasCmd = &cobra.Command{
+	Use:   "fix-alias",
+	Short: "Check and repair the public alias.",
+	Long: `Check that ELASTIC_ALIAS points exactly to ELASTIC_PUBLICCODE_INDEX
+		and ELASTIC_PUBLISHERS_INDEX, reporting the missing and the unexpected
+		indices (eg. left over by a failed promote), and repair it after
+		asking for confirmation.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Connect without creating the indices, which would hide a missing
+		// ELASTIC_PUBLICCODE_INDEX.
+		c := crawler.NewCrawler(true)
+		if err := c.ConnectElasticsearch(); err != nil {
+			log.Fatal(err)
+		}
+
+		repair, err := c.CheckAlias()
+		if err != nil {
+			log.Fatal(err)
+		}
+		repair.Report()
+
+		if !repair.Needed() || dryRun {
+			return
+		}
+
+		if !fixAliasYes {
+			fmt.Printf("Remove %v and add %v to %s? [y/N] ", repair.Remove, repair.Add, repair.Alias)
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+				log.Info("Alias left untouched")
+				return
+			}
+		}
+
+		err = c.RepairAlias(repair)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var importIndex string
+
+func init() {
+	importCmd.Flags().StringVarP(&importIndex, "index", "i", "",
+		"index to import the catalog into, ELASTIC_PUBLICCODE_INDEX if empty")
+
+	rootCmd.AddCommand(importCmd)
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import catalog.ndjson",
+	Short: "Import an exported catalog.",
+	Long: `Index the software of a catalog exported with "export --format ndjson"
+(or a JSON array of documents) and add the index to ELASTIC_ALIAS.
+The documents not matching the mapping are reported and skipped.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		index := importIndex
+		if index == "" {
+			index = viper.GetString("ELASTIC_PUBLICCODE_INDEX")
+		}
+
+		c := crawler.NewCrawler(false)
+		if err := c.ImportCatalog(args[0], index); err != nil {
+			log.Fatalf("Error while importing the catalog: %v", err)
+		}
+	}}
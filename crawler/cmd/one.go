@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"os"
 	"regexp"
 
 	"github.com/italia/developers-italia-backend/crawler/crawler"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func init() {
@@ -29,18 +31,28 @@ var oneCmd = &cobra.Command{
 		}
 
 		c := crawler.NewCrawler(dryRun)
+		if err := c.CheckGit(); err != nil {
+			log.Fatal(err)
+		}
 
 		repoURL, whitelists := args[0], args[1:]
-		err := c.CrawlRepo(repoURL, getPAfromWhiteList(repoURL, whitelists))
-		if err != nil {
-			log.Error(err)
+		crawlErr := c.CrawlRepo(signalContext(), repoURL, getPAfromWhiteList(repoURL, whitelists))
+		if crawlErr != nil {
+			log.Error(crawlErr)
 		}
 
 		// Generate the data files for Jekyll.
-		err = c.ExportForJekyll()
+		err := c.ExportForJekyll()
 		if err != nil {
 			log.Errorf("Error while exporting data for Jekyll: %v", err)
 		}
+
+		// With STRICT a repository that can't be listed, a publiccode.yml
+		// that can't be fetched or is invalid and a failed clone fail the
+		// command, eg. to gate the merges in the CI of the publishers.
+		if crawlErr != nil && viper.GetBool("STRICT") {
+			os.Exit(1)
+		}
 	},
 }
 
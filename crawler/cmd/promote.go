@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var forcePromote bool
+
+func init() {
+	promoteCmd.Flags().BoolVarP(&forcePromote, "force", "f", false, "promote even if the preview has too few documents")
+
+	rootCmd.AddCommand(promoteCmd)
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Publish the preview index.",
+	Long: `Publish the software crawled with "crawl --preview".
+		The live index is archived and replaced with the preview index,
+		moving the public alias atomically. The last crawl must have been a
+		completed preview.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := crawler.NewCrawler(false)
+
+		err := c.Promote(forcePromote)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Generate the data files for Jekyll.
+		err = c.ExportForJekyll()
+		if err != nil {
+			log.Errorf("Error while exporting data for Jekyll: %v", err)
+		}
+	}}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"io/ioutil"
+
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var reindexScript string
+
+func init() {
+	reindexCmd.Flags().StringVarP(&reindexScript, "script", "s", "",
+		"file with a painless script transforming the documents (ctx._source) while copying them")
+
+	rootCmd.AddCommand(reindexCmd)
+}
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Migrate the index to the current mapping.",
+	Long: `Copy the documents of ELASTIC_PUBLICCODE_INDEX into a new index with the
+		current mapping, without crawling, and move ELASTIC_ALIAS to it while
+		the live index gets rebuilt. If interrupted, run it again to resume.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var script string
+		if reindexScript != "" {
+			data, err := ioutil.ReadFile(reindexScript)
+			if err != nil {
+				log.Fatal(err)
+			}
+			script = string(data)
+		}
+
+		c := crawler.NewCrawler(false)
+		if err := c.Reindex(script); err != nil {
+			log.Fatalf("Error while reindexing: %v", err)
+		}
+	}}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	reposCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "perform a dry run with no changes made")
+
+	rootCmd.AddCommand(reposCmd)
+}
+
+var reposCmd = &cobra.Command{
+	Use:   "repos repos.txt whitelist.yml whitelist/*.yml",
+	Short: "Crawl publiccode.yml from the single repositories listed in a file.",
+	Long: `Crawl publiccode.yml from the repositories in repos.txt, one URL per line,
+		like the one command for each of them.
+		A repository on an unknown host or that can't be looked up doesn't stop
+		the others: the failed ones are listed at the end and the command exits
+		with status 1.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		repoURLs, err := readRepoURLs(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		c := crawler.NewCrawler(dryRun)
+		if err := c.CheckGit(); err != nil {
+			log.Fatal(err)
+		}
+
+		whitelists := args[1:]
+		publisher := func(repoURL string) crawler.PA {
+			return getPAfromWhiteList(repoURL, whitelists)
+		}
+		repoErrors, crawlErr := c.CrawlRepos(signalContext(), repoURLs, publisher)
+		if crawlErr != nil {
+			log.Error(crawlErr)
+		}
+
+		// Generate the data files for Jekyll.
+		err = c.ExportForJekyll()
+		if err != nil {
+			log.Errorf("Error while exporting data for Jekyll: %v", err)
+		}
+
+		for _, repoErr := range repoErrors {
+			log.Error(repoErr)
+		}
+		if len(repoErrors) > 0 || crawlErr != nil {
+			log.Errorf("%d of %d repositories failed", len(repoErrors), len(repoURLs))
+			os.Exit(1)
+		}
+	},
+}
+
+// readRepoURLs returns the repository URLs in fname, one per line, skipping
+// the empty lines, the comments starting with # and the blacklisted ones.
+func readRepoURLs(fname string) ([]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The blacklists are read once for all the repositories.
+	blacklisted, err := crawler.ReadBlacklistedRepos()
+	if err != nil {
+		log.Errorf("path not exists or you don't have permission: %s", err)
+	}
+
+	var repoURLs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if blacklisted.Contains(line) {
+			continue
+		}
+		repoURLs = append(repoURLs, line)
+	}
+
+	return repoURLs, scanner.Err()
+}
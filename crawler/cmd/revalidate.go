@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(revalidateCmd)
+}
+
+var revalidateCmd = &cobra.Command{
+	Use:   "revalidate",
+	Short: "Validate the indexed publiccode.yml files with the current parser.",
+	Long: `Parse again the publiccode.yml files stored in ElasticSearch with the
+		current parser and report the ones that are not valid anymore.
+		Nothing is fetched from the network and the index is left unchanged.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Only the stored files are read: the IPA list and the indices are
+		// left untouched.
+		c := crawler.NewCrawler(true)
+		if err := c.ConnectElasticsearch(); err != nil {
+			log.Fatal(err)
+		}
+
+		results, err := c.Revalidate()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var data [][]string
+		var invalid, missing int
+		for _, result := range results {
+			switch {
+			case !result.Stored:
+				missing++
+				data = append(data, []string{result.FileRawURL, "not stored, crawl again"})
+			case result.Err != nil:
+				invalid++
+				data = append(data, []string{result.FileRawURL, result.Err.Error()})
+			}
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"File", "Error"})
+		table.SetFooter([]string{
+			"Checked: " + strconv.Itoa(len(results)) + ", not valid anymore: " + strconv.Itoa(invalid),
+			"Not stored: " + strconv.Itoa(missing),
+		})
+		table.SetRowLine(true)
+		table.AppendBulk(data)
+		table.Render()
+	}}
@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -19,6 +24,25 @@ Complete documentation is available at https://github.com/italia/developers-ital
 	},
 }
 
+// signalContext returns a context canceled on SIGINT or SIGTERM, to let the
+// crawls wrap up. A second signal exits immediately.
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warnf("Received %v, shutting down after the repositories in progress (again to exit now)", sig)
+		cancel()
+
+		<-signals
+		log.Fatal("Exiting without shutting down")
+	}()
+
+	return ctx
+}
+
 // Execute is the entrypoint for cmd package Cobra.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
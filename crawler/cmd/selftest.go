@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+}
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check the crawler end-to-end on a built-in fixture.",
+	Long: `Crawl a repository served by a stub code hosting into a scratch index
+		and check it gets indexed, then clean up.
+		It exits with a non-zero status on failure.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := crawler.SelfTest()
+		if err != nil {
+			log.Fatalf("Self test failed: %v", err)
+		}
+
+		log.Info("Self test passed")
+	}}
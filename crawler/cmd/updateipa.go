@@ -8,7 +8,11 @@ import (
 	"github.com/spf13/viper"
 )
 
+var forceIPA bool
+
 func init() {
+	updateIPACmd.Flags().BoolVarP(&forceIPA, "force", "f", false, "import the data even if it didn't change since the last import")
+
 	rootCmd.AddCommand(updateIPACmd)
 }
 
@@ -25,7 +29,7 @@ var updateIPACmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
-		err = ipa.UpdateFromIndicePA(es)
+		err = ipa.UpdateFromIndicePA(es, forceIPA)
 		if err != nil {
 			log.Error(err)
 		}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/italia/developers-italia-backend/crawler/crawler"
+	"github.com/spf13/cobra"
+)
+
+var offline bool
+
+func init() {
+	validateCmd.Flags().BoolVar(&offline, "offline", false, "don't check the URLs in the file")
+
+	rootCmd.AddCommand(validateCmd)
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate publiccode.yml",
+	Short: "Validate a local publiccode.yml like the crawler does.",
+	Long: `Validate a local publiccode.yml with the checks of the crawl, without
+		a repository, and print its errors and warnings, eg. in the CI of the
+		publishers. The codiceIPA isn't matched with the whitelist.
+		It exits with status 1 if the file is not valid and 2 if it can't be read.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validation, err := crawler.ValidateLocalFile(args[0], offline)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		for _, err := range validation.Errors {
+			// The parser errors can span multiple lines.
+			fmt.Printf("ERROR %s\n", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+		}
+		for _, warning := range validation.Warnings {
+			fmt.Printf("WARNING %s\n", warning)
+		}
+
+		if !validation.Valid() {
+			fmt.Printf("%s is not valid: %d errors, %d warnings\n", args[0], len(validation.Errors), len(validation.Warnings))
+			os.Exit(1)
+		}
+		fmt.Printf("%s is valid: %d warnings\n", args[0], len(validation.Warnings))
+	}}
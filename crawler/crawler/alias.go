@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/italia/developers-italia-backend/crawler/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// AliasRepair is the fix of the public alias: the indices to add to it and to
+// remove from it.
+type AliasRepair struct {
+	Alias  string
+	Add    []string
+	Remove []string
+	// Missing are the expected indices that don't exist and can't be added.
+	Missing []string
+}
+
+// Needed returns whether the alias has to be fixed.
+func (r AliasRepair) Needed() bool {
+	return len(r.Add) > 0 || len(r.Remove) > 0
+}
+
+// Report logs the anomalies of the alias.
+func (r AliasRepair) Report() {
+	for _, index := range r.Missing {
+		log.Errorf("Alias %s: index %s doesn't exist", r.Alias, index)
+	}
+	for _, index := range r.Add {
+		log.Warnf("Alias %s: missing index %s", r.Alias, index)
+	}
+	for _, index := range r.Remove {
+		log.Warnf("Alias %s: unexpected index %s", r.Alias, index)
+	}
+	if !r.Needed() && len(r.Missing) == 0 {
+		log.Infof("Alias %s is fine", r.Alias)
+	}
+}
+
+// aliasIndices returns the indices the public alias should point to: the
+// live software index and the publishers one.
+func aliasIndices() []string {
+	return []string{
+		viper.GetString("ELASTIC_PUBLICCODE_INDEX"),
+		viper.GetString("ELASTIC_PUBLISHERS_INDEX"),
+	}
+}
+
+// planAliasRepair compares the indices of alias with the expected ones.
+// exists tells whether an index exists.
+func planAliasRepair(alias string, current, expected []string, exists func(string) bool) AliasRepair {
+	repair := AliasRepair{Alias: alias}
+
+	isCurrent := make(map[string]bool, len(current))
+	for _, index := range current {
+		isCurrent[index] = true
+	}
+	isExpected := make(map[string]bool, len(expected))
+	for _, index := range expected {
+		isExpected[index] = true
+
+		switch {
+		case isCurrent[index]:
+		case exists(index):
+			repair.Add = append(repair.Add, index)
+		default:
+			repair.Missing = append(repair.Missing, index)
+		}
+	}
+	for _, index := range current {
+		if !isExpected[index] {
+			repair.Remove = append(repair.Remove, index)
+		}
+	}
+	sort.Strings(repair.Remove)
+
+	return repair
+}
+
+// CheckAlias inspects ELASTIC_ALIAS and returns how to make it point only to
+// the live indices.
+func (c *Crawler) CheckAlias() (AliasRepair, error) {
+	alias := viper.GetString("ELASTIC_ALIAS")
+
+	current, err := elastic.AliasIndices(alias, c.es)
+	if err != nil {
+		return AliasRepair{}, err
+	}
+
+	var existsErr error
+	repair := planAliasRepair(alias, current, aliasIndices(), func(index string) bool {
+		exists, err := c.es.IndexExists(index).Do(context.Background())
+		if err != nil {
+			existsErr = err
+		}
+		return exists
+	})
+
+	return repair, existsErr
+}
+
+// RepairAlias applies repair in a single atomic update of the alias.
+func (c *Crawler) RepairAlias(repair AliasRepair) error {
+	if !repair.Needed() {
+		return nil
+	}
+
+	service := c.es.Alias()
+	for _, index := range repair.Remove {
+		service = service.Remove(index, repair.Alias)
+	}
+	for _, index := range repair.Add {
+		service = service.Add(index, repair.Alias)
+	}
+
+	if _, err := service.Do(context.Background()); err != nil {
+		return fmt.Errorf("can't update the alias %s: %v", repair.Alias, err)
+	}
+	log.Infof("Alias %s repaired", repair.Alias)
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanAliasRepair(t *testing.T) {
+	expected := []string{"publiccode", "publishers"}
+	exists := func(index string) bool { return index != "gone" }
+
+	repair := planAliasRepair("alias", []string{"publishers", "publiccode"}, expected, exists)
+	assert.False(t, repair.Needed())
+
+	repair = planAliasRepair("alias", []string{"publiccode_preview", "publishers"}, expected, exists)
+	assert.True(t, repair.Needed())
+	assert.Equal(t, []string{"publiccode"}, repair.Add)
+	assert.Equal(t, []string{"publiccode_preview"}, repair.Remove)
+
+	repair = planAliasRepair("alias", nil, []string{"publiccode", "gone"}, exists)
+	assert.Equal(t, []string{"publiccode"}, repair.Add)
+	assert.Equal(t, []string{"gone"}, repair.Missing)
+	assert.Empty(t, repair.Remove)
+}
@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// errNoAPIActivity is returned by apiRepoActivity for the repositories
+// whose code hosting doesn't expose the commit statistics.
+var errNoAPIActivity = errors.New("activity not available from the API of the code hosting")
+
+// errStatsNotReady is returned while GitHub is still computing the commit
+// statistics of a repository, answering 202 Accepted. They are usually
+// ready for the next crawl.
+var errStatsNotReady = errors.New("commit statistics not ready yet")
+
+// apiActivity returns whether the activity of the repositories not cloned
+// is calculated from the API of the code hosting, API_ACTIVITY.
+func apiActivity() bool {
+	return viper.GetBool("API_ACTIVITY")
+}
+
+// githubWeek is a week of the GitHub statistics, starting on Sunday at W.
+type githubWeek struct {
+	W    int64 `json:"week"`
+	Days []int `json:"days"`
+}
+
+// githubContributor is an author of the GitHub statistics, with the number
+// of commits of each week starting at W.
+type githubContributor struct {
+	Weeks []struct {
+		W int64 `json:"w"`
+		C int   `json:"c"`
+	} `json:"weeks"`
+}
+
+// apiRepoActivity returns the repository activity index and the vitality
+// calculated like CalculateRepoActivity, but from the commit statistics of
+// the API of the code hosting instead of the git clone.
+// Only GitHub exposes them, for the last year of the whole repository:
+// the merges and the releases are not counted and the repositories with a
+// subpath are not supported.
+func apiRepoActivity(ctx context.Context, repository Repository, days int, now time.Time) (float64, map[int]float64, error) {
+	var metadata struct {
+		URL       string    `json:"url"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	if repository.Domain.API() != "github" || repository.Subpath != "" || len(repository.Metadata) == 0 {
+		return 0, nil, errNoAPIActivity
+	}
+	if err := json.Unmarshal(repository.Metadata, &metadata); err != nil {
+		return 0, nil, err
+	}
+	if metadata.URL == "" {
+		return 0, nil, errNoAPIActivity
+	}
+
+	var weeks []githubWeek
+	if err := getGithubStats(ctx, metadata.URL+"/stats/commit_activity", repository.Headers, &weeks); err != nil {
+		return 0, nil, err
+	}
+	var contributors []githubContributor
+	if err := getGithubStats(ctx, metadata.URL+"/stats/contributors", repository.Headers, &contributors); err != nil {
+		return 0, nil, err
+	}
+
+	commitsPerDay := map[string]int{}
+	for _, week := range weeks {
+		start := time.Unix(week.W, 0).UTC()
+		for d, commits := range week.Days {
+			commitsPerDay[start.AddDate(0, 0, d).Format("2006-01-02")] += commits
+		}
+	}
+
+	longevity := now.Sub(metadata.CreatedAt).Hours() / 24
+	if metadata.CreatedAt.IsZero() {
+		longevity = 0
+	}
+
+	activityIndex, vitality := calculateVitality(days, longevity, func(i int) (float64, float64, float64) {
+		lastDays := now.AddDate(0, 0, -i)
+		return contributorsBefore(contributors, lastDays), float64(commitsPerDay[lastDays.UTC().Format("2006-01-02")]), 0
+	})
+
+	return activityIndex, vitality, nil
+}
+
+// contributorsBefore returns the number of contributors with commits in the
+// weeks started before t.
+func contributorsBefore(contributors []githubContributor, t time.Time) float64 {
+	var authors float64
+	for _, contributor := range contributors {
+		for _, week := range contributor.Weeks {
+			if week.C > 0 && time.Unix(week.W, 0).Before(t) {
+				authors++
+				break
+			}
+		}
+	}
+
+	return authors
+}
+
+// getGithubStats decodes in v the GitHub statistics at statsURL. v is left
+// empty for the empty repositories, that GitHub answers with 204 No Content.
+func getGithubStats(ctx context.Context, statsURL string, headers map[string]string, v interface{}) error {
+	resp, err := getURLContext(ctx, requestAPI, statsURL, headers)
+	switch {
+	case resp.Status.Code == http.StatusAccepted:
+		return errStatsNotReady
+	case resp.Status.Code == http.StatusNoContent:
+		return nil
+	case err != nil:
+		return err
+	case resp.Status.Code != http.StatusOK:
+		return fmt.Errorf("unexpected status %s of %s", resp.Status.Text, statsURL)
+	}
+
+	return json.Unmarshal(resp.Body, v)
+}
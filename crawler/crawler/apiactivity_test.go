@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIRepoActivity(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	// ranges reads vitality-ranges.yml from the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	now := time.Date(2020, time.July, 15, 12, 0, 0, 0, time.UTC)
+	week := time.Date(2020, time.July, 12, 0, 0, 0, 0, time.UTC).Unix()
+
+	var stats string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/italia/app/stats/commit_activity":
+			switch stats {
+			case "":
+				w.WriteHeader(http.StatusAccepted)
+			case "empty":
+				w.WriteHeader(http.StatusNoContent)
+			case "forbidden":
+				w.WriteHeader(http.StatusForbidden)
+			default:
+				fmt.Fprint(w, stats)
+			}
+		case "/repos/italia/app/stats/contributors":
+			fmt.Fprintf(w, `[{"total": 5, "weeks": [{"w": %d, "c": 0}, {"w": %d, "c": 5}]}]`, week-7*24*3600, week)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	repository := Repository{
+		Domain:   Domain{Host: "github.com"},
+		Metadata: []byte(`{"url": "` + ts.URL + `/repos/italia/app", "created_at": "2020-04-06T12:00:00Z"}`),
+	}
+
+	// 5 commits today (codeActivity 8) and none yesterday (2), one author
+	// (userCommunity 4), no releases (releaseHistory 20), 100 days old
+	// (longevity 20).
+	stats = fmt.Sprintf(`[{"week": %d, "days": [0, 0, 0, 5, 0, 0, 0], "total": 5}]`, week)
+	activityIndex, vitality, err := apiRepoActivity(context.Background(), repository, 2, now)
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]float64{0: 52, 1: 46}, vitality)
+	assert.Equal(t, float64(49), activityIndex)
+
+	// Still being computed by GitHub.
+	stats = ""
+	_, _, err = apiRepoActivity(context.Background(), repository, 2, now)
+	assert.Equal(t, errStatsNotReady, err)
+
+	// An empty repository, without commits.
+	stats = "empty"
+	_, vitality, err = apiRepoActivity(context.Background(), repository, 2, now)
+	assert.Nil(t, err)
+	assert.Len(t, vitality, 2)
+
+	// Not accessible.
+	stats = "forbidden"
+	_, _, err = apiRepoActivity(context.Background(), repository, 2, now)
+	assert.Error(t, err)
+
+	// Not supported.
+	_, _, err = apiRepoActivity(context.Background(), Repository{Domain: Domain{Host: "gitlab.com"}, Metadata: []byte(`{}`)}, 2, now)
+	assert.Equal(t, errNoAPIActivity, err)
+	repository.Subpath = "apps/protocollo"
+	_, _, err = apiRepoActivity(context.Background(), repository, 2, now)
+	assert.Equal(t, errNoAPIActivity, err)
+}
@@ -0,0 +1,35 @@
+package crawler
+
+import (
+	"context"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+)
+
+// skipArchived returns whether the archived repositories are skipped and
+// removed from Elasticsearch (SKIP_ARCHIVED).
+func skipArchived() bool {
+	return viper.GetBool("SKIP_ARCHIVED")
+}
+
+// skipArchivedListed returns whether a listed repository is left out because
+// archived. The archived repositories are removed by ProcessRepo with
+// SKIP_ARCHIVED, skipped here otherwise.
+func skipArchivedListed(archived bool) bool {
+	return archived && !skipArchived()
+}
+
+// removeFromES deletes the indexed document of repository, if any.
+func (c *Crawler) removeFromES(ctx context.Context, repository Repository) error {
+	_, err := c.es.Delete().
+		Index(c.index).
+		Type("software").
+		Id(repository.generateID()).
+		Do(ctx)
+	if es.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddGiteaRepositoryArchived(t *testing.T) {
+	v := GiteaRepo{FullName: "regione/old", Archived: true, DefaultBranch: "main", HTMLURL: "https://gitea.example.org/regione/old"}
+	repositories := make(chan Repository, 1)
+
+	assert.Error(t, addGiteaRepository(v, "", Domain{}, PA{}, nil, repositories))
+
+	viper.Set("SKIP_ARCHIVED", true)
+	defer viper.Set("SKIP_ARCHIVED", nil)
+
+	// Passed to ProcessRepo, to be removed.
+	assert.NoError(t, addGiteaRepository(v, "", Domain{}, PA{}, nil, repositories))
+	assert.True(t, (<-repositories).Archived)
+}
+
+func TestRemoveFromES(t *testing.T) {
+	repository := Repository{Name: "pcm/app", GitCloneURL: "https://github.com/pcm/app.git"}
+	unknown := Repository{Name: "pcm/new", GitCloneURL: "https://github.com/pcm/new.git"}
+
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/publiccode/software/"+repository.generateID() {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"result": "not_found"}`)
+			return
+		}
+		deleted = append(deleted, r.URL.Path)
+		fmt.Fprintf(w, `{"_id": "%s", "result": "deleted"}`, repository.generateID())
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crawler{es: client, index: "publiccode"}
+
+	assert.NoError(t, c.removeFromES(context.Background(), repository))
+	assert.Len(t, deleted, 1)
+
+	// Never indexed.
+	assert.NoError(t, c.removeFromES(context.Background(), unknown))
+}
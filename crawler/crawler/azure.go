@@ -0,0 +1,333 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// azureAPIVersion is the version of the Azure DevOps REST API requested.
+const azureAPIVersion = "6.0"
+
+// azurePageSize is the number of projects requested per page.
+const azurePageSize = 100
+
+// azureContinuationHeader is the header with the token of the next page of
+// the Azure DevOps listings.
+const azureContinuationHeader = "X-Ms-Continuationtoken"
+
+// AzureProjects is the response of the Azure DevOps projects list.
+type AzureProjects struct {
+	Count int            `json:"count"`
+	Value []AzureProject `json:"value"`
+}
+
+// AzureProject is a project of an Azure DevOps organization.
+type AzureProject struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	State      string `json:"state"`
+	Visibility string `json:"visibility"`
+}
+
+// AzureRepos is the response of the Azure DevOps repositories list.
+type AzureRepos struct {
+	Count int         `json:"count"`
+	Value []AzureRepo `json:"value"`
+}
+
+// AzureRepo is a git repository of an Azure DevOps project.
+type AzureRepo struct {
+	ID            string       `json:"id"`
+	Name          string       `json:"name"`
+	URL           string       `json:"url"`
+	Project       AzureProject `json:"project"`
+	DefaultBranch string       `json:"defaultBranch"`
+	Size          int64        `json:"size"`
+	RemoteURL     string       `json:"remoteUrl"`
+	WebURL        string       `json:"webUrl"`
+	IsDisabled    bool         `json:"isDisabled"`
+	IsFork        bool         `json:"isFork"`
+}
+
+// azureHeaders returns the headers of the Azure DevOps requests, rotating
+// between the personal access tokens in BasicAuth. The user is ignored by
+// Azure DevOps, so the tokens can be given alone.
+func azureHeaders(domain Domain) map[string]string {
+	credentials := make([]string, 0, len(domain.BasicAuth))
+	for _, credential := range domain.BasicAuth {
+		if credential != "" && !strings.Contains(credential, ":") {
+			credential = ":" + credential
+		}
+		credentials = append(credentials, credential)
+	}
+
+	headers := make(map[string]string)
+	if authorization := rotateAuthorization(credentials, domain.Host, time.Now()); authorization != "" {
+		headers["Authorization"] = authorization
+	}
+
+	return headers
+}
+
+// RegisterAzureAPI register the crawler function for Azure DevOps API.
+// It lists the projects of an organization at "link", following the
+// continuation token, and adds the repositories of each one.
+// If a next page is available return its url.
+// Otherwise returns an empty ("") string.
+func RegisterAzureAPI() OrganizationHandler {
+	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, string, error) {
+		headers := azureHeaders(domain)
+
+		// Parse url.
+		u, err := url.Parse(link)
+		if err != nil {
+			return link, "", err
+		}
+		// Set domain host to new host.
+		domain.Host = u.Hostname()
+
+		// The organizations of a single project list its repositories.
+		if strings.HasSuffix(u.Path, "/_apis/git/repositories") {
+			return "", "", addAzureRepositories(link, domain, pa, headers, repositories)
+		}
+
+		resp, err := getURL(requestAPI, link, headers)
+		if err != nil {
+			return link, "", err
+		}
+		if resp.Status.Code != http.StatusOK {
+			log.Warnf("Request returned: %s", string(resp.Body))
+			return "", "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+		}
+
+		var projects AzureProjects
+		err = json.Unmarshal(resp.Body, &projects)
+		if err != nil {
+			return link, "", err
+		}
+
+		for _, project := range projects.Value {
+			if project.Visibility != "public" {
+				log.Debugf("Skipping the %s project of %s: not public", project.Name, link)
+				continue
+			}
+
+			reposURL := *u
+			reposURL.Path = path.Join(path.Dir(path.Dir(u.Path)), project.Name, "_apis/git/repositories")
+			reposURL.RawQuery = url.Values{"api-version": []string{azureAPIVersion}}.Encode()
+			err = addAzureRepositories(reposURL.String(), domain, pa, headers, repositories)
+			if err != nil {
+				log.Warnf("Skipping the %s project of %s: %v", project.Name, link, err)
+			}
+		}
+
+		// The last page has no continuation token.
+		token := resp.Headers.Get(azureContinuationHeader)
+		if token == "" {
+			return "", "", nil
+		}
+		query := u.Query()
+		query.Set("continuationToken", token)
+		u.RawQuery = query.Encode()
+
+		return u.String(), "", nil
+	}
+}
+
+// addAzureRepositories adds the repositories listed at link, the
+// repositories of a project, to the repositories channel.
+func addAzureRepositories(link string, domain Domain, pa PA, headers map[string]string, repositories chan Repository) error {
+	resp, err := getURL(requestAPI, link, headers)
+	if err != nil {
+		return err
+	}
+	if resp.Status.Code != http.StatusOK {
+		log.Warnf("Request returned: %s", string(resp.Body))
+		return errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+	}
+
+	var repos AzureRepos
+	err = json.Unmarshal(resp.Body, &repos)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range repos.Value {
+		err = addAzureRepository(v, "", domain, pa, headers, repositories)
+		if err != nil {
+			log.Warnf("Skipping %s: %v", v.WebURL, err)
+		}
+	}
+
+	return nil
+}
+
+// RegisterSingleAzureAPI register the crawler function for single repository Azure DevOps API.
+// Return nil if the repository was successfully added to repositories channel.
+// Otherwise return the generated error.
+func RegisterSingleAzureAPI() SingleRepoHandler {
+	return func(domain Domain, link string, repositories chan Repository, pa PA) error {
+		headers := azureHeaders(domain)
+
+		// Parse url.
+		u, err := url.Parse(link)
+		if err != nil {
+			return err
+		}
+		subpath := splitSubpath(u)
+
+		// Set domain host to new host.
+		domain.Host = u.Hostname()
+
+		// IN: https://dev.azure.com/org/project/_git/repo
+		// OUT: https://dev.azure.com/org/project/_apis/git/repositories/repo
+		parts := strings.Split(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), "/")
+		if len(parts) != 4 || parts[2] != "_git" {
+			return fmt.Errorf("not an Azure DevOps repository url: %s", link)
+		}
+		u.Path = path.Join("/", parts[0], parts[1], "_apis/git/repositories", parts[3])
+		u.RawQuery = url.Values{"api-version": []string{azureAPIVersion}}.Encode()
+
+		// Get single Repo.
+		resp, err := getURL(requestAPI, u.String(), headers)
+		if err != nil {
+			return err
+		}
+		if resp.Status.Code != http.StatusOK {
+			log.Warnf("Request returned: %s", string(resp.Body))
+			return errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+		}
+
+		var v AzureRepo
+		err = json.Unmarshal(resp.Body, &v)
+		if err != nil {
+			return err
+		}
+
+		return addAzureRepository(v, subpath, domain, pa, headers, repositories)
+	}
+}
+
+// addAzureRepository adds the repository v to the repositories channel.
+// subpath is the directory of the software, empty for the root of the repository.
+func addAzureRepository(v AzureRepo, subpath string, domain Domain, pa PA, headers map[string]string, repositories chan Repository) error {
+	if v.Project.Visibility == "private" || v.IsDisabled {
+		return fmt.Errorf("%w: private or disabled", errRepositorySkipped)
+	}
+	// If the repository was never used, there's no branch.
+	branch := strings.TrimPrefix(v.DefaultBranch, "refs/heads/")
+	if branch == "" {
+		return fmt.Errorf("%w: empty", errRepositorySkipped)
+	}
+
+	fileRawURL, err := generateAzureRawURL(v.WebURL, branch, subpath, domain.crawledFilename())
+	if err != nil {
+		return err
+	}
+
+	// Marshal all the repository metadata.
+	metadata, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("azure metadata: %v", err)
+		return err
+	}
+
+	u, err := url.Parse(v.WebURL)
+	if err != nil {
+		return err
+	}
+
+	repositories <- Repository{
+		Name:        strings.Replace(strings.Trim(u.Path, "/"), "/_git/", "/", 1),
+		Hostname:    domain.Host,
+		FileRawURL:  fileRawURL,
+		GitCloneURL: v.WebURL,
+		GitBranch:   branch,
+		Domain:      domain,
+		Pa:          pa,
+		Headers:     headers,
+		Metadata:    metadata,
+		Subpath:     subpath,
+		Fork:        v.IsFork,
+	}
+
+	return nil
+}
+
+// generateAzureRawURL returns the Azure DevOps specific file raw url, from
+// the web url of the repository.
+// IN: https://dev.azure.com/org/project/_git/repo
+// OUT: https://dev.azure.com/org/project/_apis/git/repositories/repo/items?path=/publiccode.yml&...
+func generateAzureRawURL(webURL, branch, subpath, filename string) (string, error) {
+	u, err := url.Parse(webURL)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 4 || parts[2] != "_git" {
+		return "", fmt.Errorf("not an Azure DevOps repository url: %s", webURL)
+	}
+	u.Path = path.Join("/", parts[0], parts[1], "_apis/git/repositories", parts[3], "items")
+	u.RawQuery = url.Values{
+		"path":                          []string{path.Join("/", subpath, filename)},
+		"versionDescriptor.version":     []string{branch},
+		"versionDescriptor.versionType": []string{"branch"},
+		"$format":                       []string{"octetStream"},
+		"api-version":                   []string{azureAPIVersion},
+	}.Encode()
+
+	return u.String(), nil
+}
+
+// GenerateAzureAPIURL returns the api url of given Azure DevOps organization
+// link: its projects or, for a single project, its repositories.
+// IN: https://dev.azure.com/org
+// OUT:https://dev.azure.com/org/_apis/projects?$top=100&api-version=6.0
+// IN: https://dev.azure.com/org/project
+// OUT:https://dev.azure.com/org/project/_apis/git/repositories?api-version=6.0
+func GenerateAzureAPIURL() GeneratorAPIURL {
+	return func(in string) (out []string, err error) {
+		u, err := url.Parse(in)
+		if err != nil {
+			return []string{in}, err
+		}
+
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		switch len(parts) {
+		case 1:
+			u.Path = path.Join("/", parts[0], "_apis/projects")
+			u.RawQuery = url.Values{
+				"$top":        []string{fmt.Sprint(azurePageSize)},
+				"api-version": []string{azureAPIVersion},
+			}.Encode()
+		case 2:
+			u.Path = path.Join("/", parts[0], parts[1], "_apis/git/repositories")
+			u.RawQuery = url.Values{"api-version": []string{azureAPIVersion}}.Encode()
+		default:
+			return []string{in}, fmt.Errorf("not an Azure DevOps organization or project url: %s", in)
+		}
+
+		return []string{u.String()}, nil
+	}
+}
+
+// IsAzure returns "true" if the url is on Azure DevOps.
+func IsAzure(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		log.Errorf("IsAzure: impossible to parse %s.", link)
+		return false
+	}
+
+	return u.Hostname() == "dev.azure.com"
+}
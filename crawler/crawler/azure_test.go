@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateAzureAPIURL(t *testing.T) {
+	out, err := GenerateAzureAPIURL()("https://dev.azure.com/comune")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://dev.azure.com/comune/_apis/projects?%24top=100&api-version=6.0"}, out)
+
+	out, err = GenerateAzureAPIURL()("https://dev.azure.com/comune/servizi")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://dev.azure.com/comune/servizi/_apis/git/repositories?api-version=6.0"}, out)
+
+	assert.Equal(t, "azure", Domain{Host: "dev.azure.com"}.API())
+}
+
+func TestGenerateAzureRawURL(t *testing.T) {
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	rawURL, err := generateAzureRawURL("https://dev.azure.com/comune/servizi/_git/protocollo", "main", "apps/web", "publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dev.azure.com/comune/servizi/_apis/git/repositories/protocollo/items?"+
+		"%24format=octetStream&api-version=6.0&path=%2Fapps%2Fweb%2Fpubliccode.yml"+
+		"&versionDescriptor.version=main&versionDescriptor.versionType=branch", rawURL)
+
+	_, err = generateAzureRawURL("https://dev.azure.com/comune/servizi", "main", "", "publiccode.yml")
+	assert.Error(t, err)
+}
+
+func TestAzureAPI(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	var authorization string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		repo := func(project, name, visibility string) string {
+			return fmt.Sprintf(`{"name": "%s", "defaultBranch": "refs/heads/main",
+				"project": {"name": "%s", "visibility": "%s"},
+				"webUrl": "%s/comune/%s/_git/%s"}`, name, project, visibility, ts.URL, project, name)
+		}
+
+		switch r.URL.Path {
+		case "/comune/_apis/projects":
+			if r.URL.Query().Get("continuationToken") == "" {
+				w.Header().Set("X-MS-ContinuationToken", "next")
+				fmt.Fprint(w, `{"count": 2, "value": [{"name": "servizi", "visibility": "public"}, {"name": "interno", "visibility": "private"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"count": 1, "value": [{"name": "tributi", "visibility": "public"}]}`)
+		case "/comune/servizi/_apis/git/repositories":
+			fmt.Fprintf(w, `{"count": 1, "value": [%s]}`, repo("servizi", "protocollo", "public"))
+		case "/comune/tributi/_apis/git/repositories":
+			fmt.Fprintf(w, `{"count": 1, "value": [%s]}`, repo("tributi", "imu", "public"))
+		case "/comune/servizi/_apis/git/repositories/protocollo":
+			fmt.Fprint(w, repo("servizi", "protocollo", "public"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	domain := Domain{Host: "dev.azure.com", BasicAuth: []string{"PAT"}}
+	repositories := make(chan Repository, 10)
+
+	next, _, err := RegisterAzureAPI()(domain, ts.URL+"/comune/_apis/projects?%24top=100&api-version=6.0", repositories, PA{})
+	assert.NoError(t, err)
+	assert.Equal(t, ts.URL+"/comune/_apis/projects?%24top=100&api-version=6.0&continuationToken=next", next)
+	assert.Equal(t, authorizationHeader(":PAT"), authorization)
+
+	next, _, err = RegisterAzureAPI()(domain, next, repositories, PA{})
+	assert.NoError(t, err)
+	assert.Empty(t, next)
+
+	err = RegisterSingleAzureAPI()(domain, ts.URL+"/comune/servizi/_git/protocollo#apps/web", repositories, PA{})
+	assert.NoError(t, err)
+	close(repositories)
+
+	var repos []Repository
+	for repo := range repositories {
+		repos = append(repos, repo)
+	}
+	assert.Len(t, repos, 3)
+	assert.Equal(t, "comune/servizi/protocollo", repos[0].Name)
+	assert.Equal(t, ts.URL+"/comune/servizi/_git/protocollo", repos[0].GitCloneURL)
+	assert.Equal(t, "main", repos[0].GitBranch)
+	assert.Equal(t, "comune/tributi/imu", repos[1].Name)
+	assert.Equal(t, "apps/web", repos[2].Subpath)
+	assert.Contains(t, repos[2].FileRawURL, "path=%2Fapps%2Fweb%2Fpubliccode.yml")
+}
+
+func TestAzureHeaders(t *testing.T) {
+	atomic.StoreUint32(&tokenRotation, 0)
+	domain := Domain{Host: "dev.azure.com", BasicAuth: []string{"ONE", "user:TWO"}}
+
+	// The tokens are rotated, with an empty user if it's missing.
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte(":ONE")), azureHeaders(domain)["Authorization"])
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("user:TWO")), azureHeaders(domain)["Authorization"])
+
+	assert.Empty(t, azureHeaders(Domain{Host: "dev.azure.com"}))
+}
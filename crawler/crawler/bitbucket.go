@@ -3,14 +3,13 @@ package crawler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"path"
 	"time"
 
-	httpclient "github.com/italia/httpclient-lib-go"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 // Bitbucket is the complete response for the Bitbucket all repositories list.
@@ -181,13 +180,13 @@ type Links struct {
 
 // RegisterBitbucketAPI register the crawler function for Bitbucket API.
 func RegisterBitbucketAPI() OrganizationHandler {
-	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, error) {
+	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, string, error) {
 		// Set BasicAuth header.
 		headers := make(map[string]string)
 		if domain.BasicAuth != nil {
 			n, err := generateRandomInt(len(domain.BasicAuth))
 			if err != nil {
-				return link, err
+				return link, "", err
 			}
 			headers["Authorization"] = domain.BasicAuth[n]
 		}
@@ -195,26 +194,26 @@ func RegisterBitbucketAPI() OrganizationHandler {
 		// Parse url.
 		u, err := url.Parse(link)
 		if err != nil {
-			return link, err
+			return link, "", err
 		}
 		// Set domain host to new host.
 		domain.Host = u.Hostname()
 
 		// Get List of repositories.
-		resp, err := httpclient.GetURL(link, headers)
+		resp, err := getURL(requestAPI, link, headers)
 		if err != nil {
-			return link, err
+			return link, "", err
 		}
 		if resp.Status.Code != http.StatusOK {
 			log.Warnf("Request returned: %s", string(resp.Body))
-			return "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+			return "", "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
 		}
 
 		// Fill response as list of values (repositories data).
 		var result Bitbucket
 		err = json.Unmarshal(resp.Body, &result)
 		if err != nil {
-			return link, err
+			return link, "", err
 		}
 
 		// Add repositories to the channel that will perform the check on everyone.
@@ -223,9 +222,9 @@ func RegisterBitbucketAPI() OrganizationHandler {
 			// Join file raw URL.
 			u, err := url.Parse(v.Links.HTML.Href)
 			if err != nil {
-				return link, err
+				return link, "", err
 			}
-			u.Path = path.Join(u.Path, "raw", v.Mainbranch.Name, viper.GetString("CRAWLED_FILENAME"))
+			u.Path = path.Join(u.Path, "raw", v.Mainbranch.Name, domain.crawledFilename())
 
 			// Marshal all the repository metadata.
 			metadata, err := json.Marshal(v)
@@ -245,17 +244,18 @@ func RegisterBitbucketAPI() OrganizationHandler {
 					Pa:          pa,
 					Headers:     headers,
 					Metadata:    metadata,
+					Fork:        v.Parent.FullName != "",
 				}
 			}
 		}
 
 		// if last page for this organization, the result.Next is empty.
 		if len(result.Next) == 0 {
-			return "", nil
+			return "", "", nil
 		}
 
 		// Return next url.
-		return result.Next, nil
+		return result.Next, "", nil
 	}
 }
 
@@ -277,6 +277,7 @@ func RegisterSingleBitbucketAPI() SingleRepoHandler {
 		if err != nil {
 			return err
 		}
+		subpath := splitSubpath(u)
 
 		// Set domain host to new host.
 		domain.Host = u.Hostname()
@@ -287,7 +288,7 @@ func RegisterSingleBitbucketAPI() SingleRepoHandler {
 		linkRepo := u.String()
 
 		// Get single Repo
-		resp, err := httpclient.GetURL(linkRepo, headers)
+		resp, err := getURL(requestAPI, linkRepo, headers)
 		if err != nil {
 			return err
 		}
@@ -308,7 +309,7 @@ func RegisterSingleBitbucketAPI() SingleRepoHandler {
 		if err != nil {
 			return err
 		}
-		fullURL := path.Join(u.Hostname(), result.FullName, "raw", result.Mainbranch.Name, viper.GetString("CRAWLED_FILENAME"))
+		fullURL := path.Join(u.Hostname(), result.FullName, "raw", result.Mainbranch.Name, subpath, domain.crawledFilename())
 
 		// Marshal all the repository metadata.
 		metadata, err := json.Marshal(result)
@@ -326,9 +327,10 @@ func RegisterSingleBitbucketAPI() SingleRepoHandler {
 				Pa:         pa,
 				Headers:    headers,
 				Metadata:   metadata,
+				Subpath:    subpath,
 			}
 		} else {
-			return errors.New("repository is: empty")
+			return fmt.Errorf("%w: empty", errRepositorySkipped)
 		}
 
 		return nil
@@ -367,7 +369,7 @@ func IsBitbucket(link string) bool {
 	u.Path = "2.0/hook_events"
 	u.Host = "api." + u.Host
 
-	resp, err := httpclient.GetURL(u.String(), nil)
+	resp, err := getURL(requestAPI, u.String(), nil)
 	if err != nil {
 		log.Debugf("can %s use Bitbucket API? No.", link)
 		return false
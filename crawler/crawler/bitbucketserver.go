@@ -0,0 +1,358 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// bitbucketServerAPIPath is the path of the Bitbucket Server REST API,
+// after the context path of the instance.
+const bitbucketServerAPIPath = "rest/api/1.0"
+
+// bitbucketServerPageSize is the number of repositories requested per page.
+const bitbucketServerPageSize = 100
+
+// BitbucketServerRepos is a page of the repositories of a Bitbucket Server
+// project or user.
+type BitbucketServerRepos struct {
+	Size          int                   `json:"size"`
+	Limit         int                   `json:"limit"`
+	Start         int                   `json:"start"`
+	IsLastPage    bool                  `json:"isLastPage"`
+	NextPageStart int                   `json:"nextPageStart"`
+	Values        []BitbucketServerRepo `json:"values"`
+}
+
+// BitbucketServerRepo is a repository of Bitbucket Server.
+type BitbucketServerRepo struct {
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Public   bool   `json:"public"`
+	Archived bool   `json:"archived"`
+	Project  struct {
+		Key    string `json:"key"`
+		Type   string `json:"type"`
+		Public bool   `json:"public"`
+		Owner  struct {
+			Slug string `json:"slug"`
+		} `json:"owner"`
+	} `json:"project"`
+	Origin *struct {
+		Slug string `json:"slug"`
+	} `json:"origin,omitempty"`
+	Links struct {
+		Clone []struct {
+			Href string `json:"href"`
+			Name string `json:"name"`
+		} `json:"clone"`
+		Self []struct {
+			Href string `json:"href"`
+		} `json:"self"`
+	} `json:"links"`
+}
+
+// BitbucketServerBranch is the default branch of a Bitbucket Server repository.
+type BitbucketServerBranch struct {
+	ID        string `json:"id"`
+	DisplayID string `json:"displayId"`
+}
+
+// bitbucketServerHeaders returns the headers of the Bitbucket Server
+// requests, with one of the credentials in BasicAuth: "user:token" is sent
+// as basic auth, the HTTP access tokens alone as bearer tokens.
+func bitbucketServerHeaders(domain Domain, host string) map[string]string {
+	headers := make(map[string]string)
+
+	authorization := rotateAuthorization(domain.BasicAuth, host, time.Now())
+	if strings.HasPrefix(authorization, "token ") {
+		authorization = "Bearer " + strings.TrimPrefix(authorization, "token ")
+	}
+	if authorization != "" {
+		headers["Authorization"] = authorization
+	}
+
+	return headers
+}
+
+// RegisterBitbucketServerAPI register the crawler function for Bitbucket Server API.
+// It adds the repositories of the project (or user) page at "link".
+// If a next page is available return its url.
+// Otherwise returns an empty ("") string.
+func RegisterBitbucketServerAPI() OrganizationHandler {
+	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, string, error) {
+		// Parse url.
+		u, err := url.Parse(link)
+		if err != nil {
+			return link, "", err
+		}
+		// Set domain host to new host.
+		domain.Host = u.Hostname()
+
+		headers := bitbucketServerHeaders(domain, u.Hostname())
+
+		resp, err := getURL(requestAPI, link, headers)
+		if err != nil {
+			return link, "", err
+		}
+		if resp.Status.Code != http.StatusOK {
+			log.Warnf("Request returned: %s", string(resp.Body))
+			return "", "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+		}
+
+		var repos BitbucketServerRepos
+		err = json.Unmarshal(resp.Body, &repos)
+		if err != nil {
+			return link, "", err
+		}
+
+		for _, v := range repos.Values {
+			err = addBitbucketServerRepository(v, "", domain, pa, headers, repositories)
+			if err != nil {
+				log.Warnf("Skipping %s/%s: %v", v.Project.Key, v.Slug, err)
+			}
+		}
+
+		return bitbucketServerNextPage(u, repos), "", nil
+	}
+}
+
+// bitbucketServerNextPage returns the url of the page after repos, listed at
+// u, or "" if it's the last one.
+func bitbucketServerNextPage(u *url.URL, repos BitbucketServerRepos) string {
+	if repos.IsLastPage || repos.NextPageStart <= repos.Start {
+		return ""
+	}
+
+	next := *u
+	query := next.Query()
+	query.Set("start", strconv.Itoa(repos.NextPageStart))
+	next.RawQuery = query.Encode()
+
+	return next.String()
+}
+
+// RegisterSingleBitbucketServerAPI register the crawler function for single repository Bitbucket Server API.
+// Return nil if the repository was successfully added to repositories channel.
+// Otherwise return the generated error.
+func RegisterSingleBitbucketServerAPI() SingleRepoHandler {
+	return func(domain Domain, link string, repositories chan Repository, pa PA) error {
+		// Parse url.
+		u, err := url.Parse(link)
+		if err != nil {
+			return err
+		}
+		subpath := splitSubpath(u)
+
+		// Set domain host to new host.
+		domain.Host = u.Hostname()
+
+		headers := bitbucketServerHeaders(domain, u.Hostname())
+
+		// IN: https://bitbucket.example.org/projects/KEY/repos/repo
+		// OUT: https://bitbucket.example.org/rest/api/1.0/projects/KEY/repos/repo
+		contextPath, owner, slug, err := splitBitbucketServerPath(u.Path)
+		if err != nil || slug == "" {
+			return fmt.Errorf("not a Bitbucket Server repository url: %s", link)
+		}
+		u.Path = path.Join("/", contextPath, bitbucketServerAPIPath, owner, "repos", slug)
+		u.RawQuery = ""
+
+		// Get single Repo.
+		resp, err := getURL(requestAPI, u.String(), headers)
+		if err != nil {
+			return err
+		}
+		if resp.Status.Code != http.StatusOK {
+			log.Warnf("Request returned: %s", string(resp.Body))
+			return errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+		}
+
+		var v BitbucketServerRepo
+		err = json.Unmarshal(resp.Body, &v)
+		if err != nil {
+			return err
+		}
+
+		return addBitbucketServerRepository(v, subpath, domain, pa, headers, repositories)
+	}
+}
+
+// addBitbucketServerRepository adds the repository v to the repositories
+// channel, on its default branch.
+// subpath is the directory of the software, empty for the root of the repository.
+func addBitbucketServerRepository(v BitbucketServerRepo, subpath string, domain Domain, pa PA, headers map[string]string, repositories chan Repository) error {
+	if !(v.Public || v.Project.Public) || skipArchivedListed(v.Archived) {
+		return fmt.Errorf("%w: private or archived", errRepositorySkipped)
+	}
+	if len(v.Links.Self) == 0 {
+		return errors.New("repository has no web url")
+	}
+	webURL := v.Links.Self[0].Href
+
+	branch, err := bitbucketServerDefaultBranch(webURL, headers)
+	if err != nil {
+		return err
+	}
+
+	fileRawURL, err := generateBitbucketServerRawURL(webURL, branch, subpath, domain.crawledFilename())
+	if err != nil {
+		return err
+	}
+
+	// Marshal all the repository metadata.
+	metadata, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("bitbucket server metadata: %v", err)
+		return err
+	}
+
+	repositories <- Repository{
+		Name:        v.Project.Key + "/" + v.Slug,
+		Hostname:    domain.Host,
+		FileRawURL:  fileRawURL,
+		GitCloneURL: bitbucketServerCloneURL(v),
+		WebURL:      strings.TrimSuffix(webURL, "/browse"),
+		GitBranch:   branch,
+		Domain:      domain,
+		Pa:          pa,
+		Headers:     headers,
+		Metadata:    metadata,
+		Subpath:     subpath,
+		Archived:    v.Archived,
+		Fork:        v.Origin != nil,
+	}
+
+	return nil
+}
+
+// bitbucketServerCloneURL returns the http clone url of v, empty if it
+// can't be cloned over http.
+func bitbucketServerCloneURL(v BitbucketServerRepo) string {
+	for _, clone := range v.Links.Clone {
+		if clone.Name == "http" || clone.Name == "https" {
+			return clone.Href
+		}
+	}
+
+	return ""
+}
+
+// bitbucketServerDefaultBranch returns the name of the default branch of
+// the repository at webURL.
+func bitbucketServerDefaultBranch(webURL string, headers map[string]string) (string, error) {
+	u, err := url.Parse(webURL)
+	if err != nil {
+		return "", err
+	}
+	contextPath, owner, slug, err := splitBitbucketServerPath(strings.TrimSuffix(u.Path, "/browse"))
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join("/", contextPath, bitbucketServerAPIPath, owner, "repos", slug, "branches/default")
+	u.RawQuery = ""
+
+	resp, err := getURL(requestAPI, u.String(), headers)
+	if err != nil {
+		return "", err
+	}
+	// If the repository was never used, there's no branch.
+	if resp.Status.Code == http.StatusNoContent || resp.Status.Code == http.StatusNotFound {
+		return "", fmt.Errorf("%w: empty", errRepositorySkipped)
+	}
+	if resp.Status.Code != http.StatusOK {
+		return "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+	}
+
+	var branch BitbucketServerBranch
+	err = json.Unmarshal(resp.Body, &branch)
+	if err != nil {
+		return "", err
+	}
+	if branch.DisplayID == "" {
+		return "", fmt.Errorf("%w: empty", errRepositorySkipped)
+	}
+
+	return branch.DisplayID, nil
+}
+
+// generateBitbucketServerRawURL returns the Bitbucket Server specific file
+// raw url, from the web url of the repository.
+// IN: https://bitbucket.example.org/projects/KEY/repos/repo/browse
+// OUT: https://bitbucket.example.org/projects/KEY/repos/repo/raw/publiccode.yml?at=refs%2Fheads%2Fmaster
+func generateBitbucketServerRawURL(webURL, branch, subpath, filename string) (string, error) {
+	u, err := url.Parse(webURL)
+	if err != nil {
+		return "", err
+	}
+
+	contextPath, owner, slug, err := splitBitbucketServerPath(strings.TrimSuffix(u.Path, "/browse"))
+	if err != nil || slug == "" {
+		return "", fmt.Errorf("not a Bitbucket Server repository url: %s", webURL)
+	}
+	u.Path = path.Join("/", contextPath, owner, "repos", slug, "raw", subpath, filename)
+	u.RawQuery = url.Values{"at": []string{"refs/heads/" + branch}}.Encode()
+
+	return u.String(), nil
+}
+
+// splitBitbucketServerPath splits the path of a Bitbucket Server web url of a
+// project, user or repository in the context path of the instance,
+// the owner ("projects/KEY" or "users/name") and the repository slug, empty
+// for the projects and users.
+func splitBitbucketServerPath(p string) (contextPath, owner, slug string, err error) {
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(p, "/"), ".git"), "/")
+
+	for i := len(parts) - 2; i >= 0; i-- {
+		if parts[i] != "projects" && parts[i] != "users" {
+			continue
+		}
+		rest := parts[i+2:]
+		if len(rest) != 0 && (len(rest) != 2 || rest[0] != "repos") {
+			continue
+		}
+
+		contextPath = strings.Join(parts[:i], "/")
+		owner = parts[i] + "/" + parts[i+1]
+		if len(rest) == 2 {
+			slug = rest[1]
+		}
+		return contextPath, owner, slug, nil
+	}
+
+	return "", "", "", fmt.Errorf("not a Bitbucket Server project or repository path: %s", p)
+}
+
+// GenerateBitbucketServerAPIURL returns the api url of given Bitbucket Server
+// project or user link.
+// IN: https://bitbucket.example.org/projects/KEY
+// OUT:https://bitbucket.example.org/rest/api/1.0/projects/KEY/repos?limit=100&start=0
+func GenerateBitbucketServerAPIURL() GeneratorAPIURL {
+	return func(in string) (out []string, err error) {
+		u, err := url.Parse(in)
+		if err != nil {
+			return []string{in}, err
+		}
+
+		contextPath, owner, slug, err := splitBitbucketServerPath(u.Path)
+		if err != nil || slug != "" {
+			return []string{in}, fmt.Errorf("not a Bitbucket Server project or user url: %s", in)
+		}
+		u.Path = path.Join("/", contextPath, bitbucketServerAPIPath, owner, "repos")
+		u.RawQuery = url.Values{
+			"limit": []string{strconv.Itoa(bitbucketServerPageSize)},
+			"start": []string{"0"},
+		}.Encode()
+
+		return []string{u.String()}, nil
+	}
+}
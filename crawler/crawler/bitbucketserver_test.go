@@ -0,0 +1,108 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateBitbucketServerAPIURL(t *testing.T) {
+	out, err := GenerateBitbucketServerAPIURL()("https://bitbucket.example.org/projects/COMUNE")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://bitbucket.example.org/rest/api/1.0/projects/COMUNE/repos?limit=100&start=0"}, out)
+
+	out, err = GenerateBitbucketServerAPIURL()("https://example.org/bitbucket/users/mario")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://example.org/bitbucket/rest/api/1.0/users/mario/repos?limit=100&start=0"}, out)
+
+	_, err = GenerateBitbucketServerAPIURL()("https://bitbucket.example.org/projects/COMUNE/repos/protocollo")
+	assert.Error(t, err)
+
+	assert.Equal(t, "bitbucket-server", Domain{Host: "bitbucket.example.org", Type: "bitbucket-server"}.API())
+}
+
+func TestGenerateBitbucketServerRawURL(t *testing.T) {
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	rawURL, err := generateBitbucketServerRawURL("https://example.org/bitbucket/projects/COMUNE/repos/protocollo/browse", "main", "apps/web", "publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.org/bitbucket/projects/COMUNE/repos/protocollo/raw/apps/web/publiccode.yml?at=refs%2Fheads%2Fmain", rawURL)
+
+	_, err = generateBitbucketServerRawURL("https://bitbucket.example.org/projects/COMUNE", "main", "", "publiccode.yml")
+	assert.Error(t, err)
+}
+
+func TestBitbucketServerAPI(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	var authorization string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		repo := func(slug string, public bool) string {
+			return fmt.Sprintf(`{"slug": "%s", "public": %t, "project": {"key": "COMUNE"},
+				"links": {"clone": [{"name": "ssh", "href": "ssh://git@example.org/comune/%s.git"},
+				{"name": "http", "href": "%s/scm/comune/%s.git"}],
+				"self": [{"href": "%s/projects/COMUNE/repos/%s/browse"}]}}`, slug, public, slug, ts.URL, slug, ts.URL, slug)
+		}
+
+		switch r.URL.Path {
+		case "/rest/api/1.0/projects/COMUNE/repos":
+			if r.URL.Query().Get("start") == "0" {
+				fmt.Fprintf(w, `{"start": 0, "isLastPage": false, "nextPageStart": 2, "values": [%s, %s]}`,
+					repo("protocollo", true), repo("interno", false))
+				return
+			}
+			fmt.Fprintf(w, `{"start": 2, "isLastPage": true, "values": [%s, %s]}`, repo("tributi", true), repo("vuoto", true))
+		case "/rest/api/1.0/projects/COMUNE/repos/protocollo":
+			fmt.Fprint(w, repo("protocollo", true))
+		case "/rest/api/1.0/projects/COMUNE/repos/protocollo/branches/default",
+			"/rest/api/1.0/projects/COMUNE/repos/tributi/branches/default":
+			fmt.Fprint(w, `{"id": "refs/heads/main", "displayId": "main"}`)
+		case "/rest/api/1.0/projects/COMUNE/repos/vuoto/branches/default":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	domain := Domain{Host: "bitbucket.example.org", Type: "bitbucket-server", BasicAuth: []string{"TOKEN"}}
+	repositories := make(chan Repository, 10)
+
+	next, _, err := RegisterBitbucketServerAPI()(domain, ts.URL+"/rest/api/1.0/projects/COMUNE/repos?limit=100&start=0", repositories, PA{})
+	assert.NoError(t, err)
+	assert.Equal(t, ts.URL+"/rest/api/1.0/projects/COMUNE/repos?limit=100&start=2", next)
+	assert.Equal(t, "Bearer TOKEN", authorization)
+
+	next, _, err = RegisterBitbucketServerAPI()(domain, next, repositories, PA{})
+	assert.NoError(t, err)
+	assert.Empty(t, next)
+
+	err = RegisterSingleBitbucketServerAPI()(domain, ts.URL+"/projects/COMUNE/repos/protocollo#apps/web", repositories, PA{})
+	assert.NoError(t, err)
+	close(repositories)
+
+	var repos []Repository
+	for repo := range repositories {
+		repos = append(repos, repo)
+	}
+	assert.Len(t, repos, 3)
+	assert.Equal(t, "COMUNE/protocollo", repos[0].Name)
+	assert.Equal(t, ts.URL+"/scm/comune/protocollo.git", repos[0].GitCloneURL)
+	assert.Equal(t, ts.URL+"/projects/COMUNE/repos/protocollo", repos[0].WebURL)
+	assert.Equal(t, "main", repos[0].GitBranch)
+	assert.Equal(t, ts.URL+"/projects/COMUNE/repos/protocollo/raw/publiccode.yml?at=refs%2Fheads%2Fmain", repos[0].FileRawURL)
+	assert.Equal(t, "COMUNE/tributi", repos[1].Name)
+	assert.Equal(t, "apps/web", repos[2].Subpath)
+	assert.Equal(t, ts.URL+"/projects/COMUNE/repos/protocollo/raw/apps/web/publiccode.yml?at=refs%2Fheads%2Fmain", repos[2].FileRawURL)
+}
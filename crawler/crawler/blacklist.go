@@ -1,10 +1,14 @@
 package crawler
 
 import (
+	"crypto/sha1"
 	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -25,14 +29,7 @@ type Repo struct {
 
 // GetAllBlackListedRepos return all blacklisted repositories
 func GetAllBlackListedRepos() map[string]string {
-	files := viper.GetString("BLACKLIST_FOLDER")
-	pattern := viper.GetString("BLACKLIST_PATTERN")
-	if files == "" || pattern == "" {
-		log.Warn("BLACKLIST_* vars are not defined in config.toml, please define both")
-		return nil
-	}
-
-	readBlacklist, err := scanBlacklists(files, pattern)
+	readBlacklist, err := readBlacklists()
 	if err != nil {
 		log.Errorf("path not exists or you don't have permission: %s", err)
 		return nil
@@ -44,22 +41,57 @@ func GetAllBlackListedRepos() map[string]string {
 	return repoListed
 }
 
-// IsRepoInBlackList checks whether a repo is in blacklist
-func IsRepoInBlackList(repoURL string) bool {
-	files := viper.GetString("BLACKLIST_FOLDER")
-	pattern := viper.GetString("BLACKLIST_PATTERN")
-	if files == "" || pattern == "" {
-		log.Warn("BLACKLIST_* var are not defined in config.toml, please define both")
+// isHostAllowlisted returns whether the host of repoURL is in
+// BLACKLIST_ALLOWED_HOSTS, whose repositories are never blacklisted.
+func isHostAllowlisted(repoURL string) bool {
+	u, err := url.Parse(repoURL)
+	if err != nil {
 		return false
 	}
 
-	readBlacklist, err := scanBlacklists(files, pattern)
+	for _, host := range viper.GetStringSlice("BLACKLIST_ALLOWED_HOSTS") {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsRepoInBlackList checks whether a repo is in blacklist.
+// It reads the blacklists on each call: use ReadBlacklistedRepos to check
+// more repositories.
+func IsRepoInBlackList(repoURL string) bool {
+	blacklisted, err := ReadBlacklistedRepos()
 	if err != nil {
 		log.Errorf("path not exists or you don't have permission: %s", err)
 		return false
 	}
-	for _, repo := range readBlacklist {
+
+	return blacklisted.Contains(repoURL)
+}
+
+// BlacklistedRepos are the repositories in the blacklists, read once by
+// ReadBlacklistedRepos for all the repositories of a crawl.
+type BlacklistedRepos []Repo
+
+// ReadBlacklistedRepos reads the blacklists in BLACKLIST_FOLDER and at the
+// BLACKLIST_URLS.
+func ReadBlacklistedRepos() (BlacklistedRepos, error) {
+	repos, err := readBlacklists()
+
+	return BlacklistedRepos(repos), err
+}
+
+// Contains checks whether repoURL is blacklisted, unless its host is in
+// BLACKLIST_ALLOWED_HOSTS.
+func (b BlacklistedRepos) Contains(repoURL string) bool {
+	for _, repo := range b {
 		if repo.URL == repoURL {
+			if isHostAllowlisted(repoURL) {
+				log.Warnf("%s is blacklisted but its host is in BLACKLIST_ALLOWED_HOSTS, processing it", repoURL)
+				return false
+			}
 			log.Warnf("PA found in blacklist with reason: "+
 				"%s and description: %s, skipping...", repo.Reason, repo.Description)
 			return true
@@ -94,6 +126,76 @@ func ReadAndParseBlacklist(blacklistFile string) ([]Repo, error) {
 	return blacklist.Repos, err
 }
 
+// readBlacklists returns the repositories in the blacklists in
+// BLACKLIST_FOLDER and at the BLACKLIST_URLS.
+func readBlacklists() ([]Repo, error) {
+	files := viper.GetString("BLACKLIST_FOLDER")
+	pattern := viper.GetString("BLACKLIST_PATTERN")
+	urls := viper.GetStringSlice("BLACKLIST_URLS")
+	if files == "" || pattern == "" {
+		if len(urls) == 0 {
+			log.Warn("BLACKLIST_* vars are not defined in config.toml, please define both")
+		}
+		return readRemoteBlacklists(urls), nil
+	}
+
+	repos, err := scanBlacklists(files, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(repos, readRemoteBlacklists(urls)...), nil
+}
+
+// readRemoteBlacklists downloads and parses the blacklists at urls.
+func readRemoteBlacklists(urls []string) []Repo {
+	var repos []Repo
+	for _, link := range urls {
+		blacklist, err := downloadBlacklist(link)
+		if err != nil {
+			log.Errorf("cannot read the blacklist at %s: %v", link, err)
+			continue
+		}
+		repos = append(repos, blacklist.Repos...)
+	}
+
+	return repos
+}
+
+// downloadBlacklist downloads and parses the blacklist at link, saving a
+// copy in the data directory. If the download fails, or the blacklist is
+// not valid, the last copy saved is used instead.
+func downloadBlacklist(link string) (Blacklist, error) {
+	cache := blacklistCachePath(link)
+
+	resp, err := getURL(requestRawFile, link, nil)
+	if err == nil {
+		var blacklist Blacklist
+		if blacklist, err = parseBlacklistFile(resp.Body); err == nil {
+			log.Infof("Loaded and parsed %s", link)
+			if err := os.MkdirAll(filepath.Dir(cache), 0744); err != nil {
+				log.Warnf("cannot save a copy of the blacklist at %s: %v", link, err)
+			} else if err := ioutil.WriteFile(cache, resp.Body, 0644); err != nil {
+				log.Warnf("cannot save a copy of the blacklist at %s: %v", link, err)
+			}
+			return blacklist, nil
+		}
+	}
+
+	data, cacheErr := ioutil.ReadFile(cache)
+	if cacheErr != nil {
+		return Blacklist{}, fmt.Errorf("%v, and there's no copy saved: %v", err, cacheErr)
+	}
+	log.Warnf("cannot read the blacklist at %s (%v), using the copy of the last crawl", link, err)
+
+	return parseBlacklistFile(data)
+}
+
+// blacklistCachePath returns the path of the copy of the blacklist at link.
+func blacklistCachePath(link string) string {
+	return filepath.Join(viper.GetString("CRAWLER_DATADIR"), "blacklists", fmt.Sprintf("%x.yml", sha1.Sum([]byte(link))))
+}
+
 func scanBlacklists(dir string, pattern string) ([]Repo, error) {
 	files, err := WalkMatch(dir, pattern)
 	if err != nil {
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fallbackBranches are the branches tried, in order, when the API of the
+// code hosting can't tell the default branch of a repository.
+var fallbackBranches = []string{"main", "master"}
+
+// fallbackRawURL returns the raw url of the crawled file, named filename, on
+// branch of the repository at link, for the api of the code hosting.
+func fallbackRawURL(api string, link *url.URL, branch, subpath, filename string) (string, error) {
+	repo := strings.TrimSuffix(strings.Trim(link.Path, "/"), ".git")
+
+	switch api {
+	case "github":
+		u := url.URL{Scheme: "https", Host: "raw.githubusercontent.com"}
+		u.Path = path.Join("/", repo, branch, subpath, filename)
+		return u.String(), nil
+	case "gitlab":
+		return generateGitlabRawURL(link.Scheme+"://"+link.Host+"/"+repo, branch, subpath, filename)
+	case "bitbucket":
+		u := url.URL{Scheme: link.Scheme, Host: link.Host}
+		u.Path = path.Join("/", repo, "raw", branch, subpath, filename)
+		return u.String(), nil
+	case "gitea":
+		return generateGiteaRawURL(link.Scheme+"://"+link.Host+"/"+repo, branch, subpath, filename)
+	case "azure":
+		return generateAzureRawURL(link.Scheme+"://"+link.Host+"/"+repo, branch, subpath, filename)
+	case "bitbucket-server":
+		return generateBitbucketServerRawURL(link.Scheme+"://"+link.Host+"/"+repo, branch, subpath, filename)
+	default:
+		return "", fmt.Errorf("no raw file url for the %s API", api)
+	}
+}
+
+// fallbackRepository adds the repository at link to repositories, looking
+// for the crawled file on the fallbackBranches. It's used when the API
+// lookup of the repository fails.
+func (domain Domain) fallbackRepository(link string, repositories chan Repository, pa PA) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	subpath := splitSubpath(u)
+	name := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+
+	domain.Host = u.Hostname()
+
+	for _, branch := range fallbackBranches {
+		rawURL, err := fallbackRawURL(domain.API(), u, branch, subpath, domain.crawledFilename())
+		if err != nil {
+			return err
+		}
+
+		resp, err := getURL(requestRawFile, rawURL, nil)
+		if err != nil || resp.Status.Code != http.StatusOK {
+			log.Debugf("%s not found on branch %s", domain.crawledFilename(), branch)
+			continue
+		}
+
+		log.WithField(logFieldRepository, name).Infof("Using the %s branch, the default branch is unknown", branch)
+		repositories <- Repository{
+			Name:        name,
+			Hostname:    u.Hostname(),
+			FileRawURL:  rawURL,
+			GitCloneURL: u.Scheme + "://" + u.Host + "/" + name + ".git",
+			GitBranch:   branch,
+			Domain:      domain,
+			Pa:          pa,
+			Metadata:    []byte("{}"),
+			Subpath:     subpath,
+		}
+
+		return nil
+	}
+
+	return errors.New("no " + domain.crawledFilename() + " on the " + strings.Join(fallbackBranches, " or ") + " branch")
+}
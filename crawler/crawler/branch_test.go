@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackRawURL(t *testing.T) {
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	tests := map[string]string{
+		"github":    "https://raw.githubusercontent.com/italia/example/main/apps/app/publiccode.yml",
+		"gitlab":    "https://example.org/italia/example/raw/main/apps/app/publiccode.yml",
+		"bitbucket": "https://example.org/italia/example/raw/main/apps/app/publiccode.yml",
+		"gitea":     "https://example.org/italia/example/raw/branch/main/apps/app/publiccode.yml",
+	}
+	for api, expected := range tests {
+		u, _ := url.Parse("https://example.org/italia/example.git")
+		rawURL, err := fallbackRawURL(api, u, "main", "apps/app", "publiccode.yml")
+		assert.NoError(t, err, api)
+		assert.Equal(t, expected, rawURL, api)
+	}
+
+	u, _ := url.Parse("https://example.org/projects/ITALIA/repos/example")
+	rawURL, err := fallbackRawURL("bitbucket-server", u, "main", "apps/app", "publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.org/projects/ITALIA/repos/example/raw/apps/app/publiccode.yml?at=refs%2Fheads%2Fmain", rawURL)
+
+	_, err = fallbackRawURL("unknown", &url.URL{}, "main", "", "publiccode.yml")
+	assert.Error(t, err)
+}
+
+func TestFallbackRepository(t *testing.T) {
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	// Only the master branch has the file.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/italia/example/raw/branch/master/publiccode.yml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("publiccodeYmlVersion: \"0.2\"\n"))
+	}))
+	defer ts.Close()
+
+	domain := Domain{Host: "gitea.example.org", Type: "gitea"}
+	repositories := make(chan Repository, 1)
+	assert.NoError(t, domain.fallbackRepository(ts.URL+"/italia/example", repositories, PA{}))
+
+	repository := <-repositories
+	assert.Equal(t, "italia/example", repository.Name)
+	assert.Equal(t, "master", repository.GitBranch)
+	assert.Equal(t, ts.URL+"/italia/example/raw/branch/master/publiccode.yml", repository.FileRawURL)
+	assert.Equal(t, ts.URL+"/italia/example.git", repository.GitCloneURL)
+
+	assert.Error(t, domain.fallbackRepository(ts.URL+"/italia/missing", repositories, PA{}))
+}
+
+func TestProcessSingleRepoFallback(t *testing.T) {
+	RegisterClientAPIs()
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	// The API fails for italia/broken and rejects italia/private, both
+	// with the file on the master branch.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/italia/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/api/v1/repos/italia/private":
+			_, _ = w.Write([]byte(`{"full_name": "italia/private", "private": true, "default_branch": "master"}`))
+		case "/italia/broken/raw/branch/master/publiccode.yml", "/italia/private/raw/branch/master/publiccode.yml":
+			_, _ = w.Write([]byte("publiccodeYmlVersion: \"0.2\"\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	domain := Domain{Host: "gitea.example.org", Type: "gitea"}
+	repositories := make(chan Repository, 1)
+
+	assert.NoError(t, domain.processSingleRepo(ts.URL+"/italia/broken", repositories, PA{}))
+	assert.Equal(t, "master", (<-repositories).GitBranch)
+
+	// Skipped on purpose, not looked up on the branches.
+	err := domain.processSingleRepo(ts.URL+"/italia/private", repositories, PA{})
+	assert.True(t, errors.Is(err, errRepositorySkipped), err)
+	assert.Empty(t, repositories)
+}
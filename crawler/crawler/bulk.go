@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"sync"
+
+	"github.com/italia/developers-italia-backend/crawler/elastic"
+	"github.com/italia/developers-italia-backend/crawler/metrics"
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+)
+
+// Documents per bulk request of the crawl and concurrent requests, capped by
+// ELASTIC_BULK_ACTIONS and ELASTIC_BULK_MAX_WORKERS.
+const (
+	crawlBulkActions = 500
+	crawlBulkWorkers = 2
+)
+
+// crawlBulk sends the documents of the crawl to Elasticsearch in bulk
+// requests, flushed as they fill up during the crawl.
+type crawlBulk struct {
+	mutex     sync.Mutex
+	processor *es.BulkProcessor
+
+	// The software sent and not indexed yet, by ID.
+	pending map[string]Repository
+}
+
+// addToBulk queues the index request of a document, the software of
+// repository if not nil. The outcome is counted once its bulk request is sent.
+func (c *Crawler) addToBulk(request *es.BulkIndexRequest, id string, repository *Repository) error {
+	c.bulk.mutex.Lock()
+	if c.bulk.processor == nil {
+		processor, err := elastic.NewBulkProcessor("crawl", crawlBulkActions, crawlBulkWorkers, c.afterBulk, c.es)
+		if err != nil {
+			c.bulk.mutex.Unlock()
+			return err
+		}
+		c.bulk.processor = processor
+		c.bulk.pending = make(map[string]Repository)
+	}
+	if repository != nil {
+		c.bulk.pending[id] = *repository
+	}
+	processor := c.bulk.processor
+	// Add waits for a worker, which takes the mutex in afterBulk.
+	c.bulk.mutex.Unlock()
+
+	processor.Add(request)
+
+	return nil
+}
+
+// closeBulk sends the documents left and waits for the bulk requests to
+// complete.
+func (c *Crawler) closeBulk() error {
+	c.bulk.mutex.Lock()
+	processor := c.bulk.processor
+	c.bulk.processor = nil
+	c.bulk.mutex.Unlock()
+
+	if processor == nil {
+		return nil
+	}
+
+	return processor.Close()
+}
+
+// afterBulk counts the documents indexed and the ones failed in a bulk
+// request, and notifies the new software.
+func (c *Crawler) afterBulk(_ int64, requests []es.BulkableRequest, response *es.BulkResponse, err error) {
+	// The processor already retried the whole request.
+	if err != nil {
+		log.Errorf("Bulk indexing of %d documents failed: %v", len(requests), err)
+		for range requests {
+			c.summary.addIndexFailure(retryableElasticError(err))
+		}
+		return
+	}
+
+	for _, items := range response.Items {
+		for _, item := range items {
+			c.bulk.mutex.Lock()
+			repository, software := c.bulk.pending[item.Id]
+			software = software && item.Index == c.index
+			if software {
+				delete(c.bulk.pending, item.Id)
+			}
+			c.bulk.mutex.Unlock()
+
+			if item.Error != nil {
+				log.Errorf("Error indexing %s/%s: %s", item.Index, item.Id, item.Error.Reason)
+				c.summary.addIndexFailure(retryableElasticError(&es.Error{Status: item.Status, Details: item.Error}))
+				continue
+			}
+			if !software {
+				continue
+			}
+
+			metrics.GetCounter("repository_file_indexed", c.index).Inc()
+			c.summary.addIndexed()
+
+			// The preview index starts empty, everything would be new.
+			if item.Result == "created" && !c.preview {
+				c.webhook.notify(repository)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	es "github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlBulk(t *testing.T) {
+	// Answers each document of the bulk requests, rejecting the "bad" one.
+	var mutex sync.Mutex
+	bulkRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			http.NotFound(w, r)
+			return
+		}
+		mutex.Lock()
+		bulkRequests++
+		mutex.Unlock()
+
+		var items []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action struct {
+				Index *struct {
+					Index string `json:"_index"`
+					ID    string `json:"_id"`
+				} `json:"index"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &action) != nil || action.Index == nil {
+				continue
+			}
+			item := fmt.Sprintf(`"_index": %q, "_id": %q, "result": "created", "status": 201`, action.Index.Index, action.Index.ID)
+			if action.Index.ID == "bad" {
+				item = fmt.Sprintf(`"_index": %q, "_id": "bad", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}`, action.Index.Index)
+			}
+			items = append(items, `{"index": {`+item+`}}`)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"took": 1, "errors": true, "items": [%s]}`, strings.Join(items, ","))
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crawler{es: client, index: "publiccode"}
+
+	// Nothing was queued, there is nothing to send.
+	assert.NoError(t, c.closeBulk())
+	assert.Equal(t, 0, bulkRequests)
+
+	software := func(id string) *es.BulkIndexRequest {
+		return es.NewBulkIndexRequest().Index("publiccode").Type("software").Id(id).Doc(map[string]string{"id": id})
+	}
+	assert.NoError(t, c.addToBulk(software("new"), "new", &Repository{Name: "new"}))
+	assert.NoError(t, c.addToBulk(software("bad"), "bad", &Repository{Name: "bad"}))
+	administration := es.NewBulkIndexRequest().Index("administrations").Type("administration").Id("pcm").Doc(administration{CodiceIPA: "pcm"})
+	assert.NoError(t, c.addToBulk(administration, "pcm", nil))
+
+	// The documents are counted once sent.
+	assert.NoError(t, c.closeBulk())
+	assert.NotZero(t, bulkRequests)
+	assert.Equal(t, 1, c.summary.indexed)
+	assert.Equal(t, 1, c.summary.indexRejected)
+	assert.Equal(t, 0, c.summary.indexFailed)
+	assert.Empty(t, c.bulk.pending)
+}
@@ -0,0 +1,185 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// checkpointInterval is how often the checkpoint is written during a crawl.
+var checkpointInterval = time.Minute
+
+// checkpoint records the repositories fully processed by a crawl and is
+// written periodically, so that a crawl dying midway can be resumed skipping
+// them.
+type checkpoint struct {
+	mutex sync.Mutex
+	// Serializes the writes of the file.
+	writeMutex sync.Mutex
+
+	path      string
+	startTime time.Time
+	done      map[string]bool
+	// Whether it was read from a previous crawl.
+	resumed bool
+}
+
+// checkpointData is the checkpoint as written to the file.
+type checkpointData struct {
+	StartTime string   `json:"startTime"`
+	Done      []string `json:"done"`
+}
+
+// checkpointFile returns the path of the checkpoint of the crawls.
+func checkpointFile() string {
+	return filepath.Join(viper.GetString("CRAWLER_DATADIR"), "checkpoint.json")
+}
+
+// newCheckpoint returns an empty checkpoint of a crawl started at startTime,
+// written to path.
+func newCheckpoint(path string, startTime time.Time) *checkpoint {
+	return &checkpoint{path: path, startTime: startTime, done: make(map[string]bool)}
+}
+
+// readCheckpoint returns the checkpoint written to path by a previous crawl,
+// nil if there's none.
+func readCheckpoint(path string) (*checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved checkpointData
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+
+	startTime, err := time.Parse(time.RFC3339, saved.StartTime)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := newCheckpoint(path, startTime)
+	cp.resumed = true
+	for _, key := range saved.Done {
+		cp.done[key] = true
+	}
+
+	return cp, nil
+}
+
+// completed returns whether repository was already fully processed.
+func (cp *checkpoint) completed(repository Repository) bool {
+	if cp == nil {
+		return false
+	}
+
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	return cp.done[repositoryKey(repository)]
+}
+
+// markDone records repository as fully processed.
+func (cp *checkpoint) markDone(repository Repository) {
+	if cp == nil {
+		return
+	}
+
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	cp.done[repositoryKey(repository)] = true
+}
+
+// write atomically replaces the file with the checkpoint, so a crash while
+// writing leaves the previous one.
+func (cp *checkpoint) write() error {
+	cp.mutex.Lock()
+	saved := checkpointData{
+		StartTime: cp.startTime.UTC().Format(time.RFC3339),
+		Done:      make([]string, 0, len(cp.done)),
+	}
+	for key := range cp.done {
+		saved.Done = append(saved.Done, key)
+	}
+	cp.mutex.Unlock()
+	sort.Strings(saved.Done)
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	cp.writeMutex.Lock()
+	defer cp.writeMutex.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(cp.path), ".checkpoint-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), cp.path)
+}
+
+// writePeriodically writes the checkpoint every checkpointInterval until
+// ctx is done.
+func (cp *checkpoint) writePeriodically(ctx context.Context) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := cp.write(); err != nil {
+				log.Errorf("Error writing the crawl checkpoint: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Resume makes the crawl skip the repositories fully processed by the
+// previous crawl, if it didn't complete. Their documents are left in the
+// index as they are.
+func (c *Crawler) Resume() error {
+	cp, err := readCheckpoint(checkpointFile())
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		log.Info("No crawl to resume, starting from scratch")
+		return nil
+	}
+
+	log.Infof("Resuming the crawl started at %s, skipping %d repositories already processed",
+		cp.startTime.Format(time.RFC3339), len(cp.done))
+	c.checkpoint = cp
+
+	return nil
+}
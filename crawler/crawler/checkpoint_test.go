@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint.json")
+	startTime := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	cp := newCheckpoint(path, startTime)
+
+	// Marked by the workers while being written.
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			cp.markDone(Repository{GitCloneURL: "https://github.com/italia/" + name + ".git"})
+			assert.NoError(t, cp.write())
+		}(name)
+	}
+	wg.Wait()
+	assert.NoError(t, cp.write())
+
+	resumed, err := readCheckpoint(path)
+	assert.NoError(t, err)
+	assert.True(t, resumed.resumed)
+	assert.Equal(t, startTime, resumed.startTime)
+	assert.True(t, resumed.completed(Repository{GitCloneURL: "https://github.com/italia/b"}))
+	assert.False(t, resumed.completed(Repository{GitCloneURL: "https://github.com/italia/d"}))
+
+	// No temporary files left.
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// Nothing is skipped without a checkpoint.
+	var none *checkpoint
+	none.markDone(Repository{GitCloneURL: "https://github.com/italia/a"})
+	assert.False(t, none.completed(Repository{GitCloneURL: "https://github.com/italia/a"}))
+}
+
+func TestResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	defer viper.Set("CRAWLER_DATADIR", nil)
+
+	var c Crawler
+	assert.NoError(t, c.Resume())
+	assert.Nil(t, c.checkpoint)
+
+	err = ioutil.WriteFile(checkpointFile(), []byte(`{"startTime": "2020-03-01T10:00:00Z", "done": ["https://github.com/italia/a#"]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, c.Resume())
+	assert.True(t, c.checkpoint.completed(Repository{GitCloneURL: "https://github.com/italia/a"}))
+}
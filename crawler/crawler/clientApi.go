@@ -13,7 +13,8 @@ type ClientAPI struct {
 }
 
 // OrganizationHandler returns the client handler for an organization/team/group page (every domain has a different handler implementation).
-type OrganizationHandler func(domain Domain, url string, repositories chan Repository, pa PA) (string, error)
+// It returns the urls of the next and, if the host gives it, of the last page.
+type OrganizationHandler func(domain Domain, url string, repositories chan Repository, pa PA) (string, string, error)
 
 // SingleRepoHandler returns the client handler for an a single repository (every domain has a different handler implementation).
 type SingleRepoHandler func(domain Domain, url string, repositories chan Repository, pa PA) error
@@ -46,6 +47,24 @@ func RegisterClientAPIs() {
 		APIURL:       GenerateGitlabAPIURL(),
 	}
 
+	clientAPIs["gitea"] = ClientAPI{
+		Organization: RegisterGiteaAPI(),
+		Single:       RegisterSingleGiteaAPI(),
+		APIURL:       GenerateGiteaAPIURL(),
+	}
+
+	clientAPIs["azure"] = ClientAPI{
+		Organization: RegisterAzureAPI(),
+		Single:       RegisterSingleAzureAPI(),
+		APIURL:       GenerateAzureAPIURL(),
+	}
+
+	clientAPIs["bitbucket-server"] = ClientAPI{
+		Organization: RegisterBitbucketServerAPI(),
+		Single:       RegisterSingleBitbucketServerAPI(),
+		APIURL:       GenerateBitbucketServerAPIURL(),
+	}
+
 }
 
 // GetClientAPICrawler checks if the API client for the requested organization clientAPI exists and return its handler.
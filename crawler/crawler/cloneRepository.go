@@ -1,18 +1,45 @@
 package crawler
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/italia/developers-italia-backend/crawler/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// errCloneTimeout is returned when git doesn't complete within the clone timeout.
+var errCloneTimeout = errors.New("git timed out")
+
+// commandContextInject runs external commands, it can be replaced in tests.
+var commandContextInject = exec.CommandContext
+
+// lookPathInject finds external commands, it can be replaced in tests.
+var lookPathInject = exec.LookPath
+
 // CloneRepository clone the repository into DATADIR/repos/<hostname>/<vendor>/<repo>/gitClone
-func CloneRepository(domain Domain, hostname, name, gitURL, gitBranch, index string) error {
+// The git commands are killed when ctx is done.
+// The failures are counted in repository_clone_failed by class, except the
+// clones interrupted because ctx is done, like in the crawl summary.
+func CloneRepository(ctx context.Context, domain Domain, hostname, name, gitURL, gitBranch, index string) (err error) {
+	defer func(ctx context.Context) {
+		if err != nil && ctx.Err() == nil {
+			metrics.IncCounterVec("repository_clone_failed", index, prometheus.Labels{"class": cloneFailureClass(err)})
+		}
+	}(ctx)
+
 	if domain.Host == "" {
 		return errors.New("cannot save a file without domain host")
 	}
@@ -23,31 +50,398 @@ func CloneRepository(domain Domain, hostname, name, gitURL, gitBranch, index str
 		return errors.New("cannot clone a repository without git URL")
 	}
 
-	vendor, repo := splitFullName(name)
-	path := filepath.Join(viper.GetString("CRAWLER_DATADIR"), "repos", hostname, vendor, repo, "gitClone")
+	path := gitClonePath(hostname, name)
+
+	// The software in the directories of a repository share its clone.
+	unlock := lockClonePath(path)
+	defer unlock()
+
+	// Like the requests, the clones in progress to a host are limited by
+	// MAX_CONCURRENT_PER_HOST.
+	release, err := acquireHost(ctx, hostname)
+	if err != nil {
+		return fmt.Errorf("clone: %w", err)
+	}
+	defer release()
+
+	// The timeout only applies to the git operations.
+	timeout := cloneTimeout(domain)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// With the mirror cache the working tree is cloned from the bare mirror,
+	// sharing its objects, so only the mirror talks to the remote.
+	// Otherwise the clone is shallow if CLONE_DEPTH is set.
+	source := gitURL
+	cloneArgs := append(gitTLSArgs(domain), "clone")
+	shallowArgs := shallowCloneArgs(time.Now())
+	if viper.GetString("MIRROR_CACHE_DIR") != "" {
+		shallowArgs = nil
+		mirror, err := updateMirror(ctx, domain, gitURL, index)
+		if err != nil {
+			return err
+		}
+		source = mirror
+		cloneArgs = append(cloneArgs, "--shared")
+	}
 
 	// If folder already exists it will do a fetch instead of a clone.
 	if _, err := os.Stat(path); !os.IsNotExist(err) {
-		//	Command is: git fetch --all
-		out, err := exec.Command("git", "-C", path, "fetch", "--all").CombinedOutput() // nolint: gas
-		if err != nil {
-			return errors.New(fmt.Sprintf("cannot git pull the repository: %s: %s", err.Error(), out))
+		err := updateClone(ctx, domain, path, gitBranch, shallowArgs, timeout, index)
+		if !errors.Is(err, errCorruptClone) {
+			return err
 		}
-		// Command is: git reset --hard origin/<branch_name>
-		out, err = exec.Command("git", "-C", path, "reset", "--hard", "origin/"+gitBranch).CombinedOutput() // nolint: gas
-		if err != nil {
-			return errors.New(fmt.Sprintf("cannot git pull the repository: %s: %s", err.Error(), out))
+
+		// Start over with a fresh clone.
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("cannot remove the corrupt clone %s: %v", path, err)
 		}
-		return err
 	}
 
 	// Clone the repository using the external command "git".
-	// Command is: git clone -b <branch> <remote_repo>
-	out, err := exec.Command("git", "clone", "-b", gitBranch, gitURL, path).CombinedOutput() // nolint: gas
+	// Command is: git clone [--depth <n> | --shallow-since <date>] -b <branch> <remote_repo>
+	clone := func(shallowArgs []string) ([]byte, error) {
+		args := append(append([]string{}, cloneArgs...), shallowArgs...)
+		return runGit(ctx, append(args, "-b", gitBranch, source, path)...)
+	}
+	out, err := clone(shallowArgs)
+	if depthArgs := shallowFallbackArgs(shallowArgs, out); err != nil && ctx.Err() == nil && depthArgs != nil {
+		log.WithField(logFieldRepository, name).Warn("No commits since the start of ACTIVITY_DAYS, cloning only the last one")
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("cannot remove the partial clone %s: %v", path, err)
+		}
+		out, err = clone(depthArgs)
+	}
+	// Remove the partial clone, otherwise the next run would try to fetch it.
+	if ctx.Err() == context.DeadlineExceeded {
+		metrics.GetCounter("repository_clone_timeout", index).Inc()
+		return removeAbortedClone(path, fmt.Errorf("clone: %w after %v", errCloneTimeout, timeout))
+	}
+	if ctx.Err() != nil {
+		// Interrupted (eg. shutting down).
+		return removeAbortedClone(path, fmt.Errorf("clone: %w", ctx.Err()))
+	}
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot git clone the repository: %s: %s", err.Error(), out))
+		return removeAbortedClone(path, errors.New(fmt.Sprintf("cannot git clone the repository: %s: %s", err.Error(), out)))
 	}
 
-	metrics.GetCounter("repository_cloned", index).Inc()
+	// With the mirror cache the remote was cloned in the mirror.
+	if source == gitURL {
+		metrics.GetCounter("repository_cloned", index).Inc()
+	}
 	return err
 }
+
+// shallowCloneArgs returns the git arguments of a shallow clone from
+// CLONE_DEPTH: the number of commits, or "activity" for the commits since
+// the start of the ACTIVITY_DAYS window at now. They're empty for a full
+// clone, if it's unset or 0.
+func shallowCloneArgs(now time.Time) []string {
+	depth := strings.TrimSpace(viper.GetString("CLONE_DEPTH"))
+	if depth == "" || depth == "0" {
+		return nil
+	}
+	if depth == "activity" {
+		return []string{"--shallow-since=" + now.AddDate(0, 0, -activityDays()).Format("2006-01-02")}
+	}
+
+	n, err := strconv.Atoi(depth)
+	if err != nil || n < 0 {
+		log.Warnf("Invalid CLONE_DEPTH %q, cloning the whole history", depth)
+		return nil
+	}
+
+	return []string{"--depth", strconv.Itoa(n)}
+}
+
+// noShallowCommits matches the output of git failing a --shallow-since clone
+// or fetch because the repository has no commits since that date.
+var noShallowCommits = regexp.MustCompile(`no commits selected for shallow requests|error processing shallow info`)
+
+// shallowFallbackArgs returns the git arguments fetching only the last
+// commit, to use instead of shallowArgs if git failed with out because of
+// --shallow-since on a dormant repository. Otherwise it returns nil.
+func shallowFallbackArgs(shallowArgs []string, out []byte) []string {
+	if len(shallowArgs) == 0 || !strings.HasPrefix(shallowArgs[0], "--shallow-since") || !noShallowCommits.Match(out) {
+		return nil
+	}
+
+	return []string{"--depth", "1"}
+}
+
+// errCorruptClone is returned by updateClone when the existing clone can't
+// be used anymore.
+var errCorruptClone = errors.New("corrupt clone")
+
+// updateClone updates the existing clone in path to the last commit of
+// gitBranch, even if it's not the branch it was cloned from (eg. the default
+// branch was renamed). The branches deleted on the remote are pruned.
+// shallowArgs keep a shallow clone shallow.
+// It returns errCorruptClone if path is not a working git clone.
+func updateClone(ctx context.Context, domain Domain, path, gitBranch string, shallowArgs []string, timeout time.Duration, index string) error {
+	// Command is: git rev-parse --is-inside-work-tree
+	if _, err := runGit(ctx, "-C", path, "rev-parse", "--is-inside-work-tree"); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%w: %v", errCorruptClone, err)
+	}
+
+	steps := []struct {
+		name string
+		args []string
+	}{
+		// Command is: git fetch --all --prune [--depth <n> | --shallow-since <date>]
+		{"fetch", append(append(gitTLSArgs(domain), "-C", path, "fetch", "--all", "--prune"), shallowArgs...)},
+		// Command is: git checkout --force -B <branch_name> origin/<branch_name>
+		{"checkout", []string{"-C", path, "checkout", "--force", "-B", gitBranch, "origin/" + gitBranch}},
+	}
+	for _, step := range steps {
+		out, err := runGit(ctx, step.args...)
+		if depthArgs := shallowFallbackArgs(shallowArgs, out); err != nil && ctx.Err() == nil && step.name == "fetch" && depthArgs != nil {
+			log.Warnf("No commits since the start of ACTIVITY_DAYS in %s, fetching only the last one", path)
+			out, err = runGit(ctx, append(append(gitTLSArgs(domain), "-C", path, "fetch", "--all", "--prune"), depthArgs...)...)
+		}
+		// A fetch or checkout killed midway can leave the clone locked or
+		// half updated. A clone too slow to update is cloned again by the
+		// next run, while the one interrupted by a shutdown is just
+		// unlocked: the next fetch and checkout complete it.
+		if ctx.Err() == context.DeadlineExceeded {
+			metrics.GetCounter("repository_clone_timeout", index).Inc()
+			return removeAbortedClone(path, fmt.Errorf("%s: %w after %v", step.name, errCloneTimeout, timeout))
+		}
+		if ctx.Err() != nil {
+			return removeGitLocks(filepath.Join(path, ".git"), fmt.Errorf("%s: %w", step.name, ctx.Err()))
+		}
+		if err != nil && step.name == "checkout" {
+			return fmt.Errorf("%w: cannot checkout %s: %s: %s", errCorruptClone, gitBranch, err.Error(), out)
+		}
+		if err != nil {
+			return errors.New(fmt.Sprintf("cannot git pull the repository: %s: %s", err.Error(), out))
+		}
+	}
+
+	return nil
+}
+
+// The error classes of the repository_clone_failed counter.
+const (
+	cloneFailureTimeout  = "timeout"
+	cloneFailureAuth     = "auth"
+	cloneFailureNotFound = "not_found"
+	cloneFailureOther    = "other"
+)
+
+// authGitErrors and notFoundGitErrors match the output of git failing
+// because of missing or wrong credentials and because the repository or the
+// branch doesn't exist. Only the "permission denied" of ssh is an auth
+// error, not the one of the local filesystem.
+var (
+	authGitErrors = regexp.MustCompile(`(?i)authentication failed|could not read (username|password)|` +
+		`terminal prompts disabled|invalid username or password|permission denied \(publickey|the requested url returned error: 40[13]`)
+	notFoundGitErrors = regexp.MustCompile(`(?i)repository not found|repository '[^']*' not found|` +
+		`does not appear to be a git repository|couldn't find remote ref|remote branch .* not found|the requested url returned error: 404`)
+)
+
+// cloneFailureClass returns the class of err, returned by CloneRepository:
+// timeout, auth, not_found or other.
+func cloneFailureClass(err error) string {
+	switch {
+	case errors.Is(err, errCloneTimeout):
+		return cloneFailureTimeout
+	case authGitErrors.MatchString(err.Error()):
+		return cloneFailureAuth
+	case notFoundGitErrors.MatchString(err.Error()):
+		return cloneFailureNotFound
+	default:
+		return cloneFailureOther
+	}
+}
+
+// removeAbortedClone removes the clone in path left by the git operation
+// failed with err, which is returned along with the error of the removal.
+func removeAbortedClone(path string, err error) error {
+	if rmErr := os.RemoveAll(path); rmErr != nil {
+		return fmt.Errorf("%w, cannot remove %s: %v", err, path, rmErr)
+	}
+
+	return err
+}
+
+// removeGitLocks removes the lock files left in the git directory gitDir by
+// the git operation killed with err, which is returned along with the error
+// of the removal. The objects are not walked: git ignores the partial packs.
+func removeGitLocks(gitDir string, err error) error {
+	walkErr := filepath.Walk(gitDir, func(path string, info os.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case info.IsDir() && info.Name() == "objects":
+			return filepath.SkipDir
+		case !info.IsDir() && strings.HasSuffix(info.Name(), ".lock"):
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return fmt.Errorf("%w, cannot remove the locks of %s: %v", err, gitDir, walkErr)
+	}
+
+	return err
+}
+
+// clonePathLocks serialize the git commands on the same clone or bare mirror.
+var clonePathLocks = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+// lockClonePath locks the clone in path and returns the function unlocking it.
+func lockClonePath(path string) func() {
+	clonePathLocks.Lock()
+	lock, ok := clonePathLocks.locks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		clonePathLocks.locks[path] = lock
+	}
+	clonePathLocks.Unlock()
+
+	lock.Lock()
+
+	return lock.Unlock
+}
+
+// transientGitErrors match the output of git failures worth retrying, caused
+// by the network or the server. Other failures, like authentication errors
+// or missing repositories, are permanent.
+var transientGitErrors = regexp.MustCompile(`(?i)could not resolve host|connection reset|connection refused|` +
+	`connection timed out|operation timed out|failed to connect|early eof|remote end hung up unexpectedly|` +
+	`rpc failed|the requested url returned error: (429|5[0-9][0-9])|temporary failure`)
+
+// gitError is a failed git command with its output.
+type gitError struct {
+	err error
+	out []byte
+}
+
+func (e gitError) Error() string {
+	return fmt.Sprintf("%v: %s", e.err, e.out)
+}
+
+// runGit runs git with args and returns its combined output. Transient
+// failures are retried with backoff (see RETRY_MAX_ATTEMPTS).
+func runGit(ctx context.Context, args ...string) ([]byte, error) {
+	var out []byte
+	err := retry(ctx, "git "+strings.Join(args, " "), func() error {
+		var err error
+		out, err = runCommand(ctx, gitBinary(), append(gitProxyArgs(), args...)...)
+		if err != nil && ctx.Err() == nil {
+			return gitError{err: err, out: out}
+		}
+		return err
+	}, func(err error) bool {
+		// The remote hangs up after refusing a --shallow-since too.
+		e, ok := err.(gitError)
+		return ok && transientGitErrors.Match(e.out) && !noShallowCommits.Match(e.out)
+	})
+
+	if e, ok := err.(gitError); ok {
+		return e.out, e.err
+	}
+	return out, err
+}
+
+// runCommand runs the command and returns its combined output. It doesn't
+// wait for the command to complete after ctx is done: killing git doesn't
+// kill its helpers (eg. git-remote-https), which keep the output open.
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := commandContextInject(ctx, name, args...) // nolint: gas
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return out.Bytes(), err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// gitBinary returns the git executable, GIT_BINARY or git from PATH.
+func gitBinary() string {
+	if viper.IsSet("GIT_BINARY") {
+		return viper.GetString("GIT_BINARY")
+	}
+
+	return "git"
+}
+
+// gitTLSArgs returns the git options disabling the verification of the TLS
+// certificates if the domain has insecure-skip-verify, or verifying them
+// with its ca-cert-file.
+func gitTLSArgs(domain Domain) []string {
+	if domain.InsecureSkipVerify {
+		return []string{"-c", "http.sslVerify=false"}
+	}
+	if domain.CACertFile != "" {
+		// git -C resolves the relative paths from the repository.
+		caCertFile, err := filepath.Abs(domain.CACertFile)
+		if err != nil {
+			caCertFile = domain.CACertFile
+		}
+		return []string{"-c", "http.sslCAInfo=" + caCertFile}
+	}
+
+	return nil
+}
+
+// checkGit returns an error if the git executable can't be found.
+func checkGit() error {
+	if _, err := lookPathInject(gitBinary()); err != nil {
+		return fmt.Errorf("git not found, install it or set GIT_BINARY: %v", err)
+	}
+
+	return nil
+}
+
+// cloneTimeout returns the timeout of the git operations for domain, 0 means
+// no timeout. The domain setting takes precedence over CLONE_TIMEOUT.
+func cloneTimeout(domain Domain) time.Duration {
+	if domain.CloneTimeout > 0 {
+		return domain.CloneTimeout
+	}
+
+	return viper.GetDuration("CLONE_TIMEOUT")
+}
+
+// gitClonePath returns the path of the local clone of the repository.
+func gitClonePath(hostname, name string) string {
+	vendor, repo := splitFullName(name)
+	return filepath.Join(viper.GetString("CRAWLER_DATADIR"), "repos", hostname, vendor, repo, "gitClone")
+}
+
+// dirSize returns the size in bytes of all the files under path.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
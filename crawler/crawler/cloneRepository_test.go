@@ -0,0 +1,445 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestCloneRepositoryTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	defer viper.Set("CRAWLER_DATADIR", nil)
+
+	// Stub a slow git clone leaving a partial directory behind.
+	commandContextInject = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		path := args[len(args)-1]
+		return exec.CommandContext(ctx, "sh", "-c", "mkdir -p "+path+" && sleep 5")
+	}
+	defer func() { commandContextInject = exec.CommandContext }()
+
+	domain := Domain{Host: "example.org", CloneTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	err = CloneRepository(context.Background(), domain, "example.org", "vendor/repo", "https://example.org/vendor/repo.git", "master", "test")
+
+	assert.True(t, errors.Is(err, errCloneTimeout))
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	_, err = os.Stat(gitClonePath("example.org", "vendor/repo"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCloneRepositoryCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	defer viper.Set("CRAWLER_DATADIR", nil)
+
+	commandContextInject = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		path := args[len(args)-1]
+		return exec.CommandContext(ctx, "sh", "-c", "mkdir -p "+path+" && sleep 5")
+	}
+	defer func() { commandContextInject = exec.CommandContext }()
+
+	// Like a shutdown in the middle of the clone.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = CloneRepository(ctx, Domain{Host: "example.org"}, "example.org", "vendor/repo", "https://example.org/vendor/repo.git", "master", "test")
+
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, errors.Is(err, errCloneTimeout))
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	_, err = os.Stat(gitClonePath("example.org", "vendor/repo"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCloneRepositoryFetchTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	defer viper.Set("CRAWLER_DATADIR", nil)
+
+	// An existing clone whose fetch stalls.
+	path := gitClonePath("example.org", "vendor/repo")
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	commandContextInject = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		for _, arg := range args {
+			if arg == "fetch" {
+				return exec.CommandContext(ctx, "sleep", "5")
+			}
+		}
+		return exec.CommandContext(ctx, "true")
+	}
+	defer func() { commandContextInject = exec.CommandContext }()
+
+	domain := Domain{Host: "example.org", CloneTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	err = CloneRepository(context.Background(), domain, "example.org", "vendor/repo", "https://example.org/vendor/repo.git", "master", "test")
+
+	assert.True(t, errors.Is(err, errCloneTimeout))
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	// The clone may be half updated, the next run starts over.
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCloneRepositoryFetchCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	defer viper.Set("CRAWLER_DATADIR", nil)
+
+	// An existing clone whose fetch is interrupted, leaving its locks.
+	path := gitClonePath("example.org", "vendor/repo")
+	for _, name := range []string{"refs/heads/master.lock", "objects/pack/pack-1.keep", "HEAD"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(path, ".git", name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, ".git", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	commandContextInject = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		for _, arg := range args {
+			if arg == "fetch" {
+				if err := ioutil.WriteFile(filepath.Join(path, ".git", "shallow.lock"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				cancel()
+				return exec.CommandContext(ctx, "sleep", "5")
+			}
+		}
+		return exec.CommandContext(ctx, "true")
+	}
+	defer func() { commandContextInject = exec.CommandContext }()
+
+	domain := Domain{Host: "example.org"}
+	err = CloneRepository(ctx, domain, "example.org", "vendor/repo", "https://example.org/vendor/repo.git", "master", "test")
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// The clone is kept for the next run, without the locks.
+	for _, name := range []string{"refs/heads/master.lock", "shallow.lock"} {
+		_, err = os.Stat(filepath.Join(path, ".git", name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+	for _, name := range []string{"objects/pack/pack-1.keep", "HEAD"} {
+		_, err = os.Stat(filepath.Join(path, ".git", name))
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestCheckGit(t *testing.T) {
+	defer func() { lookPathInject = exec.LookPath }()
+	defer viper.Set("GIT_BINARY", nil)
+	defer viper.Set("SKIP_CLONE_IF_NO_GIT", nil)
+
+	var looked string
+	lookPathInject = func(file string) (string, error) {
+		looked = file
+		return "", exec.ErrNotFound
+	}
+
+	viper.Set("GIT_BINARY", "/opt/git/bin/git")
+	c := Crawler{}
+	assert.NotNil(t, c.CheckGit())
+	assert.Equal(t, "/opt/git/bin/git", looked)
+	assert.False(t, c.noGit)
+
+	viper.Set("SKIP_CLONE_IF_NO_GIT", true)
+	assert.Nil(t, c.CheckGit())
+	assert.True(t, c.noGit)
+}
+
+func TestCloneRepositoryRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	viper.Set("RETRY_BACKOFF", "1ms")
+	defer viper.Set("CRAWLER_DATADIR", nil)
+	defer viper.Set("RETRY_BACKOFF", nil)
+	defer func() { commandContextInject = exec.CommandContext }()
+
+	// Fail the first clone with a transient error.
+	var attempts int
+	commandContextInject = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		attempts++
+		if attempts == 1 {
+			return exec.CommandContext(ctx, "sh", "-c", "echo 'fatal: unable to access: Could not resolve host: example.org' >&2; exit 128")
+		}
+		return exec.CommandContext(ctx, "mkdir", "-p", args[len(args)-1])
+	}
+
+	domain := Domain{Host: "example.org"}
+	err = CloneRepository(context.Background(), domain, "example.org", "vendor/repo", "https://example.org/vendor/repo.git", "master", "test")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+
+	// Permanent errors are not retried.
+	attempts = 0
+	commandContextInject = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		attempts++
+		return exec.CommandContext(ctx, "sh", "-c", "echo 'remote: Repository not found.' >&2; exit 128")
+	}
+	err = CloneRepository(context.Background(), domain, "example.org", "vendor/other", "https://example.org/vendor/other.git", "master", "test")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestCloneRepositoryMirrorCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", filepath.Join(dir, "data"))
+	viper.Set("MIRROR_CACHE_DIR", filepath.Join(dir, "mirrors"))
+	defer viper.Set("CRAWLER_DATADIR", nil)
+	defer viper.Set("MIRROR_CACHE_DIR", nil)
+
+	remote := filepath.Join(dir, "remote")
+	commitFixture(t, remote, []time.Time{time.Now().Add(-time.Hour)})
+
+	// Record the git commands.
+	var commands []string
+	commandContextInject = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		commands = append(commands, strings.Join(args, " "))
+		return exec.CommandContext(ctx, name, args...)
+	}
+	defer func() { commandContextInject = exec.CommandContext }()
+
+	domain := Domain{Host: "example.org"}
+	clone := func() {
+		commands = nil
+		err := CloneRepository(context.Background(), domain, "example.org", "vendor/repo", remote, "master", "test")
+		assert.NoError(t, err)
+	}
+
+	clone()
+	assert.Contains(t, strings.Join(commands, "\n"), "clone --mirror "+remote)
+
+	// The second run updates the mirror and the working tree.
+	r, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Commit("new commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Author", Email: "author@example.org", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone()
+	assert.NotContains(t, strings.Join(commands, "\n"), "clone")
+	assert.Contains(t, strings.Join(commands, "\n"), "remote update")
+
+	r, err = git.PlainOpen(gitClonePath("example.org", "vendor/repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := extractAllCommits(r, "")
+	assert.NoError(t, err)
+	assert.Len(t, commits, 2)
+}
+
+func TestCloneRepositoryUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", filepath.Join(dir, "data"))
+	defer viper.Set("CRAWLER_DATADIR", nil)
+
+	remote := filepath.Join(dir, "remote")
+	commitFixture(t, remote, []time.Time{time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour)})
+
+	var commands []string
+	commandContextInject = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		commands = append(commands, strings.Join(args, " "))
+		return exec.CommandContext(ctx, name, args...)
+	}
+	defer func() { commandContextInject = exec.CommandContext }()
+
+	domain := Domain{Host: "example.org"}
+	clone := func(branch string) {
+		commands = nil
+		err := CloneRepository(context.Background(), domain, "example.org", "vendor/repo", remote, branch, "test")
+		assert.NoError(t, err)
+	}
+	clone("master")
+
+	// The default branch was renamed on the remote.
+	if out, err := exec.Command("git", "-C", remote, "branch", "-m", "master", "main").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	clone("main")
+	assert.NotContains(t, strings.Join(commands, "\n"), "clone")
+	assert.Contains(t, strings.Join(commands, "\n"), "fetch --all --prune")
+
+	out, err := exec.Command("git", "-C", gitClonePath("example.org", "vendor/repo"), "rev-parse", "--abbrev-ref", "HEAD").Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "main", strings.TrimSpace(string(out)))
+
+	// A broken clone is cloned again.
+	assert.NoError(t, os.RemoveAll(filepath.Join(gitClonePath("example.org", "vendor/repo"), ".git")))
+	clone("main")
+	assert.Contains(t, strings.Join(commands, "\n"), "clone -b main "+remote)
+
+	r, err := git.PlainOpen(gitClonePath("example.org", "vendor/repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := extractAllCommits(r, "")
+	assert.NoError(t, err)
+	assert.Len(t, commits, 2)
+}
+
+func TestShallowCloneArgs(t *testing.T) {
+	defer viper.Set("CLONE_DEPTH", nil)
+	defer viper.Set("ACTIVITY_DAYS", nil)
+	now := time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, shallowCloneArgs(now))
+
+	viper.Set("CLONE_DEPTH", "0")
+	assert.Nil(t, shallowCloneArgs(now))
+
+	viper.Set("CLONE_DEPTH", "50")
+	assert.Equal(t, []string{"--depth", "50"}, shallowCloneArgs(now))
+
+	viper.Set("CLONE_DEPTH", "activity")
+	viper.Set("ACTIVITY_DAYS", 30)
+	assert.Equal(t, []string{"--shallow-since=2020-09-14"}, shallowCloneArgs(now))
+
+	viper.Set("CLONE_DEPTH", "many")
+	assert.Nil(t, shallowCloneArgs(now))
+}
+
+func TestCloneRepositoryShallow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", filepath.Join(dir, "data"))
+	viper.Set("CLONE_DEPTH", "1")
+	defer viper.Set("CRAWLER_DATADIR", nil)
+	defer viper.Set("CLONE_DEPTH", nil)
+
+	remote := filepath.Join(dir, "remote")
+	now := time.Now()
+	commitFixture(t, remote, []time.Time{now.AddDate(0, 0, -30), now.AddDate(0, 0, -20), now.Add(-time.Hour)})
+
+	domain := Domain{Host: "example.org"}
+	err = CloneRepository(context.Background(), domain, "example.org", "vendor/repo", "file://"+remote, "master", "test")
+	assert.NoError(t, err)
+
+	r, err := git.PlainOpen(gitClonePath("example.org", "vendor/repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := extractAllCommits(r, "")
+	assert.NoError(t, err)
+	assert.Len(t, commits, 1)
+
+	// The activity is calculated on the commits cloned.
+	repository := Repository{Name: "vendor/repo", Hostname: "example.org", Domain: domain}
+	_, vitality, _, err := repository.CalculateRepoActivity(60, false)
+	assert.NoError(t, err)
+	assert.Len(t, vitality, 60)
+}
+
+func TestCloneRepositoryShallowDormant(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", filepath.Join(dir, "data"))
+	viper.Set("CLONE_DEPTH", "activity")
+	defer viper.Set("CRAWLER_DATADIR", nil)
+	defer viper.Set("CLONE_DEPTH", nil)
+
+	// No commits in the ACTIVITY_DAYS window, --shallow-since fails.
+	remote := filepath.Join(dir, "remote")
+	now := time.Now()
+	commitFixture(t, remote, []time.Time{now.AddDate(0, 0, -200), now.AddDate(0, 0, -100)})
+
+	domain := Domain{Host: "example.org"}
+	err = CloneRepository(context.Background(), domain, "example.org", "vendor/repo", "file://"+remote, "master", "test")
+	assert.NoError(t, err)
+
+	r, err := git.PlainOpen(gitClonePath("example.org", "vendor/repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := extractAllCommits(r, "")
+	assert.NoError(t, err)
+	assert.Len(t, commits, 1)
+
+	// The same for the fetch of the existing clone.
+	err = CloneRepository(context.Background(), domain, "example.org", "vendor/repo", "file://"+remote, "master", "test")
+	assert.NoError(t, err)
+}
+
+func TestCloneFailureClass(t *testing.T) {
+	assert.Equal(t, "timeout", cloneFailureClass(fmt.Errorf("clone: %w after 1m0s", errCloneTimeout)))
+	assert.Equal(t, "auth", cloneFailureClass(errors.New("cannot git clone the repository: exit status 128: "+
+		"fatal: could not read Username for 'https://github.com': terminal prompts disabled")))
+	assert.Equal(t, "auth", cloneFailureClass(errors.New("fatal: Authentication failed for 'https://gitlab.com/comune/app.git/'")))
+	assert.Equal(t, "not_found", cloneFailureClass(errors.New("remote: Repository not found.\nfatal: repository 'https://github.com/comune/app.git/' not found")))
+	assert.Equal(t, "not_found", cloneFailureClass(errors.New("warning: Could not find remote branch main to clone.\nfatal: Remote branch main not found in upstream origin")))
+	assert.Equal(t, "other", cloneFailureClass(errors.New("fatal: unable to access 'https://example.org/app.git/': Could not resolve host: example.org")))
+	assert.Equal(t, "auth", cloneFailureClass(errors.New("git@github.com: Permission denied (publickey).\nfatal: Could not read from remote repository.")))
+	assert.Equal(t, "other", cloneFailureClass(errors.New("fatal: could not create work tree dir 'gitClone': Permission denied")))
+}
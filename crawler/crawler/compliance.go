@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"math"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// complianceWeights are the weights of the quality checks in the compliance
+// score, overridden by COMPLIANCE_WEIGHT_<CHECK>.
+type complianceWeights struct {
+	CompleteMetadata float64
+	ValidLicense     float64
+	ReachableAssets  float64
+	URLMatch         float64
+	RecentActivity   float64
+}
+
+// Default weights of the compliance score, summing up to 100.
+var defaultComplianceWeights = complianceWeights{
+	CompleteMetadata: 30,
+	ValidLicense:     25,
+	ReachableAssets:  15,
+	URLMatch:         15,
+	RecentActivity:   15,
+}
+
+// complianceWeightsFromConfig returns the default weights overridden by the
+// configuration.
+func complianceWeightsFromConfig() complianceWeights {
+	w := defaultComplianceWeights
+
+	for key, weight := range map[string]*float64{
+		"COMPLIANCE_WEIGHT_METADATA":  &w.CompleteMetadata,
+		"COMPLIANCE_WEIGHT_LICENSE":   &w.ValidLicense,
+		"COMPLIANCE_WEIGHT_ASSETS":    &w.ReachableAssets,
+		"COMPLIANCE_WEIGHT_URL_MATCH": &w.URLMatch,
+		"COMPLIANCE_WEIGHT_ACTIVITY":  &w.RecentActivity,
+	} {
+		if viper.IsSet(key) {
+			*weight = viper.GetFloat64(key)
+		}
+	}
+
+	return w
+}
+
+// complianceScore returns the weighted percentage, from 0 to 100, of the
+// quality checks passed by the software.
+func complianceScore(quality softwareQuality, w complianceWeights) int {
+	total := w.CompleteMetadata + w.ValidLicense + w.ReachableAssets + w.URLMatch + w.RecentActivity
+	if total <= 0 {
+		return 0
+	}
+
+	var score float64
+	if quality.completeMetadata {
+		score += w.CompleteMetadata
+	}
+	if quality.validLicense {
+		score += w.ValidLicense
+	}
+	if quality.reachableAssets {
+		score += w.ReachableAssets
+	}
+	if quality.urlMatch {
+		score += w.URLMatch
+	}
+	if quality.recentActivity {
+		score += w.RecentActivity
+	}
+
+	return int(math.Round(score * 100 / total))
+}
+
+// urlMatches returns whether the url of the publiccode.yml points to the
+// crawled repository, one of repositoryURLs, ignoring the scheme, the
+// credentials, the case and the trailing ".git" and slashes.
+func urlMatches(publiccodeURL string, repositoryURLs ...string) bool {
+	normalize := func(u string) string {
+		u = strings.ToLower(strings.TrimSpace(u))
+		if i := strings.Index(u, "://"); i >= 0 {
+			u = u[i+3:]
+		}
+		// The user of the clone urls, eg. https://user@example.org/app.git.
+		if i := strings.IndexAny(u, "/@"); i >= 0 && u[i] == '@' {
+			u = u[i+1:]
+		}
+		u = strings.TrimRight(u, "/")
+		return strings.TrimSuffix(u, ".git")
+	}
+
+	if publiccodeURL == "" {
+		return false
+	}
+	for _, repositoryURL := range repositoryURLs {
+		if normalize(publiccodeURL) == normalize(repositoryURL) {
+			return true
+		}
+	}
+
+	return false
+}
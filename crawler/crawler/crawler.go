@@ -1,12 +1,11 @@
 package crawler
 
 import (
-	"crypto/rand"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/big"
 	"net/http"
 	"os"
 	"path"
@@ -14,15 +13,16 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/italia/developers-italia-backend/crawler/elastic"
 	"github.com/italia/developers-italia-backend/crawler/ipa"
 	"github.com/italia/developers-italia-backend/crawler/jekyll"
 	"github.com/italia/developers-italia-backend/crawler/metrics"
-	httpclient "github.com/italia/httpclient-lib-go"
 	publiccode "github.com/italia/publiccode-parser-go"
 	es "github.com/olivere/elastic"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -38,6 +38,35 @@ type Crawler struct {
 	repositories   chan Repository
 	publishersWg   sync.WaitGroup
 	repositoriesWg sync.WaitGroup
+	summary        crawlSummary
+	scorecard      scorecard
+	fieldStats     fieldStats
+	documentIDs    documentIDs
+	seen           seenRepositories
+
+	// Repositories fully processed, to resume the crawl if it dies.
+	checkpoint *checkpoint
+
+	// Notifies the newly indexed software, nil without WEBHOOK_URL.
+	webhook *webhookNotifier
+
+	// Bulk requests saving the documents of the crawl.
+	bulk crawlBulk
+
+	// Whether the crawler saves to the preview index.
+	preview bool
+
+	// Identifier of this crawl in the events.
+	runID string
+
+	// When the crawler was created, the start of the crawl.
+	startTime time.Time
+
+	// Whether git is missing and the clones are skipped (SKIP_CLONE_IF_NO_GIT).
+	noGit bool
+
+	// 1 once the IPA update completed, read by the readiness probe.
+	ipaUpdated int32
 }
 
 // Repository is a single code repository. FileRawURL contains the direct url to the raw file.
@@ -51,6 +80,59 @@ type Repository struct {
 	Pa          PA
 	Headers     map[string]string
 	Metadata    []byte
+
+	// WebURL is the URL of the web page of the repository, if the code
+	// hosting knows it and it's not just GitCloneURL without ".git", like
+	// on Bitbucket Server (/projects/<KEY>/repos/<slug>).
+	WebURL string
+
+	// Subpath is the directory of the software in the repository, empty if
+	// it's the whole repository.
+	Subpath string
+
+	// Archived is true if the code hosting marked the repository as archived.
+	Archived bool
+	// Fork is true if the repository is a fork of another one.
+	Fork bool
+
+	// ETag and Last-Modified of the crawled file, to skip it in the next
+	// crawls if unchanged.
+	FileETag         string
+	FileLastModified string
+
+	// PubliccodeYmlVersion is the publiccodeYmlVersion declared by the file.
+	PubliccodeYmlVersion string
+
+	// Diagnostics collected when cloning.
+	RepoSizeBytes int64
+	CloneDuration time.Duration
+
+	// NoSourceDetected is true if the clone has no recognizable source files.
+	NoSourceDetected bool
+
+	// DisallowedLicense is true if the license is not in ALLOWED_LICENSES.
+	DisallowedLicense bool
+	// SPDXLicense is the normalized legal.license, empty if not valid SPDX.
+	SPDXLicense string
+	// IsOpenSource is true if SPDXLicense is made of OSI approved licenses.
+	IsOpenSource bool
+
+	// LastCommit is the time of the last commit in the clone, zero if unknown.
+	LastCommit time.Time
+	// Dormant is true if the last commit is older than MAX_INACTIVE_DAYS.
+	Dormant bool
+	// Days since the last commit, or push if not cloned, nil if unknown.
+	DaysSinceLastCommit *int
+
+	// Commits per month in the activity window, if COMMIT_HISTOGRAM is true.
+	CommitHistogram []CommitMonth
+
+	// Open issues and pull requests, nil if unknown or disabled.
+	OpenIssues       *int
+	OpenPullRequests *int
+
+	// Programming languages, most used first, nil if unknown.
+	Languages []Language
 }
 
 // NewCrawler initializes a new Crawler object, updates the IPA list and connects to Elasticsearch (if dryRun == false).
@@ -59,6 +141,11 @@ func NewCrawler(dryRun bool) *Crawler {
 	var err error
 
 	c.DryRun = dryRun
+	c.runID = newRunID()
+	c.startTime = time.Now()
+
+	setConnectTimeout()
+	logProxy()
 
 	// Make sure the data directory exists or spit an error
 	if stat, err := os.Stat(viper.GetString("CRAWLER_DATADIR")); err != nil || !stat.IsDir() {
@@ -70,6 +157,10 @@ func NewCrawler(dryRun bool) *Crawler {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err = setHostsTLS(c.domains); err != nil {
+		log.Fatal(err)
+	}
+	setHostsRateLimit(c.domains)
 
 	// Initiate a channel of repositories.
 	c.repositories = make(chan Repository, 1000)
@@ -79,31 +170,49 @@ func NewCrawler(dryRun bool) *Crawler {
 	metrics.RegisterPrometheusCounter("repository_file_saved", "Number of file saved.", c.index)
 	metrics.RegisterPrometheusCounter("repository_file_indexed", "Number of file indexed.", c.index)
 	metrics.RegisterPrometheusCounter("repository_cloned", "Number of repository cloned", c.index)
+	metrics.RegisterPrometheusCounter("repository_mirror_updated", "Number of bare mirrors updated instead of cloned", c.index)
+	metrics.RegisterPrometheusCounter("repository_clone_timeout", "Number of repository skipped because git clone timed out", c.index)
+	metrics.RegisterPrometheusCounterVec("repository_clone_failed", "Number of repositories that failed to clone, by error class", c.index, "class")
+	metrics.RegisterPrometheusCounter("repository_file_too_complex", "Number of publiccode.yml rejected because too big or nested", c.index)
+	metrics.RegisterPrometheusCounter("repository_file_missing_required", "Number of publiccode.yml rejected because missing REQUIRED_FIELDS", c.index)
+	metrics.RegisterPrometheusCounter("repository_file_missing_version", "Number of publiccode.yml rejected because missing publiccodeYmlVersion", c.index)
+	metrics.RegisterPrometheusCounter("repository_file_unsupported_version", "Number of publiccode.yml rejected because of an unsupported publiccodeYmlVersion", c.index)
+	metrics.RegisterPrometheusCounter("repository_id_collision", "Number of documents with the ID of another repository", c.index)
+	metrics.RegisterPrometheusCounter("repository_file_timeout", "Number of publiccode.yml whose download timed out", c.index)
+	metrics.RegisterPrometheusCounter("repository_file_not_modified", "Number of publiccode.yml not modified since the last crawl", c.index)
+	metrics.RegisterPrometheusHistogram("repository_processing_seconds", "Time spent processing a repository.", c.index)
+	metrics.RegisterPrometheusCounterVec("repository_validation_failed", "Number of publiccode.yml rejected, by reason", c.index, "reason")
+	metrics.RegisterPrometheusGauge("repositories_queue_depth", "Number of repositories listed and waiting to be processed.", c.index)
+	metrics.RegisterPrometheusGauge("crawl_duration_seconds", "Duration of the last crawl.", c.index)
+	metrics.RegisterPrometheusGaugeVec("host_ratelimit_remaining", "Number of API requests left in the rate limit, by host.", c.index, "host")
 	//metrics.RegisterPrometheusCounter("repository_file_saved_valid", "Number of valid file saved.", c.index)
 
+	// The "/readyz" probe of the metrics server, started before the IPA
+	// update and the listing of the publishers so the probes answer during
+	// the setup too.
+	metrics.SetReadinessCheck(c.ready)
+	startMetricsServer()
+
 	if c.DryRun {
 		log.Info("Skipping ElasticSearch update (--dry-run)")
 		return &c
 	}
 
-	log.Debug("Connecting to ElasticSearch...")
-	c.es, err = elastic.ClientFactory(
-		viper.GetString("ELASTIC_URL"),
-		viper.GetString("ELASTIC_USER"),
-		viper.GetString("ELASTIC_PWD"))
-	if err != nil {
+	if err = c.ConnectElasticsearch(); err != nil {
 		log.Fatal(err)
 	}
-	log.Debug("Successfully connected to ElasticSearch")
+
+	c.webhook = newWebhookNotifier()
 
 	// Update ipa to lastest data.
 	err = ipa.UpdateFromIndicePAIfNeeded(c.es)
 	if err != nil {
 		log.Error(err)
+	} else {
+		atomic.StoreInt32(&c.ipaUpdated, 1)
 	}
 
 	// Initialize ES index mapping
-	c.index = viper.GetString("ELASTIC_PUBLICCODE_INDEX")
 	err = elastic.CreateIndexMapping(c.index, elastic.PubliccodeMapping, c.es)
 	if err != nil {
 		log.Fatal(err)
@@ -118,8 +227,66 @@ func NewCrawler(dryRun bool) *Crawler {
 	return &c
 }
 
+// startMetricsServerOnce starts the metrics server of this process.
+var startMetricsServerOnce sync.Once
+
+// startMetricsServer starts the metrics server, also streaming the events at
+// /events and serving the status of the last crawl at /last-run, once per
+// process.
+func startMetricsServer() {
+	startMetricsServerOnce.Do(func() {
+		http.Handle("/events", events.handler())
+		http.Handle("/last-run", lastRunHandler(lastRunFile()))
+		http.Handle("/feed.atom", feedHandler(feedFile()))
+		go metrics.StartPrometheusMetricsServer()
+	})
+}
+
+// ConnectElasticsearch connects to Elasticsearch and uses
+// ELASTIC_PUBLICCODE_INDEX, without creating the indices nor updating the
+// IPA list. It's done by NewCrawler unless in dry run, where the commands
+// reading from Elasticsearch call it themselves.
+func (c *Crawler) ConnectElasticsearch() error {
+	log.Debug("Connecting to ElasticSearch...")
+	client, err := elastic.ClientFactory(
+		viper.GetString("ELASTIC_URL"),
+		viper.GetString("ELASTIC_USER"),
+		viper.GetString("ELASTIC_PWD"))
+	if err != nil {
+		return err
+	}
+	log.Debug("Successfully connected to ElasticSearch")
+
+	c.es = client
+	c.index = viper.GetString("ELASTIC_PUBLICCODE_INDEX")
+
+	return nil
+}
+
+// CheckGit makes sure git is available for cloning the repositories.
+// If it's not, the clones and what depends on them are skipped when
+// SKIP_CLONE_IF_NO_GIT is true, otherwise an error is returned.
+func (c *Crawler) CheckGit() error {
+	if viper.GetBool("SKIP_ACTIVITY") {
+		return nil
+	}
+
+	err := checkGit()
+	if err == nil {
+		return nil
+	}
+	if !viper.GetBool("SKIP_CLONE_IF_NO_GIT") {
+		return err
+	}
+
+	log.Warnf("Skipping the repository clones and activity calculation (SKIP_CLONE_IF_NO_GIT): %v", err)
+	c.noGit = true
+
+	return nil
+}
+
 // CrawlRepo crawls a single repository.
-func (c *Crawler) CrawlRepo(repoURL string, pa PA) error {
+func (c *Crawler) CrawlRepo(ctx context.Context, repoURL string, pa PA) error {
 	log.Infof("Processing repository: %s", repoURL)
 
 	// Check if current host is in known in domains.yml hosts.
@@ -134,11 +301,17 @@ func (c *Crawler) CrawlRepo(repoURL string, pa PA) error {
 		return err
 	}
 	close(c.repositories)
-	return c.crawl()
+	if err := c.crawl(ctx); err != nil {
+		return err
+	}
+
+	return c.strictError()
 }
 
 // CrawlPublishers processes a list of publishers.
-func (c *Crawler) CrawlPublishers(publishers []PA) ([]string, error) {
+// When ctx is done no more repositories are listed nor processed, the ones
+// being processed are aborted and the indexes are flushed and aliased.
+func (c *Crawler) CrawlPublishers(ctx context.Context, publishers []PA) ([]string, error) {
 	// Count configured orgs
 	orgCount := 0
 	for _, pa := range publishers {
@@ -150,7 +323,7 @@ func (c *Crawler) CrawlPublishers(publishers []PA) ([]string, error) {
 	// Process every item in publishers.
 	for _, pa := range publishers {
 		c.publishersWg.Add(1)
-		go c.CrawlPublisher(pa)
+		go c.CrawlPublisher(ctx, pa)
 	}
 
 	// Close the repositories channel when all the publisher goroutines are done
@@ -166,7 +339,39 @@ func (c *Crawler) CrawlPublishers(publishers []PA) ([]string, error) {
 	// and call deleteFromES if present
 	toBeRemoved := c.removeBlackListedFromRepositories(GetAllBlackListedRepos())
 
-	return toBeRemoved, c.crawl()
+	// Write the checkpoint periodically while crawling.
+	if c.checkpoint == nil {
+		c.checkpoint = newCheckpoint(checkpointFile(), c.startTime)
+	}
+	checkpointCtx, stopCheckpoint := context.WithCancel(context.Background())
+	checkpointDone := make(chan struct{})
+	go func() {
+		c.checkpoint.writePeriodically(checkpointCtx)
+		close(checkpointDone)
+	}()
+
+	err := c.crawl(ctx)
+	// A write still running would bring back the file removed below.
+	stopCheckpoint()
+	<-checkpointDone
+
+	// Only a completed crawl tells which software is gone.
+	if err == nil {
+		if pruneErr := c.pruneStale(c.checkpoint.startTime); pruneErr != nil {
+			log.Errorf("Not pruning the stale documents: %v", pruneErr)
+		}
+	}
+
+	// A completed crawl has nothing to resume.
+	if err == nil {
+		if removeErr := os.Remove(c.checkpoint.path); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Errorf("Error removing the crawl checkpoint: %v", removeErr)
+		}
+	} else if writeErr := c.checkpoint.write(); writeErr != nil {
+		log.Errorf("Error writing the crawl checkpoint: %v", writeErr)
+	}
+
+	return toBeRemoved, err
 }
 
 // removeBlackListedFromRepositories this function is in charge
@@ -176,7 +381,12 @@ func (c *Crawler) CrawlPublishers(publishers []PA) ([]string, error) {
 func (c *Crawler) removeBlackListedFromRepositories(listedRepos map[string]string) (toBeRemoved []string) {
 	temp := make(chan Repository, 1000)
 	for repo := range c.repositories {
-		if val, ok := listedRepos[repo.GitCloneURL]; ok {
+		val, ok := listedRepos[repo.GitCloneURL]
+		if ok && isHostAllowlisted(repo.GitCloneURL) {
+			log.Warnf("%s is blacklisted but its host is in BLACKLIST_ALLOWED_HOSTS, processing it", val)
+			ok = false
+		}
+		if ok {
 			// add repository that should be processed but
 			// they are marked as blacklisted
 			// and then ready to be removed from ES if they exist
@@ -188,54 +398,143 @@ func (c *Crawler) removeBlackListedFromRepositories(listedRepos map[string]strin
 	}
 	close(temp)
 	c.repositories = temp
+	c.summary.addBlacklisted(len(toBeRemoved))
 	return
 }
 
-func (c *Crawler) crawl() error {
+// crawlerWorkers returns the number of ProcessRepositories workers,
+// CRAWLER_WORKERS or the number of CPUs if unset or less than 1.
+func crawlerWorkers() int {
+	if !viper.IsSet("CRAWLER_WORKERS") {
+		return runtime.NumCPU()
+	}
+
+	workers := viper.GetInt("CRAWLER_WORKERS")
+	if workers < 1 {
+		log.Warnf("Invalid CRAWLER_WORKERS %d, using the number of CPUs (%d)", workers, runtime.NumCPU())
+		return runtime.NumCPU()
+	}
+
+	return workers
+}
+
+func (c *Crawler) crawl(ctx context.Context) (err error) {
 	reposChan := make(chan Repository)
 
-	// Start the metrics server.
-	go metrics.StartPrometheusMetricsServer()
+	c.summary.lastActivityDuration = lastActivityDuration(lastRunFile())
 
-	defer c.publishersWg.Wait()
+	// Record the outcome and the duration, listing included, even of the
+	// failed crawls.
+	defer func() {
+		metrics.GetGauge("crawl_duration_seconds", c.index).Set(time.Since(c.startTime).Seconds())
 
-	// Get cpus number
-	numCPUs := runtime.NumCPU()
+		if writeErr := writeLastRun(c.lastRunStatus(err, time.Now()), lastRunFile()); writeErr != nil {
+			log.Errorf("Error writing the last run status: %v", writeErr)
+		}
+	}()
+
+	defer c.publishersWg.Wait()
 
 	// Process the repositories in order to retrieve the files.
-	for i := 0; i < numCPUs; i++ {
+	workers := crawlerWorkers()
+	log.Infof("Processing the repositories with %d workers", workers)
+	for i := 0; i < workers; i++ {
 		c.repositoriesWg.Add(1)
-		go c.ProcessRepositories(reposChan)
+		go c.ProcessRepositories(ctx, reposChan)
 	}
 
+	// Once interrupted, the repositories left are drained without
+	// processing them and the crawl is wrapped up as usual.
 	for repo := range c.repositories {
-		reposChan <- repo
+		// The repositories still buffered tell whether the listing is
+		// faster than the workers.
+		metrics.GetGauge("repositories_queue_depth", c.index).Set(float64(len(c.repositories)))
+		if ctx.Err() != nil {
+			continue
+		}
+		if !c.seen.add(repo) {
+			log.WithField(logFieldRepository, repo.Name).Debugf("Skipping, already listed in this crawl: %s", repo.GitCloneURL)
+			continue
+		}
+		if c.checkpoint.completed(repo) {
+			log.WithField(logFieldRepository, repo.Name).Debugf("Skipping, already processed by the resumed crawl: %s", repo.GitCloneURL)
+			continue
+		}
+		select {
+		case reposChan <- repo:
+		case <-ctx.Done():
+			log.Warn("Interrupted, skipping the repositories left")
+		}
 	}
+	metrics.GetGauge("repositories_queue_depth", c.index).Set(0)
 	close(reposChan)
 	c.repositoriesWg.Wait()
+	// The software is notified once indexed.
+	if bulkErr := c.closeBulk(); bulkErr != nil {
+		log.Errorf("Error sending the documents to ElasticSearch: %v", bulkErr)
+	}
+	c.webhook.flush(webhookTimeout)
+
+	c.summary.log()
+
+	err = c.scorecard.write(path.Join(viper.GetString("OUTPUT_DIR"), "scorecard.json"))
+	if err != nil {
+		log.Errorf("Error writing the publishers scorecard: %v", err)
+	}
+
+	err = c.fieldStats.write(path.Join(viper.GetString("OUTPUT_DIR"), "field_stats.json"))
+	if err != nil {
+		log.Errorf("Error writing the field statistics: %v", err)
+	}
 
 	if c.DryRun {
 		log.Info("Skipping ElasticSearch indexes update (--dry-run)")
 
-		return nil
+		return interrupted(ctx)
+	}
+
+	err = writeTransfers(c.summary.codiceIPATransfers(), path.Join(viper.GetString("OUTPUT_DIR"), "codiceIPA_transfers.json"))
+	if err != nil {
+		log.Errorf("Error writing the codiceIPA transfers: %v", err)
 	}
 
 	// ElasticFlush to flush all the operations on ES.
-	err := elastic.Flush(c.index, c.es)
+	err = elastic.Flush(c.index, c.es)
 	if err != nil {
 		log.Errorf("Error flushing ElasticSearch: %v", err)
 	}
 
+	// Pick the canonical document of the software found on more hosts.
+	err = c.deduplicateMirrors()
+	if err != nil {
+		log.Errorf("Error deduplicating the mirrors: %v", err)
+	}
+
 	// Update Elastic alias.
 	err = elastic.AliasUpdate(viper.GetString("ELASTIC_PUBLISHERS_INDEX"), viper.GetString("ELASTIC_ALIAS"), c.es)
 	if err != nil {
 		return fmt.Errorf("Error updating Elastic Alias: %v", err)
 	}
+	if c.preview {
+		log.Infof("Skipping ElasticSearch alias update of %s (preview)", c.index)
+
+		return interrupted(ctx)
+	}
 	err = elastic.AliasUpdate(c.index, viper.GetString("ELASTIC_ALIAS"), c.es)
 	if err != nil {
 		return fmt.Errorf("Error updating Elastic Alias: %v", err)
 	}
 
+	return interrupted(ctx)
+}
+
+// interrupted returns the error of a crawl interrupted through ctx, nil if
+// it wasn't.
+func interrupted(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("crawl interrupted: %w", ctx.Err())
+	}
+
 	return nil
 }
 
@@ -245,16 +544,36 @@ func (c *Crawler) ExportForJekyll() error {
 		log.Info("Skipping YAML output (--dry-run)")
 		return nil;
 	}
+	if c.preview {
+		log.Info("Skipping YAML output (preview), it will be generated on promote")
+		return nil
+	}
+
+	err := jekyll.GenerateJekyllYML(c.es)
 
-	return jekyll.GenerateJekyllYML(c.es)
+	if feedErr := c.ExportFeed(feedFile()); feedErr != nil {
+		log.Errorf("Error exporting the feed of the recent software: %v", feedErr)
+	}
+
+	return err
+}
+
+// ExportCategories exports a file in dir for each of categories, with the
+// software in that category.
+func (c *Crawler) ExportCategories(dir string, categories []string, format string) error {
+	return jekyll.CategoriesSoftware(dir, categories, format, c.es)
 }
 
 // CrawlPublisher delegates the work to single PA crawlers.
-func (c *Crawler) CrawlPublisher(pa PA) {
+func (c *Crawler) CrawlPublisher(ctx context.Context, pa PA) {
 	log.Infof("Processing publisher: %s", pa.Name)
 	defer c.publishersWg.Done()
 
 	for _, orgURL := range pa.Organizations {
+		if ctx.Err() != nil {
+			return
+		}
+
 		// Check if host is in list of known code hosting domains
 		domain, err := c.KnownHost(orgURL)
 		if err != nil {
@@ -262,10 +581,14 @@ func (c *Crawler) CrawlPublisher(pa PA) {
 		}
 
 		// Process the organization
-		c.CrawlOrg(orgURL, domain, pa)
+		c.CrawlOrg(ctx, orgURL, domain, pa)
 	}
 
 	for _, repoURL := range pa.Repositories {
+		if ctx.Err() != nil {
+			return
+		}
+
 		// Check if host is in list of known code hosting domains
 		domain, err := c.KnownHost(repoURL)
 		if err != nil {
@@ -277,7 +600,10 @@ func (c *Crawler) CrawlPublisher(pa PA) {
 }
 
 // CrawlOrg fetches all the repositories belonging to an org and crawls them.
-func (c *Crawler) CrawlOrg(orgURL string, domain *Domain, pa PA) {
+// The pages after the first are fetched concurrently if the host tells which
+// one is the last, one after the other otherwise.
+// It stops at the next page when ctx is done.
+func (c *Crawler) CrawlOrg(ctx context.Context, orgURL string, domain *Domain, pa PA) {
 	orgURLs, err := domain.generateAPIURLs(orgURL)
 	if err != nil {
 		log.Errorf("generateAPIURLs error: %v", err)
@@ -287,7 +613,11 @@ ORG:
 	for _, orgURL := range orgURLs {
 		// Process the pages until the end is reached.
 		for {
-			nextURL, err := domain.processAndGetNextURL(orgURL, c.repositories, pa)
+			if ctx.Err() != nil {
+				return
+			}
+
+			nextURL, lastURL, err := domain.processAndGetNextURL(orgURL, c.repositories, pa)
 			if err != nil {
 				log.Errorf("error reading %s repository list: %v; nextURL: %v", orgURL, err, nextURL)
 				continue ORG
@@ -297,6 +627,12 @@ ORG:
 			if nextURL == "" {
 				return
 			}
+			// If the host gave the last page, the rest are fetched
+			// concurrently.
+			if pages := pageURLs(nextURL, lastURL); pages != nil {
+				c.crawlPages(ctx, domain, pages, pa)
+				return
+			}
 			// Update url to nextURL.
 			orgURL = nextURL
 		}
@@ -306,16 +642,20 @@ ORG:
 // generateRandomInt returns an integer between 0 and max parameter.
 // "Max" must be less than math.MaxInt32
 func generateRandomInt(max int) (int, error) {
-	result, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
-	return int(result.Int64()), err
+	return defaultRandom.Intn(max)
 }
 
 // ProcessRepositories process the repositories channel and check the availability of the file.
-func (c *Crawler) ProcessRepositories(repos chan Repository) {
+func (c *Crawler) ProcessRepositories(ctx context.Context, repos chan Repository) {
 	defer c.repositoriesWg.Done()
 
 	for repository := range repos {
-		c.ProcessRepo(repository)
+		c.ProcessRepo(ctx, repository)
+
+		// The repositories interrupted midway are processed again on resume.
+		if ctx.Err() == nil {
+			c.checkpoint.markDone(repository)
+		}
 	}
 }
 
@@ -324,19 +664,30 @@ type logEntry struct {
 	Message  string `json:"message"`
 }
 
-func addLogEntry(logEntries *[]logEntry, message string) {
+// addLogEntry adds message about the repository name to logEntries.
+func addLogEntry(logEntries *[]logEntry, name, message string) {
 	*logEntries = append(
 		*logEntries,
-		logEntry{Datetime: time.Now().UTC().Format(time.RFC3339), Message: message},
+		logEntry{Datetime: time.Now().UTC().Format(time.RFC3339), Message: fmt.Sprintf("[%s] %s\n", name, message)},
 	)
 }
 
 // ProcessRepo looks for a publiccode.yml file in a repository, and if found it processes it.
-func (c *Crawler) ProcessRepo(repository Repository) {
+// If ctx is done before it's saved, the repository is skipped.
+func (c *Crawler) ProcessRepo(ctx context.Context, repository Repository) {
 	var logEntries []logEntry
 
 	var message string = ""
 
+	logger := repositoryLogger(repository)
+
+	// The exemplar links the slow samples to the events of this crawl.
+	start := time.Now()
+	defer func() {
+		metrics.ObserveWithExemplar("repository_processing_seconds", c.index, time.Since(start).Seconds(),
+			prometheus.Labels{"run_id": c.runID})
+	}()
+
 	// Write the log to a file, so it can be accessed from outside at
 	// http://crawler-host/$codehosting/$org/$reponame/log.txt
 	defer func() {
@@ -348,14 +699,14 @@ func (c *Crawler) ProcessRepo(repository Repository) {
 		)
 
 		if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
-			log.Errorf("[%s]: %s", repository.Name, err.Error())
+			logger.Error(err.Error())
 
 			return
 		}
 
 		jsonOut, _ := json.Marshal(logEntries)
 		if err := ioutil.WriteFile(fname, jsonOut, 0644); err != nil {
-			log.Errorf("[%s]: %s", repository.Name, err.Error())
+			logger.Error(err.Error())
 
 			return
 		}
@@ -363,36 +714,171 @@ func (c *Crawler) ProcessRepo(repository Repository) {
 
 	// Increment counter for the number of repositories processed.
 	metrics.GetCounter("repository_processed", c.index).Inc()
+	c.summary.addProcessed()
+	c.emit(repository, eventProcessing, "")
+
+	if repository.Archived && skipArchived() {
+		message = "Skipping archived repository (SKIP_ARCHIVED)"
+		logger.Info(message)
+		addLogEntry(&logEntries, repository.Name, message)
+
+		if c.DryRun {
+			return
+		}
+		if err := c.removeFromES(ctx, repository); err != nil {
+			message = fmt.Sprintf("error removing from ElasticSearch: %v", err)
+			logger.Error(message)
+			addLogEntry(&logEntries, repository.Name, message)
+		}
+
+		return
+	}
+
+	// Send the validators of the indexed file, so the server answers
+	// 304 Not Modified if it's unchanged.
+	headers := repository.Headers
+	var stored fileValidators
+	if incrementalCrawl() && !c.DryRun {
+		var err error
+		stored, err = c.storedValidators(ctx, repository)
+		if err != nil {
+			logger.Warnf("can't read the indexed ETag and Last-Modified: %v", err)
+		}
+		headers = conditionalHeaders(repository.Headers, stored)
+	}
+
+	resp, err := getURLContext(ctx, requestRawFile, repository.FileRawURL, headers)
 
-	resp, err := httpclient.GetURL(repository.FileRawURL, repository.Headers)
+	// Keep the indexed document of an unchanged file, without parsing or
+	// cloning it again.
+	if resp.Status.Code == http.StatusNotModified {
+		metrics.GetCounter("repository_file_not_modified", c.index).Inc()
+
+		if err := c.touchES(ctx, repository); err != nil {
+			message = fmt.Sprintf("error updating the crawl time in ElasticSearch: %v", err)
+			logger.Error(message)
+			addLogEntry(&logEntries, repository.Name, message)
+
+			return
+		}
+
+		message = "publiccode.yml not modified since the last crawl (INCREMENTAL_CRAWL)"
+		logger.Info(message)
+		addLogEntry(&logEntries, repository.Name, message)
+		c.reportUnchanged(repository, stored)
+
+		return
+	}
 
 	if resp.Status.Code != http.StatusOK || err != nil {
-		message = fmt.Sprintf("[%s] Failed to GET publiccode.yml\n", repository.Name)
-		log.Errorf(message)
+		if err == nil {
+			err = errors.New(resp.Status.Text)
+		}
+		if errors.Is(err, errRequestTimeout) {
+			metrics.GetCounter("repository_file_timeout", c.index).Inc()
+		}
+		// The requests interrupted by a shutdown didn't fail.
+		if ctx.Err() == nil {
+			c.summary.addFetchFailure()
+		}
+		c.validationFailed(failureHTTPError)
+		message = fmt.Sprintf("Failed to GET publiccode.yml at %s: %v", repository.FileRawURL, err)
+		logger.Error(message)
 
-		addLogEntry(&logEntries, message)
+		addLogEntry(&logEntries, repository.Name, message)
 		return
 	}
 
-	message = fmt.Sprintf("[%s] publiccode.yml found at %s\n", repository.Name, repository.FileRawURL)
-	log.Infof(message)
-	addLogEntry(&logEntries, message)
+	repository.FileETag = resp.Headers.Get("ETag")
+	repository.FileLastModified = resp.Headers.Get("Last-Modified")
+
+	message = fmt.Sprintf("publiccode.yml found at %s (branch %s)", repository.FileRawURL, repository.GitBranch)
+	logger.Info(message)
+	addLogEntry(&logEntries, repository.Name, message)
+
+	// Record the quality of the software in the publishers scorecard.
+	var quality softwareQuality
+	defer func() {
+		c.scorecard.add(repository.Pa, quality)
+	}()
+
+	// Reject files too big or nested to be parsed safely.
+	err = checkComplexity(resp.Body)
+	if err != nil {
+		message = fmt.Sprintf("BAD publiccode.yml: %+v", err)
+		logger.Error(message)
+		addLogEntry(&logEntries, repository.Name, message)
+		c.summary.addInvalid(repository.FileRawURL, err)
+		c.emit(repository, eventInvalid, err.Error())
+		if _, ok := err.(errorTooComplex); ok {
+			metrics.GetCounter("repository_file_too_complex", c.index).Inc()
+		}
+		c.validationFailed(failureTooComplex)
+
+		return
+	}
+
+	// Reject YAML directives the parser can't handle before validating
+	// and indexing the file.
+	err = checkYAML(resp.Body)
+	if err != nil {
+		message = fmt.Sprintf("BAD publiccode.yml: %+v", err)
+		logger.Error(message)
+		addLogEntry(&logEntries, repository.Name, message)
+		c.summary.addInvalid(repository.FileRawURL, err)
+		c.emit(repository, eventInvalid, err.Error())
+		c.validationFailed(failureParseError)
+
+		return
+	}
+
+	// Check the declared publiccodeYmlVersion before parsing the whole file.
+	repository.PubliccodeYmlVersion, err = checkVersion(resp.Body)
+	if err != nil {
+		message = fmt.Sprintf("BAD publiccode.yml: %+v", err)
+		logger.Error(message)
+		addLogEntry(&logEntries, repository.Name, message)
+		c.summary.addInvalid(repository.FileRawURL, err)
+		c.emit(repository, eventInvalid, err.Error())
+		if _, ok := err.(errorMissingVersion); ok {
+			metrics.GetCounter("repository_file_missing_version", c.index).Inc()
+		} else {
+			metrics.GetCounter("repository_file_unsupported_version", c.index).Inc()
+		}
+		c.validationFailed(failureVersion)
+
+		return
+	}
 
 	// Validate the publiccode.yml
 	if repository.Pa.UnknownIPA {
-		message = fmt.Sprintf(
-			"[%s] When UnknownIPA is set to true IPA match with whitelists will be skipped\n",
-			repository.Name,
-		)
+		message = "When UnknownIPA is set to true IPA match with whitelists will be skipped"
 
-		log.Warn(message)
-		addLogEntry(&logEntries, message)
+		logger.Warn(message)
+		addLogEntry(&logEntries, repository.Name, message)
+		c.fieldStats.add(resp.Body, nil)
 	} else {
-		err = validateRemoteFile(resp.Body, repository.FileRawURL, repository.Pa, repository.Domain)
+		err = validateRemoteFile(resp.Body, repository.FileRawURL, repositoryURLs(repository), repository.Pa, repository.Domain)
+
+		// Without URL_MISMATCH_FATAL a url of another repository is only
+		// reported.
+		if mismatch, ok := err.(errorURLMismatch); ok && !urlMismatchFatal() {
+			c.summary.addURLMismatch(URLMismatch(mismatch))
+
+			message = fmt.Sprintf("WARNING urlMismatch: %v", err)
+			logger.Warn(message)
+			addLogEntry(&logEntries, repository.Name, message)
+			err = nil
+		}
+		quality = qualityFromError(err)
+		c.fieldStats.add(resp.Body, err)
 		if err != nil {
-			message = fmt.Sprintf("[%s] BAD publiccode.yml: %+v\n", repository.Name, err)
-			log.Errorf(message)
-			addLogEntry(&logEntries, message)
+			message = fmt.Sprintf("BAD publiccode.yml: %+v", err)
+			logger.Error(message)
+			addLogEntry(&logEntries, repository.Name, message)
+			c.summary.addInvalid(repository.FileRawURL, err)
+			c.emit(repository, eventInvalid, err.Error())
+			c.validationFailed(validationFailureReason(err))
 
 			if ! c.DryRun {
 				logBadYamlToFile(repository.FileRawURL)
@@ -402,67 +888,310 @@ func (c *Crawler) ProcessRepo(repository Repository) {
 		}
 	}
 
-	message = fmt.Sprintf("[%s] GOOD publiccode.yml\n", repository.Name)
-	log.Infof(message)
-	addLogEntry(&logEntries, message)
+	// Enforce the fields required by the catalog, beyond the parser.
+	err = checkRequiredFields(resp.Body)
+	if err == nil {
+		err = checkRequiredURL(ctx, resp.Body)
+	}
+	if err != nil {
+		message = fmt.Sprintf("BAD publiccode.yml: %+v", err)
+		logger.Error(message)
+		addLogEntry(&logEntries, repository.Name, message)
+		c.summary.addInvalid(repository.FileRawURL, err)
+		c.emit(repository, eventInvalid, err.Error())
+		metrics.GetCounter("repository_file_missing_required", c.index).Inc()
+		c.validationFailed(failureMissingRequired)
+
+		return
+	}
+
+	message = "GOOD publiccode.yml"
+	logger.Info(message)
+	addLogEntry(&logEntries, repository.Name, message)
+	c.summary.addValid()
+	c.emit(repository, eventValid, "")
+
+	declaredLicense := publiccodeLicense(resp.Body)
+	// The parser accepts licenses missing or not in the canonical form.
+	quality.validLicense = canonicalLicense(declaredLicense)
+	quality.urlMatch = urlMatches(publiccodeURL(resp.Body), repositoryURLs(repository)...)
+	repository.SPDXLicense, repository.IsOpenSource, err = normalizeLicense(declaredLicense)
+	if err != nil {
+		c.summary.addInvalidLicense(repository.FileRawURL, declaredLicense, err)
+
+		message = fmt.Sprintf("WARNING invalidLicense: %q: %v", declaredLicense, err)
+		logger.Warn(message)
+		addLogEntry(&logEntries, repository.Name, message)
+	}
+
+	license, disallowed := checkLicense(resp.Body)
+	if disallowed {
+		repository.DisallowedLicense = true
+		c.summary.addDisallowedLicense(license, repository.Pa.Name)
+
+		message = fmt.Sprintf("WARNING disallowedLicense: %s is not in ALLOWED_LICENSES", license)
+		logger.Warn(message)
+		addLogEntry(&logEntries, repository.Name, message)
+
+		if viper.GetBool("SKIP_DISALLOWED_LICENSES") {
+			message = "Skipping repository with disallowed license (SKIP_DISALLOWED_LICENSES)"
+			logger.Info(message)
+			addLogEntry(&logEntries, repository.Name, message)
+
+			return
+		}
+	}
 
 	if c.DryRun {
-		log.Infof("[%s]: Skipping repository clone and save to ElasticSearch (--dry-run)", repository.Name)
+		logger.Info("Skipping repository clone and save to ElasticSearch (--dry-run)")
 		return;
 	}
 
-	// Clone repository.
-	err = CloneRepository(repository.Domain, repository.Hostname, repository.Name, repository.GitCloneURL, repository.GitBranch, c.index)
+	activityIndex, vitalitySlice := c.calculateActivity(ctx, &repository, &logEntries)
+	quality.recentActivity = activityIndex > 0
+
+	repository.DaysSinceLastCommit = daysSinceLastCommit(repository, time.Now())
+
+	if lastActivity := lastActivityTime(repository); isDormant(lastActivity, time.Now()) {
+		repository.Dormant = true
+		c.summary.addDormant(repository.Pa.Name)
+
+		message = fmt.Sprintf("WARNING dormant: last activity on %s, more than %d days ago",
+			lastActivity.Format("2006-01-02"), viper.GetInt("MAX_INACTIVE_DAYS"))
+		logger.Warn(message)
+		addLogEntry(&logEntries, repository.Name, message)
+
+		if viper.GetBool("SKIP_DORMANT") {
+			message = "Skipping dormant repository (SKIP_DORMANT)"
+			logger.Info(message)
+			addLogEntry(&logEntries, repository.Name, message)
+
+			return
+		}
+	}
+
+	// The indexed document, also read by saveToES.
+	times, err := c.storedTimes(repository)
+	if err != nil {
+		logger.Warnf("can't read the indexed firstSeen, lastModified and codiceIPA: %v", err)
+	}
+
+	// Record the software moved to another administration.
+	if transfer := checkCodiceIPATransfer(repository, times, resp.Body); transfer != nil {
+		c.summary.addTransfer(*transfer)
+
+		message = fmt.Sprintf("codiceIPA changed from %s to %s", transfer.From, transfer.To)
+		logger.Info(message)
+		addLogEntry(&logEntries, repository.Name, message)
+	}
+
+	repository.OpenIssues, repository.OpenPullRequests, err = openCounts(ctx, repository)
 	if err != nil {
-		message = fmt.Sprintf("[%s] error while cloning: %v\n", repository.Name, err)
-		log.Errorf(message)
+		message = fmt.Sprintf("error getting the open issues and pull requests: %v", err)
+		logger.Warn(message)
+		addLogEntry(&logEntries, repository.Name, message)
+	}
 
-		addLogEntry(&logEntries, message)
+	repository.Languages, err = repoLanguages(ctx, repository)
+	if err != nil {
+		message = fmt.Sprintf("error getting the programming languages: %v", err)
+		logger.Warn(message)
+		addLogEntry(&logEntries, repository.Name, message)
 	}
 
-	// Calculate Repository activity index and vitality. Defaults to 60 days.
-	var activityDays int = 60
-	if viper.IsSet("ACTIVITY_DAYS") {
-		activityDays = viper.GetInt("ACTIVITY_DAYS")
+	// Don't overwrite the indexed document with a partial one.
+	if ctx.Err() != nil {
+		message = "Interrupted, not saving to ElasticSearch"
+		logger.Warn(message)
+		addLogEntry(&logEntries, repository.Name, message)
+
+		return
 	}
-	activityIndex, vitality, err := repository.CalculateRepoActivity(activityDays)
+
+	// Save to ES.
+	err = c.saveToES(ctx, repository, activityIndex, vitalitySlice, quality, times, resp.Body)
 	if err != nil {
-		message = fmt.Sprintf("[%s] error calculating activity index: %v\n", repository.Name, err)
+		message = fmt.Sprintf("error saving to ElasticSearch: %v", err)
+		logger.Error(message)
+
+		addLogEntry(&logEntries, repository.Name, message)
+
+		return
+	}
+	c.emit(repository, eventSaved, "")
+}
 
-		log.Errorf(message)
-		addLogEntry(&logEntries, message)
+// isDormant returns whether lastCommit, see lastActivityTime, is older than
+// MAX_INACTIVE_DAYS. Repositories are never dormant if it's not set or the
+// last commit is unknown.
+func isDormant(lastCommit, now time.Time) bool {
+	maxInactiveDays := viper.GetInt("MAX_INACTIVE_DAYS")
+	if maxInactiveDays <= 0 || lastCommit.IsZero() {
+		return false
 	}
-	message = fmt.Sprintf("[%s] activity index in the last %d days: %f\n", repository.Name, activityDays, activityIndex)
-	log.Infof(message)
-	addLogEntry(&logEntries, message)
 
+	return lastCommit.Before(now.AddDate(0, 0, -maxInactiveDays))
+}
+
+// calculateActivity calculates the activity index and vitality of the
+// repository, cloning it unless SKIP_ACTIVITY, git is missing or it's too
+// big. The vitality is nil if the activity was not calculated.
+func (c *Crawler) calculateActivity(ctx context.Context, repository *Repository, logEntries *[]logEntry) (float64, []int) {
+	var message string
+
+	logger := repositoryLogger(*repository)
+
+	var activityIndex float64
 	var vitalitySlice []int
-	for i := 0; i < len(vitality); i++ {
-		vitalitySlice = append(vitalitySlice, int(vitality[i]))
+	tooBig, reportedSize := isTooBigToClone(*repository)
+	switch {
+	case viper.GetBool("SKIP_ACTIVITY"):
+		message = "Skipping repository clone and activity calculation (SKIP_ACTIVITY)"
+		logger.Info(message)
+		addLogEntry(logEntries, repository.Name, message)
+
+		c.summary.addSkippedActivity()
+	case c.noGit:
+		message = "Skipping repository clone and activity calculation (git not found)"
+		logger.Info(message)
+		addLogEntry(logEntries, repository.Name, message)
+
+		c.summary.addSkippedActivity()
+	case tooBig:
+		// The publiccode.yml is indexed anyway, without the activity.
+		message = fmt.Sprintf("Skipping repository clone and activity calculation, %d MB according to the API (MAX_REPO_SIZE_MB)",
+			reportedSize/1024/1024)
+		logger.Warn(message)
+		addLogEntry(logEntries, repository.Name, message)
+
+		c.summary.addSkippedTooBig()
+	default:
+		activityStart := time.Now()
+		activityIndex, vitalitySlice = c.cloneAndCalculateActivity(ctx, repository, logEntries)
+		if vitalitySlice != nil {
+			c.summary.addActivityDuration(time.Since(activityStart))
+		}
+	}
+	// Without a clone, skipped or failed, the activity can come from the API.
+	if vitalitySlice == nil && repository.CloneDuration == 0 && apiActivity() {
+		activityIndex, vitalitySlice = calculateAPIActivity(ctx, *repository, logEntries)
 	}
 
-	// Save to ES.
-	err = c.saveToES(repository, activityIndex, vitalitySlice, resp.Body)
+	return activityIndex, vitalitySlice
+}
+
+// cloneAndCalculateActivity clones the repository and calculates its activity index and vitality.
+func (c *Crawler) cloneAndCalculateActivity(ctx context.Context, repository *Repository, logEntries *[]logEntry) (float64, []int) {
+	var message string
+
+	logger := repositoryLogger(*repository)
+
+	// Clone repository.
+	cloneStart := time.Now()
+	err := CloneRepository(ctx, repository.Domain, repository.Hostname, repository.Name, repository.GitCloneURL, repository.GitBranch, c.index)
 	if err != nil {
-		message = fmt.Sprintf("[%s] error saving to ElasticSearch: %v\n", repository.Name, err)
-		log.Errorf(message)
+		message = fmt.Sprintf("error while cloning: %v", err)
+		logger.Error(message)
+		// The clones interrupted by a shutdown didn't fail.
+		if ctx.Err() == nil {
+			c.summary.addCloneFailure(cloneFailureClass(err))
+		}
+
+		addLogEntry(logEntries, repository.Name, message)
+
+		// Don't calculate the activity on a partial or stale clone.
+		if errors.Is(err, errCloneTimeout) || ctx.Err() != nil {
+			return 0, nil
+		}
+	} else {
+		repository.CloneDuration = time.Since(cloneStart)
+		c.summary.addCloneDuration(repository.CloneDuration)
+
+		repository.RepoSizeBytes, err = dirSize(gitClonePath(repository.Hostname, repository.Name))
+		if err != nil {
+			logger.Warnf("can't compute the repository size: %v", err)
+		}
+
+		message = fmt.Sprintf("cloned in %v, size %d bytes", repository.CloneDuration, repository.RepoSizeBytes)
+		logger.Info(message)
+		addLogEntry(logEntries, repository.Name, message)
+		c.emit(*repository, eventCloned, "")
+
+		repository.LastCommit, err = lastCommitTime(gitClonePath(repository.Hostname, repository.Name))
+		if err != nil {
+			logger.Warnf("can't read the last commit: %v", err)
+		}
 
-		addLogEntry(&logEntries, message)
+		// Flag repositories with only binaries or archives for manual review.
+		hasSource, err := hasSourceFiles(gitClonePath(repository.Hostname, repository.Name), sourceExtensions())
+		if err != nil {
+			logger.Warnf("can't look for source files: %v", err)
+		} else if !hasSource {
+			repository.NoSourceDetected = true
+
+			message = "WARNING noSourceDetected: no source files found in the repository"
+			logger.Warn(message)
+			addLogEntry(logEntries, repository.Name, message)
+		}
+	}
+
+	// Calculate Repository activity index and vitality.
+	activityDays := activityDays()
+	activityIndex, vitality, commitHistogram, err := repository.CalculateRepoActivity(activityDays, viper.GetBool("COMMIT_HISTOGRAM"))
+	if err != nil {
+		message = fmt.Sprintf("error calculating activity index: %v", err)
+
+		logger.Error(message)
+		addLogEntry(logEntries, repository.Name, message)
+	}
+	message = fmt.Sprintf("activity index in the last %d days: %f", activityDays, activityIndex)
+	logger.Info(message)
+	addLogEntry(logEntries, repository.Name, message)
+
+	repository.CommitHistogram = commitHistogram
+
+	return activityIndex, vitalityBuckets(vitality, activityDays, vitalityBucketDays())
+}
+
+// calculateAPIActivity calculates the activity index and vitality of the
+// repository not cloned from the API of the code hosting, if supported.
+func calculateAPIActivity(ctx context.Context, repository Repository, logEntries *[]logEntry) (float64, []int) {
+	var message string
+
+	logger := repositoryLogger(repository)
+
+	activityDays := activityDays()
+	activityIndex, vitality, err := apiRepoActivity(ctx, repository, activityDays, time.Now())
+	if errors.Is(err, errNoAPIActivity) {
+		logger.Debug(err)
+		return 0, nil
+	}
+	if err != nil {
+		message = fmt.Sprintf("error calculating activity index from the API: %v", err)
+
+		logger.Warn(message)
+		addLogEntry(logEntries, repository.Name, message)
+		return 0, nil
 	}
+	message = fmt.Sprintf("activity index in the last %d days, from the API: %f", activityDays, activityIndex)
+	logger.Info(message)
+	addLogEntry(logEntries, repository.Name, message)
+
+	return activityIndex, vitalityBuckets(vitality, activityDays, vitalityBucketDays())
 }
 
-func validateRemoteFile(data []byte, fileRawURL string, pa PA, domain Domain) error {
+func validateRemoteFile(data []byte, fileRawURL string, repositoryURLs []string, pa PA, domain Domain) error {
 	parser, err := getRemoteFile(data, fileRawURL, pa, domain)
 	if err != nil {
 		return err
 	}
-	return validateFile(pa, parser, fileRawURL)
+	return validateFile(pa, parser, fileRawURL, repositoryURLs)
 }
 
 func getRemoteFile(data []byte, fileRawURL string, pa PA, domain Domain) (publiccode.Parser, error) {
 	parser := publiccode.NewParser()
 	parser.Strict = false
-	parser.RemoteBaseURL = strings.TrimRight(fileRawURL, viper.GetString("CRAWLED_FILENAME"))
+	parser.RemoteBaseURL = remoteBaseURL(fileRawURL, domain.crawledFilename())
 	err := parser.ParseInDomain(data, domain.Host, domain.UseTokenFor, domain.BasicAuth)
 	if err != nil {
 		log.Errorf("Error parsing publiccode.yml for %s.", fileRawURL)
@@ -471,16 +1200,63 @@ func getRemoteFile(data []byte, fileRawURL string, pa PA, domain Domain) (public
 	return *parser, nil
 }
 
+// errorIPAMismatch is a publiccode.yml whose codiceIPA isn't the one of
+// the publisher in the whitelist.
+type errorIPAMismatch struct {
+	fileRawURL string
+	codiceIPA  string
+	expected   string
+}
+
+func (e errorIPAMismatch) Error() string {
+	return "codiceIPA for: " + e.fileRawURL + " is " + e.codiceIPA + ", which differs from the one assigned to the org in the whitelist: " + e.expected
+}
+
 // validateFile will check if codiceIPA match
-// with relative entry in whitelist.
+// with relative entry in whitelist, and then if
+// the url is the repository at one of repositoryURLs.
 // Using `one` command this check will be skipped.
-func validateFile(pa PA, parser publiccode.Parser, fileRawURL string) error {
+func validateFile(pa PA, parser publiccode.Parser, fileRawURL string, repositoryURLs []string) error {
 	if !strings.EqualFold(
 		strings.TrimSpace(pa.CodiceIPA),
 		strings.TrimSpace(parser.PublicCode.It.Riuso.CodiceIPA),
 	) {
-		return errors.New("codiceIPA for: " + fileRawURL + " is " + parser.PublicCode.It.Riuso.CodiceIPA + ", which differs from the one assigned to the org in the whitelist: " + pa.CodiceIPA)
+		return errorIPAMismatch{fileRawURL, parser.PublicCode.It.Riuso.CodiceIPA, pa.CodiceIPA}
 	}
 
-	return nil
+	var declared string
+	if parser.PublicCode.URL != nil {
+		declared = parser.PublicCode.URL.String()
+	}
+
+	return checkRepositoryURL(declared, fileRawURL, repositoryURLs)
+}
+
+// The reasons of the repository_validation_failed counter.
+const (
+	failureHTTPError       = "http_error"
+	failureTooComplex      = "too_complex"
+	failureParseError      = "parse_error"
+	failureVersion         = "unsupported_version"
+	failureIPAMismatch     = "ipa_mismatch"
+	failureMissingRequired = "missing_required"
+	failureURLMismatch     = "url_mismatch"
+)
+
+// validationFailureReason returns the reason of err, returned by
+// validateRemoteFile, for the repository_validation_failed counter.
+func validationFailureReason(err error) string {
+	if _, ok := err.(errorIPAMismatch); ok {
+		return failureIPAMismatch
+	}
+	if _, ok := err.(errorURLMismatch); ok {
+		return failureURLMismatch
+	}
+
+	return failureParseError
+}
+
+// validationFailed counts a publiccode.yml rejected for reason.
+func (c *Crawler) validationFailed(reason string) {
+	metrics.IncCounterVec("repository_validation_failed", c.index, prometheus.Labels{"reason": reason})
 }
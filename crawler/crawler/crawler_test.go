@@ -1,11 +1,16 @@
 package crawler
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
+	"runtime"
 	"testing"
+	"time"
 
 	publiccode "github.com/italia/publiccode-parser-go"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -44,7 +49,7 @@ func TestIPAMatch(t *testing.T) {
 	// on both sides
 	for _, pa := range pas {
 		parser.PublicCode.It.Riuso.CodiceIPA = pa.CodiceIPA
-		err = validateFile(pa, parser, "")
+		err = validateFile(pa, parser, "", nil)
 		if err != nil {
 			t.Errorf("error comparing IPA codes %s", err)
 		}
@@ -53,11 +58,14 @@ func TestIPAMatch(t *testing.T) {
 	// it should thowns errors since they always mismatch
 	for _, pa := range pas {
 		parser.PublicCode.It.Riuso.CodiceIPA = pa.CodiceIPA + "x"
-		err = validateFile(pa, parser, "")
+		err = validateFile(pa, parser, "", nil)
 		if err == nil {
 			t.Errorf("error comparing IPA codes %v", err)
 		}
+		assert.Equal(t, failureIPAMismatch, validationFailureReason(err))
 	}
+
+	assert.Equal(t, failureParseError, validationFailureReason(publiccode.ErrorParseMulti{}))
 }
 
 func createFakeRepo(name, gitCloneURL string) (r Repository) {
@@ -87,3 +95,41 @@ func TestRemovingRepoAsBlacklisted(t *testing.T) {
 		assert.NotEmpty(t, repoListed[appendGitExt(entry)])
 	}
 }
+
+func TestIsDormant(t *testing.T) {
+	now := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+	defer viper.Set("MAX_INACTIVE_DAYS", nil)
+
+	viper.Set("MAX_INACTIVE_DAYS", 0)
+	assert.False(t, isDormant(now.AddDate(-5, 0, 0), now))
+
+	viper.Set("MAX_INACTIVE_DAYS", 365)
+	assert.True(t, isDormant(now.AddDate(-2, 0, 0), now))
+	assert.False(t, isDormant(now.AddDate(0, -6, 0), now))
+	assert.False(t, isDormant(time.Time{}, now))
+}
+
+func TestCrawlerWorkers(t *testing.T) {
+	defer viper.Set("CRAWLER_WORKERS", nil)
+
+	assert.Equal(t, runtime.NumCPU(), crawlerWorkers())
+	viper.Set("CRAWLER_WORKERS", 12)
+	assert.Equal(t, 12, crawlerWorkers())
+	viper.Set("CRAWLER_WORKERS", 0)
+	assert.Equal(t, runtime.NumCPU(), crawlerWorkers())
+}
+
+func TestDeleteByQueryFromESDryRun(t *testing.T) {
+	// There's no Elasticsearch client in dry run.
+	c := Crawler{DryRun: true}
+	assert.NoError(t, c.DeleteByQueryFromES("https://github.com/test/testrepo"))
+}
+
+func TestInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, interrupted(ctx))
+
+	cancel()
+	err := interrupted(ctx)
+	assert.True(t, errors.Is(err, context.Canceled), err)
+}
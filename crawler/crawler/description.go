@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"sort"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"github.com/spf13/viper"
+)
+
+// defaultDescriptionLanguages are the languages of the main description of
+// the software, in order of preference, overridden by DESCRIPTION_LANGUAGES.
+var defaultDescriptionLanguages = []string{"ita", "eng"}
+
+// searchableDescription is the description of the software in a single
+// language, indexed as the main searchable description.
+type searchableDescription struct {
+	LocalisedName    string   `json:"localisedName,omitempty"`
+	GenericName      string   `json:"genericName,omitempty"`
+	ShortDescription string   `json:"shortDescription,omitempty"`
+	LongDescription  string   `json:"longDescription,omitempty"`
+	Features         []string `json:"features,omitempty"`
+}
+
+// descriptionLanguages returns the languages of the main description in
+// order of preference, the first being the primary language of the catalog.
+func descriptionLanguages() []string {
+	if viper.IsSet("DESCRIPTION_LANGUAGES") {
+		return viper.GetStringSlice("DESCRIPTION_LANGUAGES")
+	}
+
+	return defaultDescriptionLanguages
+}
+
+// mainDescription returns the description in the first of languages
+// available in the publiccode.yml, or in the first available language in
+// alphabetical order if there's none. fallback is true if it's not in the
+// primary language. It returns nil if there are no descriptions.
+func mainDescription(descriptions map[string]publiccode.Desc, languages []string) (desc *searchableDescription, language string, fallback bool) {
+	if len(descriptions) == 0 {
+		return nil, "", false
+	}
+
+	for _, l := range languages {
+		if _, ok := descriptions[l]; ok {
+			language = l
+			break
+		}
+	}
+	if language == "" {
+		language = availableLanguages(descriptions)[0]
+	}
+
+	d := descriptions[language]
+	desc = &searchableDescription{
+		LocalisedName:    d.LocalisedName,
+		GenericName:      d.GenericName,
+		ShortDescription: d.ShortDescription,
+		LongDescription:  d.LongDescription,
+		Features:         d.Features,
+	}
+
+	return desc, language, len(languages) > 0 && language != languages[0]
+}
+
+// availableLanguages returns the languages of all the localized
+// descriptions, in alphabetical order.
+func availableLanguages(descriptions map[string]publiccode.Desc) []string {
+	available := make([]string, 0, len(descriptions))
+	for l := range descriptions {
+		available = append(available, l)
+	}
+	sort.Strings(available)
+
+	return available
+}
@@ -0,0 +1,42 @@
+package crawler
+
+import (
+	"testing"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainDescription(t *testing.T) {
+	languages := []string{"ita", "eng"}
+	ita := publiccode.Desc{ShortDescription: "Italiano"}
+	eng := publiccode.Desc{ShortDescription: "English"}
+	deu := publiccode.Desc{ShortDescription: "Deutsch"}
+	fra := publiccode.Desc{ShortDescription: "Français"}
+
+	desc, language, fallback := mainDescription(map[string]publiccode.Desc{"ita": ita, "eng": eng}, languages)
+	assert.Equal(t, "Italiano", desc.ShortDescription)
+	assert.Equal(t, "ita", language)
+	assert.False(t, fallback)
+
+	desc, language, fallback = mainDescription(map[string]publiccode.Desc{"eng": eng, "deu": deu}, languages)
+	assert.Equal(t, "English", desc.ShortDescription)
+	assert.Equal(t, "eng", language)
+	assert.True(t, fallback)
+
+	desc, language, fallback = mainDescription(map[string]publiccode.Desc{"fra": fra, "deu": deu}, languages)
+	assert.Equal(t, "Deutsch", desc.ShortDescription)
+	assert.Equal(t, "deu", language)
+	assert.True(t, fallback)
+
+	desc, language, fallback = mainDescription(nil, languages)
+	assert.Nil(t, desc)
+	assert.Equal(t, "", language)
+	assert.False(t, fallback)
+}
+
+func TestAvailableLanguages(t *testing.T) {
+	descriptions := map[string]publiccode.Desc{"ita": {}, "eng": {}, "deu": {}}
+	assert.Equal(t, []string{"deu", "eng", "ita"}, availableLanguages(descriptions))
+	assert.Empty(t, availableLanguages(nil))
+}
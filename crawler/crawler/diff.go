@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	es "github.com/olivere/elastic"
+)
+
+// CrawlSnapshot is the software of an index at a point in time, stored to
+// diff it with a later crawl.
+type CrawlSnapshot struct {
+	Index     string             `json:"index"`
+	Timestamp string             `json:"timestamp"`
+	Software  []SnapshotSoftware `json:"software"`
+}
+
+// SnapshotSoftware identifies a software of a snapshot and the content of
+// its publiccode.yml.
+type SnapshotSoftware struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	FileRawURL string `json:"fileRawURL"`
+	Hash       string `json:"publiccodeHash"`
+}
+
+// CrawlDiff is what changed between two snapshots.
+type CrawlDiff struct {
+	From    string             `json:"from"`
+	To      string             `json:"to"`
+	Added   []SnapshotSoftware `json:"added"`
+	Removed []SnapshotSoftware `json:"removed"`
+	Changed []SnapshotSoftware `json:"changed"`
+}
+
+// publiccodeHash returns the hash of the publiccode.yml bytes, stored in
+// saveToES to tell which software changed between two crawls.
+func publiccodeHash(data []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(data))
+}
+
+// Snapshot scrolls the software of index, the alias or an index of a
+// previous crawl, into a CrawlSnapshot.
+func (c *Crawler) Snapshot(index string) (CrawlSnapshot, error) {
+	snapshot := CrawlSnapshot{
+		Index:     index,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Software:  []SnapshotSoftware{},
+	}
+
+	fields := es.NewFetchSourceContext(true).Include("id", "fileRawURL", "publiccodeHash", "rawPubliccode", "publiccode.name")
+	scroll := c.es.Scroll(index).Type("software").FetchSourceContext(fields).Size(500)
+	for {
+		results, err := scroll.Do(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return snapshot, err
+		}
+
+		for _, hit := range results.Hits.Hits {
+			var doc struct {
+				ID             string `json:"id"`
+				FileRawURL     string `json:"fileRawURL"`
+				PubliccodeHash string `json:"publiccodeHash"`
+				RawPubliccode  string `json:"rawPubliccode"`
+				Publiccode     struct {
+					Name string `json:"name"`
+				} `json:"publiccode"`
+			}
+			if err := json.Unmarshal(*hit.Source, &doc); err != nil {
+				return snapshot, err
+			}
+
+			// The software indexed before publiccodeHash was stored only
+			// have the raw file.
+			hash := doc.PubliccodeHash
+			if hash == "" && doc.RawPubliccode != "" {
+				hash = publiccodeHash([]byte(doc.RawPubliccode))
+			}
+			id := doc.ID
+			if id == "" {
+				id = hit.Id
+			}
+			snapshot.Software = append(snapshot.Software, SnapshotSoftware{
+				ID:         id,
+				Name:       doc.Publiccode.Name,
+				FileRawURL: doc.FileRawURL,
+				Hash:       hash,
+			})
+		}
+	}
+
+	return snapshot, nil
+}
+
+// LoadSnapshot returns the snapshot in fname, if it ends with .json, or
+// else the one of the index named so.
+func (c *Crawler) LoadSnapshot(name string) (CrawlSnapshot, error) {
+	if strings.HasSuffix(name, ".json") {
+		return ReadSnapshot(name)
+	}
+	return c.Snapshot(name)
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot.
+func ReadSnapshot(fname string) (CrawlSnapshot, error) {
+	var snapshot CrawlSnapshot
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("invalid snapshot %s: %w", fname, err)
+	}
+
+	return snapshot, nil
+}
+
+// WriteSnapshot saves the snapshot to fname, to diff it with the next crawl.
+func WriteSnapshot(snapshot CrawlSnapshot, fname string) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, data, 0644)
+}
+
+// DiffSnapshots returns the software added, removed and with a different
+// publiccode.yml in to, compared to from, sorted by ID.
+// The software without a hash in either snapshot are never reported as
+// changed.
+func DiffSnapshots(from, to CrawlSnapshot) CrawlDiff {
+	diff := CrawlDiff{
+		From:    from.Index,
+		To:      to.Index,
+		Added:   []SnapshotSoftware{},
+		Removed: []SnapshotSoftware{},
+		Changed: []SnapshotSoftware{},
+	}
+
+	before := make(map[string]SnapshotSoftware, len(from.Software))
+	for _, software := range from.Software {
+		before[software.ID] = software
+	}
+
+	for _, software := range to.Software {
+		old, ok := before[software.ID]
+		delete(before, software.ID)
+
+		if !ok {
+			diff.Added = append(diff.Added, software)
+		} else if old.Hash != "" && software.Hash != "" && old.Hash != software.Hash {
+			diff.Changed = append(diff.Changed, software)
+		}
+	}
+	for _, software := range before {
+		diff.Removed = append(diff.Removed, software)
+	}
+
+	for _, list := range [][]SnapshotSoftware{diff.Added, diff.Removed, diff.Changed} {
+		list := list
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+
+	return diff
+}
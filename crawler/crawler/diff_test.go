@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	es "github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	from := CrawlSnapshot{Index: "yesterday", Software: []SnapshotSoftware{
+		{ID: "b", Hash: "1"},
+		{ID: "a", Hash: "1"},
+		{ID: "c", Hash: "1"},
+		{ID: "d", Hash: ""},
+	}}
+	to := CrawlSnapshot{Index: "today", Software: []SnapshotSoftware{
+		{ID: "a", Hash: "2"},
+		{ID: "c", Hash: "1"},
+		{ID: "d", Hash: "1"},
+		{ID: "f", Hash: "1"},
+		{ID: "e", Hash: "1"},
+	}}
+
+	diff := DiffSnapshots(from, to)
+	assert.Equal(t, "yesterday", diff.From)
+	assert.Equal(t, "today", diff.To)
+	assert.Equal(t, []SnapshotSoftware{{ID: "e", Hash: "1"}, {ID: "f", Hash: "1"}}, diff.Added)
+	assert.Equal(t, []SnapshotSoftware{{ID: "b", Hash: "1"}}, diff.Removed)
+	assert.Equal(t, []SnapshotSoftware{{ID: "a", Hash: "2"}}, diff.Changed)
+
+	diff = DiffSnapshots(to, to)
+	assert.Empty(t, diff.Added)
+	assert.Empty(t, diff.Removed)
+	assert.Empty(t, diff.Changed)
+}
+
+func TestSnapshot(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/publiccode/software/_search" {
+			// The scroll is over.
+			fmt.Fprint(w, `{"_scroll_id": "1", "hits": {"total": 2, "hits": []}}`)
+			return
+		}
+		fmt.Fprint(w, `{"_scroll_id": "1", "hits": {"total": 2, "hits": [
+			{"_id": "a", "_source": {"id": "a", "fileRawURL": "https://example.org/a", "publiccodeHash": "abc", "publiccode": {"name": "A"}}},
+			{"_id": "b", "_source": {"id": "b", "rawPubliccode": "name: B\n"}}]}}`)
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	assert.NoError(t, err)
+	c := Crawler{es: client}
+
+	snapshot, err := c.Snapshot("publiccode")
+	assert.NoError(t, err)
+	assert.Equal(t, "publiccode", snapshot.Index)
+	assert.Equal(t, []SnapshotSoftware{
+		{ID: "a", Name: "A", FileRawURL: "https://example.org/a", Hash: "abc"},
+		{ID: "b", Hash: publiccodeHash([]byte("name: B\n"))},
+	}, snapshot.Software)
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "snapshot.json")
+	assert.NoError(t, WriteSnapshot(snapshot, fname))
+	saved, err := c.LoadSnapshot(fname)
+	assert.NoError(t, err)
+	assert.Equal(t, snapshot, saved)
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 )
 
@@ -17,10 +20,33 @@ type Domain struct {
 	Host        string   `yaml:"host"`
 	UseTokenFor []string `yaml:"use-token-for"`
 	BasicAuth   []string `yaml:"basic-auth"`
+	// API of a self-hosted instance whose host doesn't tell it (eg. "gitea").
+	Type string `yaml:"type"`
+	// Timeout of git clone and fetch, overrides CLONE_TIMEOUT.
+	CloneTimeout time.Duration `yaml:"clone-timeout"`
+	// DANGEROUS: don't verify the TLS certificates of this host, only meant
+	// for pilots of instances with self-signed certificates.
+	InsecureSkipVerify bool `yaml:"insecure-skip-verify"`
+	// PEM file with the CAs of the TLS certificates of this host, trusted
+	// besides the ones of the system (eg. an internal CA).
+	CACertFile string `yaml:"ca-cert-file"`
+	// Name of the file crawled on this host, overrides CRAWLED_FILENAME.
+	CrawledFilename string `yaml:"crawled-filename"`
+	// Requests per second to this host and its API host, with bursts of
+	// Burst requests. 0 means no limit.
+	RateLimit float64 `yaml:"rate-limit"`
+	Burst     int     `yaml:"burst"`
 }
 
-// API returns a Domain without tld.
+// API returns the Type of the Domain or, if not set, the Domain without tld.
 func (domain Domain) API() string {
+	if domain.Type != "" {
+		return domain.Type
+	}
+	if domain.Host == "dev.azure.com" {
+		return "azure"
+	}
+
 	truncateIndex := strings.LastIndexAny(domain.Host, ".")
 	// It is already an API without tld.
 	if truncateIndex == -1 {
@@ -30,6 +56,31 @@ func (domain Domain) API() string {
 	return domain.Host[:truncateIndex]
 }
 
+// crawledFilename returns the name of the file crawled on the domain, the
+// crawled-filename in domains.yml or CRAWLED_FILENAME.
+func (domain Domain) crawledFilename() string {
+	if domain.CrawledFilename != "" {
+		return domain.CrawledFilename
+	}
+
+	return viper.GetString("CRAWLED_FILENAME")
+}
+
+// remoteBaseURL returns the URL of the directory of the crawled file at
+// fileRawURL, named filename, against which the parser resolves the relative
+// paths in it. The query is kept, eg. the branch of Bitbucket Server.
+// fileRawURL is returned as is if its path doesn't end with filename (eg.
+// Azure DevOps, where the path of the file is in the query).
+func remoteBaseURL(fileRawURL, filename string) string {
+	u, err := url.Parse(fileRawURL)
+	if err != nil || filename == "" || !strings.HasSuffix(u.Path, "/"+filename) {
+		return fileRawURL
+	}
+	u.Path = strings.TrimSuffix(u.Path, filename)
+
+	return u.String()
+}
+
 // ReadAndParseDomains read domainsFile and return the parsed content in a Domain slice.
 func ReadAndParseDomains(domainsFile string) ([]Domain, error) {
 	// Open and read domains file list.
@@ -42,6 +93,9 @@ func ReadAndParseDomains(domainsFile string) ([]Domain, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error in parsing %s file: %v", domainsFile, err)
 	}
+	if err := validateDomains(domains); err != nil {
+		return nil, fmt.Errorf("invalid %s file: %v", domainsFile, err)
+	}
 	log.Infof("Loaded and parsed %s", domainsFile)
 
 	return domains, err
@@ -59,20 +113,155 @@ func parseDomainsFile(data []byte) ([]Domain, error) {
 	return domains, err
 }
 
-func (domain Domain) processAndGetNextURL(url string, repositories chan Repository, pa PA) (string, error) {
+// validateDomains returns an error listing all the problems of domains:
+// hosts not valid or repeated, types without a handler, use-token-for
+// without credentials and malformed credentials or limits.
+// The credentials are never part of the error.
+func validateDomains(domains []Domain) error {
+	var problems []string
+	hosts := map[string]bool{}
+	for i, domain := range domains {
+		problem := func(format string, args ...interface{}) {
+			problems = append(problems, fmt.Sprintf("domain #%d (%s): ", i+1, domain.Host)+fmt.Sprintf(format, args...))
+		}
+
+		if !isHostname(domain.Host) {
+			problem("host %q is not a hostname", domain.Host)
+			continue
+		}
+		if hosts[domain.Host] {
+			problem("host listed more than once")
+		}
+		hosts[domain.Host] = true
+
+		if _, ok := clientAPIs[domain.API()]; !ok {
+			problem("unknown type %q, set type to one of %s", domain.API(), strings.Join(knownAPIs(), ", "))
+		}
+
+		var credentials int
+		for n, credential := range domain.BasicAuth {
+			if strings.ContainsAny(credential, " \t\r\n") {
+				problem("basic-auth credential #%d contains spaces", n+1)
+			}
+			if credential != "" {
+				credentials++
+			}
+		}
+		if len(domain.UseTokenFor) > 0 && credentials == 0 {
+			problem("use-token-for is set without basic-auth credentials")
+		}
+		for _, host := range domain.UseTokenFor {
+			if !isHostname(host) {
+				problem("use-token-for host %q is not a hostname", host)
+			}
+		}
+
+		if domain.RateLimit < 0 || domain.Burst < 0 {
+			problem("rate-limit and burst can't be negative")
+		}
+		if domain.CloneTimeout < 0 {
+			problem("clone-timeout can't be negative")
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// isHostname returns whether host is a host name, without scheme and path.
+func isHostname(host string) bool {
+	u, err := url.Parse("//" + host)
+
+	return host != "" && err == nil && u.Host == host && u.Hostname() != "" && !strings.ContainsAny(host, " @")
+}
+
+// knownAPIs returns the APIs with a registered handler, the types of domains.yml.
+func knownAPIs() []string {
+	apis := make([]string, 0, len(clientAPIs))
+	for api := range clientAPIs {
+		apis = append(apis, api)
+	}
+	sort.Strings(apis)
+
+	return apis
+}
+
+// processAndGetNextURL adds the repositories in the page at url to
+// repositories and returns the urls of the next and last pages. With
+// SKIP_FORKS the forks are left out, unless their publiccode.yml is their own.
+func (domain Domain) processAndGetNextURL(url string, repositories chan Repository, pa PA) (string, string, error) {
 	crawler, err := GetClientAPICrawler(domain.API())
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	return crawler(domain, url, repositories, pa)
+	if !skipForks() && !publiccodeIndex() {
+		return crawler(domain, url, repositories, pa)
+	}
+
+	var next, last string
+	err = pipeRepositories(repositories, skipForks(), func(listed chan Repository) error {
+		next, last, err = crawler(domain, url, listed, pa)
+		return err
+	})
+
+	return next, last, err
+}
+
+// pipeRepositories runs list, passing the repositories it lists through
+// forwardRepositories before they reach repositories.
+func pipeRepositories(repositories chan Repository, skipForks bool, list func(chan Repository) error) error {
+	listed := make(chan Repository)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		forwardRepositories(listed, repositories, skipForks)
+	}()
+
+	err := list(listed)
+	close(listed)
+	<-done
+
+	return err
 }
 
+// errRepositorySkipped is wrapped by the errors of the API clients rejecting
+// a repository on purpose, eg. because it's private or empty.
+var errRepositorySkipped = errors.New("repository skipped")
+
+// processSingleRepo adds the repository at url to repositories. If the API
+// lookup fails it tries the fallbackBranches, unless the repository was
+// skipped on purpose.
 func (domain Domain) processSingleRepo(url string, repositories chan Repository, pa PA) error {
 	crawler, err := GetSingleClientAPICrawler(domain.API())
 	if err != nil {
 		return err
 	}
-	return crawler(domain, url, repositories, pa)
+
+	err = pipeRepositories(repositories, false, func(listed chan Repository) error {
+		return crawler(domain, url, listed, pa)
+	})
+	if err == nil || errors.Is(err, errRepositorySkipped) {
+		return err
+	}
+
+	log.Warnf("%s: API lookup failed (%v), trying the %s branches", url, err, strings.Join(fallbackBranches, " and "))
+	if fallbackErr := domain.fallbackRepository(url, repositories, pa); fallbackErr != nil {
+		log.Warnf("%s: %v", url, fallbackErr)
+		return err
+	}
+
+	return nil
+}
+
+// splitSubpath removes from u the fragment with the directory of the software
+// in the repository (eg. https://github.com/org/repo#apps/app) and returns it.
+func splitSubpath(u *url.URL) string {
+	subpath := strings.Trim(u.Fragment, "/")
+	u.Fragment = ""
+
+	return subpath
 }
 
 func (domain Domain) generateAPIURLs(u string) ([]string, error) {
@@ -108,6 +297,12 @@ func (c *Crawler) KnownHost(link string) (*Domain, error) {
 	} else if IsGitlab(link) {
 		log.Infof("%s - API inferred: %s", link, "gitlab")
 		return &Domain{Host: "gitlab"}, nil
+	} else if IsAzure(link) {
+		log.Infof("%s - API inferred: %s", link, "azure")
+		return &Domain{Host: "dev.azure.com"}, nil
+	} else if IsGitea(link) {
+		log.Infof("%s - API inferred: %s", link, "gitea")
+		return &Domain{Host: u.Hostname(), Type: "gitea"}, nil
 	}
 
 	return &Domain{}, errors.New("unable to detect code hosting platform: " + u.Hostname())
@@ -2,9 +2,12 @@ package crawler
 
 import (
 	"io/ioutil"
+	"net/url"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
 )
 
 // IsGithub returns "true" if the url can use Github API.
@@ -41,3 +44,55 @@ func TestParseDomainsFile(t *testing.T) {
 
 	}
 }
+
+func TestSplitSubpath(t *testing.T) {
+	u, _ := url.Parse("https://github.com/org/repo#/apps/app/")
+	assert.Equal(t, "apps/app", splitSubpath(u))
+	assert.Equal(t, "https://github.com/org/repo", u.String())
+
+	u, _ = url.Parse("https://github.com/org/repo")
+	assert.Equal(t, "", splitSubpath(u))
+}
+
+func TestCrawledFilename(t *testing.T) {
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	assert.Equal(t, "publiccode.yml", Domain{Host: "github.com"}.crawledFilename())
+	assert.Equal(t, "publiccode.yaml", Domain{Host: "gitlab.example.org", CrawledFilename: "publiccode.yaml"}.crawledFilename())
+}
+
+func TestRemoteBaseURL(t *testing.T) {
+	assert.Equal(t, "https://gitlab.example.org/comune/app/raw/main/apps/web/",
+		remoteBaseURL("https://gitlab.example.org/comune/app/raw/main/apps/web/publiccode.yaml", "publiccode.yaml"))
+	// The query of Bitbucket Server is the branch, kept for the relative paths.
+	assert.Equal(t, "https://bitbucket.example.org/projects/KEY/repos/app/raw/?at=refs%2Fheads%2Fmain",
+		remoteBaseURL("https://bitbucket.example.org/projects/KEY/repos/app/raw/publiccode.yml?at=refs%2Fheads%2Fmain", "publiccode.yml"))
+	// Another file name, or the one of Azure DevOps in the query.
+	azure := "https://dev.azure.com/comune/servizi/_apis/git/repositories/app/items?path=%2Fpubliccode.yml"
+	assert.Equal(t, azure, remoteBaseURL(azure, "publiccode.yml"))
+}
+
+func TestValidateDomains(t *testing.T) {
+	RegisterClientAPIs()
+
+	assert.NoError(t, validateDomains([]Domain{
+		{Host: "github.com", UseTokenFor: []string{"api.github.com"}, BasicAuth: []string{"user:token"}},
+		{Host: "bitbucket.org", BasicAuth: []string{""}},
+		{Host: "gitea.example.org:3000", Type: "gitea"},
+	}))
+
+	err := validateDomains([]Domain{
+		{Host: "https://gitlab.com/"},
+		{Host: "github.com", UseTokenFor: []string{"api.github.com"}, BasicAuth: []string{""}},
+		{Host: "git.example.org", BasicAuth: []string{"user: secret"}, RateLimit: -1},
+		{Host: "github.com"},
+	})
+	assert.EqualError(t, err, `domain #1 (https://gitlab.com/): host "https://gitlab.com/" is not a hostname; `+
+		`domain #2 (github.com): use-token-for is set without basic-auth credentials; `+
+		`domain #3 (git.example.org): unknown type "git.example", set type to one of azure, bitbucket, bitbucket-server, gitea, github, gitlab; `+
+		`domain #3 (git.example.org): basic-auth credential #1 contains spaces; `+
+		`domain #3 (git.example.org): rate-limit and burst can't be negative; `+
+		`domain #4 (github.com): host listed more than once`)
+	assert.NotContains(t, err.Error(), "secret")
+}
@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Policies for the documents of different repositories having the same ID
+// in a crawl, chosen with DUPLICATE_ID_POLICY. "first" and "last" follow the
+// order of the publiccode.yml URLs, not the processing one, so the outcome
+// doesn't depend on the scheduling of the workers.
+const (
+	duplicateFirstWins = "first-wins"
+	duplicateLastWins  = "last-wins"
+	duplicateMerge     = "merge"
+
+	defaultDuplicateIDPolicy = duplicateLastWins
+)
+
+// duplicateIDPolicy returns the configured DUPLICATE_ID_POLICY.
+func duplicateIDPolicy() string {
+	if !viper.IsSet("DUPLICATE_ID_POLICY") {
+		return defaultDuplicateIDPolicy
+	}
+
+	policy := viper.GetString("DUPLICATE_ID_POLICY")
+	switch policy {
+	case duplicateFirstWins, duplicateLastWins, duplicateMerge:
+		return policy
+	}
+
+	log.Warnf("Unknown DUPLICATE_ID_POLICY %q, using %s", policy, defaultDuplicateIDPolicy)
+	return defaultDuplicateIDPolicy
+}
+
+// documentSource is a repository whose document got an ID in the crawl.
+type documentSource struct {
+	url string
+
+	// doc is only kept for the merge policy.
+	doc Document
+}
+
+// documentIDs records the IDs of the documents indexed in a crawl, to detect
+// the repositories colliding on the same ID. It's shared by all the
+// ProcessRepositories workers.
+type documentIDs struct {
+	mutex sync.Mutex
+
+	sources map[string][]documentSource
+}
+
+// resolve records the document doc with id of the repository with the
+// publiccode.yml at url. It returns the document to index for id according
+// to policy, nil if the one already indexed wins, and whether url collides
+// with other repositories.
+func (d *documentIDs) resolve(id, url string, doc Document, policy string) (Document, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.sources == nil {
+		d.sources = make(map[string][]documentSource)
+	}
+
+	source := documentSource{url: url}
+	if policy == duplicateMerge {
+		source.doc = doc
+	}
+
+	sources := d.sources[id]
+	found := false
+	for i := range sources {
+		// The same repository again, eg. listed by more publishers.
+		if sources[i].url == url {
+			sources[i] = source
+			found = true
+		}
+	}
+	if !found {
+		sources = append(sources, source)
+		sort.Slice(sources, func(i, j int) bool { return sources[i].url < sources[j].url })
+	}
+	d.sources[id] = sources
+
+	if len(sources) == 1 {
+		return doc, false
+	}
+
+	for _, s := range sources {
+		if s.url != url {
+			log.Warnf("Document ID %s of %s collides with %s, applying %s", id, url, s.url, policy)
+		}
+	}
+
+	switch policy {
+	case duplicateFirstWins:
+		if sources[0].url != url {
+			return nil, true
+		}
+	case duplicateLastWins:
+		if sources[len(sources)-1].url != url {
+			return nil, true
+		}
+	case duplicateMerge:
+		return mergeDocuments(sources), true
+	}
+
+	return doc, true
+}
+
+// mergeDocuments returns the document of the first source with the fields
+// it's missing taken from the next ones, in order.
+func mergeDocuments(sources []documentSource) Document {
+	merged := Document{}
+	for _, s := range sources {
+		for k, v := range s.doc {
+			if _, ok := merged[k]; !ok {
+				merged[k] = v
+			}
+		}
+	}
+
+	return merged
+}
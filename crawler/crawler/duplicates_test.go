@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentIDsResolve(t *testing.T) {
+	// The same clone URL listed with two branches gets the same ID.
+	a := Repository{
+		GitCloneURL: "https://github.com/example/software.git",
+		FileRawURL:  "https://raw.githubusercontent.com/example/software/master/publiccode.yml",
+	}
+	b := Repository{
+		GitCloneURL: "https://github.com/example/software.git",
+		FileRawURL:  "https://raw.githubusercontent.com/example/software/stable/publiccode.yml",
+	}
+	id := a.generateID()
+	assert.Equal(t, id, b.generateID())
+
+	docA := Document{"name": "A", "vitalityScore": 10.0}
+	docB := Document{"name": "B", "dormant": true}
+
+	for _, order := range [][]Repository{{a, b}, {b, a}} {
+		docs := map[string]Document{a.FileRawURL: docA, b.FileRawURL: docB}
+
+		written := map[string]Document{}
+		for _, policy := range []string{duplicateFirstWins, duplicateLastWins, duplicateMerge} {
+			var ids documentIDs
+			var indexed Document
+			for i, repo := range order {
+				doc, collision := ids.resolve(id, repo.FileRawURL, docs[repo.FileRawURL], policy)
+				assert.Equal(t, i == 1, collision)
+				if doc != nil {
+					indexed = doc
+				}
+			}
+			written[policy] = indexed
+		}
+
+		assert.Equal(t, docA, written[duplicateFirstWins])
+		assert.Equal(t, docB, written[duplicateLastWins])
+		assert.Equal(t, Document{"name": "A", "vitalityScore": 10.0, "dormant": true}, written[duplicateMerge])
+	}
+
+	// The same repository processed again is not a collision.
+	var ids documentIDs
+	_, collision := ids.resolve(id, a.FileRawURL, docA, duplicateFirstWins)
+	assert.False(t, collision)
+	doc, collision := ids.resolve(id, a.FileRawURL, docA, duplicateFirstWins)
+	assert.False(t, collision)
+	assert.Equal(t, docA, doc)
+}
+
+func TestDuplicateIDPolicy(t *testing.T) {
+	defer viper.Set("DUPLICATE_ID_POLICY", nil)
+
+	assert.Equal(t, duplicateLastWins, duplicateIDPolicy())
+	viper.Set("DUPLICATE_ID_POLICY", "merge")
+	assert.Equal(t, duplicateMerge, duplicateIDPolicy())
+	viper.Set("DUPLICATE_ID_POLICY", "random")
+	assert.Equal(t, duplicateLastWins, duplicateIDPolicy())
+}
@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// Types of Event.
+const (
+	eventProcessing = "processing"
+	eventValid      = "valid"
+	eventInvalid    = "invalid"
+	eventCloned     = "cloned"
+	eventSaved      = "saved"
+)
+
+// eventsBuffer is the number of events buffered for each client before
+// dropping them.
+const eventsBuffer = 100
+
+// Event is a step in the processing of a repository, streamed as JSON to
+// the clients of the /events websocket.
+type Event struct {
+	RunID      string `json:"runID"`
+	Datetime   string `json:"datetime"`
+	Repository string `json:"repository"`
+	Type       string `json:"type"`
+	Message    string `json:"message,omitempty"`
+}
+
+// eventBroadcaster fans out the events to all the connected clients.
+type eventBroadcaster struct {
+	mutex   sync.Mutex
+	clients map[chan Event]bool
+}
+
+// events is the broadcaster of the events of all the crawls in this process.
+var events = &eventBroadcaster{}
+
+// subscribe returns a channel receiving the events published from now on.
+func (b *eventBroadcaster) subscribe() chan Event {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.clients == nil {
+		b.clients = make(map[chan Event]bool)
+	}
+
+	ch := make(chan Event, eventsBuffer)
+	b.clients[ch] = true
+
+	return ch
+}
+
+// unsubscribe stops sending events to ch and closes it.
+func (b *eventBroadcaster) unsubscribe(ch chan Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.clients, ch)
+	close(ch)
+}
+
+// publish sends the event to all the clients, without waiting for the slow
+// ones: if their buffer is full the event is dropped.
+func (b *eventBroadcaster) publish(event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for ch := range b.clients {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// handler streams the events to a websocket client until it disconnects.
+func (b *eventBroadcaster) handler() http.Handler {
+	return websocket.Handler(func(ws *websocket.Conn) {
+		ch := b.subscribe()
+		defer b.unsubscribe(ch)
+
+		// The clients send nothing, the reads fail once they disconnect,
+		// even if no event is sent in the meantime.
+		disconnected := make(chan error, 1)
+		go func() {
+			var message []byte
+			for {
+				if err := websocket.Message.Receive(ws, &message); err != nil {
+					disconnected <- err
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case event := <-ch:
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					log.Debugf("events client disconnected: %v", err)
+					return
+				}
+			case err := <-disconnected:
+				log.Debugf("events client disconnected: %v", err)
+				return
+			}
+		}
+	})
+}
+
+// newRunID returns an identifier of a crawl, made of its start time and a random suffix.
+func newRunID() string {
+	n, err := defaultRandom.Intn(1000000)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return fmt.Sprintf("%s-%06d", time.Now().UTC().Format("20060102T150405Z"), n)
+}
+
+// emit publishes an event about repository.
+func (c *Crawler) emit(repository Repository, eventType, message string) {
+	events.publish(Event{
+		RunID:      c.runID,
+		Datetime:   time.Now().UTC().Format(time.RFC3339),
+		Repository: repository.Name,
+		Type:       eventType,
+		Message:    message,
+	})
+}
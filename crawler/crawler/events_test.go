@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestEventsWebsocket(t *testing.T) {
+	b := &eventBroadcaster{}
+	ts := httptest.NewServer(b.handler())
+	defer ts.Close()
+
+	ws, err := websocket.Dial(strings.Replace(ts.URL, "http", "ws", 1), "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// Wait for the client to be subscribed.
+	for i := 0; i < 100; i++ {
+		b.mutex.Lock()
+		n := len(b.clients)
+		b.mutex.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.publish(Event{RunID: "run", Repository: "vendor/repo", Type: eventValid})
+
+	var event Event
+	assert.NoError(t, websocket.JSON.Receive(ws, &event))
+	assert.Equal(t, "run", event.RunID)
+	assert.Equal(t, "vendor/repo", event.Repository)
+	assert.Equal(t, eventValid, event.Type)
+}
+
+func TestEventsDropForSlowClients(t *testing.T) {
+	b := &eventBroadcaster{}
+	ch := b.subscribe()
+
+	// publish never blocks, even if nobody reads.
+	for i := 0; i < eventsBuffer*2; i++ {
+		b.publish(Event{Type: eventProcessing})
+	}
+	assert.Len(t, ch, eventsBuffer)
+
+	b.unsubscribe(ch)
+}
+
+func TestEventsUnsubscribeDisconnected(t *testing.T) {
+	b := &eventBroadcaster{}
+	ts := httptest.NewServer(b.handler())
+	defer ts.Close()
+
+	ws, err := websocket.Dial(strings.Replace(ts.URL, "http", "ws", 1), "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := func() int {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		return len(b.clients)
+	}
+	for i := 0; i < 100 && clients() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 1, clients())
+
+	// The client is unsubscribed once gone, without waiting for an event.
+	ws.Close()
+	for i := 0; i < 100 && clients() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, clients())
+}
@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// defaultFeedDays is the number of days of software in the feed, if
+// FEED_DAYS is unset.
+const defaultFeedDays = 30
+
+// feedMaxEntries is the maximum number of software in the feed.
+const feedMaxEntries = 500
+
+// feedID is the Atom ID of the feed, and the prefix of the ones of its entries.
+const feedID = "tag:developers.italia.it,2020:software"
+
+// softwareTimes are the times the indexed software was first seen and its
+// publiccode.yml last changed, with the publiccode.yml they refer to.
+type softwareTimes struct {
+	FirstSeen     string `json:"firstSeen"`
+	LastModified  string `json:"lastModified"`
+	RawPubliccode string `json:"rawPubliccode"`
+}
+
+// feedSoftware is the subset of a software document shown in the feed.
+type feedSoftware struct {
+	ID           string                 `json:"id"`
+	FirstSeen    string                 `json:"firstSeen"`
+	LastModified string                 `json:"lastModified"`
+	Publisher    string                 `json:"it-riuso-codiceIPA-label"`
+	Description  *searchableDescription `json:"description"`
+	PublicCode   struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"publiccode"`
+}
+
+// atomFeed is an Atom feed (RFC 4287).
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published,omitempty"`
+	Updated   string      `xml:"updated"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Links     []atomLink  `xml:"link"`
+	Summary   string      `xml:"summary,omitempty"`
+}
+
+// feedDays returns the number of days of software in the feed, FEED_DAYS
+// or defaultFeedDays.
+func feedDays() int {
+	if !viper.IsSet("FEED_DAYS") {
+		return defaultFeedDays
+	}
+
+	days := viper.GetInt("FEED_DAYS")
+	if days < 1 {
+		log.Warnf("Invalid FEED_DAYS %d, using %d", days, defaultFeedDays)
+		return defaultFeedDays
+	}
+
+	return days
+}
+
+// feedFile returns the path of the feed of the recent software.
+func feedFile() string {
+	return path.Join(viper.GetString("OUTPUT_DIR"), "feed.atom")
+}
+
+// storedTimes returns the times and the publiccode.yml of the indexed
+// document of repository, empty if it was never indexed. In preview they come
+// from the live index, as the preview one starts empty and replaces it on
+// promote.
+func (c *Crawler) storedTimes(repository Repository) (softwareTimes, error) {
+	var stored softwareTimes
+
+	index := c.index
+	if c.preview {
+		index = viper.GetString("ELASTIC_PUBLICCODE_INDEX")
+	}
+
+	doc, err := c.es.Get().
+		Index(index).
+		Type("software").
+		Id(repository.generateID()).
+		FetchSourceContext(es.NewFetchSourceContext(true).Include("firstSeen", "lastModified", "rawPubliccode")).
+		Do(context.Background())
+	if es.IsNotFound(err) {
+		return stored, nil
+	}
+	if err != nil {
+		return stored, err
+	}
+	if doc.Source == nil {
+		return stored, nil
+	}
+
+	err = json.Unmarshal(*doc.Source, &stored)
+
+	return stored, err
+}
+
+// lastSeen returns the lastSeen of the software found by a crawl at now.
+// The software not found anymore keeps the one of the last crawl finding it.
+func lastSeen(now time.Time) string {
+	return now.UTC().Format(time.RFC3339)
+}
+
+// softwareTimestamps returns the firstSeen and lastModified of the software
+// with the publiccode.yml data indexed at now. The stored ones are kept,
+// unless data changed.
+func softwareTimestamps(stored softwareTimes, data []byte, now time.Time) (firstSeen, lastModified string) {
+	firstSeen, lastModified = stored.FirstSeen, stored.LastModified
+
+	nowRFC3339 := now.UTC().Format(time.RFC3339)
+	if firstSeen == "" {
+		firstSeen = nowRFC3339
+	}
+	if lastModified == "" || stored.RawPubliccode != string(data) {
+		lastModified = nowRFC3339
+	}
+
+	return firstSeen, lastModified
+}
+
+// ExportFeed writes to fname the Atom feed of the software added or changed
+// in the last FEED_DAYS days, most recent first.
+func (c *Crawler) ExportFeed(fname string) error {
+	now := time.Now()
+	since := now.AddDate(0, 0, -feedDays())
+
+	res, err := c.es.Search().
+		Index(viper.GetString("ELASTIC_PUBLICCODE_INDEX")).
+		Type("software").
+		Query(es.NewRangeQuery("lastModified").Gte(since.UTC().Format(time.RFC3339))).
+		Sort("lastModified", false).
+		Size(feedMaxEntries).
+		Do(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var software []feedSoftware
+	for _, hit := range res.Hits.Hits {
+		var sw feedSoftware
+		if err := json.Unmarshal(*hit.Source, &sw); err != nil {
+			log.Errorf("Skipping software %s in the feed: %v", hit.Id, err)
+			continue
+		}
+		software = append(software, sw)
+	}
+
+	data, err := renderFeed(software, viper.GetString("FEED_URL"), now)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, data, 0644)
+}
+
+// renderFeed returns the Atom feed of software, published at feedURL if
+// not empty, updated at now.
+func renderFeed(software []feedSoftware, feedURL string, now time.Time) ([]byte, error) {
+	feed := atomFeed{
+		ID:      feedID,
+		Title:   "Developers Italia - recent software",
+		Updated: now.UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: "Developers Italia"},
+	}
+	if feedURL != "" {
+		feed.Links = append(feed.Links, atomLink{Href: feedURL, Rel: "self"})
+	}
+	if len(software) > 0 {
+		feed.Updated = software[0].LastModified
+	}
+
+	for _, sw := range software {
+		entry := atomEntry{
+			ID:        feedID + "/" + sw.ID,
+			Title:     sw.PublicCode.Name,
+			Published: sw.FirstSeen,
+			Updated:   sw.LastModified,
+		}
+		if sw.Publisher != "" {
+			entry.Author = &atomPerson{Name: sw.Publisher}
+		}
+		if sw.PublicCode.URL != "" {
+			entry.Links = append(entry.Links, atomLink{Href: sw.PublicCode.URL, Rel: "alternate"})
+		}
+		if sw.Description != nil {
+			entry.Summary = sw.Description.ShortDescription
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+// feedHandler serves the feed in fname, so it's available across runs.
+func feedHandler(fname string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadFile(fname)
+		if os.IsNotExist(err) {
+			http.Error(w, "no feed has been generated yet", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Errorf("Error reading the feed: %v", err)
+			http.Error(w, "cannot read the feed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml")
+		_, _ = w.Write(data)
+	})
+}
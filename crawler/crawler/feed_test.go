@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoftwareTimestamps(t *testing.T) {
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	// New software.
+	firstSeen, lastModified := softwareTimestamps(softwareTimes{}, []byte("name: app\n"), now)
+	assert.Equal(t, "2020-03-01T10:00:00Z", firstSeen)
+	assert.Equal(t, "2020-03-01T10:00:00Z", lastModified)
+
+	stored := softwareTimes{
+		FirstSeen:     "2020-01-01T10:00:00Z",
+		LastModified:  "2020-02-01T10:00:00Z",
+		RawPubliccode: "name: app\n",
+	}
+	firstSeen, lastModified = softwareTimestamps(stored, []byte("name: app\n"), now)
+	assert.Equal(t, "2020-01-01T10:00:00Z", firstSeen)
+	assert.Equal(t, "2020-02-01T10:00:00Z", lastModified)
+
+	// Changed publiccode.yml.
+	firstSeen, lastModified = softwareTimestamps(stored, []byte("name: new app\n"), now)
+	assert.Equal(t, "2020-01-01T10:00:00Z", firstSeen)
+	assert.Equal(t, "2020-03-01T10:00:00Z", lastModified)
+}
+
+func TestLastSeen(t *testing.T) {
+	assert.Equal(t, "2020-03-01T10:00:00Z", lastSeen(time.Date(2020, 3, 1, 11, 0, 0, 0, time.FixedZone("CET", 3600))))
+}
+
+func TestRenderFeed(t *testing.T) {
+	sw := feedSoftware{
+		ID:           "abc",
+		FirstSeen:    "2020-02-01T10:00:00Z",
+		LastModified: "2020-02-20T10:00:00Z",
+		Publisher:    "Comune di Test",
+		Description:  &searchableDescription{ShortDescription: "An app & more"},
+	}
+	sw.PublicCode.Name = "App"
+	sw.PublicCode.URL = "https://github.com/comune/app"
+
+	data, err := renderFeed([]feedSoftware{sw}, "https://example.org/feed.atom", time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	var feed atomFeed
+	assert.NoError(t, xml.Unmarshal(data, &feed))
+	assert.Equal(t, "http://www.w3.org/2005/Atom", feed.XMLName.Space)
+	assert.Equal(t, "2020-02-20T10:00:00Z", feed.Updated)
+	assert.Equal(t, []atomLink{{Href: "https://example.org/feed.atom", Rel: "self"}}, feed.Links)
+	assert.Len(t, feed.Entries, 1)
+	assert.Equal(t, atomEntry{
+		ID:        feedID + "/abc",
+		Title:     "App",
+		Published: "2020-02-01T10:00:00Z",
+		Updated:   "2020-02-20T10:00:00Z",
+		Author:    &atomPerson{Name: "Comune di Test"},
+		Links:     []atomLink{{Href: "https://github.com/comune/app", Rel: "alternate"}},
+		Summary:   "An app & more",
+	}, feed.Entries[0])
+
+	// An empty feed is updated at the time it's generated.
+	data, err = renderFeed(nil, "", time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.NoError(t, xml.Unmarshal(data, &feed))
+	assert.Equal(t, "2020-03-01T10:00:00Z", feed.Updated)
+}
+
+func TestFeedHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "feed.atom")
+	handler := feedHandler(fname)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/feed.atom", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.NoError(t, ioutil.WriteFile(fname, []byte("<feed/>"), 0644))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/feed.atom", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/atom+xml", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "<feed/>", rec.Body.String())
+}
+
+func TestStoredTimesPreview(t *testing.T) {
+	viper.Set("ELASTIC_PUBLICCODE_INDEX", "publiccode")
+	defer viper.Set("ELASTIC_PUBLICCODE_INDEX", nil)
+
+	repository := Repository{GitCloneURL: "https://example.org/italia/app.git"}
+	id := repository.generateID()
+
+	// Only the live index has the software.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/publiccode/software/"+id {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"_index": "publiccode_preview", "_type": "software", "_id": "%s", "found": false}`, id)
+			return
+		}
+		fmt.Fprintf(w, `{"_index": "publiccode", "_type": "software", "_id": "%s", "found": true,
+			"_source": {"firstSeen": "2020-01-01T10:00:00Z", "lastModified": "2020-02-01T10:00:00Z"}}`, id)
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	assert.NoError(t, err)
+	c := Crawler{es: client, index: "publiccode"}
+
+	stored, err := c.storedTimes(repository)
+	assert.NoError(t, err)
+	assert.Equal(t, "2020-02-01T10:00:00Z", stored.LastModified)
+
+	// The preview index is empty, the times come from the live one.
+	c.index, c.preview = previewIndex(), true
+	stored, err = c.storedTimes(repository)
+	assert.NoError(t, err)
+	assert.Equal(t, "2020-02-01T10:00:00Z", stored.LastModified)
+
+	// So the promoted software keeps when it was first seen.
+	firstSeen, _ := softwareTimestamps(stored, []byte("name: app\n"), time.Now())
+	assert.Equal(t, "2020-01-01T10:00:00Z", firstSeen)
+}
@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"gopkg.in/yaml.v2"
+)
+
+// Normalization of the keys of the validation errors, so that the same field
+// is counted once for all the languages and list items.
+var (
+	fieldLanguageRegexp = regexp.MustCompile(`^description/[^/]+/`)
+	fieldIndexRegexp    = regexp.MustCompile(`/[0-9]+(/|$)`)
+)
+
+// fieldStat is the number of software missing or with a malformed field.
+type fieldStat struct {
+	Field               string  `json:"field"`
+	Missing             int     `json:"missing"`
+	MissingPercentage   float64 `json:"missingPercentage"`
+	Malformed           int     `json:"malformed"`
+	MalformedPercentage float64 `json:"malformedPercentage"`
+}
+
+// fieldStatsReport is the report of the fields across the catalog.
+type fieldStatsReport struct {
+	Software int         `json:"software"`
+	Fields   []fieldStat `json:"fields"`
+}
+
+// fieldStats aggregates the missing and malformed publiccode.yml fields of
+// all the crawled software. It's shared by all the ProcessRepositories workers.
+type fieldStats struct {
+	mutex sync.Mutex
+
+	software  int
+	missing   map[string]int
+	malformed map[string]int
+}
+
+// add records the fields of a publiccode.yml from its raw data and its
+// validation error. Each field is counted at most once per software.
+func (s *fieldStats) add(data []byte, err error) {
+	missing := make(map[string]bool)
+	malformed := make(map[string]bool)
+
+	for _, field := range missingRecommendedFields(data) {
+		missing[field] = true
+	}
+
+	if multi, ok := err.(publiccode.ErrorParseMulti); ok {
+		for _, e := range multi {
+			switch e := e.(type) {
+			case publiccode.ErrorInvalidValue:
+				if strings.HasPrefix(e.Reason, "missing") {
+					missing[normalizeFieldKey(e.Key)] = true
+				} else {
+					malformed[normalizeFieldKey(e.Key)] = true
+				}
+			case publiccode.ErrorInvalidKey:
+				malformed[normalizeFieldKey(e.Key)] = true
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.missing == nil {
+		s.missing = make(map[string]int)
+		s.malformed = make(map[string]int)
+	}
+
+	s.software++
+	for field := range missing {
+		s.missing[field]++
+	}
+	for field := range malformed {
+		s.malformed[field]++
+	}
+}
+
+// report returns the statistics of the fields, the most problematic first.
+func (s *fieldStats) report() fieldStatsReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fields := make(map[string]bool)
+	for field := range s.missing {
+		fields[field] = true
+	}
+	for field := range s.malformed {
+		fields[field] = true
+	}
+
+	report := fieldStatsReport{Software: s.software, Fields: []fieldStat{}}
+	for field := range fields {
+		report.Fields = append(report.Fields, fieldStat{
+			Field:               field,
+			Missing:             s.missing[field],
+			MissingPercentage:   percentage(s.missing[field], s.software),
+			Malformed:           s.malformed[field],
+			MalformedPercentage: percentage(s.malformed[field], s.software),
+		})
+	}
+
+	sort.Slice(report.Fields, func(i, j int) bool {
+		a, b := report.Fields[i], report.Fields[j]
+		if a.Missing+a.Malformed != b.Missing+b.Malformed {
+			return a.Missing+a.Malformed > b.Missing+b.Malformed
+		}
+		return a.Field < b.Field
+	})
+
+	return report
+}
+
+// write saves the field statistics report as JSON in fname.
+func (s *fieldStats) write(fname string) error {
+	jsonOut, err := json.MarshalIndent(s.report(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, jsonOut, 0644)
+}
+
+// normalizeFieldKey returns the key of a validation error without the
+// description language and the list indexes, eg. description/*/screenshots.
+func normalizeFieldKey(key string) string {
+	key = fieldLanguageRegexp.ReplaceAllString(key, "description/*/")
+	for fieldIndexRegexp.MatchString(key) {
+		key = fieldIndexRegexp.ReplaceAllString(key, "$1")
+	}
+
+	return strings.TrimSuffix(key, "/")
+}
+
+// missingRecommendedFields returns the optional fields that are missing
+// from a publiccode.yml, not reported by the parser.
+func missingRecommendedFields(data []byte) []string {
+	var pc struct {
+		Logo        string `yaml:"logo"`
+		Roadmap     string `yaml:"roadmap"`
+		Description map[string]struct {
+			Screenshots   []string `yaml:"screenshots"`
+			Documentation string   `yaml:"documentation"`
+		} `yaml:"description"`
+	}
+	if err := yaml.Unmarshal(data, &pc); err != nil {
+		return nil
+	}
+
+	var missing []string
+	if pc.Logo == "" {
+		missing = append(missing, "logo")
+	}
+	if pc.Roadmap == "" {
+		missing = append(missing, "roadmap")
+	}
+
+	var screenshots, documentation bool
+	for _, description := range pc.Description {
+		screenshots = screenshots || len(description.Screenshots) > 0
+		documentation = documentation || description.Documentation != ""
+	}
+	if !screenshots {
+		missing = append(missing, "description/*/screenshots")
+	}
+	if !documentation {
+		missing = append(missing, "description/*/documentation")
+	}
+
+	return missing
+}
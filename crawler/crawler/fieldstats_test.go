@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"testing"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldStats(t *testing.T) {
+	complete := []byte(`
+logo: logo.png
+roadmap: https://example.org/roadmap
+description:
+  ita:
+    screenshots: [screenshot.png]
+    documentation: https://example.org/docs
+`)
+	noScreenshots := []byte(`
+logo: logo.png
+roadmap: https://example.org/roadmap
+description:
+  ita:
+    documentation: https://example.org/docs
+  eng:
+    documentation: https://example.org/docs
+`)
+
+	var s fieldStats
+	s.add(complete, nil)
+	s.add(noScreenshots, publiccode.ErrorParseMulti{
+		publiccode.ErrorInvalidValue{Key: "description/ita/shortDescription", Reason: "missing mandatory key"},
+		publiccode.ErrorInvalidValue{Key: "description/eng/shortDescription", Reason: "missing mandatory key"},
+		publiccode.ErrorInvalidValue{Key: "description/ita/screenshots/0", Reason: "invalid file extension for: a.txt"},
+	})
+
+	report := s.report()
+	assert.Equal(t, 2, report.Software)
+	assert.Equal(t, []fieldStat{
+		{Field: "description/*/screenshots", Missing: 1, MissingPercentage: 50, Malformed: 1, MalformedPercentage: 50},
+		{Field: "description/*/shortDescription", Missing: 1, MissingPercentage: 50},
+	}, report.Fields)
+}
+
+func TestNormalizeFieldKey(t *testing.T) {
+	assert.Equal(t, "description/*/screenshots", normalizeFieldKey("description/ita/screenshots/2"))
+	assert.Equal(t, "maintenance/contacts/name", normalizeFieldKey("maintenance/contacts/0/name"))
+	assert.Equal(t, "legal/license", normalizeFieldKey("legal/license"))
+}
@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// skipForks returns whether the forks are skipped when listing the
+// repositories of the organizations (SKIP_FORKS).
+func skipForks() bool {
+	return viper.GetBool("SKIP_FORKS")
+}
+
+// publiccodeURL returns the url of the raw publiccode.yml.
+func publiccodeURL(data []byte) string {
+	var pc struct {
+		URL string `yaml:"url"`
+	}
+	if err := yaml.Unmarshal(data, &pc); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(pc.URL)
+}
+
+// forkHasOwnPubliccode returns whether the publiccode.yml of the fork
+// repository has the url of the fork itself rather than the upstream one.
+func forkHasOwnPubliccode(repository Repository) bool {
+	resp, err := getURL(requestRawFile, repository.FileRawURL, repository.Headers)
+	if err != nil || resp.Status.Code != http.StatusOK {
+		return false
+	}
+
+	return urlMatches(publiccodeURL(resp.Body), repositoryURLs(repository)...)
+}
+
+// forwardRepositories sends the repositories in listed to repositories,
+// one for each directory in their publiccodeIndexFilename manifest. With
+// skipForks the forks without their own publiccode.yml are skipped.
+// It returns when listed is closed.
+func forwardRepositories(listed, repositories chan Repository, skipForks bool) {
+	for repository := range listed {
+		if skipForks && repository.Fork && !forkHasOwnPubliccode(repository) {
+			log.Infof("Skipping %s: repo is a fork (SKIP_FORKS)", repository.Name)
+			continue
+		}
+		for _, software := range expandPubliccodeIndex(repository) {
+			repositories <- software
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubliccodeURL(t *testing.T) {
+	assert.Equal(t, "https://github.com/pcm/app", publiccodeURL([]byte("url: https://github.com/pcm/app\n")))
+	assert.Equal(t, "", publiccodeURL([]byte("name: app\n")))
+	assert.Equal(t, "", publiccodeURL([]byte("- not a map")))
+}
+
+func TestSkipForkedRepositories(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/own/publiccode.yml":
+			fmt.Fprint(w, "url: https://github.com/comune/own\n")
+		case "/upstream/publiccode.yml":
+			fmt.Fprint(w, "url: https://github.com/upstream/app\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	listed := make(chan Repository, 4)
+	listed <- Repository{Name: "comune/app", GitCloneURL: "https://github.com/comune/app.git"}
+	listed <- Repository{Name: "comune/own", GitCloneURL: "https://github.com/comune/own.git", FileRawURL: ts.URL + "/own/publiccode.yml", Fork: true}
+	listed <- Repository{Name: "comune/mirror", GitCloneURL: "https://github.com/comune/mirror.git", FileRawURL: ts.URL + "/upstream/publiccode.yml", Fork: true}
+	listed <- Repository{Name: "comune/missing", GitCloneURL: "https://github.com/comune/missing.git", FileRawURL: ts.URL + "/missing/publiccode.yml", Fork: true}
+	close(listed)
+
+	repositories := make(chan Repository, 4)
+	forwardRepositories(listed, repositories, true)
+	close(repositories)
+
+	var names []string
+	for repository := range repositories {
+		names = append(names, repository.Name)
+	}
+	assert.Equal(t, []string{"comune/app", "comune/own"}, names)
+}
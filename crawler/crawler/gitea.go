@@ -0,0 +1,278 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	httpclient "github.com/italia/httpclient-lib-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// giteaPageLimit is the number of repositories requested per page, the
+// default maximum of Gitea.
+const giteaPageLimit = 50
+
+// GiteaRepo is a repository in the Gitea API responses.
+type GiteaRepo struct {
+	ID    int `json:"id"`
+	Owner struct {
+		ID    int    `json:"id"`
+		Login string `json:"login"`
+	} `json:"owner"`
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	Empty         bool      `json:"empty"`
+	Private       bool      `json:"private"`
+	Fork          bool      `json:"fork"`
+	Mirror        bool      `json:"mirror"`
+	Archived      bool      `json:"archived"`
+	HTMLURL       string    `json:"html_url"`
+	SSHURL        string    `json:"ssh_url"`
+	CloneURL      string    `json:"clone_url"`
+	Website       string    `json:"website"`
+	DefaultBranch string    `json:"default_branch"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// RegisterGiteaAPI register the crawler function for Gitea API.
+// It get the list of repositories on "link" url.
+// If a next page is available return its url.
+// Otherwise returns an empty ("") string.
+func RegisterGiteaAPI() OrganizationHandler {
+	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, string, error) {
+		// Parse url.
+		u, err := url.Parse(link)
+		if err != nil {
+			return link, "", err
+		}
+		// Set domain host to new host.
+		domain.Host = u.Hostname()
+
+		// Set BasicAuth header, user:token like on Github.
+		headers := map[string]string{
+			"Authorization": rotateAuthorization(domain.BasicAuth, u.Hostname(), time.Now()),
+		}
+
+		// Get List of repositories.
+		resp, err := getURL(requestAPI, link, headers)
+		if err != nil {
+			return link, "", err
+		}
+		if resp.Status.Code != http.StatusOK {
+			log.Warnf("Request returned: %s", string(resp.Body))
+			return "", "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+		}
+
+		var results []GiteaRepo
+		err = json.Unmarshal(resp.Body, &results)
+		if err != nil {
+			return link, "", err
+		}
+
+		// Add repositories to the channel that will perform the check on everyone.
+		for _, v := range results {
+			err = addGiteaRepository(v, "", domain, pa, headers, repositories)
+			if err != nil {
+				log.Warnf("Skipping %s: %v", v.FullName, err)
+			}
+		}
+
+		return giteaNextURL(u, resp.Headers.Get("Link"), len(results)), lastPage(resp.Headers), nil
+	}
+}
+
+// giteaNextURL returns the url of the page after u, read from the Link header
+// or, on the instances not sending it, the page query parameter. It returns
+// an empty string after the last page, the one with less than limit results.
+func giteaNextURL(u *url.URL, linkHeader string, results int) string {
+	if linkHeader != "" {
+		nextLink := httpclient.HeaderLink(linkHeader, "next")
+		// if last page for this organization, the nextLink is empty or equal to actual link.
+		if nextLink == u.String() {
+			return ""
+		}
+		return nextLink
+	}
+
+	query := u.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = giteaPageLimit
+	}
+	if results < limit {
+		return ""
+	}
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	query.Set("page", strconv.Itoa(page+1))
+	query.Set("limit", strconv.Itoa(limit))
+
+	next := *u
+	next.RawQuery = query.Encode()
+
+	return next.String()
+}
+
+// RegisterSingleGiteaAPI register the crawler function for single repository Gitea API.
+// Return nil if the repository was successfully added to repositories channel.
+// Otherwise return the generated error.
+func RegisterSingleGiteaAPI() SingleRepoHandler {
+	return func(domain Domain, link string, repositories chan Repository, pa PA) error {
+		// Parse url.
+		u, err := url.Parse(link)
+		if err != nil {
+			return err
+		}
+		subpath := splitSubpath(u)
+
+		// Set domain host to new host.
+		domain.Host = u.Hostname()
+
+		// Set BasicAuth header, user:token like on Github.
+		headers := map[string]string{
+			"Authorization": rotateAuthorization(domain.BasicAuth, u.Hostname(), time.Now()),
+		}
+
+		u.Path = path.Join("/api/v1/repos", strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"))
+
+		// Get single Repo.
+		resp, err := getURL(requestAPI, u.String(), headers)
+		if err != nil {
+			return err
+		}
+		if resp.Status.Code != http.StatusOK {
+			log.Warnf("Request returned: %s", string(resp.Body))
+			return errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+		}
+
+		var v GiteaRepo
+		err = json.Unmarshal(resp.Body, &v)
+		if err != nil {
+			return err
+		}
+
+		return addGiteaRepository(v, subpath, domain, pa, headers, repositories)
+	}
+}
+
+// addGiteaRepository adds the repository v to the repositories channel.
+// subpath is the directory of the software, empty for the root of the repository.
+func addGiteaRepository(v GiteaRepo, subpath string, domain Domain, pa PA, headers map[string]string, repositories chan Repository) error {
+	if v.Private || skipArchivedListed(v.Archived) {
+		return fmt.Errorf("%w: private or archived", errRepositorySkipped)
+	}
+	// If the repository was never used, there's no branch.
+	if v.Empty || v.DefaultBranch == "" {
+		return fmt.Errorf("%w: empty", errRepositorySkipped)
+	}
+
+	fileRawURL, err := generateGiteaRawURL(v.HTMLURL, v.DefaultBranch, subpath, domain.crawledFilename())
+	if err != nil {
+		return err
+	}
+
+	// Marshal all the repository metadata.
+	metadata, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("gitea metadata: %v", err)
+		return err
+	}
+
+	repositories <- Repository{
+		Name:        v.FullName,
+		Hostname:    domain.Host,
+		FileRawURL:  fileRawURL,
+		GitCloneURL: v.CloneURL,
+		GitBranch:   v.DefaultBranch,
+		Domain:      domain,
+		Pa:          pa,
+		Headers:     headers,
+		Metadata:    metadata,
+		Subpath:     subpath,
+		Archived:    v.Archived,
+		Fork:        v.Fork,
+	}
+
+	return nil
+}
+
+// generateGiteaRawURL returns the Gitea specific file raw url.
+// subpath is the directory of the file, empty for the root of the repository.
+func generateGiteaRawURL(baseURL, defaultBranch, subpath, filename string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(u.Path, "raw", "branch", defaultBranch, subpath, filename)
+
+	return u.String(), nil
+}
+
+// GenerateGiteaAPIURL returns the api urls of given Gitea organization link.
+// IN: https://gitea.example.org/italia
+// OUT:https://gitea.example.org/api/v1/orgs/italia/repos?limit=50&page=1,https://gitea.example.org/api/v1/users/italia/repos?limit=50&page=1
+func GenerateGiteaAPIURL() GeneratorAPIURL {
+	return func(in string) (out []string, err error) {
+		for _, owner := range []string{"orgs", "users"} {
+			u, err := url.Parse(in)
+			if err != nil {
+				return []string{in}, err
+			}
+			u.Path = path.Join("/api/v1", owner, strings.Trim(u.Path, "/"), "repos")
+			u.RawQuery = url.Values{
+				"page":  []string{"1"},
+				"limit": []string{strconv.Itoa(giteaPageLimit)},
+			}.Encode()
+			out = append(out, u.String())
+		}
+
+		return out, nil
+	}
+}
+
+// IsGitea returns "true" if the url can use Gitea API.
+func IsGitea(link string) bool {
+	if len(link) == 0 {
+		log.Errorf("IsGitea: empty link %s.", link)
+		return false
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		log.Errorf("IsGitea: impossible to parse %s.", link)
+		return false
+	}
+	u.Path = "api/v1/version"
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	resp, err := getURL(requestAPI, u.String(), nil)
+	if err != nil || resp.Status.Code != http.StatusOK {
+		log.Debugf("can %s use Gitea API? No.", link)
+		return false
+	}
+
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(resp.Body, &version); err != nil || version.Version == "" {
+		log.Debugf("can %s use Gitea API? No.", link)
+		return false
+	}
+
+	log.Debugf("can %s use Gitea API? Yes.", link)
+	return true
+}
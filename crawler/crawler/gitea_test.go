@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateGiteaAPIURL(t *testing.T) {
+	out, err := GenerateGiteaAPIURL()("https://gitea.example.org/regione")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://gitea.example.org/api/v1/orgs/regione/repos?limit=50&page=1",
+		"https://gitea.example.org/api/v1/users/regione/repos?limit=50&page=1",
+	}, out)
+}
+
+func TestGiteaNextURL(t *testing.T) {
+	u, _ := url.Parse("https://gitea.example.org/api/v1/orgs/regione/repos?limit=2&page=1")
+
+	assert.Equal(t, "https://gitea.example.org/api/v1/orgs/regione/repos?limit=2&page=2",
+		giteaNextURL(u, `<https://gitea.example.org/api/v1/orgs/regione/repos?limit=2&page=2>; rel="next"`, 2))
+	assert.Equal(t, "", giteaNextURL(u, `<https://gitea.example.org/api/v1/orgs/regione/repos?limit=2&page=1>; rel="first"`, 2))
+
+	// Instances not sending the Link header are paginated by page.
+	assert.Equal(t, "https://gitea.example.org/api/v1/orgs/regione/repos?limit=2&page=2", giteaNextURL(u, "", 2))
+	assert.Equal(t, "", giteaNextURL(u, "", 1))
+}
+
+func TestGiteaAPI(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	var authorization string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		repo := func(name string, private bool) string {
+			return fmt.Sprintf(`{"full_name": "regione/%s", "private": %t, "default_branch": "main",
+				"html_url": "%s/regione/%s", "clone_url": "%s/regione/%s.git"}`, name, private, ts.URL, name, ts.URL, name)
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/orgs/regione/repos":
+			if r.URL.Query().Get("page") == "1" {
+				w.Header().Set("Link", fmt.Sprintf(`<%[1]s/api/v1/orgs/regione/repos?limit=2&page=2>; rel="next", <%[1]s/api/v1/orgs/regione/repos?limit=2&page=2>; rel="last"`, ts.URL))
+				fmt.Fprintf(w, "[%s, %s]", repo("a", false), repo("private", true))
+				return
+			}
+			fmt.Fprintf(w, "[%s]", repo("b", false))
+		case "/api/v1/repos/regione/a":
+			fmt.Fprint(w, repo("a", false))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	domain := Domain{Host: "gitea.example.org", Type: "gitea", BasicAuth: []string{"user:token"}}
+	repositories := make(chan Repository, 10)
+
+	next, last, err := RegisterGiteaAPI()(domain, ts.URL+"/api/v1/orgs/regione/repos?limit=2&page=1", repositories, PA{})
+	assert.NoError(t, err)
+	assert.Equal(t, ts.URL+"/api/v1/orgs/regione/repos?limit=2&page=2", next)
+	assert.Equal(t, ts.URL+"/api/v1/orgs/regione/repos?limit=2&page=2", last)
+	assert.Equal(t, authorizationHeader("user:token"), authorization)
+
+	next, _, err = RegisterGiteaAPI()(domain, next, repositories, PA{})
+	assert.NoError(t, err)
+	assert.Empty(t, next)
+
+	err = RegisterSingleGiteaAPI()(domain, ts.URL+"/regione/a#apps/web", repositories, PA{})
+	assert.NoError(t, err)
+	close(repositories)
+
+	var repos []Repository
+	for repo := range repositories {
+		repos = append(repos, repo)
+	}
+	assert.Len(t, repos, 3)
+	assert.Equal(t, "regione/a", repos[0].Name)
+	assert.Equal(t, ts.URL+"/regione/a/raw/branch/main/publiccode.yml", repos[0].FileRawURL)
+	assert.Equal(t, ts.URL+"/regione/a.git", repos[0].GitCloneURL)
+	assert.Equal(t, "gitea", repos[0].Domain.API())
+	assert.Equal(t, "regione/b", repos[1].Name)
+	assert.Equal(t, ts.URL+"/regione/a/raw/branch/main/apps/web/publiccode.yml", repos[2].FileRawURL)
+	assert.Equal(t, "apps/web", repos[2].Subpath)
+}
@@ -1,10 +1,9 @@
 package crawler
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"math/rand"
+	"fmt"
 	"net/http"
 	"net/url"
 	"path"
@@ -13,7 +12,6 @@ import (
 
 	httpclient "github.com/italia/httpclient-lib-go"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 // GithubOrgs is the complete result from the Github API respose for /orgs/<Name>/repos.
@@ -217,52 +215,41 @@ type GithubFiles []struct {
 	} `json:"_links"`
 }
 
-func githubBasicAuth(domain Domain) string {
-	if len(domain.BasicAuth) > 0 {
-		auth := domain.BasicAuth[rand.Intn(len(domain.BasicAuth))]
-		return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
-	}
-	return ""
-}
-
 // RegisterGithubAPI register the crawler function for Github API.
 // It get the list of repositories on "link" url.
 // If a next page is available return its url.
 // Otherwise returns an empty ("") string.
 func RegisterGithubAPI() OrganizationHandler {
-	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, error) {
-		// Set BasicAuth header
-		headers := make(map[string]string)
-		headers["Authorization"] = githubBasicAuth(domain)
-
+	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, string, error) {
 		// Parse url.
 		u, err := url.Parse(link)
 		if err != nil {
-			return link, err
+			return link, "", err
 		}
 		// Set domain host to new host.
 		domain.Host = u.Hostname()
 
+		// Each request gets the next credential, see githubAuthorization.
 		// Get List of repositories.
-		resp, err := httpclient.GetURL(link, headers)
+		resp, err := getURL(requestAPI, link, githubHeaders(domain, u.Hostname()))
 		if err != nil {
-			return link, err
+			return link, "", err
 		}
 		if resp.Status.Code != http.StatusOK {
 			log.Warnf("Request returned: %s", string(resp.Body))
-			return "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+			return "", "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
 		}
 
 		// Fill response as list of values (repositories data).
 		var results GithubOrgs
 		err = json.Unmarshal(resp.Body, &results)
 		if err != nil {
-			return link, err
+			return link, "", err
 		}
 
 		// Add repositories to the channel that will perform the check on everyone.
 		for _, v := range results {
-			if v.Private || v.Archived {
+			if v.Private || skipArchivedListed(v.Archived) {
 				log.Warnf("Skipping %s: repo is private or archived", v.FullName)
 				continue
 			}
@@ -274,7 +261,7 @@ func RegisterGithubAPI() OrganizationHandler {
 			}
 			contents := strings.Replace(v.ContentsURL, "{+path}", "", -1)
 			// Get List of files.
-			resp, err := httpclient.GetURL(contents, headers)
+			resp, err := getURL(requestAPI, contents, githubHeaders(domain, u.Hostname()))
 			if err != nil {
 				log.Errorf("Request returned an error: %v", err)
 				continue
@@ -289,7 +276,7 @@ func RegisterGithubAPI() OrganizationHandler {
 				log.Infof("Repository is empty: %s", link)
 			}
 
-			err = addGithubProjectsToRepositories(files, v.FullName, v.CloneURL, v.DefaultBranch, domain.Host, domain, pa, headers, metadata, repositories)
+			err = addGithubProjectsToRepositories(files, v.FullName, v.CloneURL, v.DefaultBranch, v.Archived, v.Fork, domain.Host, domain, pa, githubHeaders(domain, u.Hostname()), metadata, repositories)
 			if err != nil {
 				log.Infof("addGithubProectsToRepositories %v", err)
 			}
@@ -301,10 +288,10 @@ func RegisterGithubAPI() OrganizationHandler {
 
 		// if last page for this organization, the nextLink is empty or equal to actual link.
 		if nextLink == "" || nextLink == link {
-			return "", nil
+			return "", "", nil
 		}
 
-		return nextLink, nil
+		return nextLink, lastPage(resp.Headers), nil
 	}
 }
 
@@ -313,15 +300,12 @@ func RegisterGithubAPI() OrganizationHandler {
 // Otherwise return the generated error.
 func RegisterSingleGithubAPI() SingleRepoHandler {
 	return func(domain Domain, link string, repositories chan Repository, pa PA) error {
-		// Set BasicAuth header.
-		headers := make(map[string]string)
-		headers["Authorization"] = githubBasicAuth(domain)
-
 		// Parse url.
 		u, err := url.Parse(link)
 		if err != nil {
 			return err
 		}
+		subpath := splitSubpath(u)
 
 		// Set domain host to new host.
 		domain.Host = u.Hostname()
@@ -330,8 +314,11 @@ func RegisterSingleGithubAPI() SingleRepoHandler {
 		u.Path = strings.Trim(u.Path, "/")
 		u.Host = "api." + u.Host
 
+		// Each request gets the next credential, see githubAuthorization.
+		headers := githubHeaders(domain, u.Hostname())
+
 		// Get List of repositories.
-		resp, err := httpclient.GetURL(u.String(), headers)
+		resp, err := getURL(requestAPI, u.String(), headers)
 		if err != nil {
 			return err
 		}
@@ -346,9 +333,9 @@ func RegisterSingleGithubAPI() SingleRepoHandler {
 			return err
 		}
 
-		if v.Private || v.Archived {
+		if v.Private || skipArchivedListed(v.Archived) {
 			log.Warnf("Skipping %s: repo is private or archived", v.FullName)
-			return errors.New("Skipping private or archived repo")
+			return fmt.Errorf("%w: private or archived", errRepositorySkipped)
 		}
 
 		// Marshal all the repository metadata.
@@ -357,10 +344,10 @@ func RegisterSingleGithubAPI() SingleRepoHandler {
 			log.Errorf("github metadata: %v", err)
 			return err
 		}
-		contents := strings.Replace(v.ContentsURL, "{+path}", "", -1)
+		contents := strings.Replace(v.ContentsURL, "{+path}", subpath, -1)
 
 		// Get List of files.
-		resp, err = httpclient.GetURL(contents, headers)
+		resp, err = getURL(requestAPI, contents, githubHeaders(domain, u.Hostname()))
 		if err != nil {
 			return err
 		}
@@ -375,51 +362,52 @@ func RegisterSingleGithubAPI() SingleRepoHandler {
 			log.Infof("Repository is empty: %s", link)
 		}
 
-		foundIt := false
 		// Search a file with a valid name and a downloadURL.
-		for _, f := range files {
-			if f.Name == viper.GetString("CRAWLED_FILENAME") && f.DownloadURL != "" {
-				// Add repository to channel.
-				repositories <- Repository{
-					Name:        v.FullName,
-					Hostname:    u.Hostname(),
-					FileRawURL:  f.DownloadURL,
-					GitCloneURL: v.CloneURL,
-					GitBranch:   v.DefaultBranch,
-					Domain:      domain,
-					Pa:          pa,
-					Headers:     headers,
-					Metadata:    metadata,
-				}
-				foundIt = true
-			}
+		fileRawURL := githubFileRawURL(files, domain.crawledFilename())
+		if fileRawURL == "" {
+			return fmt.Errorf("%w: no %s", errRepositorySkipped, domain.crawledFilename())
 		}
-		if !foundIt {
-			return errors.New("Repository does not contain " + viper.GetString("CRAWLED_FILENAME"))
+
+		// Add repository to channel.
+		repositories <- Repository{
+			Name:        v.FullName,
+			Hostname:    u.Hostname(),
+			FileRawURL:  fileRawURL,
+			GitCloneURL: v.CloneURL,
+			GitBranch:   v.DefaultBranch,
+			Domain:      domain,
+			Pa:          pa,
+			Headers:     headers,
+			Metadata:    metadata,
+			Subpath:     subpath,
+			Archived:    v.Archived,
 		}
 		return nil
 	}
 }
 
 // addGithubProjectsToRepositories adds the projects from api response to repository channel.
-func addGithubProjectsToRepositories(files GithubFiles, fullName, cloneURL, defaultBranch, hostname string,
+func addGithubProjectsToRepositories(files GithubFiles, fullName, cloneURL, defaultBranch string, archived, fork bool, hostname string,
 	domain Domain, pa PA, headers map[string]string, metadata []byte, repositories chan Repository) error {
 	// Search a file with a valid name and a downloadURL.
-	for _, f := range files {
-		if f.Name == viper.GetString("CRAWLED_FILENAME") && f.DownloadURL != "" {
-			// Add repository to channel.
-			repositories <- Repository{
-				Name:        fullName,
-				Hostname:    hostname,
-				FileRawURL:  f.DownloadURL,
-				GitCloneURL: cloneURL,
-				GitBranch:   defaultBranch,
-				Domain:      domain,
-				Pa:          pa,
-				Headers:     headers,
-				Metadata:    metadata,
-			}
-		}
+	fileRawURL := githubFileRawURL(files, domain.crawledFilename())
+	if fileRawURL == "" {
+		return nil
+	}
+
+	// Add repository to channel.
+	repositories <- Repository{
+		Name:        fullName,
+		Hostname:    hostname,
+		FileRawURL:  fileRawURL,
+		GitCloneURL: cloneURL,
+		GitBranch:   defaultBranch,
+		Domain:      domain,
+		Pa:          pa,
+		Headers:     headers,
+		Metadata:    metadata,
+		Archived:    archived,
+		Fork:        fork,
 	}
 
 	return nil
@@ -467,7 +455,7 @@ func IsGithub(link string) bool {
 	u.Path = "rate_limit"
 	u.Host = "api." + u.Host
 
-	resp, err := httpclient.GetURL(u.String(), nil)
+	resp, err := getURL(requestAPI, u.String(), nil)
 	if err != nil {
 		log.Debugf("can %s use Github API? No.", link)
 		return false
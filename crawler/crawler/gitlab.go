@@ -3,6 +3,7 @@ package crawler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"path"
@@ -11,7 +12,6 @@ import (
 
 	httpclient "github.com/italia/httpclient-lib-go"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 // GitlabGroups is the complete result from the Gitlab API respose.
@@ -27,7 +27,7 @@ type GitlabGroups struct {
 	RequestAccessEnabled      bool                  `json:"request_access_enabled"`
 	FullName                  string                `json:"full_name"`
 	FullPath                  string                `json:"full_path"`
-	ParentID                  string                `json:"parent_id"`
+	ParentID                  int                   `json:"parent_id"`
 	Projects                  []GitlabProject       `json:"projects"`
 	SharedProjects            []GitlabSharedProject `json:"shared_projects"`
 	LdapCn                    interface{}           `json:"ldap_cn"`
@@ -53,6 +53,13 @@ type GitlabRepo struct {
 	StarCount         int           `json:"star_count"`
 	ForksCount        int           `json:"forks_count"`
 	LastActivityAt    time.Time     `json:"last_activity_at"`
+	Links             struct {
+		MergeRequests string `json:"merge_requests"`
+	} `json:"_links"`
+	IssuesEnabled        bool `json:"issues_enabled"`
+	MergeRequestsEnabled bool `json:"merge_requests_enabled"`
+	OpenIssuesCount      int  `json:"open_issues_count,omitempty"`
+	Archived             bool `json:"archived"`
 }
 
 // GitlabProject is a software project hosted on Gitlab.
@@ -102,6 +109,7 @@ type GitlabProject struct {
 		FullPath string      `json:"full_path"`
 		ParentID interface{} `json:"parent_id"`
 	} `json:"namespace"`
+	ForkedFromProject                         *GitlabRepo   `json:"forked_from_project,omitempty"`
 	ImportStatus                              string        `json:"import_status"`
 	OpenIssuesCount                           int           `json:"open_issues_count,omitempty"`
 	PublicJobs                                bool          `json:"public_jobs"`
@@ -188,6 +196,10 @@ type GitlabSharedProject struct {
 	} `json:"owner,omitempty"`
 }
 
+// gitlabSubgroupsMaxDepth is the maximum nesting level of subgroups we descend into,
+// the same limit GitLab enforces.
+const gitlabSubgroupsMaxDepth = 20
+
 // useGitlabGroups returns true when we want to use the /api/v4/groups API
 // instead of /api/v4/projects.
 //
@@ -202,7 +214,7 @@ func useGitlabGroups(u *url.URL) bool {
 
 // RegisterGitlabAPI register the crawler function for Gitlab API.
 func RegisterGitlabAPI() OrganizationHandler {
-	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, error) {
+	return func(domain Domain, link string, repositories chan Repository, pa PA) (string, string, error) {
 		log.Debugf("RegisterGitlabAPI: %s ", link)
 
 		// Set BasicAuth header.
@@ -210,41 +222,49 @@ func RegisterGitlabAPI() OrganizationHandler {
 		if domain.BasicAuth != nil {
 			n, err := generateRandomInt(len(domain.BasicAuth))
 			if err != nil {
-				return link, err
+				return link, "", err
 			}
 			headers["Authorization"] = domain.BasicAuth[n]
 		}
 
 		u, err := url.Parse(link)
 		if err != nil {
-			return link, err
+			return link, "", err
 		}
 		// Set domain host to new host.
 		domain.Host = u.Hostname()
 
-		resp, err := httpclient.GetURL(link, headers)
+		resp, err := getURL(requestAPI, link, headers)
 		if err != nil {
-			return link, err
+			return link, "", err
 		}
 		if resp.Status.Code != http.StatusOK {
 			log.Warnf("Request returned: %s", string(resp.Body))
-			return "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+			return "", "", errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
 		}
 
 		if useGitlabGroups(u) {
 			var result GitlabGroups
 			err = json.Unmarshal(resp.Body, &result)
 			if err != nil {
-				return link, err
+				return link, "", err
 			}
 
 			err = addGitlabProjectsToRepositories(result.Projects, domain, pa, headers, repositories)
 			if err != nil {
-				return link, err
+				return link, "", err
 			}
 			err = addGitlabSharedProjectsToRepositories(result.SharedProjects, domain, pa, headers, repositories)
 			if err != nil {
-				return link, err
+				return link, "", err
+			}
+
+			// Walk the subgroups tree, as the group API only lists the projects
+			// directly belonging to the group.
+			visited := map[int]bool{result.ID: true}
+			err = addGitlabSubgroupsToRepositories(u, result.ID, 1, visited, domain, pa, headers, repositories)
+			if err != nil {
+				return link, "", err
 			}
 		} else {
 			var projects []GitlabProject
@@ -253,41 +273,41 @@ func RegisterGitlabAPI() OrganizationHandler {
 			log.Infof("Getting all projects: %v", plink)
 			url, err := url.Parse(plink)
 			if err != nil {
-				return plink, err
+				return plink, "", err
 			}
 
-			resp, err := httpclient.GetURL(url.String(), headers)
+			resp, err := getURL(requestAPI, url.String(), headers)
 			if err != nil {
-				return plink, err
+				return plink, "", err
 			}
 
 			if resp.Status.Code != http.StatusOK {
 				log.Infof("Request returned status code: %s", string(resp.Body))
-				return plink, err
+				return plink, "", err
 			}
 
 			if err = json.Unmarshal(resp.Body, &projects); err != nil {
-				return plink, err;
+				return plink, "", err
 			}
 
 			err = addGitlabProjectsToRepositories(projects, domain, pa, headers, repositories)
 			if err != nil {
-				return plink, err
+				return plink, "", err
 			}
 		}
 
 		// if last page for this organization, the Link is empty.
 		if len(resp.Headers.Get("Link")) == 0 {
-			return "", nil
+			return "", "", nil
 		}
 
 		// Return next url.
 		nextLink := httpclient.HeaderLink(resp.Headers.Get("Link"), "next")
 		if nextLink == "" {
-			return "", nil
+			return "", "", nil
 		}
 
-		return nextLink, nil
+		return nextLink, lastPage(resp.Headers), nil
 	}
 }
 
@@ -310,6 +330,7 @@ func RegisterSingleGitlabAPI() SingleRepoHandler {
 			log.Error(err)
 			return err
 		}
+		subpath := splitSubpath(u)
 
 		// Set domain host to new host.
 		domain.Host = u.Hostname()
@@ -319,7 +340,7 @@ func RegisterSingleGitlabAPI() SingleRepoHandler {
 		fullURL := "https://" + u.Hostname() + "/api/v4/projects/" + url.QueryEscape(repoString)
 
 		// Get single Repo
-		resp, err := httpclient.GetURL(fullURL, headers)
+		resp, err := getURL(requestAPI, fullURL, headers)
 		if err != nil {
 			return err
 		}
@@ -336,7 +357,7 @@ func RegisterSingleGitlabAPI() SingleRepoHandler {
 		}
 
 		// Join file raw URL string.
-		fileRawURL, err := generateGitlabRawURL(result.WebURL, result.DefaultBranch)
+		fileRawURL, err := generateGitlabRawURL(result.WebURL, result.DefaultBranch, subpath, domain.crawledFilename())
 		if err != nil {
 			return err
 		}
@@ -360,9 +381,11 @@ func RegisterSingleGitlabAPI() SingleRepoHandler {
 				Pa:          pa,
 				Headers:     headers,
 				Metadata:    metadata,
+				Subpath:     subpath,
+				Archived:    result.Archived,
 			}
 		} else {
-			return errors.New("repository is empty." + result.WebURL)
+			return fmt.Errorf("%w: empty", errRepositorySkipped)
 		}
 
 		return nil
@@ -370,12 +393,13 @@ func RegisterSingleGitlabAPI() SingleRepoHandler {
 }
 
 // generateGitlabRawURL returns the file Gitlab specific file raw url.
-func generateGitlabRawURL(baseURL, defaultBranch string) (string, error) {
+// subpath is the directory of the file, empty for the root of the repository.
+func generateGitlabRawURL(baseURL, defaultBranch, subpath, filename string) (string, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return "", err
 	}
-	u.Path = path.Join(u.Path, "raw", defaultBranch, viper.GetString("CRAWLED_FILENAME"))
+	u.Path = path.Join(u.Path, "raw", defaultBranch, subpath, filename)
 
 	return u.String(), err
 }
@@ -384,7 +408,7 @@ func generateGitlabRawURL(baseURL, defaultBranch string) (string, error) {
 func addGitlabProjectsToRepositories(projects []GitlabProject, domain Domain, pa PA, headers map[string]string, repositories chan Repository) error {
 	for _, v := range projects {
 		// Join file raw URL string.
-		rawURL, err := generateGitlabRawURL(v.WebURL, v.DefaultBranch)
+		rawURL, err := generateGitlabRawURL(v.WebURL, v.DefaultBranch, "", domain.crawledFilename())
 		if err != nil {
 			return err
 		}
@@ -407,6 +431,8 @@ func addGitlabProjectsToRepositories(projects []GitlabProject, domain Domain, pa
 				Pa:          pa,
 				Headers:     headers,
 				Metadata:    metadata,
+				Archived:    v.Archived,
+				Fork:        v.ForkedFromProject != nil,
 			}
 		}
 	}
@@ -418,7 +444,7 @@ func addGitlabProjectsToRepositories(projects []GitlabProject, domain Domain, pa
 func addGitlabSharedProjectsToRepositories(projects []GitlabSharedProject, domain Domain, pa PA, headers map[string]string, repositories chan Repository) error {
 	for _, v := range projects {
 		// Join file raw URL string.
-		rawURL, err := generateGitlabRawURL(v.WebURL, v.DefaultBranch)
+		rawURL, err := generateGitlabRawURL(v.WebURL, v.DefaultBranch, "", domain.crawledFilename())
 		if err != nil {
 			return err
 		}
@@ -441,6 +467,8 @@ func addGitlabSharedProjectsToRepositories(projects []GitlabSharedProject, domai
 				Pa:          pa,
 				Headers:     headers,
 				Metadata:    metadata,
+				Archived:    v.Archived,
+				Fork:        v.ForkedFromProject.ID != 0,
 			}
 		}
 	}
@@ -448,6 +476,84 @@ func addGitlabSharedProjectsToRepositories(projects []GitlabSharedProject, domai
 	return nil
 }
 
+// addGitlabSubgroupsToRepositories recursively adds the projects of all the subgroups
+// of the group groupID to repository channel.
+// Groups already in visited are skipped and the recursion stops at gitlabSubgroupsMaxDepth.
+func addGitlabSubgroupsToRepositories(apiURL *url.URL, groupID, depth int, visited map[int]bool, domain Domain, pa PA, headers map[string]string, repositories chan Repository) error {
+	if depth > gitlabSubgroupsMaxDepth {
+		log.Warnf("Not descending into the subgroups of GitLab group %d: maximum depth %d reached", groupID, gitlabSubgroupsMaxDepth)
+		return nil
+	}
+
+	subgroupsURL := *apiURL
+	subgroupsURL.Path = fmt.Sprintf("/api/v4/groups/%d/subgroups", groupID)
+	subgroupsURL.RawQuery = "per_page=100"
+	link := subgroupsURL.String()
+
+	for link != "" {
+		resp, err := getURL(requestAPI, link, headers)
+		if err != nil {
+			return err
+		}
+		if resp.Status.Code != http.StatusOK {
+			log.Warnf("Request returned: %s", string(resp.Body))
+			return errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+		}
+
+		var subgroups []GitlabGroups
+		err = json.Unmarshal(resp.Body, &subgroups)
+		if err != nil {
+			return err
+		}
+
+		for _, subgroup := range subgroups {
+			if visited[subgroup.ID] {
+				log.Debugf("GitLab group %s already visited, skipping", subgroup.FullPath)
+				continue
+			}
+			visited[subgroup.ID] = true
+
+			// The subgroups API doesn't return the projects, get the full group.
+			groupURL := *apiURL
+			groupURL.Path = fmt.Sprintf("/api/v4/groups/%d", subgroup.ID)
+			groupURL.RawQuery = ""
+
+			resp, err := getURL(requestAPI, groupURL.String(), headers)
+			if err != nil {
+				return err
+			}
+			if resp.Status.Code != http.StatusOK {
+				log.Warnf("Request returned: %s", string(resp.Body))
+				return errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+			}
+
+			var group GitlabGroups
+			err = json.Unmarshal(resp.Body, &group)
+			if err != nil {
+				return err
+			}
+
+			err = addGitlabProjectsToRepositories(group.Projects, domain, pa, headers, repositories)
+			if err != nil {
+				return err
+			}
+			err = addGitlabSharedProjectsToRepositories(group.SharedProjects, domain, pa, headers, repositories)
+			if err != nil {
+				return err
+			}
+
+			err = addGitlabSubgroupsToRepositories(apiURL, subgroup.ID, depth+1, visited, domain, pa, headers, repositories)
+			if err != nil {
+				return err
+			}
+		}
+
+		link = httpclient.HeaderLink(resp.Headers.Get("Link"), "next")
+	}
+
+	return nil
+}
+
 // GenerateGitlabAPIURL returns the api url of given Gitlab organization link.
 // IN: https://gitlab.org/blockninja
 // OUT:https://gitlab.com/api/v4/groups/blockninja
@@ -479,7 +585,7 @@ func IsGitlab(link string) bool {
 
 	u.Path = "api/v4/templates/gitlab_ci_ymls"
 
-	resp, err := httpclient.GetURL(u.String(), nil)
+	resp, err := getURL(requestAPI, u.String(), nil)
 	if err != nil {
 		log.Debugf("can %s use Gitlab API? No.", link)
 		return false
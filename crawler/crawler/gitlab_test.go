@@ -1,10 +1,14 @@
 package crawler
 
 import (
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 )
 
 // IsGitlab returns "true" if the url can use Gitlab API.
@@ -58,3 +62,45 @@ func TestGenerateGitlabAPIURL(t *testing.T) {
 	}
 
 }
+
+// gitlabGroupsFixture serves a GitLab group with nested subgroups, one of
+// which lists its own ancestor to simulate a cycle.
+var gitlabGroupsFixture = map[string]string{
+	"/api/v4/groups/parent": `{"id": 1, "full_path": "parent",
+		"projects": [{"path_with_namespace": "parent/p1", "default_branch": "master", "web_url": "https://gitlab.example.com/parent/p1"}]}`,
+	"/api/v4/groups/1/subgroups": `[{"id": 2, "full_path": "parent/child", "parent_id": 1}, {"id": 1, "full_path": "parent"}]`,
+	"/api/v4/groups/2": `{"id": 2, "full_path": "parent/child", "parent_id": 1,
+		"projects": [{"path_with_namespace": "parent/child/p2", "default_branch": "master", "web_url": "https://gitlab.example.com/parent/child/p2"}]}`,
+	"/api/v4/groups/2/subgroups": `[{"id": 3, "full_path": "parent/child/grandchild", "parent_id": 2}]`,
+	"/api/v4/groups/3": `{"id": 3, "full_path": "parent/child/grandchild", "parent_id": 2,
+		"projects": [{"path_with_namespace": "parent/child/grandchild/p3", "default_branch": "main", "web_url": "https://gitlab.example.com/parent/child/grandchild/p3"}]}`,
+	"/api/v4/groups/3/subgroups": `[]`,
+}
+
+func TestGitlabSubgroups(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := gitlabGroupsFixture[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	repositories := make(chan Repository, 10)
+	handler := RegisterGitlabAPI()
+	next, _, err := handler(Domain{Host: "gitlab.example.com"}, ts.URL+"/api/v4/groups/parent", repositories, PA{})
+	close(repositories)
+
+	assert.Nil(t, err)
+	assert.Empty(t, next)
+
+	var names []string
+	for repo := range repositories {
+		names = append(names, repo.Name)
+	}
+	assert.Equal(t, []string{"parent/p1", "parent/child/p2", "parent/child/grandchild/p3"}, names)
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+// hostSlots are the semaphores limiting the requests and clones in progress
+// to each host, by hostname.
+var hostSlots = struct {
+	sync.Mutex
+	slots map[string]chan struct{}
+}{slots: make(map[string]chan struct{})}
+
+// maxConcurrentPerHost returns the maximum number of requests and clones in
+// progress to the same host, MAX_CONCURRENT_PER_HOST. 0 means no limit.
+func maxConcurrentPerHost() int {
+	return viper.GetInt("MAX_CONCURRENT_PER_HOST")
+}
+
+// acquireHost waits for a free slot of host and returns the function
+// releasing it. It's an error if ctx is done before.
+func acquireHost(ctx context.Context, host string) (func(), error) {
+	max := maxConcurrentPerHost()
+	if max < 1 || host == "" {
+		return func() {}, nil
+	}
+
+	hostSlots.Lock()
+	slots, ok := hostSlots.slots[host]
+	if !ok || cap(slots) != max {
+		slots = make(chan struct{}, max)
+		hostSlots.slots[host] = slots
+	}
+	hostSlots.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// hostLimiters are the rate limiters of the requests to the hosts of the
+// domains with rate-limit in domains.yml, by hostname.
+var hostLimiters = struct {
+	sync.RWMutex
+	limiters map[string]*rate.Limiter
+}{limiters: make(map[string]*rate.Limiter)}
+
+// setHostsRateLimit applies the rate-limit and burst of the domains to the
+// requests to their hosts and to their API hosts (eg. api.github.com), so
+// the fragile instances can be crawled gently and the others quickly.
+// burst defaults to 1.
+func setHostsRateLimit(domains []Domain) {
+	limiters := make(map[string]*rate.Limiter)
+	for _, domain := range domains {
+		if domain.RateLimit <= 0 {
+			continue
+		}
+		burst := domain.Burst
+		if burst < 1 {
+			burst = 1
+		}
+
+		limiter := rate.NewLimiter(rate.Limit(domain.RateLimit), burst)
+		limiters[domain.Host] = limiter
+		limiters["api."+domain.Host] = limiter
+	}
+
+	hostLimiters.Lock()
+	defer hostLimiters.Unlock()
+	hostLimiters.limiters = limiters
+}
+
+// waitHostRate waits for the rate limit of host in domains.yml to allow a
+// request. It's an error if ctx is done before.
+func waitHostRate(ctx context.Context, host string) error {
+	hostLimiters.RLock()
+	limiter, ok := hostLimiters.limiters[host]
+	hostLimiters.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	return limiter.Wait(ctx)
+}
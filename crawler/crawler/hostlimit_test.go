@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireHost(t *testing.T) {
+	viper.Set("MAX_CONCURRENT_PER_HOST", 1)
+	defer viper.Set("MAX_CONCURRENT_PER_HOST", nil)
+
+	release, err := acquireHost(context.Background(), "gitlab.example.org")
+	assert.NoError(t, err)
+
+	// Other hosts are not limited by it.
+	other, err := acquireHost(context.Background(), "github.com")
+	assert.NoError(t, err)
+	other()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = acquireHost(ctx, "gitlab.example.org")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	release()
+	release, err = acquireHost(context.Background(), "gitlab.example.org")
+	assert.NoError(t, err)
+	release()
+}
+
+func TestGetURLConcurrentPerHost(t *testing.T) {
+	viper.Set("MAX_CONCURRENT_PER_HOST", 2)
+	defer viper.Set("MAX_CONCURRENT_PER_HOST", nil)
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := getURL(requestAPI, ts.URL, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 2, maxInFlight)
+}
+
+func TestWaitHostRate(t *testing.T) {
+	setHostsRateLimit([]Domain{{Host: "gitlab.example.org", RateLimit: 10, Burst: 2}, {Host: "github.com"}})
+	defer setHostsRateLimit(nil)
+
+	assert.NoError(t, waitHostRate(context.Background(), "gitlab.example.org"))
+	assert.NoError(t, waitHostRate(context.Background(), "api.gitlab.example.org"))
+
+	// The burst is over and the next request is in 100ms.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, waitHostRate(ctx, "gitlab.example.org"))
+
+	start := time.Now()
+	assert.NoError(t, waitHostRate(context.Background(), "gitlab.example.org"))
+	assert.True(t, time.Since(start) > 50*time.Millisecond)
+
+	// The hosts without rate-limit are not limited.
+	assert.NoError(t, waitHostRate(ctx, "github.com"))
+	assert.NoError(t, waitHostRate(ctx, "example.org"))
+}
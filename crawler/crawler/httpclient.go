@@ -0,0 +1,456 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/italia/developers-italia-backend/crawler/metrics"
+	"github.com/italia/httpclient-lib-go"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// requestKind is the type of an HTTP request, each with its own timeout.
+type requestKind int
+
+const (
+	// requestAPI is a call to the API of a code hosting: listings,
+	// repository metadata and the like.
+	requestAPI requestKind = iota
+	// requestRawFile is the download of a raw file, like the publiccode.yml.
+	requestRawFile
+	// requestAsset is a check of the URLs referenced by a publiccode.yml.
+	requestAsset
+)
+
+// Default timeouts of the HTTP requests, overridden by HTTP_API_TIMEOUT,
+// HTTP_RAW_FILE_TIMEOUT and HTTP_ASSET_TIMEOUT, or by HTTP_TIMEOUT for all
+// of them.
+const (
+	defaultHTTPAPITimeout     = 30 * time.Second
+	defaultHTTPRawFileTimeout = 2 * time.Minute
+	defaultHTTPAssetTimeout   = 10 * time.Second
+)
+
+// defaultHTTPConnectTimeout is the default timeout of the connection and of
+// the TLS handshake, overridden by HTTP_CONNECT_TIMEOUT.
+const defaultHTTPConnectTimeout = 10 * time.Second
+
+// defaultMaxRateLimitWait is the longest wait for a rate limit to reset,
+// overridden by MAX_RATELIMIT_WAIT.
+const defaultMaxRateLimitWait = time.Hour
+
+// userAgent is the User-Agent of the requests, like the one of httpclient-lib-go.
+const userAgent = "Golang_italia_backend_bot"
+
+var httpTimeouts = map[requestKind]struct {
+	key        string
+	defaultVal time.Duration
+}{
+	requestAPI:     {"HTTP_API_TIMEOUT", defaultHTTPAPITimeout},
+	requestRawFile: {"HTTP_RAW_FILE_TIMEOUT", defaultHTTPRawFileTimeout},
+	requestAsset:   {"HTTP_ASSET_TIMEOUT", defaultHTTPAssetTimeout},
+}
+
+// secureClient is the HTTP client of the requests to the hosts without
+// their own TLS settings in domains.yml.
+var secureClient = &http.Client{Transport: newTransport(nil, defaultHTTPConnectTimeout)}
+
+// errRequestTimeout is returned by the requests that timed out.
+var errRequestTimeout = errors.New("request timed out")
+
+// newTransport returns the transport of the HTTP clients, through the proxy
+// of proxyFunc, giving up on the connections and TLS handshakes taking longer
+// than connectTimeout. tlsConfig is nil for the default verification of the
+// TLS certificates.
+func newTransport(tlsConfig *tls.Config, connectTimeout time.Duration) *http.Transport {
+	transport := &http.Transport{
+		Proxy: proxyFunc(),
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: connectTimeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSClientConfig:     tlsConfig,
+	}
+
+	return transport
+}
+
+// connectTimeout returns the timeout of the connections and TLS handshakes.
+func connectTimeout() time.Duration {
+	if viper.IsSet("HTTP_CONNECT_TIMEOUT") {
+		return viper.GetDuration("HTTP_CONNECT_TIMEOUT")
+	}
+
+	return defaultHTTPConnectTimeout
+}
+
+// setConnectTimeout applies HTTP_CONNECT_TIMEOUT, and PROXY_URL, to the HTTP
+// clients. The clients of the hosts with their own TLS settings get them
+// with setHostsTLS.
+func setConnectTimeout() {
+	secureClient.Transport = newTransport(nil, connectTimeout())
+}
+
+// hostClients are the HTTP clients of the hosts of the domains with their
+// own TLS settings: insecure-skip-verify or ca-cert-file.
+var hostClients = struct {
+	sync.RWMutex
+	clients map[string]*http.Client
+}{clients: make(map[string]*http.Client)}
+
+// httpDoInject performs the HTTP requests, replaced in tests. The timeouts
+// come from the context of each request.
+var httpDoInject = doRequest
+
+// doRequest performs req with the TLS settings of its host.
+func doRequest(req *http.Request) (*http.Response, error) {
+	hostClients.RLock()
+	client, ok := hostClients.clients[req.URL.Hostname()]
+	hostClients.RUnlock()
+	if ok {
+		return client.Do(req)
+	}
+
+	return secureClient.Do(req)
+}
+
+// setHostsTLS applies the TLS settings of the domains to their hosts, and
+// only to them: insecure-skip-verify disables the verification of the
+// certificates, ca-cert-file trusts the CAs in the file besides the ones
+// of the system.
+func setHostsTLS(domains []Domain) error {
+	clients := make(map[string]*http.Client)
+	for _, domain := range domains {
+		tlsConfig, err := domainTLSConfig(domain)
+		if err != nil {
+			return fmt.Errorf("%s: %v", domain.Host, err)
+		}
+		if tlsConfig != nil {
+			clients[domain.Host] = &http.Client{Transport: newTransport(tlsConfig, connectTimeout())}
+		}
+	}
+
+	hostClients.Lock()
+	defer hostClients.Unlock()
+	hostClients.clients = clients
+
+	return nil
+}
+
+// domainTLSConfig returns the TLS settings of the requests to domain, nil
+// for the default ones.
+func domainTLSConfig(domain Domain) (*tls.Config, error) {
+	if domain.InsecureSkipVerify {
+		log.Warnf("!!! TLS certificates of %s are NOT verified (insecure-skip-verify in domains.yml) !!!", domain.Host)
+		return &tls.Config{InsecureSkipVerify: true}, nil // nolint: gosec
+	}
+	if domain.CACertFile == "" {
+		return nil, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	pem, err := ioutil.ReadFile(domain.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates in ca-cert-file %s", domain.CACertFile)
+	}
+
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// errRateLimited is returned by a request refused because of the rate limit.
+var errRateLimited = errors.New("rate limit reached")
+
+// rateLimitResets are the times the hosts that ran out of requests reset
+// their rate limit, so that the next requests wait for it. They are by
+// host and Authorization header, as each token has its own rate limit.
+var rateLimitResets = struct {
+	sync.Mutex
+	resets map[rateLimitKey]time.Time
+}{resets: make(map[rateLimitKey]time.Time)}
+
+// rateLimitKey identifies a rate limit.
+type rateLimitKey struct {
+	host          string
+	authorization string
+}
+
+// rateLimitReset returns when the rate limit of host with authorization
+// resets, zero if there are requests left.
+func rateLimitReset(host, authorization string) time.Time {
+	rateLimitResets.Lock()
+	defer rateLimitResets.Unlock()
+
+	return rateLimitResets.resets[rateLimitKey{host, authorization}]
+}
+
+// maxRateLimitWait returns the longest wait for a rate limit, MAX_RATELIMIT_WAIT.
+func maxRateLimitWait() time.Duration {
+	if viper.IsSet("MAX_RATELIMIT_WAIT") {
+		return viper.GetDuration("MAX_RATELIMIT_WAIT")
+	}
+
+	return defaultMaxRateLimitWait
+}
+
+// recordRateLimit records when the rate limit of host with authorization
+// resets if the response headers say no requests are left. The requests
+// left are in the host_ratelimit_remaining gauge.
+func recordRateLimit(host, authorization string, header http.Header, now time.Time) {
+	recordRateLimitRemaining(host, authorization, header, now)
+
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || !time.Unix(reset, 0).After(now) {
+		return
+	}
+
+	rateLimitResets.Lock()
+	defer rateLimitResets.Unlock()
+
+	rateLimitResets.resets[rateLimitKey{host, authorization}] = time.Unix(reset, 0)
+}
+
+// rateLimitsRemaining are the requests left in the rate limits, from the
+// last response to each of them.
+var rateLimitsRemaining = struct {
+	sync.Mutex
+	remaining map[rateLimitKey]float64
+}{remaining: make(map[rateLimitKey]float64)}
+
+// recordRateLimitRemaining sets the host_ratelimit_remaining gauge of host
+// from the X-RateLimit-Remaining header of GitHub, Gitea and Bitbucket or the
+// RateLimit-Remaining one of GitLab, if any. With the tokens in rotation, it's
+// the fewest requests left among them, not counting those already reset.
+func recordRateLimitRemaining(host, authorization string, header http.Header, now time.Time) {
+	value := header.Get("X-RateLimit-Remaining")
+	if value == "" {
+		value = header.Get("RateLimit-Remaining")
+	}
+	remaining, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+
+	rateLimitsRemaining.Lock()
+	rateLimitsRemaining.remaining[rateLimitKey{host, authorization}] = remaining
+	fewest := remaining
+	for key, left := range rateLimitsRemaining.remaining {
+		if key.host != host || left >= fewest {
+			continue
+		}
+		if left == 0 && !rateLimitReset(key.host, key.authorization).After(now) {
+			continue
+		}
+		fewest = left
+	}
+	rateLimitsRemaining.Unlock()
+
+	metrics.SetGaugeVec("host_ratelimit_remaining", viper.GetString("ELASTIC_PUBLICCODE_INDEX"),
+		prometheus.Labels{"host": host}, fewest)
+}
+
+// waitRateLimit waits for the rate limit of host with authorization to
+// reset, if no requests are left, up to MAX_RATELIMIT_WAIT. It returns early
+// when ctx is done.
+func waitRateLimit(ctx context.Context, host, authorization string) {
+	wait := time.Until(rateLimitReset(host, authorization))
+	if wait <= 0 {
+		return
+	}
+	if max := maxRateLimitWait(); wait > max {
+		wait = max
+	}
+
+	log.Infof("No requests left in the rate limit of %s, waiting %v", host, wait.Round(time.Second))
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+	}
+}
+
+// requestTimeout returns the timeout of the requests of kind.
+func requestTimeout(kind requestKind) time.Duration {
+	setting := httpTimeouts[kind]
+	if viper.IsSet(setting.key) {
+		return viper.GetDuration(setting.key)
+	}
+	if viper.IsSet("HTTP_TIMEOUT") {
+		return viper.GetDuration("HTTP_TIMEOUT")
+	}
+
+	return setting.defaultVal
+}
+
+// getURL GETs URL with the timeout of kind, each attempt with its own
+// context. Requests refused because of the rate limit are retried after
+// the wait asked by the server, up to RETRY_MAX_ATTEMPTS times.
+// Like httpclient.GetURL, it returns an error if the status is not 200 OK.
+func getURL(kind requestKind, URL string, headers map[string]string) (httpclient.HTTPResponse, error) {
+	return getURLContext(context.Background(), kind, URL, headers)
+}
+
+// getURLContext is getURL giving up when ctx is done, also while waiting
+// for the rate limit.
+// When the host has no requests left, it waits for the rate limit to reset
+// instead of failing, up to MAX_RATELIMIT_WAIT.
+func getURLContext(ctx context.Context, kind requestKind, URL string, headers map[string]string) (httpclient.HTTPResponse, error) {
+	return requestURLContext(ctx, kind, http.MethodGet, URL, headers)
+}
+
+// requestURLContext is getURLContext with another method than GET, eg. HEAD.
+func requestURLContext(ctx context.Context, kind requestKind, method, URL string, headers map[string]string) (httpclient.HTTPResponse, error) {
+	attempts, backoff := retrySettings()
+
+	var host string
+	if u, err := url.Parse(URL); err == nil {
+		host = u.Hostname()
+	}
+
+	for attempt := 1; ; attempt++ {
+		waitRateLimit(ctx, host, headers["Authorization"])
+
+		resp, wait, err := getURLOnce(ctx, kind, method, URL, headers)
+		if err != errRateLimited || attempt >= attempts {
+			return resp, err
+		}
+
+		if max := maxRateLimitWait(); wait > max {
+			return resp, fmt.Errorf("%w: reset in %v, more than MAX_RATELIMIT_WAIT (%v)", errRateLimited, wait, max)
+		}
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		log.Infof("Rate limit reached for %s (attempt %d/%d), waiting %v", URL, attempt, attempts, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return resp, err
+		}
+	}
+}
+
+// getURLOnce performs a single request of URL with method. If it was refused
+// because of the rate limit it returns errRateLimited and how long the server
+// asked to wait.
+func getURLOnce(ctx context.Context, kind requestKind, method, URL string, headers map[string]string) (httpclient.HTTPResponse, time.Duration, error) {
+	failed := func(err error) (httpclient.HTTPResponse, time.Duration, error) {
+		return httpclient.HTTPResponse{
+			Status: httpclient.ResponseStatus{Text: err.Error() + URL, Code: -1},
+		}, 0, err
+	}
+
+	req, err := http.NewRequest(method, URL, nil)
+	if err != nil {
+		return failed(err)
+	}
+
+	// The waits for a free slot of the host and for its rate-limit don't
+	// count in the timeout.
+	release, err := acquireHost(ctx, req.URL.Hostname())
+	if err != nil {
+		return failed(err)
+	}
+	defer release()
+	if err := waitHostRate(ctx, req.URL.Hostname()); err != nil {
+		return failed(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout(kind))
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	for k, v := range headers {
+		req.Header.Add(k, v)
+	}
+	version := "0.0.1_local"
+	if headers["version"] != "" {
+		version = headers["version"]
+	}
+	// GitHub requires the User-Agent to be set.
+	req.Header.Add("User-Agent", userAgent+"/"+version)
+
+	resp, err := httpDoInject(req)
+	if err != nil {
+		return failed(timeoutError(ctx, err))
+	}
+	defer resp.Body.Close()
+
+	response := httpclient.HTTPResponse{
+		Status:  httpclient.ResponseStatus{Text: resp.Status, Code: resp.StatusCode},
+		Headers: resp.Header,
+	}
+	recordRateLimit(req.URL.Hostname(), req.Header.Get("Authorization"), resp.Header, time.Now())
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		response.Body, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return failed(timeoutError(ctx, err))
+		}
+		return response, 0, nil
+	case resp.StatusCode == http.StatusNotFound:
+		log.Debugf("Status: %s - Resource: %s", resp.Status, URL)
+		return response, 0, errors.New("not found")
+	// GitHub refuses with 403 the requests over the rate limit, with
+	// Retry-After for the secondary rate limits.
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0",
+		resp.StatusCode == http.StatusForbidden && resp.Header.Get("Retry-After") != "":
+		log.Debugf("Status: %s - Resource: %s", resp.Status, URL)
+		return response, rateLimitWait(resp.Header, time.Now()), errRateLimited
+	case resp.StatusCode == http.StatusForbidden:
+		return response, 0, errors.New("forbidden resource")
+	default:
+		return response, 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// timeoutError wraps err in errRequestTimeout if the request failed because
+// it timed out, connecting or waiting for the response.
+func timeoutError(ctx context.Context, err error) error {
+	var netErr net.Error
+	if ctx.Err() == context.DeadlineExceeded || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %v", errRequestTimeout, err)
+	}
+
+	return err
+}
+
+// rateLimitWait returns how long the rate limit headers ask to wait, from
+// Retry-After or X-RateLimit-Reset. It's 0 if they are not set.
+func rateLimitWait(header http.Header, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if wait := time.Unix(reset, 0).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,293 @@
+package crawler
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/italia/developers-italia-backend/crawler/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetURLTimeouts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	viper.Set("HTTP_API_TIMEOUT", "5s")
+	viper.Set("HTTP_RAW_FILE_TIMEOUT", "1m")
+	defer viper.Set("HTTP_API_TIMEOUT", nil)
+	defer viper.Set("HTTP_RAW_FILE_TIMEOUT", nil)
+
+	var timeout time.Duration
+	defer func(do func(*http.Request) (*http.Response, error)) { httpDoInject = do }(httpDoInject)
+	httpDoInject = func(req *http.Request) (*http.Response, error) {
+		deadline, ok := req.Context().Deadline()
+		assert.True(t, ok)
+		timeout = time.Until(deadline).Round(time.Second)
+		return http.DefaultClient.Do(req)
+	}
+
+	resp, err := getURL(requestAPI, ts.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(resp.Body))
+	assert.Equal(t, 5*time.Second, timeout)
+
+	_, err = getURL(requestRawFile, ts.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, timeout)
+
+	_, err = getURL(requestAsset, ts.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultHTTPAssetTimeout, timeout)
+}
+
+func TestGetURLTimeoutExpires(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	viper.Set("HTTP_API_TIMEOUT", "50ms")
+	defer viper.Set("HTTP_API_TIMEOUT", nil)
+
+	resp, err := getURL(requestAPI, ts.URL, nil)
+	assert.True(t, errors.Is(err, errRequestTimeout), err)
+	assert.Equal(t, -1, resp.Status.Code)
+
+	_, err = getURL(requestRawFile, ts.URL, nil)
+	assert.NoError(t, err)
+}
+
+func TestHTTPTimeout(t *testing.T) {
+	// Restore the default clients once the settings are reset.
+	defer setConnectTimeout()
+
+	viper.Set("HTTP_TIMEOUT", "1m")
+	viper.Set("HTTP_ASSET_TIMEOUT", "5s")
+	defer viper.Set("HTTP_TIMEOUT", nil)
+	defer viper.Set("HTTP_ASSET_TIMEOUT", nil)
+
+	// HTTP_TIMEOUT applies to the requests without their own timeout.
+	assert.Equal(t, time.Minute, requestTimeout(requestAPI))
+	assert.Equal(t, time.Minute, requestTimeout(requestRawFile))
+	assert.Equal(t, 5*time.Second, requestTimeout(requestAsset))
+
+	assert.Equal(t, defaultHTTPConnectTimeout, connectTimeout())
+	viper.Set("HTTP_CONNECT_TIMEOUT", "3s")
+	defer viper.Set("HTTP_CONNECT_TIMEOUT", nil)
+	assert.Equal(t, 3*time.Second, connectTimeout())
+
+	setConnectTimeout()
+	transport := secureClient.Transport.(*http.Transport)
+	assert.Equal(t, 3*time.Second, transport.TLSHandshakeTimeout)
+}
+
+func TestGetURLContextCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	// Waiting for the rate limit doesn't hold a shutdown.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := getURLContext(ctx, requestAPI, ts.URL, nil)
+	assert.Equal(t, errRateLimited, err)
+	assert.True(t, time.Since(start) < 10*time.Second)
+
+	_, err = getURLContext(ctx, requestAPI, ts.URL, nil)
+	assert.Error(t, err)
+}
+
+func TestGetURLRateLimit(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	resp, err := getURL(requestAPI, ts.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(resp.Body))
+	assert.Equal(t, 2, requests)
+}
+
+func TestGetURLSecondaryRateLimit(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	resp, err := getURL(requestAPI, ts.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(resp.Body))
+	assert.Equal(t, 2, requests)
+}
+
+func TestGetURLMaxRateLimitWait(t *testing.T) {
+	viper.Set("MAX_RATELIMIT_WAIT", "100ms")
+	defer viper.Set("MAX_RATELIMIT_WAIT", nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	_, err := getURL(requestAPI, ts.URL, nil)
+	assert.True(t, errors.Is(err, errRateLimited))
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
+
+func TestGetURLWaitsForRateLimitReset(t *testing.T) {
+	viper.Set("MAX_RATELIMIT_WAIT", "200ms")
+	defer viper.Set("MAX_RATELIMIT_WAIT", nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	defer func() {
+		rateLimitResets.Lock()
+		delete(rateLimitResets.resets, rateLimitKey{host: "127.0.0.1"})
+		rateLimitResets.Unlock()
+	}()
+
+	// The last request left succeeds, the next one waits for the reset,
+	// capped to MAX_RATELIMIT_WAIT.
+	_, err := getURL(requestAPI, ts.URL, nil)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	_, err = getURL(requestAPI, ts.URL, nil)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+}
+
+func TestGetURLRateLimitRemaining(t *testing.T) {
+	metrics.RegisterPrometheusGaugeVec("host_ratelimit_remaining", "Test gauge.", "test", "host")
+
+	left := map[string]string{"": "42", "token a": "10"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GitLab's header.
+		w.Header().Set("RateLimit-Remaining", left[r.Header.Get("Authorization")])
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	URL := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+
+	gauge := func() float64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		assert.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() != "publiccode_crawler_test_host_ratelimit_remaining" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				if metric.GetLabel()[0].GetValue() == "localhost" {
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+		return -1
+	}
+
+	_, err := getURL(requestAPI, URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(42), gauge())
+
+	// The gauge has the fewest requests left among the tokens.
+	_, err = getURL(requestAPI, URL, map[string]string{"Authorization": "token a"})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), gauge())
+
+	_, err = getURL(requestAPI, URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), gauge())
+
+	left["token a"] = "50"
+	_, err = getURL(requestAPI, URL, map[string]string{"Authorization": "token a"})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(42), gauge())
+}
+
+func TestGetURLInsecureSkipVerify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	defer setHostsTLS(nil)
+
+	// The stub host has a self-signed certificate.
+	_, err := getURL(requestAPI, ts.URL, nil)
+	assert.Error(t, err)
+
+	assert.NoError(t, setHostsTLS([]Domain{{Host: "127.0.0.1", InsecureSkipVerify: true}}))
+	resp, err := getURL(requestAPI, ts.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(resp.Body))
+
+	// Other hosts are still verified.
+	assert.NoError(t, setHostsTLS([]Domain{{Host: "gitlab.example.org", InsecureSkipVerify: true}, {Host: "127.0.0.1"}}))
+	_, err = getURL(requestAPI, ts.URL, nil)
+	assert.Error(t, err)
+}
+
+func TestGetURLCACertFile(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	defer setHostsTLS(nil)
+
+	dir, err := ioutil.TempDir("", "crawler")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The CA of the stub host is its self-signed certificate.
+	caCertFile := filepath.Join(dir, "ca.pem")
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	assert.NoError(t, ioutil.WriteFile(caCertFile, pemCert, 0644))
+
+	assert.NoError(t, setHostsTLS([]Domain{{Host: "127.0.0.1", CACertFile: caCertFile}}))
+	resp, err := getURL(requestAPI, ts.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(resp.Body))
+	assert.Equal(t, []string{"-c", "http.sslCAInfo=" + caCertFile}, gitTLSArgs(Domain{CACertFile: caCertFile}))
+
+	assert.NoError(t, ioutil.WriteFile(caCertFile, []byte("not a certificate"), 0644))
+	assert.Error(t, setHostsTLS([]Domain{{Host: "127.0.0.1", CACertFile: caCertFile}}))
+	assert.Error(t, setHostsTLS([]Domain{{Host: "127.0.0.1", CACertFile: filepath.Join(dir, "missing.pem")}}))
+}
@@ -0,0 +1,171 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/italia/developers-italia-backend/crawler/elastic"
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ImportCatalog indexes in index the software of the catalog exported in
+// fname, either as NDJSON or as a JSON array, and moves ELASTIC_ALIAS to it
+// from the other software indices. The documents not matching the mapping
+// are reported and skipped.
+func (c *Crawler) ImportCatalog(fname, index string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = elastic.CreateIndexMapping(index, elastic.PubliccodeMapping, c.es)
+	if err != nil {
+		return err
+	}
+
+	var failedMu sync.Mutex
+	failed := 0
+	after := func(executionID int64, requests []es.BulkableRequest, response *es.BulkResponse, err error) {
+		failedMu.Lock()
+		defer failedMu.Unlock()
+
+		if err != nil {
+			log.Errorf("Bulk import into %s failed: %v", index, err)
+			failed += len(requests)
+			return
+		}
+		for _, item := range response.Failed() {
+			log.Warnf("Rejected software %s: %s", item.Id, item.Error.Reason)
+			failed++
+		}
+	}
+	processor, err := elastic.NewBulkProcessor("import", 500, 1, after, c.es)
+	if err != nil {
+		return err
+	}
+
+	imported, rejected := 0, 0
+	err = readCatalog(f, func(doc json.RawMessage) error {
+		id, problems, err := catalogDocument(doc)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			log.Warnf("Rejected software %s: %s", id, strings.Join(problems, ", "))
+			rejected++
+			return nil
+		}
+
+		processor.Add(es.NewBulkIndexRequest().Index(index).Type("software").Id(id).Doc(doc))
+		imported++
+		return nil
+	})
+	if closeErr := processor.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = elastic.Flush(index, c.es)
+	if err != nil {
+		return err
+	}
+	// Replace the software indices in the alias, not to serve the software twice.
+	err = elastic.AliasReplace(viper.GetString("ELASTIC_ALIAS"), index, []string{viper.GetString("ELASTIC_PUBLISHERS_INDEX")}, c.es)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Imported %d software into %s, %d rejected", imported-failed, index, rejected+failed)
+
+	return nil
+}
+
+// readCatalog calls fn with each software of the catalog in r, either a JSON
+// array or NDJSON. The summary line of the NDJSON exports is skipped.
+func readCatalog(r io.Reader, fn func(doc json.RawMessage) error) error {
+	br := bufio.NewReader(r)
+	array, err := startsWithArray(br)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(br)
+	if array {
+		// Consume the opening bracket.
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	for dec.More() {
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+		if isNDJSONSummary(doc) {
+			continue
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startsWithArray returns whether the first non-space character of br is
+// the opening bracket of a JSON array, without consuming it.
+func startsWithArray(br *bufio.Reader) (bool, error) {
+	for {
+		r, _, err := br.ReadRune()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !unicode.IsSpace(r) {
+			return r == '[', br.UnreadRune()
+		}
+	}
+}
+
+// isNDJSONSummary returns whether doc is the summary line of an NDJSON export.
+func isNDJSONSummary(doc json.RawMessage) bool {
+	var v map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return false
+	}
+	_, ok := v["_summary"]
+
+	return ok && len(v) == 1
+}
+
+// catalogDocument returns the ID of the software in doc and the problems
+// preventing it from being indexed with PubliccodeMapping.
+func catalogDocument(doc json.RawMessage) (string, []string, error) {
+	var v map[string]interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return "", []string{fmt.Sprintf("not a JSON object: %v", err)}, nil
+	}
+
+	id, _ := v["id"].(string)
+	if id == "" {
+		return "", []string{"id: missing"}, nil
+	}
+
+	problems, err := elastic.ValidateDocument(elastic.PubliccodeMapping, "software", v)
+
+	return id, problems, err
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportRoundTrip(t *testing.T) {
+	exported := []json.RawMessage{
+		json.RawMessage(`{"id":"a","name":"A","vitalityScore":42,"publiccode":{"name":"A","legal":{"license":"MIT"}}}`),
+		json.RawMessage(`{"id":"b","name":"B","descriptionFallback":true,"tags":["x","y"]}`),
+	}
+	sent := false
+	next := func() ([]json.RawMessage, error) {
+		if sent {
+			return nil, io.EOF
+		}
+		sent = true
+		return exported, nil
+	}
+
+	var out bytes.Buffer
+	_, err := writeNDJSON(&out, next, "run", time.Now())
+	assert.NoError(t, err)
+
+	var imported []json.RawMessage
+	err = readCatalog(&out, func(doc json.RawMessage) error {
+		id, problems, err := catalogDocument(doc)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, id)
+		assert.Empty(t, problems)
+		imported = append(imported, doc)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, exported, imported)
+
+	// The JSON array exports are read the same.
+	array, err := json.Marshal(exported)
+	assert.NoError(t, err)
+	imported = nil
+	err = readCatalog(bytes.NewReader(append([]byte("\n "), array...)), func(doc json.RawMessage) error {
+		imported = append(imported, doc)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, exported, imported)
+}
+
+func TestCatalogDocument(t *testing.T) {
+	_, problems, err := catalogDocument(json.RawMessage(`{"name":"A"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id: missing"}, problems)
+
+	id, problems, err := catalogDocument(json.RawMessage(`{"id":"a","vitalityScore":"high","descriptionFallback":"no"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", id)
+	assert.Len(t, problems, 2)
+	assert.True(t, strings.HasPrefix(problems[0], "descriptionFallback:"), problems[0])
+
+	_, problems, err = catalogDocument(json.RawMessage(`[1]`))
+	assert.NoError(t, err)
+	assert.Len(t, problems, 1)
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+)
+
+// fileValidators are the ETag and Last-Modified of the crawled file when
+// it was last indexed, with the file and the vitality the reports of the
+// unchanged software are made from.
+type fileValidators struct {
+	ETag          string   `json:"fileETag"`
+	LastModified  string   `json:"fileLastModified"`
+	RawPubliccode string   `json:"rawPubliccode"`
+	VitalityScore *float64 `json:"vitalityScore"`
+}
+
+// incrementalCrawl returns whether the files unchanged since they were
+// last indexed are skipped (INCREMENTAL_CRAWL).
+func incrementalCrawl() bool {
+	return viper.GetBool("INCREMENTAL_CRAWL")
+}
+
+// storedValidators returns the validators of the indexed document of
+// repository, empty if it was never indexed in this index.
+func (c *Crawler) storedValidators(ctx context.Context, repository Repository) (fileValidators, error) {
+	var stored fileValidators
+
+	doc, err := c.es.Get().
+		Index(c.index).
+		Type("software").
+		Id(repository.generateID()).
+		FetchSourceContext(es.NewFetchSourceContext(true).Include("fileETag", "fileLastModified", "rawPubliccode", "vitalityScore")).
+		Do(ctx)
+	if es.IsNotFound(err) {
+		return stored, nil
+	}
+	if err != nil {
+		return stored, err
+	}
+	if doc.Source == nil {
+		return stored, nil
+	}
+
+	err = json.Unmarshal(*doc.Source, &stored)
+
+	return stored, err
+}
+
+// conditionalHeaders returns headers with If-None-Match and
+// If-Modified-Since from the stored validators. headers is not modified.
+func conditionalHeaders(headers map[string]string, stored fileValidators) map[string]string {
+	conditional := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		conditional[k] = v
+	}
+	if stored.ETag != "" {
+		conditional["If-None-Match"] = stored.ETag
+	}
+	if stored.LastModified != "" {
+		conditional["If-Modified-Since"] = stored.LastModified
+	}
+
+	return conditional
+}
+
+// reportUnchanged adds the software of repository, whose file didn't change,
+// to the summary, the scorecard and the field statistics as it was last
+// indexed.
+func (c *Crawler) reportUnchanged(repository Repository, stored fileValidators) {
+	// Only the valid files are indexed.
+	c.summary.addValid()
+
+	// Indexed before the file was stored.
+	if stored.RawPubliccode == "" {
+		return
+	}
+
+	data := []byte(stored.RawPubliccode)
+	quality := qualityFromError(nil)
+	quality.validLicense = canonicalLicense(publiccodeLicense(data))
+	quality.urlMatch = urlMatches(publiccodeURL(data), repositoryURLs(repository)...)
+	quality.recentActivity = stored.VitalityScore != nil && *stored.VitalityScore > 0
+	c.scorecard.add(repository.Pa, quality)
+	c.fieldStats.add(data, nil)
+}
+
+// touchES updates the crawl time and lastSeen of the indexed document of
+// repository, whose file didn't change, leaving the rest as it is.
+func (c *Crawler) touchES(ctx context.Context, repository Repository) error {
+	_, err := c.es.Update().
+		Index(c.index).
+		Type("software").
+		Id(repository.generateID()).
+		Doc(map[string]interface{}{
+			"crawltime": time.Now().Format(time.RFC3339),
+			"lastSeen":  lastSeen(time.Now()),
+		}).
+		Do(ctx)
+
+	return err
+}
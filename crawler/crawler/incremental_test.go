@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	es "github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalHeaders(t *testing.T) {
+	headers := map[string]string{"Authorization": "token abc"}
+
+	assert.Equal(t, map[string]string{
+		"Authorization":     "token abc",
+		"If-None-Match":     `"v1"`,
+		"If-Modified-Since": "Wed, 14 Oct 2020 12:00:00 GMT",
+	}, conditionalHeaders(headers, fileValidators{ETag: `"v1"`, LastModified: "Wed, 14 Oct 2020 12:00:00 GMT"}))
+	assert.Equal(t, map[string]string{"Authorization": "token abc"}, conditionalHeaders(headers, fileValidators{}))
+	assert.Equal(t, map[string]string{"Authorization": "token abc"}, headers)
+}
+
+func TestStoredValidators(t *testing.T) {
+	repository := Repository{Name: "pcm/app", GitCloneURL: "https://github.com/pcm/app.git"}
+	unknown := Repository{Name: "pcm/new", GitCloneURL: "https://github.com/pcm/new.git"}
+
+	// Fake Elasticsearch with the previously indexed document of repository.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/publiccode/software/"+repository.generateID() {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"found": false}`)
+			return
+		}
+		fmt.Fprintf(w, `{"_id": "%s", "found": true, "_source": {"fileETag": "\"v1\""}}`, repository.generateID())
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crawler{es: client, index: "publiccode"}
+
+	stored, err := c.storedValidators(context.Background(), repository)
+	assert.NoError(t, err)
+	assert.Equal(t, fileValidators{ETag: `"v1"`}, stored)
+
+	// Never indexed.
+	stored, err = c.storedValidators(context.Background(), unknown)
+	assert.NoError(t, err)
+	assert.Equal(t, fileValidators{}, stored)
+}
+
+func TestTouchES(t *testing.T) {
+	repository := Repository{Name: "pcm/app", GitCloneURL: "https://github.com/pcm/app.git"}
+
+	var update struct {
+		Doc map[string]string `json:"doc"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/publiccode/software/"+repository.generateID()+"/_update", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"result": "updated"}`)
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crawler{es: client, index: "publiccode"}
+
+	assert.NoError(t, c.touchES(context.Background(), repository))
+	assert.Contains(t, update.Doc, "crawltime")
+	assert.Contains(t, update.Doc, "lastSeen")
+}
+
+func TestReportUnchanged(t *testing.T) {
+	repository := Repository{
+		Name:        "pcm/app",
+		GitCloneURL: "https://github.com/pcm/app.git",
+		Pa:          PA{CodiceIPA: "pcm", Name: "Presidenza"},
+	}
+	vitality := 42.0
+	stored := fileValidators{
+		ETag:          `"v1"`,
+		RawPubliccode: "url: https://github.com/pcm/app\nlegal:\n  license: AGPL-3.0-or-later\n",
+		VitalityScore: &vitality,
+	}
+
+	var c Crawler
+	c.reportUnchanged(repository, stored)
+	assert.Equal(t, 1, c.summary.valid)
+	assert.Equal(t, 1, c.fieldStats.software)
+	assert.Equal(t, []softwareQuality{{
+		completeMetadata: true,
+		validLicense:     true,
+		reachableAssets:  true,
+		urlMatch:         true,
+		recentActivity:   true,
+	}}, c.scorecard.qualities["pcm"])
+
+	// Indexed without the file, only the summary counts it.
+	c.reportUnchanged(repository, fileValidators{ETag: `"v1"`})
+	assert.Equal(t, 2, c.summary.valid)
+	assert.Equal(t, 1, c.fieldStats.software)
+}
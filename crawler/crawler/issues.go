@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	httpclient "github.com/italia/httpclient-lib-go"
+)
+
+// openCounts returns the number of open issues and pull (merge) requests of
+// repository, read from its metadata and the API of the code hosting.
+// They are nil if unknown or if issues or pull requests are disabled.
+func openCounts(ctx context.Context, repository Repository) (issues, pullRequests *int, err error) {
+	switch repository.Domain.API() {
+	case "github":
+		return githubOpenCounts(ctx, repository)
+	case "gitlab":
+		return gitlabOpenCounts(ctx, repository)
+	}
+
+	return nil, nil, nil
+}
+
+// githubOpenCounts returns the open issues and pull requests of a GitHub repository.
+// GitHub counts the pull requests as issues, so they are always fetched.
+func githubOpenCounts(ctx context.Context, repository Repository) (*int, *int, error) {
+	var metadata struct {
+		HasIssues       bool   `json:"has_issues"`
+		OpenIssuesCount int    `json:"open_issues_count"`
+		PullsURL        string `json:"pulls_url"`
+	}
+	if err := json.Unmarshal(repository.Metadata, &metadata); err != nil {
+		return nil, nil, err
+	}
+	if metadata.PullsURL == "" {
+		return nil, nil, nil
+	}
+
+	pullsURL := strings.Replace(metadata.PullsURL, "{/number}", "", 1) + "?state=open&per_page=1"
+	resp, err := getURLContext(ctx, requestAPI, pullsURL, repository.Headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.Status.Code != http.StatusOK {
+		return nil, nil, errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+	}
+
+	// With one pull request per page, the last page is the number of pull requests.
+	var pullRequests int
+	if last := httpclient.HeaderLink(resp.Headers.Get("Link"), "last"); last != "" {
+		u, err := url.Parse(last)
+		if err != nil {
+			return nil, nil, err
+		}
+		pullRequests, err = strconv.Atoi(u.Query().Get("page"))
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var pulls []json.RawMessage
+		if err := json.Unmarshal(resp.Body, &pulls); err != nil {
+			return nil, nil, err
+		}
+		pullRequests = len(pulls)
+	}
+
+	if !metadata.HasIssues {
+		return nil, &pullRequests, nil
+	}
+	issues := metadata.OpenIssuesCount - pullRequests
+
+	return &issues, &pullRequests, nil
+}
+
+// gitlabOpenCounts returns the open issues and merge requests of a GitLab project.
+func gitlabOpenCounts(ctx context.Context, repository Repository) (*int, *int, error) {
+	var metadata struct {
+		IssuesEnabled        bool `json:"issues_enabled"`
+		MergeRequestsEnabled bool `json:"merge_requests_enabled"`
+		OpenIssuesCount      int  `json:"open_issues_count"`
+		Links                struct {
+			MergeRequests string `json:"merge_requests"`
+		} `json:"_links"`
+	}
+	if err := json.Unmarshal(repository.Metadata, &metadata); err != nil {
+		return nil, nil, err
+	}
+
+	var issues, mergeRequests *int
+	if metadata.IssuesEnabled {
+		issues = &metadata.OpenIssuesCount
+	}
+	if !metadata.MergeRequestsEnabled || metadata.Links.MergeRequests == "" {
+		return issues, nil, nil
+	}
+
+	resp, err := getURLContext(ctx, requestAPI, metadata.Links.MergeRequests+"?state=opened&per_page=1", repository.Headers)
+	if err != nil {
+		return issues, nil, err
+	}
+	if resp.Status.Code != http.StatusOK {
+		return issues, nil, errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+	}
+
+	// GitLab omits X-Total on large result sets.
+	total, err := strconv.Atoi(resp.Headers.Get("X-Total"))
+	if err != nil {
+		return issues, nil, nil
+	}
+	mergeRequests = &total
+
+	return issues, mergeRequests, nil
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readMetadataFixture returns the metadata in testdata/metadata, pointing the
+// API URLs of host to baseURL.
+func readMetadataFixture(t *testing.T, name, host, baseURL string) []byte {
+	data, err := ioutil.ReadFile("testdata/metadata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []byte(strings.Replace(string(data), host, baseURL, -1))
+}
+
+func TestOpenCounts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/italia/app/pulls":
+			w.Header().Set("Link", `<`+"http://"+r.Host+r.URL.Path+`?state=open&per_page=1&page=2>; rel="next", `+
+				`<`+"http://"+r.Host+r.URL.Path+`?state=open&per_page=1&page=3>; rel="last"`)
+			_, _ = w.Write([]byte(`[{"number": 1}]`))
+		case "/api/v4/projects/1/merge_requests":
+			w.Header().Set("X-Total", "2")
+			_, _ = w.Write([]byte(`[{"iid": 1}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	github := Repository{
+		Domain:   Domain{Host: "github.com"},
+		Metadata: readMetadataFixture(t, "github.json", "https://api.github.com", ts.URL),
+	}
+	issues, pullRequests, err := openCounts(context.Background(), github)
+	assert.Nil(t, err)
+	require.NotNil(t, issues)
+	require.NotNil(t, pullRequests)
+	// GitHub counts the 3 pull requests in open_issues_count.
+	assert.Equal(t, 4, *issues)
+	assert.Equal(t, 3, *pullRequests)
+
+	gitlab := Repository{
+		Domain:   Domain{Host: "gitlab.com"},
+		Metadata: readMetadataFixture(t, "gitlab.json", "https://gitlab.com", ts.URL),
+	}
+	issues, pullRequests, err = openCounts(context.Background(), gitlab)
+	assert.Nil(t, err)
+	require.NotNil(t, issues)
+	require.NotNil(t, pullRequests)
+	assert.Equal(t, 4, *issues)
+	assert.Equal(t, 2, *pullRequests)
+
+	// Issues disabled.
+	gitlab.Metadata = []byte(`{"issues_enabled": false, "open_issues_count": 0}`)
+	issues, pullRequests, err = openCounts(context.Background(), gitlab)
+	assert.Nil(t, err)
+	assert.Nil(t, issues)
+	assert.Nil(t, pullRequests)
+
+	// No counts from Bitbucket.
+	issues, pullRequests, err = openCounts(context.Background(), Repository{Domain: Domain{Host: "bitbucket.org"}})
+	assert.Nil(t, err)
+	assert.Nil(t, issues)
+	assert.Nil(t, pullRequests)
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+)
+
+// Language is a programming language of a repository and its share of the
+// code, in percent.
+type Language struct {
+	Name    string  `json:"name"`
+	Percent float64 `json:"percent"`
+}
+
+// repoLanguages returns the programming languages of repository, most used
+// first, read from the API of the code hosting. They are nil if the code
+// hosting doesn't tell them.
+func repoLanguages(ctx context.Context, repository Repository) ([]Language, error) {
+	var metadata struct {
+		// GitHub.
+		LanguagesURL string `json:"languages_url"`
+		// GitLab.
+		Links struct {
+			Self string `json:"self"`
+		} `json:"_links"`
+		// Gitea.
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	}
+	if len(repository.Metadata) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(repository.Metadata, &metadata); err != nil {
+		return nil, err
+	}
+
+	var languagesURL string
+	switch repository.Domain.API() {
+	case "github":
+		languagesURL = metadata.LanguagesURL
+	case "gitlab":
+		if metadata.Links.Self != "" {
+			languagesURL = metadata.Links.Self + "/languages"
+		}
+	case "gitea":
+		u, err := url.Parse(metadata.HTMLURL)
+		if err != nil || metadata.FullName == "" {
+			return nil, err
+		}
+		u.Path = path.Join("/api/v1/repos", metadata.FullName, "languages")
+		languagesURL = u.String()
+	}
+	if languagesURL == "" {
+		return nil, nil
+	}
+
+	resp, err := getURLContext(ctx, requestAPI, languagesURL, repository.Headers)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status.Code != http.StatusOK {
+		return nil, errors.New("request returned an incorrect http.Status: " + resp.Status.Text)
+	}
+
+	// GitHub and Gitea count the bytes of each language, GitLab the
+	// percentages.
+	var shares map[string]float64
+	if err := json.Unmarshal(resp.Body, &shares); err != nil {
+		return nil, err
+	}
+
+	return languagePercents(shares), nil
+}
+
+// languagePercents returns the languages with their share of the total of
+// shares, most used first.
+func languagePercents(shares map[string]float64) []Language {
+	var total float64
+	for _, share := range shares {
+		total += share
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	languages := make([]Language, 0, len(shares))
+	for name, share := range shares {
+		languages = append(languages, Language{Name: name, Percent: share * 100 / total})
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if languages[i].Percent != languages[j].Percent {
+			return languages[i].Percent > languages[j].Percent
+		}
+		return languages[i].Name < languages[j].Name
+	})
+
+	return languages
+}
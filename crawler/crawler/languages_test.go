@@ -0,0 +1,59 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoLanguages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/italia/app/languages", "/api/v1/repos/comune/app/languages":
+			_, _ = w.Write([]byte(`{"Go": 7500, "Shell": 2500}`))
+		case "/api/v4/projects/1/languages":
+			_, _ = w.Write([]byte(`{"Python": 80.0, "HTML": 20.0}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	github := Repository{
+		Domain:   Domain{Host: "github.com"},
+		Metadata: readMetadataFixture(t, "github.json", "https://api.github.com", ts.URL),
+	}
+	languages, err := repoLanguages(context.Background(), github)
+	assert.Nil(t, err)
+	assert.Equal(t, []Language{{Name: "Go", Percent: 75}, {Name: "Shell", Percent: 25}}, languages)
+
+	gitlab := Repository{
+		Domain:   Domain{Host: "gitlab.com"},
+		Metadata: readMetadataFixture(t, "gitlab.json", "https://gitlab.com", ts.URL),
+	}
+	languages, err = repoLanguages(context.Background(), gitlab)
+	assert.Nil(t, err)
+	assert.Equal(t, []Language{{Name: "Python", Percent: 80}, {Name: "HTML", Percent: 20}}, languages)
+
+	gitea := Repository{
+		Domain:   Domain{Host: "gitea.example.org", Type: "gitea"},
+		Metadata: []byte(`{"full_name": "comune/app", "html_url": "` + ts.URL + `/comune/app"}`),
+	}
+	languages, err = repoLanguages(context.Background(), gitea)
+	assert.Nil(t, err)
+	assert.Equal(t, "Go", languages[0].Name)
+
+	// No languages from Bitbucket.
+	languages, err = repoLanguages(context.Background(), Repository{
+		Domain:   Domain{Host: "bitbucket.org"},
+		Metadata: []byte(`{"full_name": "comune/app"}`),
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, languages)
+
+	// Empty repository.
+	assert.Nil(t, languagePercents(map[string]float64{}))
+}
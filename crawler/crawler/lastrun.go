@@ -0,0 +1,128 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Results of a crawl in the last run status.
+const (
+	lastRunSuccess = "success"
+	lastRunFailure = "failure"
+)
+
+// lastRun is the status of the last crawl, written at its end, even if it
+// failed, and served at /last-run.
+type lastRun struct {
+	RunID           string      `json:"runID"`
+	Result          string      `json:"result"`
+	Error           string      `json:"error,omitempty"`
+	Timestamp       string      `json:"timestamp"`
+	StartTime       string      `json:"startTime"`
+	DurationSeconds float64     `json:"durationSeconds"`
+	Index           string      `json:"index"`
+	DryRun          bool        `json:"dryRun,omitempty"`
+	Preview         bool        `json:"preview,omitempty"`
+	Counts          CrawlCounts `json:"counts"`
+
+	// Mean seconds of the clone and activity calculation of a repository,
+	// carried over from the previous runs if none was done.
+	ActivitySeconds float64 `json:"activitySeconds,omitempty"`
+}
+
+// lastRunFile returns the path of the status of the last crawl.
+func lastRunFile() string {
+	return path.Join(viper.GetString("OUTPUT_DIR"), "last_run.json")
+}
+
+// lastRunStatus returns the status of the crawl ended at now with err.
+func (c *Crawler) lastRunStatus(err error, now time.Time) lastRun {
+	run := lastRun{
+		RunID:           c.runID,
+		Result:          lastRunSuccess,
+		Timestamp:       now.UTC().Format(time.RFC3339),
+		StartTime:       c.startTime.UTC().Format(time.RFC3339),
+		DurationSeconds: now.Sub(c.startTime).Seconds(),
+		Index:           c.index,
+		DryRun:          c.DryRun,
+		Preview:         c.preview,
+		Counts:          c.summary.counts(),
+		ActivitySeconds: c.summary.meanActivityDuration().Seconds(),
+	}
+	if err != nil {
+		run.Result = lastRunFailure
+		run.Error = err.Error()
+	}
+
+	return run
+}
+
+// writeLastRun writes run to fname.
+func writeLastRun(run lastRun, fname string) error {
+	jsonOut, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, jsonOut, 0644)
+}
+
+// readLastRun returns the status of the last crawl written to fname.
+func readLastRun(fname string) (lastRun, error) {
+	var run lastRun
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return run, err
+	}
+	err = json.Unmarshal(data, &run)
+
+	return run, err
+}
+
+// lastActivityDuration returns the mean time of the clone and activity
+// calculation of a repository in the last crawl written to fname, 0 if
+// unknown.
+func lastActivityDuration(fname string) time.Duration {
+	run, err := readLastRun(fname)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Can't read the last run status: %v", err)
+		}
+		return 0
+	}
+
+	return time.Duration(run.ActivitySeconds * float64(time.Second))
+}
+
+// lastRunHandler serves the status of the last crawl in fname, so it's
+// available across runs.
+func lastRunHandler(fname string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadFile(fname)
+		if os.IsNotExist(err) {
+			http.Error(w, "no crawl has run yet", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Errorf("Error reading the last run status: %v", err)
+			http.Error(w, "cannot read the last run status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "output", "last_run.json")
+
+	rec := httptest.NewRecorder()
+	lastRunHandler(fname).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/last-run", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	start := time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+	c := Crawler{runID: "run", startTime: start, index: "publiccodes"}
+	c.summary.addProcessed()
+	c.summary.addProcessed()
+	c.summary.addIndexed()
+	c.summary.addDormant("PA")
+
+	run := c.lastRunStatus(errors.New("Error updating Elastic Alias"), start.Add(90*time.Second))
+	assert.NoError(t, writeLastRun(run, fname))
+
+	rec = httptest.NewRecorder()
+	lastRunHandler(fname).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/last-run", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var served lastRun
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, lastRun{
+		RunID:           "run",
+		Result:          lastRunFailure,
+		Error:           "Error updating Elastic Alias",
+		Timestamp:       "2020-10-14T12:01:30Z",
+		StartTime:       "2020-10-14T12:00:00Z",
+		DurationSeconds: 90,
+		Index:           "publiccodes",
+		Counts:          CrawlCounts{Processed: 2, Indexed: 1, Dormant: 1},
+	}, served)
+
+	assert.Equal(t, lastRunSuccess, c.lastRunStatus(nil, start).Result)
+}
+
+func TestLastActivityDuration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "last_run.json")
+
+	assert.Equal(t, time.Duration(0), lastActivityDuration(fname))
+
+	var c Crawler
+	c.summary.addActivityDuration(1500 * time.Millisecond)
+	assert.NoError(t, writeLastRun(c.lastRunStatus(nil, time.Now()), fname))
+	assert.Equal(t, 1500*time.Millisecond, lastActivityDuration(fname))
+
+	// A run skipping the activity carries over the duration.
+	c = Crawler{}
+	c.summary.lastActivityDuration = lastActivityDuration(fname)
+	c.summary.addSkippedActivity()
+	assert.NoError(t, writeLastRun(c.lastRunStatus(nil, time.Now()), fname))
+	assert.Equal(t, 1500*time.Millisecond, lastActivityDuration(fname))
+}
@@ -0,0 +1,268 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alranel/go-spdx/spdx"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// spdxLicenses are the licenses of the SPDX list, by lowercase ID.
+var spdxLicenses = func() map[string]spdx.License {
+	licenses := make(map[string]spdx.License)
+	for _, license := range spdx.List() {
+		licenses[strings.ToLower(license.ID)] = license
+	}
+
+	return licenses
+}()
+
+// InvalidLicense is a publiccode.yml whose license is not valid SPDX.
+type InvalidLicense struct {
+	FileRawURL string `json:"fileRawURL"`
+	License    string `json:"license"`
+	Reason     string `json:"reason"`
+}
+
+// errorInvalidLicense is a license that's not a valid SPDX expression.
+type errorInvalidLicense struct {
+	reason string
+}
+
+func (e errorInvalidLicense) Error() string {
+	return "invalid SPDX license: " + e.reason
+}
+
+// publiccodeLicense returns the legal.license of a publiccode.yml.
+func publiccodeLicense(data []byte) string {
+	var pc struct {
+		Legal struct {
+			License string `yaml:"license"`
+		} `yaml:"legal"`
+	}
+	if err := yaml.Unmarshal(data, &pc); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(pc.Legal.License)
+}
+
+// licenseAllowed returns whether the SPDX license expression is made of the
+// allowed licenses, evaluated like normalizeLicense with AND binding tighter
+// than OR: one allowed alternative is enough for OR, all are needed for AND.
+// Licenses are compared case-insensitively, normalized like normalizeLicense
+// (eg. "GPL-3.0" is "GPL-3.0-only"). "WITH" exceptions are ignored.
+func licenseAllowed(expression string, allowed []string) bool {
+	allowedIDs := make(map[string]bool, len(allowed))
+	for _, id := range allowed {
+		allowedIDs[licenseKey(id)] = true
+	}
+
+	p := newLicenseParser(expression)
+	p.accept = func(id string) bool {
+		return allowedIDs[strings.ToLower(id)]
+	}
+
+	_, accepted, err := p.or()
+
+	return err == nil && p.peek() == "" && accepted
+}
+
+// licenseKey returns the lowercase canonical SPDX ID of the license id, id
+// lowercased if it's not an SPDX license.
+func licenseKey(id string) string {
+	id = strings.TrimSpace(id)
+	if canonical, _, err := spdxLicenseID(id); err == nil {
+		id = canonical
+	}
+
+	return strings.ToLower(id)
+}
+
+// checkLicense returns whether the license of the publiccode.yml is not in
+// ALLOWED_LICENSES. All the licenses are allowed if it's not set.
+// license is normalized like normalizeLicense, if valid.
+func checkLicense(data []byte) (license string, disallowed bool) {
+	license = publiccodeLicense(data)
+	if normalized, _, err := normalizeLicense(license); err == nil {
+		license = normalized
+	}
+	if !viper.IsSet("ALLOWED_LICENSES") {
+		return license, false
+	}
+
+	return license, !licenseAllowed(license, viper.GetStringSlice("ALLOWED_LICENSES"))
+}
+
+// normalizeLicense validates the SPDX license expression and returns it
+// with the IDs and operators in their canonical case and the deprecated GNU
+// IDs replaced, eg. "GPL-3.0" with "GPL-3.0-only" and "GPL-3.0+" with
+// "GPL-3.0-or-later". openSource is whether the licenses are OSI approved:
+// one alternative is enough for OR, all are needed for AND.
+func normalizeLicense(expression string) (normalized string, openSource bool, err error) {
+	p := newLicenseParser(expression)
+	if len(p.tokens) == 0 {
+		return "", false, errorInvalidLicense{"missing"}
+	}
+
+	normalized, openSource, err = p.or()
+	if err != nil {
+		return "", false, err
+	}
+	if p.peek() != "" {
+		return "", false, errorInvalidLicense{fmt.Sprintf("unexpected %q", p.peek())}
+	}
+
+	return normalized, openSource, nil
+}
+
+// canonicalLicense returns whether the license expression is valid SPDX and
+// already as normalizeLicense returns it, eg. not "GPL-3.0" nor "mit".
+func canonicalLicense(expression string) bool {
+	normalized, _, err := normalizeLicense(expression)
+
+	return err == nil && normalized == expression
+}
+
+// licenseParser parses the tokens of an SPDX license expression, where AND
+// binds tighter than OR, and evaluates whether it's accepted: one accepted
+// alternative is enough for OR, all are needed for AND.
+type licenseParser struct {
+	tokens []string
+	pos    int
+
+	// accept tells whether a license, by canonical ID, is accepted. The OSI
+	// approved ones are if nil.
+	accept func(id string) bool
+}
+
+// newLicenseParser returns the parser of the tokens of expression.
+func newLicenseParser(expression string) *licenseParser {
+	replacer := strings.NewReplacer("(", " ( ", ")", " ) ")
+
+	return &licenseParser{tokens: strings.Fields(replacer.Replace(expression))}
+}
+
+// peek returns the next token, empty at the end.
+func (p *licenseParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the next token, empty at the end.
+func (p *licenseParser) next() string {
+	token := p.peek()
+	p.pos++
+
+	return token
+}
+
+func (p *licenseParser) or() (string, bool, error) {
+	expression, accepted, err := p.and()
+	for err == nil && strings.EqualFold(p.peek(), "OR") {
+		p.next()
+
+		var right string
+		var rightAccepted bool
+		right, rightAccepted, err = p.and()
+		expression, accepted = expression+" OR "+right, accepted || rightAccepted
+	}
+
+	return expression, accepted, err
+}
+
+func (p *licenseParser) and() (string, bool, error) {
+	expression, accepted, err := p.license()
+	for err == nil && strings.EqualFold(p.peek(), "AND") {
+		p.next()
+
+		var right string
+		var rightAccepted bool
+		right, rightAccepted, err = p.license()
+		expression, accepted = expression+" AND "+right, accepted && rightAccepted
+	}
+
+	return expression, accepted, err
+}
+
+// license parses a license, with its exception if any, or a parenthesized
+// expression.
+func (p *licenseParser) license() (string, bool, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return "", false, errorInvalidLicense{"unexpected end"}
+	case token == "(":
+		expression, accepted, err := p.or()
+		if err != nil {
+			return "", false, err
+		}
+		if p.next() != ")" {
+			return "", false, errorInvalidLicense{"missing )"}
+		}
+		return "(" + expression + ")", accepted, nil
+	case isLicenseOperator(token):
+		return "", false, errorInvalidLicense{fmt.Sprintf("unexpected %q", token)}
+	}
+
+	id, openSource, err := spdxLicenseID(token)
+	if err != nil {
+		return "", false, err
+	}
+	accepted := openSource
+	if p.accept != nil {
+		accepted = p.accept(id)
+	}
+
+	if strings.EqualFold(p.peek(), "WITH") {
+		p.next()
+		exception := p.next()
+		if exception == "" || isLicenseOperator(exception) {
+			return "", false, errorInvalidLicense{"missing exception after WITH"}
+		}
+		id += " WITH " + exception
+	}
+
+	return id, accepted, nil
+}
+
+// isLicenseOperator returns whether token is an operator or a parenthesis.
+func isLicenseOperator(token string) bool {
+	switch strings.ToUpper(token) {
+	case "AND", "OR", "WITH", "(", ")":
+		return true
+	}
+
+	return false
+}
+
+// spdxLicenseID returns the canonical SPDX ID of the license token, with the
+// trailing "+" for "or later", and whether it's OSI approved.
+func spdxLicenseID(token string) (string, bool, error) {
+	orLater := strings.HasSuffix(token, "+")
+	key := strings.ToLower(strings.TrimSuffix(token, "+"))
+
+	license, ok := spdxLicenses[key]
+	if !ok {
+		return "", false, errorInvalidLicense{fmt.Sprintf("unknown license %q", token)}
+	}
+
+	// The GNU licenses have versions for "only" and "or later".
+	if only, ok := spdxLicenses[key+"-only"]; ok {
+		if later, ok := spdxLicenses[key+"-or-later"]; ok && orLater {
+			return later.ID, later.OSIApproved, nil
+		}
+		return only.ID, only.OSIApproved, nil
+	}
+
+	if orLater {
+		return license.ID + "+", license.OSIApproved, nil
+	}
+
+	return license.ID, license.OSIApproved, nil
+}
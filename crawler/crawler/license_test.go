@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLicenseAllowed(t *testing.T) {
+	allowed := []string{"MIT", "EUPL-1.2", "GPL-2.0-only"}
+
+	assert.True(t, licenseAllowed("MIT", allowed))
+	assert.True(t, licenseAllowed("eupl-1.2", allowed))
+	assert.True(t, licenseAllowed("AGPL-3.0-or-later OR MIT", allowed))
+	assert.True(t, licenseAllowed("(MIT AND EUPL-1.2)", allowed))
+	assert.True(t, licenseAllowed("GPL-2.0-only WITH Classpath-exception-2.0", allowed))
+
+	assert.False(t, licenseAllowed("AGPL-3.0-or-later", allowed))
+	assert.False(t, licenseAllowed("MIT AND AGPL-3.0-or-later", allowed))
+	assert.False(t, licenseAllowed("", allowed))
+
+	// The deprecated GNU IDs are normalized, declared and allowed.
+	assert.True(t, licenseAllowed("GPL-2.0", allowed))
+	assert.True(t, licenseAllowed("AGPL-3.0+", []string{"AGPL-3.0-or-later"}))
+	assert.True(t, licenseAllowed("AGPL-3.0-only", []string{"AGPL-3.0"}))
+	assert.False(t, licenseAllowed("GPL-2.0+", allowed))
+
+	// AND binds tighter than OR, as in normalizeLicense.
+	assert.True(t, licenseAllowed("AGPL-3.0-or-later AND Apache-2.0 OR MIT", allowed))
+	assert.True(t, licenseAllowed("MIT AND EUPL-1.2 OR AGPL-3.0-or-later", allowed))
+	assert.False(t, licenseAllowed("MIT AND (EUPL-1.2 OR AGPL-3.0-or-later) AND Apache-2.0", allowed))
+	assert.False(t, licenseAllowed("MIT OR", allowed))
+}
+
+func TestCanonicalLicense(t *testing.T) {
+	assert.True(t, canonicalLicense("AGPL-3.0-or-later"))
+	assert.True(t, canonicalLicense("(MIT OR EUPL-1.2) AND GPL-2.0-only WITH Classpath-exception-2.0"))
+
+	assert.False(t, canonicalLicense(""))
+	assert.False(t, canonicalLicense("mit"))
+	assert.False(t, canonicalLicense("GPL-3.0"))
+	assert.False(t, canonicalLicense("Proprietary"))
+}
+
+func TestCheckLicense(t *testing.T) {
+	viper.Set("ALLOWED_LICENSES", []string{"AGPL-3.0-or-later"})
+	defer viper.Set("ALLOWED_LICENSES", nil)
+
+	license, disallowed := checkLicense([]byte("legal:\n  license: agpl-3.0+\n"))
+	assert.Equal(t, "AGPL-3.0-or-later", license)
+	assert.False(t, disallowed)
+
+	license, disallowed = checkLicense([]byte("legal:\n  license: GPL-3.0\n"))
+	assert.Equal(t, "GPL-3.0-only", license)
+	assert.True(t, disallowed)
+}
+
+func TestPubliccodeLicense(t *testing.T) {
+	assert.Equal(t, "AGPL-3.0-or-later", publiccodeLicense([]byte("legal:\n  license: AGPL-3.0-or-later\n")))
+	assert.Equal(t, "", publiccodeLicense([]byte("name: test\n")))
+}
+
+func TestNormalizeLicense(t *testing.T) {
+	tests := []struct {
+		expression string
+		normalized string
+		openSource bool
+	}{
+		{"MIT", "MIT", true},
+		{"eupl-1.2", "EUPL-1.2", true},
+		{"GPL-3.0", "GPL-3.0-only", true},
+		{"AGPL-3.0+", "AGPL-3.0-or-later", true},
+		{"CC-BY-4.0", "CC-BY-4.0", false},
+		{"CC-BY-4.0 or MIT", "CC-BY-4.0 OR MIT", true},
+		{"CC-BY-4.0 AND MIT", "CC-BY-4.0 AND MIT", false},
+		{"(mit  AND apache-2.0) OR CC-BY-4.0", "(MIT AND Apache-2.0) OR CC-BY-4.0", true},
+		{"GPL-2.0-only WITH Classpath-exception-2.0", "GPL-2.0-only WITH Classpath-exception-2.0", true},
+	}
+	for _, test := range tests {
+		normalized, openSource, err := normalizeLicense(test.expression)
+		assert.NoError(t, err, test.expression)
+		assert.Equal(t, test.normalized, normalized, test.expression)
+		assert.Equal(t, test.openSource, openSource, test.expression)
+	}
+
+	for _, expression := range []string{"", "Not-A-License", "MIT OR", "(MIT", "MIT AND AND EUPL-1.2", "MIT EUPL-1.2", "MIT WITH"} {
+		_, _, err := normalizeLicense(expression)
+		assert.IsType(t, errorInvalidLicense{}, err, expression)
+	}
+}
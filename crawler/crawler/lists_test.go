@@ -2,9 +2,15 @@ package crawler
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -73,3 +79,77 @@ repos:
 	// assert.True(t, IsRepoInBlackList("https://github.com/italia/repo2"))
 	// assert.False(t, IsRepoInBlackList("https://github.com/italia/repo3"))
 }
+
+func TestBlacklistAllowedHosts(t *testing.T) {
+	viper.Set("BLACKLIST_ALLOWED_HOSTS", []string{"gitlab.example.org"})
+	defer viper.Set("BLACKLIST_ALLOWED_HOSTS", nil)
+
+	c := Crawler{repositories: make(chan Repository, 3)}
+	c.repositories <- Repository{GitCloneURL: "https://github.com/italia/repo1.git"}
+	c.repositories <- Repository{GitCloneURL: "https://gitlab.example.org/italia/repo2.git"}
+	c.repositories <- Repository{GitCloneURL: "https://github.com/italia/repo3.git"}
+	close(c.repositories)
+
+	// The allowlist takes precedence over the blacklist.
+	toBeRemoved := c.removeBlackListedFromRepositories(map[string]string{
+		"https://github.com/italia/repo1.git":         "https://github.com/italia/repo1",
+		"https://gitlab.example.org/italia/repo2.git": "https://gitlab.example.org/italia/repo2",
+	})
+	assert.Equal(t, []string{"https://github.com/italia/repo1"}, toBeRemoved)
+
+	var kept []string
+	for repo := range c.repositories {
+		kept = append(kept, repo.GitCloneURL)
+	}
+	assert.Equal(t, []string{"https://gitlab.example.org/italia/repo2.git", "https://github.com/italia/repo3.git"}, kept)
+
+	assert.True(t, isHostAllowlisted("https://GitLab.example.org/italia/repo2"))
+	assert.False(t, isHostAllowlisted("https://github.com/italia/repo1"))
+}
+
+func TestBlacklistedReposContains(t *testing.T) {
+	viper.Set("BLACKLIST_ALLOWED_HOSTS", []string{"gitlab.example.org"})
+	defer viper.Set("BLACKLIST_ALLOWED_HOSTS", nil)
+
+	blacklisted := BlacklistedRepos{
+		{URL: "https://github.com/italia/repo1"},
+		{URL: "https://gitlab.example.org/italia/repo2"},
+	}
+	assert.True(t, blacklisted.Contains("https://github.com/italia/repo1"))
+	assert.False(t, blacklisted.Contains("https://gitlab.example.org/italia/repo2"))
+	assert.False(t, blacklisted.Contains("https://github.com/italia/repo3"))
+	assert.False(t, BlacklistedRepos(nil).Contains("https://github.com/italia/repo1"))
+}
+
+func TestRemoteBlacklist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	available := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "repos:\n  - url: https://github.com/italia/repo1\n")
+	}))
+	defer ts.Close()
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	viper.Set("BLACKLIST_URLS", []string{ts.URL + "/blacklist.yml"})
+	defer viper.Set("CRAWLER_DATADIR", nil)
+	defer viper.Set("BLACKLIST_URLS", nil)
+
+	expected := map[string]string{"https://github.com/italia/repo1.git": "https://github.com/italia/repo1"}
+	assert.Equal(t, expected, GetAllBlackListedRepos())
+
+	// If the blacklist can't be downloaded, the copy saved is used.
+	available = false
+	assert.Equal(t, expected, GetAllBlackListedRepos())
+
+	os.RemoveAll(filepath.Join(dir, "blacklists"))
+	assert.Empty(t, GetAllBlackListedRepos())
+}
@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Fields of the repository context in the log entries.
+const (
+	logFieldRepository = "repository"
+	logFieldHostname   = "hostname"
+	logFieldCloneURL   = "cloneURL"
+)
+
+// SetLogFormat sets the format of the logs: "text", the default, or "json".
+func SetLogFormat(format string) error {
+	formatter, err := logFormatter(format)
+	if err != nil {
+		return err
+	}
+	log.SetFormatter(formatter)
+
+	return nil
+}
+
+// logFormatter returns the logrus formatter of format.
+func logFormatter(format string) (log.Formatter, error) {
+	switch format {
+	case "", "text":
+		return &repositoryTextFormatter{}, nil
+	case "json":
+		return &log.JSONFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown LOG_FORMAT %q, it can be text or json", format)
+	}
+}
+
+// repositoryLogger returns the logger of the messages about repository,
+// with its context in structured fields.
+func repositoryLogger(repository Repository) *log.Entry {
+	return log.WithFields(log.Fields{
+		logFieldRepository: repository.Name,
+		logFieldHostname:   repository.Hostname,
+		logFieldCloneURL:   repository.GitCloneURL,
+	})
+}
+
+// repositoryTextFormatter is the logrus text formatter, printing the
+// repository context as a "[name]" prefix of the message like it always
+// did, instead of fields.
+type repositoryTextFormatter struct {
+	log.TextFormatter
+}
+
+// Format renders a single log entry.
+func (f *repositoryTextFormatter) Format(entry *log.Entry) ([]byte, error) {
+	name, ok := entry.Data[logFieldRepository]
+	if !ok {
+		return f.TextFormatter.Format(entry)
+	}
+
+	prefixed := *entry
+	prefixed.Message = fmt.Sprintf("[%v] %s", name, entry.Message)
+	prefixed.Data = make(log.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		switch k {
+		case logFieldRepository, logFieldHostname, logFieldCloneURL:
+		default:
+			prefixed.Data[k] = v
+		}
+	}
+
+	return f.TextFormatter.Format(&prefixed)
+}
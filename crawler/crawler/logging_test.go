@@ -0,0 +1,40 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogFormatter(t *testing.T) {
+	_, err := logFormatter("xml")
+	assert.Error(t, err)
+
+	repository := Repository{Name: "italia/example", Hostname: "github.com", GitCloneURL: "https://github.com/italia/example.git"}
+
+	formatter, err := logFormatter("")
+	assert.NoError(t, err)
+	out, err := formatter.Format(repositoryLogger(repository).WithField("other", 1))
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `msg="[italia/example] `)
+	assert.Contains(t, string(out), "other=1")
+	assert.NotContains(t, string(out), "hostname=")
+
+	formatter, err = logFormatter("json")
+	assert.NoError(t, err)
+	entry := repositoryLogger(repository)
+	entry.Message = "GOOD publiccode.yml"
+	entry.Level = log.InfoLevel
+	out, err = formatter.Format(entry)
+	assert.NoError(t, err)
+
+	var fields map[string]interface{}
+	assert.NoError(t, json.NewDecoder(bytes.NewReader(out)).Decode(&fields))
+	assert.Equal(t, "GOOD publiccode.yml", fields["msg"])
+	assert.Equal(t, "italia/example", fields["repository"])
+	assert.Equal(t, "github.com", fields["hostname"])
+	assert.Equal(t, "https://github.com/italia/example.git", fields["cloneURL"])
+}
@@ -0,0 +1,29 @@
+package crawler
+
+import (
+	"time"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+)
+
+// maintenanceContract returns the end of the maintenance contract of the
+// software, the latest of its contractors, and whether it's expired at now.
+// until is zero if the software is not maintained under contract.
+func maintenanceContract(pc publiccode.PublicCode, now time.Time) (until time.Time, expired bool) {
+	if pc.Maintenance.Type != "contract" {
+		return time.Time{}, false
+	}
+
+	for _, contractor := range pc.Maintenance.Contractors {
+		if contractor.Until.After(until) {
+			until = contractor.Until
+		}
+	}
+
+	if until.IsZero() {
+		return until, false
+	}
+
+	// The contract is valid for the whole "until" day.
+	return until, !now.Before(until.AddDate(0, 0, 1))
+}
@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceContract(t *testing.T) {
+	now := time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	withMaintenance := func(maintenanceType string, until ...time.Time) publiccode.PublicCode {
+		var pc publiccode.PublicCode
+		pc.Maintenance.Type = maintenanceType
+		for _, u := range until {
+			pc.Maintenance.Contractors = append(pc.Maintenance.Contractors, publiccode.Contractor{Name: "Contractor", Until: u})
+		}
+		return pc
+	}
+
+	// Internal
+	until, expired := maintenanceContract(withMaintenance("internal"), now)
+	assert.True(t, until.IsZero())
+	assert.False(t, expired)
+
+	// Contract, active
+	active := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	until, expired = maintenanceContract(withMaintenance("contract", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), active), now)
+	assert.Equal(t, active, until)
+	assert.False(t, expired)
+
+	// Contract, ending today
+	today := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+	_, expired = maintenanceContract(withMaintenance("contract", today), now)
+	assert.False(t, expired)
+
+	// Contract, expired
+	past := time.Date(2020, 6, 14, 0, 0, 0, 0, time.UTC)
+	until, expired = maintenanceContract(withMaintenance("contract", past), now)
+	assert.Equal(t, past, until)
+	assert.True(t, expired)
+}
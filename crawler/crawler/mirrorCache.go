@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/italia/developers-italia-backend/crawler/metrics"
+	"github.com/spf13/viper"
+)
+
+// normalizeCloneURL returns gitURL without the scheme, the credentials and
+// the trailing ".git", lowercasing the host.
+func normalizeCloneURL(gitURL string) string {
+	u := strings.TrimSpace(gitURL)
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	}
+	u = strings.TrimSuffix(strings.TrimRight(u, "/"), ".git")
+
+	host, rest := u, ""
+	if i := strings.Index(u, "/"); i >= 0 {
+		host, rest = u[:i], u[i:]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+
+	return strings.ToLower(host) + rest
+}
+
+// mirrorPath returns the path of the bare mirror of gitURL in the cache.
+func mirrorPath(cacheDir, gitURL string) string {
+	key := fmt.Sprintf("%x", sha1.Sum([]byte(normalizeCloneURL(gitURL))))
+
+	return filepath.Join(cacheDir, key[:2], key+".git")
+}
+
+// updateMirror creates or updates the bare mirror of gitURL in
+// MIRROR_CACHE_DIR and returns its path.
+func updateMirror(ctx context.Context, domain Domain, gitURL, index string) (string, error) {
+	path := mirrorPath(viper.GetString("MIRROR_CACHE_DIR"), gitURL)
+
+	unlock := lockClonePath(path)
+	defer unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		// Command is: git remote update --prune
+		out, err := runGit(ctx, append(gitTLSArgs(domain), "-C", path, "remote", "update", "--prune")...)
+		// Like the clones, a mirror too slow to update is mirrored again by
+		// the next run and the one interrupted by a shutdown is unlocked.
+		if ctx.Err() == context.DeadlineExceeded {
+			metrics.GetCounter("repository_clone_timeout", index).Inc()
+			return "", removeAbortedClone(path, fmt.Errorf("mirror update: %w", errCloneTimeout))
+		}
+		if ctx.Err() != nil {
+			return "", removeGitLocks(path, fmt.Errorf("mirror update: %w", ctx.Err()))
+		}
+		if err != nil {
+			return "", fmt.Errorf("cannot update the mirror %s: %w: %s", path, err, out)
+		}
+
+		metrics.GetCounter("repository_mirror_updated", index).Inc()
+		return path, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return "", err
+	}
+
+	// Command is: git clone --mirror <remote_repo>
+	out, err := runGit(ctx, append(gitTLSArgs(domain), "clone", "--mirror", gitURL, path)...)
+	if err != nil || ctx.Err() != nil {
+		// Remove the partial mirror, otherwise the next run would try to update it.
+		if rmErr := os.RemoveAll(path); rmErr != nil {
+			return "", fmt.Errorf("cannot remove %s: %v", path, rmErr)
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		metrics.GetCounter("repository_clone_timeout", index).Inc()
+		return "", fmt.Errorf("mirror clone: %w", errCloneTimeout)
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("mirror clone: %w", ctx.Err())
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot mirror the repository: %w: %s", err, out)
+	}
+
+	metrics.GetCounter("repository_cloned", index).Inc()
+	return path, nil
+}
@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// mirrorCandidate is an indexed document of software also found on other hosts.
+type mirrorCandidate struct {
+	ID         string    `json:"id"`
+	FileRawURL string    `json:"fileRawURL"`
+	CodeHost   string    `json:"codeHost"`
+	LastCommit time.Time `json:"lastCommit"`
+}
+
+// codeHost returns the host of the git clone URL.
+func codeHost(gitCloneURL string) string {
+	u, err := url.Parse(gitCloneURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// chooseCanonical returns the canonical document among the candidates and
+// the other ones, its mirrors. The canonical one is on the first host in
+// preference; hosts not in preference come last. Ties go to the most
+// recently active, then to the lowest ID.
+func chooseCanonical(candidates []mirrorCandidate, preference []string) (mirrorCandidate, []mirrorCandidate) {
+	rank := func(host string) int {
+		for i, h := range preference {
+			if strings.EqualFold(h, host) {
+				return i
+			}
+		}
+		return len(preference)
+	}
+
+	sorted := make([]mirrorCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if rank(a.CodeHost) != rank(b.CodeHost) {
+			return rank(a.CodeHost) < rank(b.CodeHost)
+		}
+		if !a.LastCommit.Equal(b.LastCommit) {
+			return a.LastCommit.After(b.LastCommit)
+		}
+		return a.ID < b.ID
+	})
+
+	return sorted[0], sorted[1:]
+}
+
+// mirrorDocument is an indexed document, with its mirror fields as set by
+// the last deduplication.
+type mirrorDocument struct {
+	mirrorCandidate
+	Publiccode struct {
+		URL string `json:"url"`
+	} `json:"publiccode"`
+	MirrorOf string   `json:"mirrorOf"`
+	Mirrors  []string `json:"mirrors"`
+}
+
+// mirrorFields are the mirrorOf and mirrors of a document.
+type mirrorFields struct {
+	mirrorOf string
+	mirrors  []string
+}
+
+// groupMirrors returns the mirror fields of the documents by ID: the
+// documents with the same publiccode.url, normalized like the clone URLs,
+// are the same software and the canonical one is picked by chooseCanonical.
+// The other documents have empty fields.
+func groupMirrors(docs []mirrorDocument, preference []string) map[string]mirrorFields {
+	bySoftware := make(map[string][]mirrorCandidate)
+	for _, doc := range docs {
+		if doc.Publiccode.URL == "" {
+			continue
+		}
+		key := normalizeCloneURL(doc.Publiccode.URL)
+		bySoftware[key] = append(bySoftware[key], doc.mirrorCandidate)
+	}
+
+	fields := make(map[string]mirrorFields, len(docs))
+	for _, candidates := range bySoftware {
+		if len(candidates) < 2 {
+			continue
+		}
+
+		canonical, mirrors := chooseCanonical(candidates, preference)
+
+		var mirrorURLs []string
+		for _, mirror := range mirrors {
+			mirrorURLs = append(mirrorURLs, mirror.FileRawURL)
+			fields[mirror.ID] = mirrorFields{mirrorOf: canonical.ID}
+		}
+		fields[canonical.ID] = mirrorFields{mirrors: mirrorURLs}
+	}
+
+	return fields
+}
+
+// deduplicateMirrors finds the software indexed from more than one
+// repository, by publiccode.url, and picks the canonical document according
+// to CANONICAL_HOSTS. The canonical document lists its mirrors in mirrors,
+// the mirrors point to it with mirrorOf. The fields are recomputed on each
+// run, so they are cleared from the software whose mirrors are gone.
+func (c *Crawler) deduplicateMirrors() error {
+	ctx := context.Background()
+	preference := viper.GetStringSlice("CANONICAL_HOSTS")
+
+	// Make the documents of this crawl searchable.
+	if _, err := c.es.Refresh(c.index).Do(ctx); err != nil {
+		return err
+	}
+
+	var docs []mirrorDocument
+	fields := es.NewFetchSourceContext(true).Include("fileRawURL", "codeHost", "lastCommit", "publiccode.url", "mirrorOf", "mirrors")
+	scroll := c.es.Scroll(c.index).Type("software").FetchSourceContext(fields).Size(500)
+	for {
+		results, err := scroll.Do(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, hit := range results.Hits.Hits {
+			var doc mirrorDocument
+			if err := json.Unmarshal(*hit.Source, &doc); err != nil {
+				log.Errorf("Error reading document %s: %v", hit.Id, err)
+				continue
+			}
+			doc.ID = hit.Id
+			docs = append(docs, doc)
+		}
+	}
+
+	mirrors := groupMirrors(docs, preference)
+	for _, doc := range docs {
+		want := mirrors[doc.ID]
+		if doc.MirrorOf == want.mirrorOf && reflect.DeepEqual(doc.Mirrors, want.mirrors) {
+			continue
+		}
+
+		// The empty fields are set to null, removing them.
+		update := map[string]interface{}{"mirrorOf": nil, "mirrors": nil}
+		if want.mirrorOf != "" {
+			update["mirrorOf"] = want.mirrorOf
+		}
+		if len(want.mirrors) > 0 {
+			update["mirrors"] = want.mirrors
+			log.Infof("%s is the canonical of %s, mirrored at %s", doc.FileRawURL, doc.Publiccode.URL, strings.Join(want.mirrors, ", "))
+		}
+
+		_, err := c.es.Update().Index(c.index).Type("software").Id(doc.ID).Doc(update).Do(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
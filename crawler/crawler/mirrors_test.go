@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChooseCanonical(t *testing.T) {
+	now := time.Now()
+	github := mirrorCandidate{ID: "1", CodeHost: "github.com", LastCommit: now.AddDate(0, -6, 0)}
+	gitlab := mirrorCandidate{ID: "2", CodeHost: "gitlab.com", LastCommit: now}
+	selfHosted := mirrorCandidate{ID: "3", CodeHost: "git.example.org", LastCommit: now.AddDate(0, 0, -1)}
+	candidates := []mirrorCandidate{github, gitlab, selfHosted}
+
+	canonical, mirrors := chooseCanonical(candidates, []string{"github.com", "gitlab.com"})
+	assert.Equal(t, github, canonical)
+	assert.Equal(t, []mirrorCandidate{gitlab, selfHosted}, mirrors)
+
+	canonical, mirrors = chooseCanonical(candidates, []string{"git.example.org", "GitHub.com"})
+	assert.Equal(t, selfHosted, canonical)
+	assert.Equal(t, []mirrorCandidate{github, gitlab}, mirrors)
+
+	// Without preference the most recently active wins.
+	canonical, mirrors = chooseCanonical(candidates, nil)
+	assert.Equal(t, gitlab, canonical)
+	assert.Equal(t, []mirrorCandidate{selfHosted, github}, mirrors)
+
+	// Unlisted hosts tie.
+	canonical, _ = chooseCanonical(candidates, []string{"bitbucket.org"})
+	assert.Equal(t, gitlab, canonical)
+}
+
+func TestGroupMirrors(t *testing.T) {
+	doc := func(id, host, softwareURL string) mirrorDocument {
+		var d mirrorDocument
+		d.ID, d.CodeHost, d.FileRawURL = id, host, "https://"+host+"/"+id+"/publiccode.yml"
+		d.Publiccode.URL = softwareURL
+		return d
+	}
+	docs := []mirrorDocument{
+		doc("github", "github.com", "https://github.com/comune/app"),
+		doc("gitlab", "gitlab.com", "https://GitHub.com/comune/app.git"),
+		doc("other", "github.com", "https://github.com/comune/other"),
+		doc("nourl", "github.com", ""),
+	}
+
+	assert.Equal(t, map[string]mirrorFields{
+		"github": {mirrors: []string{"https://gitlab.com/gitlab/publiccode.yml"}},
+		"gitlab": {mirrorOf: "github"},
+	}, groupMirrors(docs, []string{"github.com"}))
+}
+
+func TestDeduplicateMirrorsClearsStale(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	updates := map[string]map[string]interface{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/publiccode/software/_search":
+			// The mirror whose canonical is gone, a canonical whose mirror
+			// is gone and a software never mirrored.
+			fmt.Fprint(w, `{"_scroll_id": "1", "hits": {"total": 3, "hits": [
+				{"_id": "mirror", "_source": {"publiccode": {"url": "https://github.com/comune/app"}, "mirrorOf": "gone"}},
+				{"_id": "canonical", "_source": {"publiccode": {"url": "https://github.com/comune/other"}, "mirrors": ["https://gitlab.com/gone"]}},
+				{"_id": "single", "_source": {"publiccode": {"url": "https://github.com/comune/single"}}}]}}`)
+		case strings.HasSuffix(r.URL.Path, "/_update"):
+			var body struct {
+				Doc map[string]interface{} `json:"doc"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			updates[r.URL.Path] = body.Doc
+			fmt.Fprint(w, `{"_index": "publiccode", "_type": "software", "result": "updated"}`)
+		case strings.HasSuffix(r.URL.Path, "/_refresh"):
+			fmt.Fprint(w, `{"_shards": {"total": 1, "successful": 1, "failed": 0}}`)
+		default:
+			// The scroll is over.
+			fmt.Fprint(w, `{"_scroll_id": "1", "hits": {"total": 3, "hits": []}}`)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crawler{es: client, index: "publiccode"}
+
+	assert.NoError(t, c.deduplicateMirrors())
+	cleared := map[string]interface{}{"mirrorOf": nil, "mirrors": nil}
+	assert.Equal(t, map[string]map[string]interface{}{
+		"/publiccode/software/mirror/_update":    cleared,
+		"/publiccode/software/canonical/_update": cleared,
+	}, updates)
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// publiccodeIndexFilename is the manifest listing the directories of a
+// repository with a publiccode.yml, one per line.
+const publiccodeIndexFilename = ".publiccode-index"
+
+// publiccodeIndex returns whether the repositories are looked for a
+// publiccodeIndexFilename manifest (PUBLICCODE_INDEX).
+func publiccodeIndex() bool {
+	return viper.GetBool("PUBLICCODE_INDEX")
+}
+
+// parsePubliccodeIndex returns the directories listed in the manifest data,
+// "" for the root of the repository. Empty lines, the ones starting with #
+// and the paths outside of the repository are ignored.
+func parsePubliccodeIndex(data []byte) []string {
+	var subpaths []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		subpath := strings.Trim(path.Clean("/"+line), "/")
+		if cleaned := path.Clean(line); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			continue
+		}
+		if !seen[subpath] {
+			seen[subpath] = true
+			subpaths = append(subpaths, subpath)
+		}
+	}
+
+	return subpaths
+}
+
+// siblingRawURL returns the raw url of the file name in the subpath
+// directory, relative to the directory of fileRawURL.
+func siblingRawURL(fileRawURL, subpath, name string) (string, error) {
+	u, err := url.Parse(fileRawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(path.Dir(u.Path), subpath, name)
+
+	return u.String(), nil
+}
+
+// githubFileRawURL returns the download url of the crawled file among files
+// or, with PUBLICCODE_INDEX, the one it would have next to the
+// publiccodeIndexFilename, so the directories it lists are crawled even
+// without a publiccode.yml in the root. It's "" if there's neither.
+func githubFileRawURL(files GithubFiles, filename string) string {
+	var indexURL string
+	for _, f := range files {
+		if f.DownloadURL == "" {
+			continue
+		}
+		switch f.Name {
+		case filename:
+			return f.DownloadURL
+		case publiccodeIndexFilename:
+			indexURL = f.DownloadURL
+		}
+	}
+	if indexURL == "" || !publiccodeIndex() {
+		return ""
+	}
+
+	fileRawURL, err := siblingRawURL(indexURL, "", filename)
+	if err != nil {
+		return ""
+	}
+
+	return fileRawURL
+}
+
+// expandPubliccodeIndex returns a repository for each directory listed in
+// the manifest of repository, each one with its own Subpath and FileRawURL.
+// It's only repository if there's no manifest, PUBLICCODE_INDEX is not
+// set or the directory of the software is already set.
+func expandPubliccodeIndex(repository Repository) []Repository {
+	if !publiccodeIndex() || repository.Subpath != "" {
+		return []Repository{repository}
+	}
+
+	indexURL, err := siblingRawURL(repository.FileRawURL, "", publiccodeIndexFilename)
+	if err != nil {
+		return []Repository{repository}
+	}
+	resp, err := getURL(requestRawFile, indexURL, repository.Headers)
+	if err != nil || resp.Status.Code != http.StatusOK {
+		return []Repository{repository}
+	}
+
+	subpaths := parsePubliccodeIndex(resp.Body)
+	if len(subpaths) == 0 {
+		return []Repository{repository}
+	}
+	log.WithField(logFieldRepository, repository.Name).Infof("%d directories listed in %s", len(subpaths), publiccodeIndexFilename)
+
+	var repositories []Repository
+	for _, subpath := range subpaths {
+		fileRawURL, err := siblingRawURL(repository.FileRawURL, subpath, repository.Domain.crawledFilename())
+		if err != nil {
+			continue
+		}
+
+		software := repository
+		software.Subpath = subpath
+		software.FileRawURL = fileRawURL
+		repositories = append(repositories, software)
+	}
+
+	return repositories
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePubliccodeIndex(t *testing.T) {
+	data := []byte("# tools\napps/protocollo\n\n  apps/albo/  \n.\n../outside\napps/albo\n")
+
+	assert.Equal(t, []string{"apps/protocollo", "apps/albo", ""}, parsePubliccodeIndex(data))
+	assert.Empty(t, parsePubliccodeIndex([]byte("# nothing\n")))
+}
+
+func TestGithubFileRawURL(t *testing.T) {
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	index := GithubFiles{{Name: ".publiccode-index", DownloadURL: "https://raw.githubusercontent.com/comune/tools/main/.publiccode-index"}}
+	assert.Equal(t, "", githubFileRawURL(index, "publiccode.yml"))
+
+	viper.Set("PUBLICCODE_INDEX", true)
+	defer viper.Set("PUBLICCODE_INDEX", nil)
+	assert.Equal(t, "https://raw.githubusercontent.com/comune/tools/main/publiccode.yml", githubFileRawURL(index, "publiccode.yml"))
+
+	files := append(index, GithubFiles{{Name: "publiccode.yml", DownloadURL: "https://example.org/publiccode.yml"}}...)
+	assert.Equal(t, "https://example.org/publiccode.yml", githubFileRawURL(files, "publiccode.yml"))
+}
+
+func TestExpandPubliccodeIndex(t *testing.T) {
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/comune/tools/raw/main/.publiccode-index" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "apps/protocollo\napps/albo\n")
+	}))
+	defer ts.Close()
+
+	repository := Repository{Name: "comune/tools", FileRawURL: ts.URL + "/comune/tools/raw/main/publiccode.yml"}
+	single := Repository{Name: "comune/single", FileRawURL: ts.URL + "/comune/single/raw/main/publiccode.yml"}
+
+	assert.Equal(t, []Repository{repository}, expandPubliccodeIndex(repository))
+
+	viper.Set("PUBLICCODE_INDEX", true)
+	defer viper.Set("PUBLICCODE_INDEX", nil)
+
+	expanded := expandPubliccodeIndex(repository)
+	assert.Len(t, expanded, 2)
+	assert.Equal(t, "apps/protocollo", expanded[0].Subpath)
+	assert.Equal(t, ts.URL+"/comune/tools/raw/main/apps/protocollo/publiccode.yml", expanded[0].FileRawURL)
+	assert.Equal(t, "apps/albo", expanded[1].Subpath)
+	assert.NotEqual(t, expanded[0].generateID(), expanded[1].generateID())
+
+	// No manifest.
+	assert.Equal(t, []Repository{single}, expandPubliccodeIndex(single))
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ndjsonSummary is the last line of an NDJSON export, told apart from the
+// documents by its only key "_summary".
+type ndjsonSummary struct {
+	Summary struct {
+		Count     int    `json:"count"`
+		RunID     string `json:"runID"`
+		Timestamp string `json:"timestamp"`
+	} `json:"_summary"`
+}
+
+// ExportNDJSON streams all the software of ELASTIC_PUBLICCODE_INDEX to fname,
+// one JSON document per line, followed by a summary line.
+// Documents are scrolled in batches, so memory doesn't grow with the catalog.
+func (c *Crawler) ExportNDJSON(fname string) error {
+	if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
+		return err
+	}
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scroll := c.es.Scroll(viper.GetString("ELASTIC_PUBLICCODE_INDEX")).Type("software").Size(500)
+	next := func() ([]json.RawMessage, error) {
+		results, err := scroll.Do(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		docs := make([]json.RawMessage, 0, len(results.Hits.Hits))
+		for _, hit := range results.Hits.Hits {
+			docs = append(docs, *hit.Source)
+		}
+		return docs, nil
+	}
+
+	w := bufio.NewWriter(f)
+	count, err := writeNDJSON(w, next, c.runID, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	log.Infof("Exported %d software to %s", count, fname)
+
+	return f.Close()
+}
+
+// writeNDJSON writes the documents returned by next, until it returns
+// io.EOF, one per line and then the summary line. It returns the number of
+// documents written.
+func writeNDJSON(w io.Writer, next func() ([]json.RawMessage, error), runID string, now time.Time) (int, error) {
+	count := 0
+	var line bytes.Buffer
+	for {
+		docs, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		for _, doc := range docs {
+			line.Reset()
+			if err := json.Compact(&line, doc); err != nil {
+				return count, err
+			}
+			line.WriteByte('\n')
+			if _, err := w.Write(line.Bytes()); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+
+	var summary ndjsonSummary
+	summary.Summary.Count = count
+	summary.Summary.RunID = runID
+	summary.Summary.Timestamp = now.UTC().Format(time.RFC3339)
+
+	return count, json.NewEncoder(w).Encode(summary)
+}
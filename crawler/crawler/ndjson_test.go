@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteNDJSON(t *testing.T) {
+	batches := [][]json.RawMessage{
+		{json.RawMessage(`{"id": "a",
+			"publiccode": {"name": "A"}}`), json.RawMessage(`{"id": "b"}`)},
+		{json.RawMessage(`{"id": "c", "description": "multi\nline"}`)},
+	}
+	next := func() ([]json.RawMessage, error) {
+		if len(batches) == 0 {
+			return nil, io.EOF
+		}
+		batch := batches[0]
+		batches = batches[1:]
+		return batch, nil
+	}
+
+	var out bytes.Buffer
+	now := time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+	count, err := writeNDJSON(&out, next, "run", now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var v map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &v), scanner.Text())
+		lines = append(lines, v)
+	}
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "a", lines[0]["id"])
+	assert.Equal(t, "c", lines[2]["id"])
+	assert.Equal(t, map[string]interface{}{
+		"count":     3.0,
+		"runID":     "run",
+		"timestamp": "2020-10-14T12:00:00Z",
+	}, lines[3]["_summary"])
+}
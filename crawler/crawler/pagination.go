@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	httpclient "github.com/italia/httpclient-lib-go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// defaultOrgPageWorkers is the number of pages of an organization fetched
+// concurrently, if ORG_PAGE_WORKERS is unset.
+const defaultOrgPageWorkers = 4
+
+// maxOrgPages is the maximum number of pages of an organization fetched
+// concurrently, to protect from bogus last pages.
+const maxOrgPages = 1000
+
+// orgPageWorkers returns the number of pages of an organization fetched
+// concurrently, ORG_PAGE_WORKERS or defaultOrgPageWorkers.
+// 1 fetches them one after the other.
+func orgPageWorkers() int {
+	if !viper.IsSet("ORG_PAGE_WORKERS") {
+		return defaultOrgPageWorkers
+	}
+
+	workers := viper.GetInt("ORG_PAGE_WORKERS")
+	if workers < 1 {
+		log.Warnf("Invalid ORG_PAGE_WORKERS %d, using %d", workers, defaultOrgPageWorkers)
+		return defaultOrgPageWorkers
+	}
+
+	return workers
+}
+
+// lastPage returns the url of the last page of the listing from the
+// rel="last" Link header, empty if there's none.
+func lastPage(headers http.Header) string {
+	return httpclient.HeaderLink(headers.Get("Link"), "last")
+}
+
+// pageURLs returns the urls of the pages from next to last, both included, if
+// they differ only by the page query parameter. Otherwise, as with opaque
+// cursors, it returns nil.
+func pageURLs(next, last string) []string {
+	nextURL, err := url.Parse(next)
+	if err != nil {
+		return nil
+	}
+	lastURL, err := url.Parse(last)
+	if err != nil {
+		return nil
+	}
+
+	nextQuery, lastQuery := nextURL.Query(), lastURL.Query()
+	from, err := strconv.Atoi(nextQuery.Get("page"))
+	if err != nil {
+		return nil
+	}
+	to, err := strconv.Atoi(lastQuery.Get("page"))
+	if err != nil || to < from || to-from >= maxOrgPages {
+		return nil
+	}
+
+	nextQuery.Del("page")
+	lastQuery.Del("page")
+	nextURL.RawQuery, lastURL.RawQuery = "", ""
+	if nextURL.String() != lastURL.String() || nextQuery.Encode() != lastQuery.Encode() {
+		return nil
+	}
+
+	var pages []string
+	for page := from; page <= to; page++ {
+		nextQuery.Set("page", strconv.Itoa(page))
+		nextURL.RawQuery = nextQuery.Encode()
+		pages = append(pages, nextURL.String())
+	}
+
+	return pages
+}
+
+// crawlPages fetches the pages of an organization with orgPageWorkers
+// workers, adding their repositories to c.repositories.
+func (c *Crawler) crawlPages(ctx context.Context, domain *Domain, pages []string, pa PA) {
+	urls := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < orgPageWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range urls {
+				// The next and last urls are ignored, all the pages are
+				// already queued.
+				if _, _, err := domain.processAndGetNextURL(page, c.repositories, pa); err != nil {
+					log.Errorf("error reading %s repository list: %v", page, err)
+				}
+			}
+		}()
+	}
+
+	for _, page := range pages {
+		if ctx.Err() != nil {
+			break
+		}
+		urls <- page
+	}
+	close(urls)
+	wg.Wait()
+}
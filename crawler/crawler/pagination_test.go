@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageURLs(t *testing.T) {
+	assert.Equal(t, []string{
+		"https://api.github.com/orgs/italia/repos?page=2&per_page=100",
+		"https://api.github.com/orgs/italia/repos?page=3&per_page=100",
+	}, pageURLs(
+		"https://api.github.com/orgs/italia/repos?page=2&per_page=100",
+		"https://api.github.com/orgs/italia/repos?per_page=100&page=3",
+	))
+
+	// No last page, opaque cursors and different listings.
+	assert.Nil(t, pageURLs("https://api.github.com/orgs/italia/repos?page=2", ""))
+	assert.Nil(t, pageURLs("https://example.org/repos?cursor=abc", "https://example.org/repos?cursor=def"))
+	assert.Nil(t, pageURLs("https://api.github.com/orgs/italia/repos?page=2", "https://api.github.com/orgs/other/repos?page=3"))
+	assert.Nil(t, pageURLs("https://api.github.com/orgs/italia/repos?page=3", "https://api.github.com/orgs/italia/repos?page=2"))
+}
+
+func TestCrawlOrgPages(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	RegisterClientAPIs()
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	viper.Set("ORG_PAGE_WORKERS", 3)
+	defer viper.Set("CRAWLED_FILENAME", nil)
+	defer viper.Set("ORG_PAGE_WORKERS", nil)
+
+	const lastPage = 5
+
+	var mu sync.Mutex
+	var requested []string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/orgs/regione/repos" {
+			http.NotFound(w, r)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		mu.Lock()
+		requested = append(requested, page)
+		mu.Unlock()
+
+		link := fmt.Sprintf(`<%s/api/v1/orgs/regione/repos?limit=1&page=%d>; rel="last"`, ts.URL, lastPage)
+		if page == "1" {
+			link += fmt.Sprintf(`, <%s/api/v1/orgs/regione/repos?limit=1&page=2>; rel="next"`, ts.URL)
+		}
+		w.Header().Set("Link", link)
+		fmt.Fprintf(w, `[{"full_name": "regione/repo%s", "default_branch": "main",
+			"html_url": "%s/regione/repo%s", "clone_url": "%s/regione/repo%s.git"}]`, page, ts.URL, page, ts.URL, page)
+	}))
+	defer ts.Close()
+
+	c := Crawler{repositories: make(chan Repository, 10)}
+	domain := Domain{Host: "gitea.example.org", Type: "gitea"}
+	c.CrawlOrg(context.Background(), ts.URL+"/regione", &domain, PA{})
+	close(c.repositories)
+
+	var names []string
+	for repo := range c.repositories {
+		names = append(names, repo.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"regione/repo1", "regione/repo2", "regione/repo3", "regione/repo4", "regione/repo5"}, names)
+
+	// Each page is requested once.
+	sort.Strings(requested)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, requested)
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Document is a software document about to be indexed, by JSON field.
+type Document map[string]interface{}
+
+// DocumentProcessor modifies the document of repository before it's
+// indexed. An error prevents the document from being indexed.
+type DocumentProcessor func(repository Repository, doc Document) error
+
+var (
+	documentProcessorsMutex sync.RWMutex
+	documentProcessors      = []DocumentProcessor{noopDocumentProcessor}
+)
+
+// noopDocumentProcessor is the default processor, leaving documents unchanged.
+func noopDocumentProcessor(Repository, Document) error {
+	return nil
+}
+
+// RegisterDocumentProcessor adds p to the processors run on each document,
+// in registration order, after the standard fields are populated.
+func RegisterDocumentProcessor(p DocumentProcessor) {
+	documentProcessorsMutex.Lock()
+	defer documentProcessorsMutex.Unlock()
+
+	documentProcessors = append(documentProcessors, p)
+}
+
+// processDocument returns the document of v after running the registered
+// processors on it.
+func processDocument(repository Repository, v interface{}) (Document, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	documentProcessorsMutex.RLock()
+	defer documentProcessorsMutex.RUnlock()
+
+	for _, p := range documentProcessors {
+		if err := p(repository, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
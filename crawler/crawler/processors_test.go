@@ -0,0 +1,38 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentProcessors(t *testing.T) {
+	defer func(processors []DocumentProcessor) { documentProcessors = processors }(documentProcessors)
+
+	file := struct {
+		ID   string `json:"id"`
+		Slug string `json:"slug"`
+	}{ID: "4a5d", Slug: "pcm-app"}
+	repository := Repository{Name: "pcm/app"}
+
+	// The default processor leaves the document unchanged.
+	doc, err := processDocument(repository, file)
+	assert.Nil(t, err)
+	assert.Equal(t, Document{"id": "4a5d", "slug": "pcm-app"}, doc)
+
+	RegisterDocumentProcessor(func(repository Repository, doc Document) error {
+		doc["environment"] = "staging"
+		doc["internalName"] = repository.Name
+		return nil
+	})
+	doc, err = processDocument(repository, file)
+	assert.Nil(t, err)
+	assert.Equal(t, Document{"id": "4a5d", "slug": "pcm-app", "environment": "staging", "internalName": "pcm/app"}, doc)
+
+	RegisterDocumentProcessor(func(Repository, Document) error {
+		return errors.New("rejected")
+	})
+	_, err = processDocument(repository, file)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/italia/developers-italia-backend/crawler/elastic"
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Default minimum ratio between the documents in the preview and in the live
+// index required for promoting the preview, overridden by PROMOTE_MIN_DOCS_RATIO.
+const defaultPromoteMinDocsRatio = 0.9
+
+// previewIndex returns the name of the preview index.
+func previewIndex() string {
+	if viper.IsSet("ELASTIC_PREVIEW_INDEX") {
+		return viper.GetString("ELASTIC_PREVIEW_INDEX")
+	}
+
+	return viper.GetString("ELASTIC_PUBLICCODE_INDEX") + "_preview"
+}
+
+// UsePreviewIndex makes the crawler save the software in a new, empty, preview
+// index instead of the live one. The public alias is left untouched until
+// the preview gets promoted with Promote. When resuming a crawl, the preview
+// index is kept.
+func (c *Crawler) UsePreviewIndex() error {
+	c.preview = true
+	c.index = previewIndex()
+
+	if c.DryRun {
+		return nil
+	}
+
+	log.Infof("Crawling into the preview index %s", c.index)
+
+	// Keep the software of the resumed crawl.
+	if c.checkpoint != nil && c.checkpoint.resumed {
+		return elastic.CreateIndexMapping(c.index, elastic.PubliccodeMapping, c.es)
+	}
+
+	// Start from scratch, so the preview only has the software of this crawl.
+	_, err := c.es.DeleteIndex(c.index).Do(context.Background())
+	if err != nil && !es.IsNotFound(err) {
+		return err
+	}
+
+	return elastic.CreateIndexMapping(c.index, elastic.PubliccodeMapping, c.es)
+}
+
+// Promote publishes the preview index: the live index is archived, the public
+// alias is moved to the preview and the live index is replaced with its
+// contents. The promotion is refused if the last crawl was not a completed
+// preview and, unless force is true, if the preview has suspiciously fewer
+// documents than the live index.
+func (c *Crawler) Promote(force bool) error {
+	live := viper.GetString("ELASTIC_PUBLICCODE_INDEX")
+	preview := previewIndex()
+	alias := viper.GetString("ELASTIC_ALIAS")
+
+	err := checkPreviewCompleted(lastRunFile())
+	if err != nil {
+		return err
+	}
+
+	liveCount, err := elastic.CountDocuments(live, c.es)
+	if err != nil {
+		return err
+	}
+	previewCount, err := elastic.CountDocuments(preview, c.es)
+	if err != nil {
+		return err
+	}
+
+	minRatio := defaultPromoteMinDocsRatio
+	if viper.IsSet("PROMOTE_MIN_DOCS_RATIO") {
+		minRatio = viper.GetFloat64("PROMOTE_MIN_DOCS_RATIO")
+	}
+
+	err = checkPromotion(previewCount, liveCount, minRatio)
+	if err != nil {
+		if !force {
+			return err
+		}
+		log.Warnf("Promoting anyway (--force): %v", err)
+	}
+
+	// Keep a copy of the current live index.
+	archive := fmt.Sprintf("%s_archive_%s", live, time.Now().UTC().Format("20060102150405"))
+	log.Infof("Archiving %s (%d documents) to %s", live, liveCount, archive)
+	err = elastic.CreateIndexMapping(archive, elastic.PubliccodeMapping, c.es)
+	if err != nil {
+		return err
+	}
+	err = c.copyIndex(live, archive, "")
+	if err != nil {
+		return err
+	}
+
+	// Publish the preview...
+	err = elastic.AliasSwap(alias, live, preview, c.es)
+	if err != nil {
+		return err
+	}
+	log.Infof("Alias %s moved to %s (%d documents)", alias, preview, previewCount)
+
+	// ...and make it the new live index, which the next crawls will update.
+	_, err = c.es.DeleteIndex(live).Do(context.Background())
+	if err != nil {
+		return err
+	}
+	err = elastic.CreateIndexMapping(live, elastic.PubliccodeMapping, c.es)
+	if err != nil {
+		return err
+	}
+	err = c.copyIndex(preview, live, "")
+	if err != nil {
+		return err
+	}
+	err = elastic.AliasSwap(alias, preview, live, c.es)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.es.DeleteIndex(preview).Do(context.Background())
+	if err != nil {
+		return err
+	}
+	log.Infof("Preview promoted to %s", live)
+
+	return nil
+}
+
+// checkPreviewCompleted returns an error unless the last crawl, whose status
+// is in fname, was a preview that completed: an interrupted or failed one
+// has only part of the software.
+func checkPreviewCompleted(fname string) error {
+	run, err := readLastRun(fname)
+	if os.IsNotExist(err) {
+		return errors.New("no crawl status in " + fname + ", is there a preview to promote?")
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !run.Preview || run.DryRun:
+		return fmt.Errorf("the last crawl (%s) was not a preview", run.RunID)
+	case run.Result != lastRunSuccess:
+		return fmt.Errorf("the preview crawl %s did not complete: %s", run.RunID, run.Error)
+	}
+
+	return nil
+}
+
+// checkPromotion returns an error if the preview index has less than minRatio
+// times the documents of the live index.
+func checkPromotion(previewCount, liveCount int64, minRatio float64) error {
+	if previewCount == 0 {
+		return fmt.Errorf("the preview index is empty")
+	}
+
+	if float64(previewCount) < float64(liveCount)*minRatio {
+		return fmt.Errorf("the preview index has %d documents, less than %.0f%% of the %d in the live index",
+			previewCount, minRatio*100, liveCount)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPromotion(t *testing.T) {
+	assert.NoError(t, checkPromotion(100, 100, 0.9))
+	assert.NoError(t, checkPromotion(90, 100, 0.9))
+	assert.NoError(t, checkPromotion(10, 0, 0.9))
+	assert.Error(t, checkPromotion(89, 100, 0.9))
+	assert.Error(t, checkPromotion(0, 0, 0.9))
+}
+
+func TestCheckPreviewCompleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "last_run.json")
+
+	assert.Error(t, checkPreviewCompleted(fname))
+
+	c := Crawler{runID: "run", startTime: time.Now(), preview: true}
+	assert.NoError(t, writeLastRun(c.lastRunStatus(nil, time.Now()), fname))
+	assert.NoError(t, checkPreviewCompleted(fname))
+
+	// Interrupted.
+	assert.NoError(t, writeLastRun(c.lastRunStatus(errors.New("crawl interrupted: context canceled"), time.Now()), fname))
+	assert.EqualError(t, checkPreviewCompleted(fname), "the preview crawl run did not complete: crawl interrupted: context canceled")
+
+	// A crawl of the live index ran after the preview.
+	c.preview = false
+	assert.NoError(t, writeLastRun(c.lastRunStatus(nil, time.Now()), fname))
+	assert.EqualError(t, checkPreviewCompleted(fname), "the last crawl (run) was not a preview")
+}
+
+func TestPromoteCopyFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	viper.Set("OUTPUT_DIR", dir)
+	viper.Set("ELASTIC_PUBLICCODE_INDEX", "publiccode")
+	viper.Set("ELASTIC_ALIAS", "alias")
+	defer func() {
+		viper.Set("CRAWLER_DATADIR", nil)
+		viper.Set("OUTPUT_DIR", nil)
+		viper.Set("ELASTIC_PUBLICCODE_INDEX", nil)
+		viper.Set("ELASTIC_ALIAS", nil)
+	}()
+
+	fake := &fakeReindexES{
+		indices: map[string]bool{"publiccode": true, "publiccode_preview": true},
+		aliased: map[string]bool{"publiccode": true},
+		failedTask: `{"completed": true, "task": {"status": {"total": 2, "created": 1}},
+			"response": {"failures": [{"id": "abc", "cause": {"reason": "mapper_parsing_exception"}}]}}`,
+	}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crawler{es: client, runID: "run", startTime: time.Now(), preview: true}
+	assert.NoError(t, writeLastRun(c.lastRunStatus(nil, time.Now()), lastRunFile()))
+
+	// The archive is incomplete: the alias is left on the live index.
+	err = c.Promote(false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 documents couldn't be copied from publiccode into publiccode_archive_")
+	assert.NotContains(t, fake.requests, "POST _aliases")
+	assert.Equal(t, map[string]bool{"publiccode": true}, fake.aliased)
+}
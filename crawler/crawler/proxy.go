@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// proxyURL returns PROXY_URL, the proxy of all the outbound requests and
+// clones overriding HTTP_PROXY, HTTPS_PROXY and NO_PROXY. It's nil if unset
+// or invalid.
+func proxyURL() *url.URL {
+	setting := viper.GetString("PROXY_URL")
+	if setting == "" {
+		return nil
+	}
+
+	u, err := url.Parse(setting)
+	if err != nil || u.Host == "" {
+		log.Errorf("Invalid PROXY_URL %q, using the proxy of the environment, if any", redactedURL(setting))
+		return nil
+	}
+
+	return u
+}
+
+// proxyFunc returns the proxy of the HTTP clients: PROXY_URL or the one of
+// the environment.
+func proxyFunc() func(*http.Request) (*url.URL, error) {
+	if u := proxyURL(); u != nil {
+		return http.ProxyURL(u)
+	}
+
+	return http.ProxyFromEnvironment
+}
+
+// gitProxyArgs returns the git options making it use PROXY_URL. Otherwise
+// git reads the proxy from the environment on its own.
+func gitProxyArgs() []string {
+	if u := proxyURL(); u != nil {
+		return []string{"-c", "http.proxy=" + u.String()}
+	}
+
+	return nil
+}
+
+// logProxy logs the proxy in effect.
+func logProxy() {
+	if u := proxyURL(); u != nil {
+		log.Infof("Using the proxy %s (PROXY_URL)", redactedURL(u.String()))
+		return
+	}
+
+	for _, variable := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if proxy := os.Getenv(variable); proxy != "" {
+			log.Infof("Using the proxy %s (%s), except for NO_PROXY %q", redactedURL(proxy), variable, noProxy())
+			return
+		}
+	}
+
+	log.Info("Not using a proxy")
+}
+
+// noProxy returns the hosts excluded from the proxy of the environment.
+func noProxy() string {
+	if hosts := os.Getenv("NO_PROXY"); hosts != "" {
+		return hosts
+	}
+
+	return os.Getenv("no_proxy")
+}
+
+// redactedURL returns rawURL hiding its password, if any.
+func redactedURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+
+	return u.String()
+}
@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/italia/developers-italia-backend/crawler/elastic"
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Default maximum ratio between the stale documents and all the documents of
+// the index for pruning them, overridden by PRUNE_MAX_RATIO.
+const defaultPruneMaxRatio = 0.1
+
+// pruneGracePeriod returns how long before the start of the crawl a
+// document must have been last seen to be pruned, PRUNE_GRACE_PERIOD.
+// 0 disables the pruning.
+func pruneGracePeriod() time.Duration {
+	return viper.GetDuration("PRUNE_GRACE_PERIOD")
+}
+
+// pruneMaxRatio returns the maximum ratio of stale documents pruned,
+// PRUNE_MAX_RATIO or defaultPruneMaxRatio.
+func pruneMaxRatio() float64 {
+	if !viper.IsSet("PRUNE_MAX_RATIO") {
+		return defaultPruneMaxRatio
+	}
+
+	return viper.GetFloat64("PRUNE_MAX_RATIO")
+}
+
+// checkPrune returns an error if the stale documents are more than maxRatio
+// times all the documents, as after crawls failing for most of the hosts.
+func checkPrune(stale, total int64, maxRatio float64) error {
+	if float64(stale) > float64(total)*maxRatio {
+		return fmt.Errorf("%d of the %d documents are stale, more than %.0f%% (PRUNE_MAX_RATIO)",
+			stale, total, maxRatio*100)
+	}
+
+	return nil
+}
+
+// pruneStale deletes the documents of the software last seen more than
+// PRUNE_GRACE_PERIOD before crawlStart, eg. because its publiccode.yml was
+// removed or the repository went private. The documents indexed before
+// lastSeen existed are kept.
+func (c *Crawler) pruneStale(crawlStart time.Time) error {
+	grace := pruneGracePeriod()
+	if grace <= 0 {
+		return nil
+	}
+	if c.DryRun {
+		log.Info("Skipping the pruning of the stale documents (--dry-run)")
+		return nil
+	}
+	// The preview index has only the software of this crawl.
+	if c.preview {
+		return nil
+	}
+
+	cutoff := crawlStart.Add(-grace).UTC().Format(time.RFC3339)
+	query := es.NewRangeQuery("lastSeen").Lt(cutoff)
+
+	stale, err := c.es.Count(c.index).Type("software").Query(query).Do(context.Background())
+	if err != nil {
+		return err
+	}
+	if stale == 0 {
+		return nil
+	}
+	total, err := elastic.CountDocuments(c.index, c.es)
+	if err != nil {
+		return err
+	}
+	if err := checkPrune(stale, total, pruneMaxRatio()); err != nil {
+		return err
+	}
+
+	res, err := c.es.DeleteByQuery().
+		Index(c.index).
+		Type("software").
+		Query(query).
+		Refresh("true").
+		Do(context.Background())
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Pruned %d documents not seen since %s", res.Deleted, cutoff)
+	c.summary.addPruned(int(res.Deleted))
+
+	return nil
+}
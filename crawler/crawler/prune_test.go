@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPrune(t *testing.T) {
+	assert.NoError(t, checkPrune(0, 0, 0.1))
+	assert.NoError(t, checkPrune(10, 100, 0.1))
+	assert.EqualError(t, checkPrune(11, 100, 0.1), "11 of the 100 documents are stale, more than 10% (PRUNE_MAX_RATIO)")
+}
+
+func TestPruneStale(t *testing.T) {
+	var stale int
+	var deleted bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_delete_by_query"):
+			deleted = true
+			fmt.Fprintf(w, `{"deleted": %d}`, stale)
+		case r.URL.Path == "/publiccode/software/_count":
+			fmt.Fprintf(w, `{"count": %d}`, stale)
+		case r.URL.Path == "/publiccode/_count":
+			fmt.Fprint(w, `{"count": 100}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crawler{es: client, index: "publiccode"}
+
+	// Disabled.
+	stale = 5
+	assert.NoError(t, c.pruneStale(time.Now()))
+	assert.False(t, deleted)
+
+	viper.Set("PRUNE_GRACE_PERIOD", "720h")
+	defer viper.Set("PRUNE_GRACE_PERIOD", nil)
+
+	assert.NoError(t, c.pruneStale(time.Now()))
+	assert.True(t, deleted)
+	assert.Equal(t, 5, c.summary.pruned)
+
+	// Too many stale documents, something went wrong.
+	deleted = false
+	stale = 50
+	assert.Error(t, c.pruneStale(time.Now()))
+	assert.False(t, deleted)
+}
@@ -0,0 +1,176 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/italia/developers-italia-backend/crawler/ipa"
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Sources of the publishers to crawl, set with PUBLISHERS_SOURCE.
+const (
+	PublishersSourceWhitelist = "whitelist"
+	PublishersSourceIndex     = "index"
+	PublishersSourceURL       = "url"
+)
+
+// PublishersSource returns where the publishers to crawl are read from:
+// the whitelist files (the default), the ELASTIC_PUBLISHERS_URLS_INDEX index
+// or the whitelist at PUBLISHERS_URL.
+func PublishersSource() string {
+	if viper.IsSet("PUBLISHERS_SOURCE") {
+		return viper.GetString("PUBLISHERS_SOURCE")
+	}
+
+	return PublishersSourceWhitelist
+}
+
+// indexedPublisher is an administration in ELASTIC_PUBLISHERS_URLS_INDEX,
+// with the orgs and repos fields listing its code hosting URLs. The ID of
+// the document is the codiceIPA, if ipa is not set.
+type indexedPublisher struct {
+	IPA           string   `json:"ipa"`
+	Description   string   `json:"description"`
+	Organizations []string `json:"orgs"`
+	Repositories  []string `json:"repos"`
+}
+
+// ReadPublishersFromIndex returns the administrations of the
+// ELASTIC_PUBLISHERS_URLS_INDEX index having at least an organization or a
+// repository. Unlike ELASTIC_INDICEPA_INDEX, it's not recreated by the
+// IndicePA imports. The administrations without a description get the name
+// in IndicePA.
+func (c *Crawler) ReadPublishersFromIndex() ([]PA, error) {
+	if c.es == nil {
+		return nil, errNoElasticsearch
+	}
+
+	index := viper.GetString("ELASTIC_PUBLISHERS_URLS_INDEX")
+
+	query := es.NewBoolQuery().
+		Should(es.NewExistsQuery("orgs"), es.NewExistsQuery("repos")).
+		MinimumNumberShouldMatch(1)
+
+	var publishers []PA
+	scroll := c.es.Scroll(index).Type("pa").Query(query).Size(500)
+	for {
+		results, err := scroll.Do(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range results.Hits.Hits {
+			publisher, err := publisherFromIndex(hit.Id, *hit.Source)
+			if err != nil {
+				log.Errorf("Skipping publisher %s of %s: %v", hit.Id, index, err)
+				continue
+			}
+			publishers = append(publishers, publisher)
+		}
+	}
+	log.Infof("Loaded %d publishers from %s", len(publishers), index)
+
+	return publishers, nil
+}
+
+// publisherFromIndex returns the PA of the document id of
+// ELASTIC_PUBLISHERS_URLS_INDEX.
+func publisherFromIndex(id string, source json.RawMessage) (PA, error) {
+	var p indexedPublisher
+	if err := json.Unmarshal(source, &p); err != nil {
+		return PA{}, err
+	}
+	if p.IPA == "" {
+		p.IPA = id
+	}
+	if p.Description == "" {
+		p.Description = ipa.GetAdministrationName(p.IPA)
+	}
+
+	return PA{
+		Name:          p.Description,
+		CodiceIPA:     p.IPA,
+		Organizations: p.Organizations,
+		Repositories:  p.Repositories,
+	}, nil
+}
+
+// ReadPublishersFromURL downloads and parses the whitelist at PUBLISHERS_URL,
+// YAML or JSON with the same structure as the whitelist files. Unlike the
+// blacklists there's no copy to fall back to: the crawl stops if it can't be
+// downloaded or it's not valid, instead of crawling nothing.
+func ReadPublishersFromURL() ([]PA, error) {
+	link := viper.GetString("PUBLISHERS_URL")
+	if !isHTTPURL(link) {
+		return nil, fmt.Errorf("PUBLISHERS_URL is not an HTTP(S) URL: %q", link)
+	}
+
+	// The status is -1 if there's no response at all.
+	resp, err := getURL(requestRawFile, link, nil)
+	switch {
+	case resp.Status.Code > 0 && resp.Status.Code != http.StatusOK:
+		return nil, fmt.Errorf("error in downloading %s: status %s", link, resp.Status.Text)
+	case err != nil:
+		return nil, fmt.Errorf("error in downloading %s: %v", link, err)
+	}
+
+	// JSON is valid YAML.
+	publishers, err := parseWhitelistFile(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error in parsing %s: %v", link, err)
+	}
+	if err := ValidatePublishers(publishers); err != nil {
+		return nil, fmt.Errorf("invalid publishers in %s: %v", link, err)
+	}
+	log.Infof("Loaded %d publishers from %s", len(publishers), link)
+
+	return publishers, nil
+}
+
+// ValidatePublishers returns an error listing the publishers without
+// organizations and repositories or with URLs not valid.
+func ValidatePublishers(publishers []PA) error {
+	if len(publishers) == 0 {
+		return errors.New("no publishers")
+	}
+
+	var problems []string
+	for i, publisher := range publishers {
+		name := publisher.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(publisher.Organizations) == 0 && len(publisher.Repositories) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: no orgs nor repos", name))
+		}
+		for _, link := range append(append([]string{}, publisher.Organizations...), publisher.Repositories...) {
+			if !isHTTPURL(link) {
+				problems = append(problems, fmt.Sprintf("%s: invalid URL %q", name, link))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// isHTTPURL returns whether link is an absolute HTTP(S) URL.
+func isHTTPURL(link string) bool {
+	u, err := url.Parse(link)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublisherFromIndex(t *testing.T) {
+	publisher, err := publisherFromIndex("1", []byte(`{
+		"ipa": "pcm",
+		"description": "Presidenza del Consiglio dei Ministri",
+		"type": "Pubbliche Amministrazioni",
+		"orgs": ["https://github.com/italia"],
+		"repos": ["https://gitlab.com/pcm/app"]
+	}`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, PA{
+		Name:          "Presidenza del Consiglio dei Ministri",
+		CodiceIPA:     "pcm",
+		Organizations: []string{"https://github.com/italia"},
+		Repositories:  []string{"https://gitlab.com/pcm/app"},
+	}, publisher)
+
+	// The ID is the codiceIPA.
+	publisher, err = publisherFromIndex("pcm", []byte(`{"description": "PCM", "orgs": ["https://github.com/italia"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "pcm", publisher.CodiceIPA)
+
+	_, err = publisherFromIndex("pcm", []byte(`{"orgs": "https://github.com/italia"}`))
+	assert.NotNil(t, err)
+}
+
+func TestReadPublishersFromIndex(t *testing.T) {
+	viper.Set("ELASTIC_PUBLISHERS_URLS_INDEX", "indicepa_urls")
+	defer viper.Set("ELASTIC_PUBLISHERS_URLS_INDEX", nil)
+
+	var searched []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/pa/_search") {
+			searched = append(searched, r.URL.Path)
+			fmt.Fprint(w, `{"_scroll_id": "1", "hits": {"total": 1, "hits": [
+				{"_id": "pcm", "_source": {"description": "PCM", "orgs": ["https://github.com/italia"]}}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"_scroll_id": "1", "hits": {"total": 1, "hits": []}}`)
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publishers, err := (&Crawler{es: client}).ReadPublishersFromIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, []PA{{Name: "PCM", CodiceIPA: "pcm", Organizations: []string{"https://github.com/italia"}}}, publishers)
+	assert.Equal(t, []string{"/indicepa_urls/pa/_search"}, searched)
+}
+
+func TestReadPublishersFromIndexNotConnected(t *testing.T) {
+	// Eg. in dry run.
+	_, err := (&Crawler{DryRun: true}).ReadPublishersFromIndex()
+	assert.Equal(t, errNoElasticsearch, err)
+}
+
+func TestReadPublishersFromURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/publishers.json":
+			fmt.Fprint(w, `[{"name": "Comune di Roma", "codice-iPA": "c_h501", "orgs": ["https://github.com/comune-roma"]}]`)
+		case "/publishers.yml":
+			fmt.Fprint(w, "- name: pcm\n  codice-iPA: pcm\n  repos:\n    - https://github.com/italia/app\n")
+		case "/empty.yml":
+			fmt.Fprint(w, "[]")
+		case "/invalid.yml":
+			fmt.Fprint(w, "- name: pcm\n  orgs:\n    - github.com/italia\n- name: empty\n")
+		case "/unavailable.yml":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "- name: pcm\n  codice-iPA: pcm\n  repos:\n    - https://github.com/italia/app\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	defer viper.Set("PUBLISHERS_URL", nil)
+
+	viper.Set("PUBLISHERS_URL", ts.URL+"/publishers.json")
+	publishers, err := ReadPublishersFromURL()
+	assert.NoError(t, err)
+	assert.Equal(t, []PA{{Name: "Comune di Roma", CodiceIPA: "c_h501", Organizations: []string{"https://github.com/comune-roma"}}}, publishers)
+
+	viper.Set("PUBLISHERS_URL", ts.URL+"/publishers.yml")
+	publishers, err = ReadPublishersFromURL()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/italia/app"}, publishers[0].Repositories)
+
+	viper.Set("PUBLISHERS_URL", ts.URL+"/empty.yml")
+	_, err = ReadPublishersFromURL()
+	assert.EqualError(t, err, "invalid publishers in "+ts.URL+"/empty.yml: no publishers")
+
+	viper.Set("PUBLISHERS_URL", ts.URL+"/invalid.yml")
+	_, err = ReadPublishersFromURL()
+	assert.EqualError(t, err, "invalid publishers in "+ts.URL+`/invalid.yml: pcm: invalid URL "github.com/italia"; empty: no orgs nor repos`)
+
+	viper.Set("PUBLISHERS_URL", ts.URL+"/missing.yml")
+	_, err = ReadPublishersFromURL()
+	assert.EqualError(t, err, "error in downloading "+ts.URL+"/missing.yml: status 404 Not Found")
+
+	viper.Set("PUBLISHERS_URL", ts.URL+"/unavailable.yml")
+	_, err = ReadPublishersFromURL()
+	assert.EqualError(t, err, "error in downloading "+ts.URL+"/unavailable.yml: status 503 Service Unavailable")
+
+	viper.Set("PUBLISHERS_URL", "publishers.yml")
+	_, err = ReadPublishersFromURL()
+	assert.EqualError(t, err, `PUBLISHERS_URL is not an HTTP(S) URL: "publishers.yml"`)
+}
+
+func TestValidatePublishers(t *testing.T) {
+	assert.NoError(t, ValidatePublishers([]PA{{Name: "pcm", Organizations: []string{"https://github.com/italia"}}}))
+
+	err := ValidatePublishers([]PA{
+		{Name: "pcm", Repositories: []string{"https://github.com/italia/app", "ftp://example.org/app"}},
+		{Organizations: []string{}},
+	})
+	assert.EqualError(t, err, `pcm: invalid URL "ftp://example.org/app"; #2: no orgs nor repos`)
+}
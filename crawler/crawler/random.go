@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	crand "crypto/rand"
+	"math/big"
+	mrand "math/rand"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// defaultRandom is used for all the randomness of the crawler (eg. picking
+// a token), so that runs can be made reproducible setting RANDOM_SEED.
+var defaultRandom = &randomSource{}
+
+// randomSource returns random numbers from crypto/rand or, if seeded, from
+// a deterministic math/rand source. It's safe for concurrent use.
+type randomSource struct {
+	once  sync.Once
+	mutex sync.Mutex
+	rand  *mrand.Rand
+}
+
+// newSeededRandomSource returns a randomSource always generating the same
+// numbers for the same seed.
+func newSeededRandomSource(seed int64) *randomSource {
+	r := &randomSource{rand: mrand.New(mrand.NewSource(seed))}
+	r.once.Do(func() {})
+
+	return r
+}
+
+// seeded returns the deterministic source, nil if crypto/rand must be used.
+// RANDOM_SEED is read on first use.
+func (r *randomSource) seeded() *mrand.Rand {
+	r.once.Do(func() {
+		if viper.IsSet("RANDOM_SEED") {
+			r.rand = mrand.New(mrand.NewSource(viper.GetInt64("RANDOM_SEED")))
+		}
+	})
+
+	return r.rand
+}
+
+// Intn returns an integer in [0, n).
+func (r *randomSource) Intn(n int) (int, error) {
+	if seeded := r.seeded(); seeded != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		return seeded.Intn(n), nil
+	}
+
+	result, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(result.Int64()), nil
+}
@@ -0,0 +1,32 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeededRandomSourceIsReproducible(t *testing.T) {
+	generate := func(r *randomSource) []int {
+		var numbers []int
+		for i := 0; i < 10; i++ {
+			n, err := r.Intn(1000)
+			assert.NoError(t, err)
+			numbers = append(numbers, n)
+		}
+
+		return numbers
+	}
+
+	assert.Equal(t, generate(newSeededRandomSource(42)), generate(newSeededRandomSource(42)))
+	assert.NotEqual(t, generate(newSeededRandomSource(42)), generate(newSeededRandomSource(43)))
+}
+
+func TestRandomSourceIntn(t *testing.T) {
+	r := &randomSource{}
+	for i := 0; i < 100; i++ {
+		n, err := r.Intn(3)
+		assert.NoError(t, err)
+		assert.True(t, n >= 0 && n < 3)
+	}
+}
@@ -0,0 +1,34 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+// errNoElasticsearch is returned by what needs Elasticsearch when the
+// crawler is not connected to it, eg. in dry run.
+var errNoElasticsearch = errors.New("not connected to Elasticsearch")
+
+// ready returns nil if the crawler is ready to work: Elasticsearch replies
+// to a ping and the IPA update completed. In dry run Elasticsearch is not used.
+func (c *Crawler) ready(ctx context.Context) error {
+	if c.DryRun {
+		return nil
+	}
+	if c.es == nil {
+		return errNoElasticsearch
+	}
+	if atomic.LoadInt32(&c.ipaUpdated) == 0 {
+		return errors.New("IPA update not completed")
+	}
+
+	if _, _, err := c.es.Ping(viper.GetString("ELASTIC_URL")).Do(ctx); err != nil {
+		return fmt.Errorf("cannot ping Elasticsearch: %v", err)
+	}
+
+	return nil
+}
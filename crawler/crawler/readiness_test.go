@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReady(t *testing.T) {
+	up := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"version": {"number": "6.8.0"}}`))
+	}))
+	defer ts.Close()
+
+	viper.Set("ELASTIC_URL", ts.URL)
+	defer viper.Set("ELASTIC_URL", nil)
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Crawler{es: client}
+	assert.EqualError(t, c.ready(context.Background()), "IPA update not completed")
+
+	c.ipaUpdated = 1
+	assert.NoError(t, c.ready(context.Background()))
+
+	// Elasticsearch is pinged on each check.
+	up = false
+	assert.Error(t, c.ready(context.Background()))
+
+	assert.NoError(t, (&Crawler{DryRun: true}).ready(context.Background()))
+}
@@ -0,0 +1,185 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+)
+
+// errActivityNotCalculated is the error of a software whose activity could
+// not be calculated again, eg. because of SKIP_ACTIVITY or a failed clone.
+var errActivityNotCalculated = errors.New("activity not calculated")
+
+// ActivityUpdate is the result of recalculating the activity of an indexed
+// software.
+type ActivityUpdate struct {
+	ID            string
+	URL           string
+	ActivityIndex float64
+	// Err is nil if the activity was calculated, and saved unless in dry run.
+	Err error
+}
+
+// indexedSoftware is a software of the index to recalculate the activity of.
+type indexedSoftware struct {
+	ID  string
+	URL string
+}
+
+// RecalculateActivity calculates again the activity index and the vitality
+// of the software in the index, with the current ACTIVITY_DAYS and
+// VITALITY_BUCKET_DAYS, and updates only those fields of the documents.
+// The repositories are looked up and cloned, or their activity read from
+// the API, like in a crawl, with CRAWLER_WORKERS workers and the same rate
+// limits, but their publiccode.yml are not downloaded nor validated.
+// In dry run the documents are read but not updated.
+// The results are in the order of the index.
+func (c *Crawler) RecalculateActivity(ctx context.Context) ([]ActivityUpdate, error) {
+	if c.es == nil {
+		return nil, errNoElasticsearch
+	}
+
+	software, err := c.indexedSoftware(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ActivityUpdate, len(software))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < crawlerWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = c.recalculateActivity(ctx, software[j])
+			}
+		}()
+	}
+
+	for i, sw := range software {
+		if ctx.Err() != nil {
+			results[i] = ActivityUpdate{ID: sw.ID, URL: sw.URL, Err: ctx.Err()}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+// indexedSoftware returns the ID and the repository URL of the software in
+// the index.
+func (c *Crawler) indexedSoftware(ctx context.Context) ([]indexedSoftware, error) {
+	var software []indexedSoftware
+
+	fields := es.NewFetchSourceContext(true).Include("publiccode.url")
+	scroll := c.es.Scroll(c.index).Type("software").FetchSourceContext(fields).Size(500)
+	for {
+		results, err := scroll.Do(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range results.Hits.Hits {
+			var doc struct {
+				Publiccode struct {
+					URL string `json:"url"`
+				} `json:"publiccode"`
+			}
+			if err := json.Unmarshal(*hit.Source, &doc); err != nil {
+				return nil, err
+			}
+			software = append(software, indexedSoftware{ID: hit.Id, URL: doc.Publiccode.URL})
+		}
+	}
+
+	return software, nil
+}
+
+// recalculateActivity looks up the repository of sw, calculates its
+// activity and updates the document.
+func (c *Crawler) recalculateActivity(ctx context.Context, sw indexedSoftware) ActivityUpdate {
+	result := ActivityUpdate{ID: sw.ID, URL: sw.URL}
+
+	repository, err := c.lookupRepository(sw)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	var logEntries []logEntry
+	activityIndex, vitality := c.calculateActivity(ctx, &repository, &logEntries)
+	if vitality == nil {
+		result.Err = errActivityNotCalculated
+		return result
+	}
+	result.ActivityIndex = activityIndex
+
+	if c.DryRun {
+		log.WithField(logFieldRepository, repository.Name).Info("Skipping the activity update (--dry-run)")
+		return result
+	}
+
+	doc := map[string]interface{}{
+		"vitalityScore":     activityIndex,
+		"vitalityDataChart": vitality,
+		"vitalityBuckets":   currentVitalityBuckets(),
+	}
+	if repository.CommitHistogram != nil {
+		doc["commitHistogram"] = repository.CommitHistogram
+	}
+	_, result.Err = c.es.Update().Index(c.index).Type("software").Id(sw.ID).Doc(doc).Do(ctx)
+
+	return result
+}
+
+// lookupRepository returns the repository of sw from the API of its code
+// hosting. It must be the one indexed as sw: a publiccode.yml whose url is
+// another repository, eg. its upstream, is not recalculated.
+func (c *Crawler) lookupRepository(sw indexedSoftware) (Repository, error) {
+	if sw.URL == "" {
+		return Repository{}, errors.New("no url in the indexed publiccode.yml")
+	}
+
+	domain, err := c.KnownHost(sw.URL)
+	if err != nil {
+		return Repository{}, err
+	}
+
+	// The repository can list more software, eg. a monorepo.
+	repositories := make(chan Repository)
+	listed := make(chan []Repository)
+	go func() {
+		var all []Repository
+		for repository := range repositories {
+			all = append(all, repository)
+		}
+		listed <- all
+	}()
+	err = domain.processSingleRepo(sw.URL, repositories, PA{})
+	close(repositories)
+	all := <-listed
+	if err != nil {
+		return Repository{}, err
+	}
+
+	for _, repository := range all {
+		if repository.generateID() == sw.ID {
+			return repository, nil
+		}
+	}
+
+	return Repository{}, errors.New("the url is not the repository indexed")
+}
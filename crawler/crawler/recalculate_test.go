@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecalculateActivity(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	RegisterClientAPIs()
+
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", filepath.Join(dir, "data"))
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	viper.Set("CRAWLER_WORKERS", 2)
+	viper.Set("VITALITY_BUCKET_DAYS", 7)
+	defer viper.Set("CRAWLER_DATADIR", nil)
+	defer viper.Set("CRAWLED_FILENAME", nil)
+	defer viper.Set("CRAWLER_WORKERS", nil)
+	defer viper.Set("VITALITY_BUCKET_DAYS", nil)
+
+	remote := filepath.Join(dir, "remote")
+	commitFixture(t, remote, []time.Time{time.Now().Add(-time.Hour)})
+
+	var host *httptest.Server
+	host = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/1.0/projects/COMUNE/repos/protocollo":
+			fmt.Fprintf(w, `{"slug": "protocollo", "public": true, "project": {"key": "COMUNE"},
+				"links": {"clone": [{"name": "http", "href": "file://%s"}],
+				"self": [{"href": "%s/projects/COMUNE/repos/protocollo/browse"}]}}`, remote, host.URL)
+		case "/rest/api/1.0/projects/COMUNE/repos/protocollo/branches/default":
+			fmt.Fprint(w, `{"id": "refs/heads/master", "displayId": "master"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer host.Close()
+
+	// Known by another name than 127.0.0.1, like in TestListRepos.
+	repoURL := strings.Replace(host.URL, "127.0.0.1", "localhost", 1) + "/projects/COMUNE/repos/protocollo"
+	id := (&Repository{GitCloneURL: "file://" + remote}).generateID()
+
+	updates := map[string]map[string]interface{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/publiccode/software/_search":
+			fmt.Fprintf(w, `{"_scroll_id": "1", "hits": {"total": 3, "hits": [
+				{"_id": "%s", "_source": {"publiccode": {"url": "%s"}}},
+				{"_id": "upstream", "_source": {"publiccode": {"url": "%s"}}},
+				{"_id": "nourl", "_source": {"publiccode": {}}}]}}`, id, repoURL, repoURL)
+		case strings.HasSuffix(r.URL.Path, "/_update"):
+			var body struct {
+				Doc map[string]interface{} `json:"doc"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			updates[r.URL.Path] = body.Doc
+			fmt.Fprint(w, `{"_index": "publiccode", "_type": "software", "result": "updated"}`)
+		default:
+			// The scroll is over.
+			fmt.Fprint(w, `{"_scroll_id": "1", "hits": {"total": 3, "hits": []}}`)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	assert.NoError(t, err)
+	c := Crawler{
+		es:      client,
+		index:   "publiccode",
+		domains: []Domain{{Host: "localhost", Type: "bitbucket-server"}},
+	}
+
+	results, err := c.RecalculateActivity(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+
+	assert.Equal(t, id, results[0].ID)
+	assert.NoError(t, results[0].Err)
+	assert.EqualError(t, results[1].Err, "the url is not the repository indexed")
+	assert.EqualError(t, results[2].Err, "no url in the indexed publiccode.yml")
+
+	// Only the activity fields are updated, with 60 days in buckets of 7.
+	assert.Len(t, updates, 1)
+	doc := updates["/publiccode/software/"+id+"/_update"]
+	assert.Len(t, doc["vitalityDataChart"], 9)
+	assert.Equal(t, map[string]interface{}{"windowDays": float64(60), "bucketDays": float64(7)}, doc["vitalityBuckets"])
+	assert.Contains(t, doc, "vitalityScore")
+	assert.Len(t, doc, 3)
+
+	// In dry run the software is read but not updated.
+	updates = map[string]map[string]interface{}{}
+	c.DryRun = true
+	results, err = c.RecalculateActivity(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.Empty(t, updates)
+	c.DryRun = false
+
+	// Nothing is calculated without the clones.
+	viper.Set("SKIP_ACTIVITY", true)
+	defer viper.Set("SKIP_ACTIVITY", nil)
+	results, err = c.RecalculateActivity(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, errActivityNotCalculated, results[0].Err)
+
+	// Elasticsearch is required.
+	_, err = (&Crawler{DryRun: true}).RecalculateActivity(context.Background())
+	assert.Equal(t, errNoElasticsearch, err)
+}
@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// daysSince returns the number of whole days from t to now, nil if t is unknown.
+func daysSince(t, now time.Time) *int {
+	if t.IsZero() {
+		return nil
+	}
+
+	days := int(now.Sub(t).Hours() / 24)
+	if days < 0 {
+		days = 0
+	}
+
+	return &days
+}
+
+// lastPushTime returns when the repository was last pushed to according to
+// the metadata of its code hosting, zero if unknown.
+// GitLab, Bitbucket and Gitea only expose the last activity or update, that
+// includes other changes like the issues.
+func lastPushTime(repository Repository) time.Time {
+	var metadata struct {
+		PushedAt       time.Time `json:"pushed_at"`
+		LastActivityAt time.Time `json:"last_activity_at"`
+		UpdatedOn      time.Time `json:"updated_on"`
+		UpdatedAt      time.Time `json:"updated_at"`
+	}
+	if err := json.Unmarshal(repository.Metadata, &metadata); err != nil {
+		return time.Time{}
+	}
+
+	switch repository.Domain.API() {
+	case "github":
+		return metadata.PushedAt
+	case "gitlab":
+		return metadata.LastActivityAt
+	case "bitbucket":
+		return metadata.UpdatedOn
+	case "gitea":
+		return metadata.UpdatedAt
+	}
+
+	return time.Time{}
+}
+
+// daysSinceLastCommit returns the days since the last commit of the clone
+// or, if the repository wasn't cloned, since the last push reported by its
+// code hosting. It's nil if both are unknown.
+func daysSinceLastCommit(repository Repository, now time.Time) *int {
+	if !repository.LastCommit.IsZero() {
+		return daysSince(repository.LastCommit, now)
+	}
+
+	return daysSince(lastPushTime(repository), now)
+}
+
+// lastActivityTime returns when the repository was last pushed to according
+// to its code hosting or, if unknown, the time of the last commit in the
+// clone, that a stale mirror or a fallback repository can make older.
+func lastActivityTime(repository Repository) time.Time {
+	if pushed := lastPushTime(repository); !pushed.IsZero() {
+		return pushed
+	}
+
+	return repository.LastCommit
+}
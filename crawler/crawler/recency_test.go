@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDaysSinceLastCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	commitFixture(t, dir, []time.Time{now.AddDate(0, 0, -30), now.AddDate(0, 0, -10).Add(-time.Hour)})
+
+	last, err := lastCommitTime(dir)
+	assert.NoError(t, err)
+
+	days := daysSinceLastCommit(Repository{LastCommit: last}, now)
+	if assert.NotNil(t, days) {
+		assert.Equal(t, 10, *days)
+	}
+
+	// Without a clone, the push date of the code hosting is used.
+	github := Repository{
+		Domain:   Domain{Host: "github.com"},
+		Metadata: []byte(`{"pushed_at": "` + now.AddDate(0, 0, -3).Format(time.RFC3339) + `"}`),
+	}
+	days = daysSinceLastCommit(github, now)
+	if assert.NotNil(t, days) {
+		assert.Equal(t, 3, *days)
+	}
+
+	assert.Nil(t, daysSinceLastCommit(Repository{Domain: Domain{Host: "github.com"}}, now))
+}
+
+func TestLastActivityTime(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// The push date of the code hosting wins over the clone.
+	github := Repository{
+		Domain:     Domain{Host: "github.com"},
+		Metadata:   []byte(`{"pushed_at": "` + now.AddDate(0, 0, -3).Format(time.RFC3339) + `"}`),
+		LastCommit: now.AddDate(-2, 0, 0),
+	}
+	assert.True(t, now.AddDate(0, 0, -3).Equal(lastActivityTime(github)))
+
+	// Without it, the last commit of the clone.
+	github.Metadata = nil
+	assert.True(t, now.AddDate(-2, 0, 0).Equal(lastActivityTime(github)))
+}
@@ -0,0 +1,192 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/italia/developers-italia-backend/crawler/elastic"
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// reindexPollInterval is how often the progress of the copies is reported.
+var reindexPollInterval = 5 * time.Second
+
+// reindexTask is a copy between two indices in progress, saved so it can be
+// resumed if Reindex gets interrupted.
+type reindexTask struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+	ID  string `json:"id"`
+}
+
+// reindexTaskFile returns the path of the file with the copy in progress.
+func reindexTaskFile() string {
+	return filepath.Join(viper.GetString("CRAWLER_DATADIR"), "reindex_task.json")
+}
+
+// migrationIndex returns the name of the index published while the live
+// index is rebuilt by Reindex.
+func migrationIndex() string {
+	return viper.GetString("ELASTIC_PUBLICCODE_INDEX") + "_reindex"
+}
+
+// Reindex migrates the live index to the current PubliccodeMapping with the
+// Elasticsearch reindex API, without crawling: the documents are copied,
+// transformed by the painless script if not empty, into the migration index,
+// the public alias is moved to it and the live index is rebuilt from it.
+// If interrupted, running it again resumes from where it stopped.
+func (c *Crawler) Reindex(script string) error {
+	live := viper.GetString("ELASTIC_PUBLICCODE_INDEX")
+	migration := migrationIndex()
+	alias := viper.GetString("ELASTIC_ALIAS")
+
+	current, err := elastic.AliasIndices(alias, c.es)
+	if err != nil {
+		return err
+	}
+
+	published := false
+	for _, index := range current {
+		published = published || index == migration
+	}
+
+	// Unless already published, copy the live index into the migration index...
+	if !published {
+		err = elastic.CreateIndexMapping(migration, elastic.PubliccodeMapping, c.es)
+		if err != nil {
+			return err
+		}
+		err = c.copyIndex(live, migration, script)
+		if err != nil {
+			return err
+		}
+
+		// ...and publish it while the live index gets rebuilt.
+		err = elastic.AliasSwap(alias, live, migration, c.es)
+		if err != nil {
+			return err
+		}
+		log.Infof("Alias %s moved to %s", alias, migration)
+	}
+
+	// Recreate the live index with the new mapping, unless resuming its copy.
+	task, err := readReindexTask()
+	if err != nil {
+		return err
+	}
+	if task.Src != migration || task.Dst != live {
+		_, err = c.es.DeleteIndex(live).Do(context.Background())
+		if err != nil && !es.IsNotFound(err) {
+			return err
+		}
+	}
+	err = elastic.CreateIndexMapping(live, elastic.PubliccodeMapping, c.es)
+	if err != nil {
+		return err
+	}
+	err = c.copyIndex(migration, live, "")
+	if err != nil {
+		return err
+	}
+
+	err = elastic.AliasSwap(alias, migration, live, c.es)
+	if err != nil {
+		return err
+	}
+	_, err = c.es.DeleteIndex(migration).Do(context.Background())
+	if err != nil {
+		return err
+	}
+	log.Infof("%s migrated to the current mapping", live)
+
+	return nil
+}
+
+// copyIndex copies src into dst with a reindex task, reporting its progress,
+// and waits for it to complete. It fails if any document wasn't copied. It resumes the task saved by an interrupted
+// copy between the same indices, or starts it again if Elasticsearch lost it.
+func (c *Crawler) copyIndex(src, dst, script string) error {
+	task, err := readReindexTask()
+	if err != nil {
+		return err
+	}
+
+	if task.Src == src && task.Dst == dst && task.ID != "" {
+		log.Infof("Resuming the copy of %s into %s (task %s)", src, dst, task.ID)
+	} else {
+		task, err = c.startCopy(src, dst, script)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		status, err := elastic.ReindexTask(task.ID, c.es)
+		if es.IsNotFound(err) {
+			log.Warnf("Reindex task %s not found, copying %s into %s again", task.ID, src, dst)
+			task, err = c.startCopy(src, dst, script)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Copying %s into %s: %d/%d documents", src, dst, status.Done(), status.Total)
+		if status.Completed {
+			if err := os.Remove(reindexTaskFile()); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			for _, failure := range status.Failures {
+				log.Errorf("Document not copied into %s: %s", dst, failure)
+			}
+			if len(status.Failures) > 0 {
+				return fmt.Errorf("%d documents couldn't be copied from %s into %s", len(status.Failures), src, dst)
+			}
+
+			return nil
+		}
+
+		time.Sleep(reindexPollInterval)
+	}
+}
+
+// startCopy starts the reindex task copying src into dst and saves it.
+func (c *Crawler) startCopy(src, dst, script string) (reindexTask, error) {
+	id, err := elastic.StartReindex(src, dst, script, c.es)
+	if err != nil {
+		return reindexTask{}, err
+	}
+	task := reindexTask{Src: src, Dst: dst, ID: id}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return task, err
+	}
+
+	return task, ioutil.WriteFile(reindexTaskFile(), data, 0644)
+}
+
+// readReindexTask returns the copy in progress, empty if there's none.
+func readReindexTask() (reindexTask, error) {
+	var task reindexTask
+
+	data, err := ioutil.ReadFile(reindexTaskFile())
+	if os.IsNotExist(err) {
+		return task, nil
+	}
+	if err != nil {
+		return task, err
+	}
+
+	return task, json.Unmarshal(data, &task)
+}
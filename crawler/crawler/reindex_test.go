@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeReindexES is a fake Elasticsearch with the indices and the alias
+// pointing to them, completing the reindex tasks at the first check, with
+// the failures of failedTask if set.
+type fakeReindexES struct {
+	sync.Mutex
+	indices    map[string]bool
+	aliased    map[string]bool
+	requests   []string
+	failedTask string
+}
+
+func (f *fakeReindexES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	path := strings.Trim(r.URL.Path, "/")
+	f.requests = append(f.requests, r.Method+" "+path)
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "_alias/"):
+		res := make(map[string]interface{})
+		for index := range f.aliased {
+			res[index] = map[string]interface{}{"aliases": map[string]interface{}{"alias": struct{}{}}}
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	case path == "_aliases":
+		var body struct {
+			Actions []map[string]struct {
+				Index string `json:"index"`
+			} `json:"actions"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		for _, action := range body.Actions {
+			for op, v := range action {
+				f.aliased[v.Index] = op == "add"
+			}
+		}
+		_, _ = w.Write([]byte(`{"acknowledged": true}`))
+	case path == "_reindex":
+		_, _ = w.Write([]byte(`{"task": "node:1"}`))
+	case strings.HasPrefix(path, "_tasks/") && f.failedTask != "":
+		_, _ = w.Write([]byte(f.failedTask))
+	case strings.HasPrefix(path, "_tasks/"):
+		_, _ = w.Write([]byte(`{"completed": true, "task": {"status": {"total": 2, "created": 2}}}`))
+	case strings.HasSuffix(path, "/_count"):
+		_, _ = w.Write([]byte(`{"count": 2}`))
+	case r.Method == http.MethodHead:
+		if !f.indices[path] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		f.indices[path] = true
+		_, _ = w.Write([]byte(`{"acknowledged": true}`))
+	case r.Method == http.MethodDelete:
+		delete(f.indices, path)
+		delete(f.aliased, path)
+		_, _ = w.Write([]byte(`{"acknowledged": true}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	viper.Set("ELASTIC_PUBLICCODE_INDEX", "publiccode")
+	viper.Set("ELASTIC_ALIAS", "alias")
+	defer func() {
+		viper.Set("CRAWLER_DATADIR", nil)
+		viper.Set("ELASTIC_PUBLICCODE_INDEX", nil)
+		viper.Set("ELASTIC_ALIAS", nil)
+	}()
+
+	fake := &fakeReindexES{
+		indices: map[string]bool{"publiccode": true},
+		aliased: map[string]bool{"publiccode": true},
+	}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crawler{es: client}
+
+	assert.NoError(t, c.Reindex(""))
+	assert.Equal(t, map[string]bool{"publiccode": true}, fake.indices)
+	assert.True(t, fake.aliased["publiccode"])
+	assert.False(t, fake.aliased["publiccode_reindex"])
+	_, err = os.Stat(reindexTaskFile())
+	assert.True(t, os.IsNotExist(err))
+
+	// Interrupted while rebuilding the live index: its copy is resumed,
+	// without deleting it or starting it again.
+	fake.indices["publiccode_reindex"] = true
+	fake.aliased = map[string]bool{"publiccode_reindex": true}
+	fake.requests = nil
+	err = ioutil.WriteFile(reindexTaskFile(), []byte(`{"src": "publiccode_reindex", "dst": "publiccode", "id": "node:7"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, c.Reindex(""))
+	assert.Contains(t, fake.requests, "GET _tasks/node:7")
+	assert.NotContains(t, fake.requests, "POST _reindex")
+	assert.NotContains(t, fake.requests, "DELETE publiccode")
+	assert.Equal(t, map[string]bool{"publiccode": true}, fake.indices)
+	assert.True(t, fake.aliased["publiccode"])
+}
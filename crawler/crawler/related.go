@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"context"
+	"strings"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// defaultRelatedSoftwareKeys are the publiccode.yml keys referencing other
+// software, overridden by RELATED_SOFTWARE_KEYS.
+var defaultRelatedSoftwareKeys = []string{"isBasedOn", "dependsOn.open"}
+
+// relatedSoftwareKeys returns the configured keys referencing other software.
+func relatedSoftwareKeys() []string {
+	if viper.IsSet("RELATED_SOFTWARE_KEYS") {
+		return viper.GetStringSlice("RELATED_SOFTWARE_KEYS")
+	}
+
+	return defaultRelatedSoftwareKeys
+}
+
+// relatedSoftwareReferences returns the references to other software found
+// in keys: URLs for isBasedOn and names for dependencies.
+func relatedSoftwareReferences(pc publiccode.PublicCode, keys []string) []string {
+	var references []string
+
+	dependencyNames := func(dependencies []publiccode.Dependency) []string {
+		var names []string
+		for _, d := range dependencies {
+			names = append(names, d.Name)
+		}
+		return names
+	}
+
+	for _, key := range keys {
+		switch key {
+		case "isBasedOn":
+			references = append(references, pc.IsBasedOn...)
+		case "dependsOn.open":
+			references = append(references, dependencyNames(pc.DependsOn.Open)...)
+		case "dependsOn.proprietary":
+			references = append(references, dependencyNames(pc.DependsOn.Proprietary)...)
+		case "dependsOn.hardware":
+			references = append(references, dependencyNames(pc.DependsOn.Hardware)...)
+		default:
+			log.Warnf("Unknown key %s in RELATED_SOFTWARE_KEYS", key)
+		}
+	}
+
+	return references
+}
+
+// resolveRelatedSoftware returns the references, replacing the ones to
+// indexed software with their document ID. Duplicates are removed.
+func resolveRelatedSoftware(references []string, resolve func(reference string) (string, bool)) []string {
+	var related []string
+	seen := make(map[string]bool)
+
+	for _, reference := range references {
+		reference = strings.TrimSpace(reference)
+		if reference == "" {
+			continue
+		}
+
+		if id, ok := resolve(reference); ok {
+			reference = id
+		}
+		if !seen[reference] {
+			seen[reference] = true
+			related = append(related, reference)
+		}
+	}
+
+	return related
+}
+
+// findSoftwareID returns the ID of the indexed software with reference as
+// publiccode.url. Only URLs can be resolved.
+func (c *Crawler) findSoftwareID(reference string) (string, bool) {
+	if !strings.Contains(reference, "://") {
+		return "", false
+	}
+
+	withoutGit := strings.TrimSuffix(reference, ".git")
+	searchResult, err := c.es.Search().
+		Index(c.index).
+		Query(es.NewTermsQuery("publiccode.url", withoutGit, withoutGit+".git")).
+		FetchSource(false).
+		Size(1).
+		Do(context.Background())
+	if err != nil {
+		log.Errorf("Error looking for related software %s: %v", reference, err)
+		return "", false
+	}
+	if len(searchResult.Hits.Hits) == 0 {
+		return "", false
+	}
+
+	return searchResult.Hits.Hits[0].Id, true
+}
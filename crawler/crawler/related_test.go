@@ -0,0 +1,27 @@
+package crawler
+
+import (
+	"testing"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelatedSoftware(t *testing.T) {
+	var pc publiccode.PublicCode
+	pc.IsBasedOn = []string{"https://github.com/italia/indexed", "https://example.org/not-indexed"}
+	pc.DependsOn.Open = []publiccode.Dependency{{Name: "PostgreSQL"}, {Name: "PostgreSQL"}}
+	pc.DependsOn.Proprietary = []publiccode.Dependency{{Name: "Oracle"}}
+
+	indexed := map[string]string{"https://github.com/italia/indexed": "4a5d"}
+	resolve := func(reference string) (string, bool) {
+		id, ok := indexed[reference]
+		return id, ok
+	}
+
+	references := relatedSoftwareReferences(pc, defaultRelatedSoftwareKeys)
+	assert.Equal(t, []string{"4a5d", "https://example.org/not-indexed", "PostgreSQL"}, resolveRelatedSoftware(references, resolve))
+
+	references = relatedSoftwareReferences(pc, []string{"dependsOn.proprietary"})
+	assert.Equal(t, []string{"Oracle"}, resolveRelatedSoftware(references, resolve))
+}
@@ -4,7 +4,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -31,48 +31,49 @@ type Range struct {
 	Points float64
 }
 
+// CommitMonth is the number of commits in a month of the activity window.
+type CommitMonth struct {
+	Month   string `json:"month"`
+	Commits int    `json:"commits"`
+}
+
 // CalculateRepoActivity return the repository activity index and the vitality slice calculated on the git clone.
+// If histogram is true, it also returns the number of commits per month in the last days.
 // It follows the document https://lg-acquisizione-e-riuso-software-per-la-pa.readthedocs.io/
 // In reference to section: 2.5.2. Fase 2.2: Valutazione soluzioni riusabili per la PA
-func (repository *Repository) CalculateRepoActivity(days int) (float64, map[int]float64, error) {
+func (repository *Repository) CalculateRepoActivity(days int, histogram bool) (float64, map[int]float64, []CommitMonth, error) {
 	if repository.Domain.Host == "" {
-		return 0, nil, errors.New("cannot calculate repository activity without domain host")
+		return 0, nil, nil, errors.New("cannot calculate repository activity without domain host")
 	}
 	if repository.Name == "" {
-		return 0, nil, errors.New("cannot  calculate repository activity without name")
+		return 0, nil, nil, errors.New("cannot  calculate repository activity without name")
 	}
 
-	vendor, repo := splitFullName(repository.Name)
-
-	path := filepath.Join(viper.GetString("CRAWLER_DATADIR"), "repos", repository.Hostname, vendor, repo, "gitClone")
+	path := gitClonePath(repository.Hostname, repository.Name)
 
 	// MkdirAll will create all the folder path, if not exists.
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return 0, nil, err
+		return 0, nil, nil, err
 	}
-	// Repository activity score.
-	var (
-		userCommunity  float64
-		codeActivity   float64
-		releaseHistory float64
-		longevity      float64
-
-		repoActivity float64
-	)
 
 	// Open and load the git repo path.
 	r, err := git.PlainOpen(path)
 	if err != nil {
 		log.Error(err)
-		return 0, nil, err
+		return 0, nil, nil, err
 	}
 
-	// Extract all the commits.
-	commits, err := extractAllCommits(r)
+	// Extract all the commits, only the ones touching the subpath if set.
+	commits, err := extractAllCommits(r, repository.Subpath)
 	if err != nil {
 		log.Error(err)
 	}
 
+	// A shallow clone (CLONE_DEPTH) may miss part of the history.
+	if shallow, err := r.Storer.Shallow(); err == nil && len(shallow) > 0 {
+		warnShallowHistory(repository.Name, days, commits, time.Now())
+	}
+
 	// List commits before a number of days: commitsLastDays[from days before today][]commits
 	commitsLastDays := extractCommitsLastDays(days, commits)
 
@@ -88,22 +89,35 @@ func (repository *Repository) CalculateRepoActivity(days int) (float64, map[int]
 	// List tags in a day: tagsPerDay[day][]commits
 	tagsPerDays := extractTagsPerDay(days, tags)
 
-	// For every day (and before) calculate the Vitality index.
-	vitalityIndex := map[int]float64{}
-
 	// Longevity is the repository age.
-	longevity, err = calculateLongevityIndex(r)
+	longevity, err := calculateLongevityIndex(r)
 	if err != nil {
 		log.Warn(err)
 	}
 
-	for i := 0; i < days; i++ {
-		userCommunity = ranges("userCommunity", userCommunityLastDays(commitsLastDays[i]))
+	activityIndex, vitalityIndex := calculateVitality(days, longevity, func(i int) (float64, float64, float64) {
+		return userCommunityLastDays(commitsLastDays[i]), activityLastDays(commitsPerDay[i]), releaseHistoryLastDays(tagsPerDays[i])
+	})
+
+	var commitHistogram []CommitMonth
+	if histogram {
+		commitHistogram = monthlyCommits(days, commits, time.Now())
+	}
+
+	return activityIndex, vitalityIndex, commitHistogram, nil
+}
 
-		codeActivity = ranges("codeActivity", activityLastDays(commitsPerDay[i]))
-		releaseHistory = ranges("releaseHistory", releaseHistoryLastDays(tagsPerDays[i]))
+// calculateVitality returns the activity index and the vitality index of
+// each of the last days of a repository longevity days old. daily returns,
+// for the day i days before today, the number of authors until then, the
+// number of commits and merges and the number of releases of the day.
+func calculateVitality(days int, longevity float64, daily func(i int) (float64, float64, float64)) (float64, map[int]float64) {
+	vitalityIndex := map[int]float64{}
+	for i := 0; i < days; i++ {
+		authors, commits, releases := daily(i)
 
-		repoActivity = userCommunity + codeActivity + releaseHistory + ranges("longevity", longevity)
+		repoActivity := ranges("userCommunity", authors) + ranges("codeActivity", commits) +
+			ranges("releaseHistory", releases) + ranges("longevity", longevity)
 		if repoActivity > 100 {
 			repoActivity = 100
 		}
@@ -114,7 +128,115 @@ func (repository *Repository) CalculateRepoActivity(days int) (float64, map[int]
 	if vitalityIndexTotal > 100 {
 		vitalityIndexTotal = float64(100)
 	}
-	return float64(int(vitalityIndexTotal)), vitalityIndex, nil
+
+	return float64(int(vitalityIndexTotal)), vitalityIndex
+}
+
+// defaultActivityDays is the number of days of the activity calculation,
+// overridden by ACTIVITY_DAYS.
+const defaultActivityDays = 60
+
+// activityDays returns the number of days of the activity calculation.
+func activityDays() int {
+	if viper.IsSet("ACTIVITY_DAYS") && viper.GetInt("ACTIVITY_DAYS") > 0 {
+		return viper.GetInt("ACTIVITY_DAYS")
+	}
+
+	return defaultActivityDays
+}
+
+// defaultVitalityBucketDays is the number of days of each value of the
+// vitality, overridden by VITALITY_BUCKET_DAYS.
+const defaultVitalityBucketDays = 1
+
+// vitalityBucketDays returns the number of days of each value of the vitality.
+func vitalityBucketDays() int {
+	if viper.IsSet("VITALITY_BUCKET_DAYS") && viper.GetInt("VITALITY_BUCKET_DAYS") > 0 {
+		return viper.GetInt("VITALITY_BUCKET_DAYS")
+	}
+
+	return defaultVitalityBucketDays
+}
+
+// VitalityBuckets describe the vitalityDataChart of a document: its value i
+// is the mean vitality index of the BucketDays days starting i*BucketDays
+// days before the crawl, going back WindowDays days. The last bucket is
+// shorter if WindowDays is not a multiple of BucketDays.
+type VitalityBuckets struct {
+	WindowDays int `json:"windowDays"`
+	BucketDays int `json:"bucketDays"`
+}
+
+// currentVitalityBuckets returns the VitalityBuckets of the configured
+// ACTIVITY_DAYS and VITALITY_BUCKET_DAYS.
+func currentVitalityBuckets() VitalityBuckets {
+	return VitalityBuckets{WindowDays: activityDays(), BucketDays: vitalityBucketDays()}
+}
+
+// vitalityBuckets returns the mean vitality of each bucket of bucketDays
+// days of the last days, most recent first. Its length only depends on
+// days and bucketDays: the days missing from vitality count as 0.
+func vitalityBuckets(vitality map[int]float64, days, bucketDays int) []int {
+	if bucketDays < 1 {
+		bucketDays = 1
+	}
+
+	buckets := make([]int, 0, (days+bucketDays-1)/bucketDays)
+	for start := 0; start < days; start += bucketDays {
+		end := start + bucketDays
+		if end > days {
+			end = days
+		}
+
+		var total float64
+		for i := start; i < end; i++ {
+			total += vitality[i]
+		}
+		buckets = append(buckets, int(total/float64(end-start)))
+	}
+
+	return buckets
+}
+
+// warnShallowHistory logs a warning if the commits of a shallow clone
+// don't cover the last days, since the activity is then underestimated.
+// The longevity is always underestimated, the first commit is missing.
+func warnShallowHistory(name string, days int, commits []*object.Commit, now time.Time) {
+	logger := log.WithField(logFieldRepository, name)
+	logger.Warn("Shallow clone, the longevity is calculated from the oldest commit cloned and will be underestimated")
+
+	cutoff := now.AddDate(0, 0, -days)
+	for _, c := range commits {
+		if !c.Author.When.After(cutoff) {
+			return
+		}
+	}
+	logger.Warnf("Shallow clone without the history of the last %d days (CLONE_DEPTH), the activity index may be lower", days)
+}
+
+// monthlyCommits returns the number of commits per month in the last days
+// before now, oldest month first. Months without commits are included.
+func monthlyCommits(days int, commits []*object.Commit, now time.Time) []CommitMonth {
+	from := now.AddDate(0, 0, -days)
+
+	var months []CommitMonth
+	index := map[string]int{}
+	for m := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, now.Location()); !m.After(now); m = m.AddDate(0, 1, 0) {
+		index[m.Format("2006-01")] = len(months)
+		months = append(months, CommitMonth{Month: m.Format("2006-01")})
+	}
+
+	for _, c := range commits {
+		when := c.Author.When.In(now.Location())
+		if when.Before(from) || when.After(now) {
+			continue
+		}
+		if i, ok := index[when.Format("2006-01")]; ok {
+			months[i].Commits++
+		}
+	}
+
+	return months
 }
 
 // userCommunityLastDays returns the number of unique commits authors.
@@ -169,7 +291,9 @@ func extractAllTagsCommit(r *git.Repository) ([]*object.Commit, error) {
 }
 
 // extractAllCommits returns a slice of all the commits from the passed repository.
-func extractAllCommits(r *git.Repository) ([]*object.Commit, error) {
+// If subpath is not empty only the commits changing it are returned, like
+// git log -- <subpath>.
+func extractAllCommits(r *git.Repository, subpath string) ([]*object.Commit, error) {
 	var commits []*object.Commit
 
 	ref, err := r.Head()
@@ -184,7 +308,9 @@ func extractAllCommits(r *git.Repository) ([]*object.Commit, error) {
 	}
 
 	err = cIter.ForEach(func(c *object.Commit) error {
-		commits = append(commits, c)
+		if subpath == "" || commitChangesPath(c, subpath) {
+			commits = append(commits, c)
+		}
 		return nil
 	})
 	if err != nil {
@@ -193,6 +319,40 @@ func extractAllCommits(r *git.Repository) ([]*object.Commit, error) {
 	return commits, nil
 }
 
+// commitChangesPath returns whether the commit changed the file or directory
+// at subpath, compared to all of its parents.
+func commitChangesPath(c *object.Commit, subpath string) bool {
+	hash := pathHash(c, subpath)
+
+	changed := true
+	err := c.Parents().ForEach(func(parent *object.Commit) error {
+		if pathHash(parent, subpath) == hash {
+			changed = false
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+
+	return changed && (hash != plumbing.ZeroHash || c.NumParents() > 0)
+}
+
+// pathHash returns the hash of the file or directory at subpath in the
+// commit, the zero hash if it doesn't exist.
+func pathHash(c *object.Commit, subpath string) plumbing.Hash {
+	tree, err := c.Tree()
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+	entry, err := tree.FindEntry(strings.Trim(subpath, "/"))
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+
+	return entry.Hash
+}
+
 // calculateLongevityIndex cal
 func calculateLongevityIndex(r *git.Repository) (float64, error) {
 	ref, err := r.Head()
@@ -325,3 +485,23 @@ func meanActivity(points map[int]float64) float64 {
 
 	return total / float64(len(points))
 }
+
+// lastCommitTime returns the time of the last commit of the git clone in path.
+func lastCommitTime(path string) (time.Time, error) {
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return commit.Committer.When, nil
+}
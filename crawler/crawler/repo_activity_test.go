@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// commitFixture creates a git repository in path with a commit at each of dates.
+func commitFixture(t *testing.T, path string, dates []time.Time) {
+	r, err := git.PlainInit(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, date := range dates {
+		err = ioutil.WriteFile(filepath.Join(path, "file"), []byte(date.String()), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Commit("commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "Author", Email: "author" + string(rune('a'+i)) + "@example.org", When: date},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCommitHistogram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set("CRAWLER_DATADIR", dir)
+	defer viper.Set("CRAWLER_DATADIR", nil)
+
+	now := time.Now()
+	inWindow := []time.Time{now.AddDate(0, 0, -45), now.AddDate(0, 0, -40), now.Add(-time.Hour)}
+	dates := append([]time.Time{now.AddDate(0, 0, -200)}, inWindow...)
+	commitFixture(t, gitClonePath("example.org", "vendor/repo"), dates)
+
+	repository := Repository{Name: "vendor/repo", Hostname: "example.org", Domain: Domain{Host: "example.org"}}
+
+	_, _, histogram, err := repository.CalculateRepoActivity(90, false)
+	assert.Nil(t, err)
+	assert.Nil(t, histogram)
+
+	_, _, histogram, err = repository.CalculateRepoActivity(90, true)
+	assert.Nil(t, err)
+
+	expected := map[string]int{}
+	for _, date := range inWindow {
+		expected[date.Format("2006-01")]++
+	}
+
+	var total int
+	for _, month := range histogram {
+		assert.Equal(t, expected[month.Month], month.Commits, month.Month)
+		total += month.Commits
+	}
+	assert.Equal(t, len(inWindow), total)
+	assert.Equal(t, now.AddDate(0, 0, -90).Format("2006-01"), histogram[0].Month)
+	assert.Equal(t, now.Format("2006-01"), histogram[len(histogram)-1].Month)
+}
+
+func TestExtractCommitsSubpath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Commit to app/ twice and to other/ three times.
+	for i, file := range []string{"app/file", "other/file", "app/file", "other/file", "other/file"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Add(file); err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Commit("commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "Author", Email: "author@example.org", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commits, err := extractAllCommits(r, "")
+	assert.NoError(t, err)
+	assert.Len(t, commits, 5)
+
+	commits, err = extractAllCommits(r, "app")
+	assert.NoError(t, err)
+	assert.Len(t, commits, 2)
+
+	commits, err = extractAllCommits(r, "/other/")
+	assert.NoError(t, err)
+	assert.Len(t, commits, 3)
+
+	commits, err = extractAllCommits(r, "missing")
+	assert.NoError(t, err)
+	assert.Empty(t, commits)
+}
+
+func TestVitalityBuckets(t *testing.T) {
+	vitality := map[int]float64{0: 50, 1: 40, 2: 30, 3: 20, 4: 10}
+
+	assert.Equal(t, []int{50, 40, 30, 20, 10}, vitalityBuckets(vitality, 5, 1))
+	assert.Equal(t, []int{45, 25, 10}, vitalityBuckets(vitality, 5, 2))
+
+	// Same length without the vitality of some days.
+	assert.Equal(t, []int{25, 0, 0}, vitalityBuckets(map[int]float64{0: 50}, 5, 2))
+	assert.Len(t, vitalityBuckets(nil, 60, 7), 9)
+
+	viper.Set("ACTIVITY_DAYS", 30)
+	viper.Set("VITALITY_BUCKET_DAYS", 7)
+	defer viper.Set("ACTIVITY_DAYS", nil)
+	defer viper.Set("VITALITY_BUCKET_DAYS", nil)
+	assert.Equal(t, VitalityBuckets{WindowDays: 30, BucketDays: 7}, currentVitalityBuckets())
+
+	viper.Set("VITALITY_BUCKET_DAYS", 0)
+	assert.Equal(t, defaultVitalityBucketDays, vitalityBucketDays())
+}
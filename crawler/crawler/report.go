@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Report is the summary of a crawl, for dashboards.
+type Report struct {
+	RunID string `json:"runID"`
+	CrawlCounts
+
+	// The clone failures of CloneFailed by class of the error: timeout,
+	// auth, not_found or other.
+	CloneFailures map[string]int `json:"cloneFailures,omitempty"`
+
+	// The publiccode.yml files whose license is not valid SPDX.
+	InvalidLicenses []InvalidLicense `json:"invalidLicenses,omitempty"`
+
+	// The publiccode.yml files whose url is not the repository they were
+	// crawled from, indexed without URL_MISMATCH_FATAL.
+	URLMismatches []URLMismatch `json:"urlMismatches,omitempty"`
+}
+
+// Report returns the totals of the repositories crawled so far, including
+// the blacklisted ones removed with DeleteByQueryFromES.
+func (c *Crawler) Report() Report {
+	c.summary.mutex.Lock()
+	defer c.summary.mutex.Unlock()
+
+	var invalidLicenses []InvalidLicense
+	if len(c.summary.invalidLicenses) > 0 {
+		invalidLicenses = make([]InvalidLicense, len(c.summary.invalidLicenses))
+		copy(invalidLicenses, c.summary.invalidLicenses)
+		sort.Slice(invalidLicenses, func(i, j int) bool { return invalidLicenses[i].FileRawURL < invalidLicenses[j].FileRawURL })
+	}
+
+	var cloneFailures map[string]int
+	if len(c.summary.cloneFailureClasses) > 0 {
+		cloneFailures = make(map[string]int, len(c.summary.cloneFailureClasses))
+		for class, n := range c.summary.cloneFailureClasses {
+			cloneFailures[class] = n
+		}
+	}
+
+	var urlMismatches []URLMismatch
+	if len(c.summary.urlMismatches) > 0 {
+		urlMismatches = make([]URLMismatch, len(c.summary.urlMismatches))
+		copy(urlMismatches, c.summary.urlMismatches)
+		sort.Slice(urlMismatches, func(i, j int) bool { return urlMismatches[i].FileRawURL < urlMismatches[j].FileRawURL })
+	}
+
+	return Report{
+		RunID:       c.runID,
+		CrawlCounts: c.summary.countsLocked(),
+
+		CloneFailures:   cloneFailures,
+		InvalidLicenses: invalidLicenses,
+		URLMismatches:   urlMismatches,
+	}
+}
+
+// WriteReport writes the Report of the crawl to fname as JSON.
+func (c *Crawler) WriteReport(fname string) error {
+	jsonOut, err := json.MarshalIndent(c.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, jsonOut, 0644)
+}
@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := Crawler{runID: "run"}
+
+	// The workers update the summary concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			c.summary.addProcessed()
+			if i%2 == 0 {
+				c.summary.addValid()
+				c.summary.addIndexed()
+			} else {
+				c.summary.addInvalid("https://example.org/publiccode.yml", errors.New("invalid"))
+			}
+			if i == 0 {
+				c.summary.addCloneFailure(cloneFailureTimeout)
+			}
+		}(i)
+	}
+	wg.Wait()
+	c.summary.addBlacklisted(2)
+	c.summary.addRemoved()
+	c.summary.addIndexFailure(false)
+	c.summary.addIndexFailure(true)
+	c.summary.addIndexFailure(true)
+
+	expected := Report{
+		RunID: "run",
+		CrawlCounts: CrawlCounts{
+			Processed:   10,
+			Valid:       5,
+			Invalid:     5,
+			Blacklisted: 2,
+			Removed:     1,
+			CloneFailed: 1,
+			Indexed:     5,
+
+			IndexRejected: 1,
+			IndexFailed:   2,
+		},
+
+		CloneFailures: map[string]int{"timeout": 1},
+	}
+	assert.Equal(t, expected, c.Report())
+
+	fname := filepath.Join(dir, "reports", "crawl.json")
+	assert.NoError(t, c.WriteReport(fname))
+
+	data, err := ioutil.ReadFile(fname)
+	assert.NoError(t, err)
+
+	var written Report
+	assert.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, expected, written)
+}
+
+func TestReportInvalidLicenses(t *testing.T) {
+	var c Crawler
+	c.summary.addInvalidLicense("https://example.org/b/publiccode.yml", "Proprietary", errorInvalidLicense{`unknown license "Proprietary"`})
+	c.summary.addInvalidLicense("https://example.org/a/publiccode.yml", "MIT OR", errorInvalidLicense{"unexpected end"})
+
+	expected := []InvalidLicense{
+		{FileRawURL: "https://example.org/a/publiccode.yml", License: "MIT OR", Reason: "invalid SPDX license: unexpected end"},
+		{FileRawURL: "https://example.org/b/publiccode.yml", License: "Proprietary", Reason: `invalid SPDX license: unknown license "Proprietary"`},
+	}
+	assert.Equal(t, expected, c.Report().InvalidLicenses)
+}
+
+func TestReportURLMismatches(t *testing.T) {
+	var c Crawler
+	c.summary.addURLMismatch(URLMismatch{FileRawURL: "https://example.org/b/publiccode.yml", URL: "https://example.org/upstream"})
+	c.summary.addURLMismatch(URLMismatch{FileRawURL: "https://example.org/a/publiccode.yml", URL: "https://example.org/upstream"})
+
+	report := c.Report()
+	assert.Len(t, report.URLMismatches, 2)
+	assert.Equal(t, "https://example.org/a/publiccode.yml", report.URLMismatches[0].FileRawURL)
+}
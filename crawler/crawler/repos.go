@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RepoError is a repository of CrawlRepos that couldn't be listed, eg. on
+// an unknown host.
+type RepoError struct {
+	RepoURL string
+	Err     error
+}
+
+func (e RepoError) Error() string {
+	return fmt.Sprintf("%s: %v", e.RepoURL, e.Err)
+}
+
+// CrawlRepos processes the single repositories in repoURLs like CrawlRepo,
+// each with the publisher returned by publisher, but a repository that
+// can't be looked up doesn't stop the others: its error is in the returned
+// slice, in the order of repoURLs. The error is the one of the crawl, as
+// in CrawlRepo.
+func (c *Crawler) CrawlRepos(ctx context.Context, repoURLs []string, publisher func(repoURL string) PA) ([]RepoError, error) {
+	var repoErrors []RepoError
+
+	// The crawl drains the repositories until the channel is closed, so the
+	// listing is over and repoErrors complete when it returns.
+	listed := make(chan struct{})
+	go func() {
+		defer close(listed)
+		defer close(c.repositories)
+		repoErrors = c.listRepos(ctx, repoURLs, publisher)
+	}()
+
+	err := c.crawl(ctx)
+	<-listed
+	if err != nil {
+		return repoErrors, err
+	}
+
+	return repoErrors, c.strictError()
+}
+
+// listRepos sends the repositories in repoURLs to c.repositories and returns
+// the ones failed. It stops when ctx is done.
+func (c *Crawler) listRepos(ctx context.Context, repoURLs []string, publisher func(repoURL string) PA) []RepoError {
+	var repoErrors []RepoError
+
+	for _, repoURL := range repoURLs {
+		if ctx.Err() != nil {
+			repoErrors = append(repoErrors, RepoError{RepoURL: repoURL, Err: ctx.Err()})
+			continue
+		}
+
+		log.Infof("Processing repository: %s", repoURL)
+
+		domain, err := c.KnownHost(repoURL)
+		if err != nil {
+			repoErrors = append(repoErrors, RepoError{RepoURL: repoURL, Err: err})
+			continue
+		}
+
+		err = domain.processSingleRepo(repoURL, c.repositories, publisher(repoURL))
+		if err != nil {
+			repoErrors = append(repoErrors, RepoError{RepoURL: repoURL, Err: err})
+		}
+	}
+
+	return repoErrors
+}
@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRepos(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	RegisterClientAPIs()
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/1.0/projects/COMUNE/repos/protocollo":
+			fmt.Fprintf(w, `{"slug": "protocollo", "public": true, "project": {"key": "COMUNE"},
+				"links": {"clone": [{"name": "http", "href": "%s/scm/comune/protocollo.git"}],
+				"self": [{"href": "%s/projects/COMUNE/repos/protocollo/browse"}]}}`, ts.URL, ts.URL)
+		case "/rest/api/1.0/projects/COMUNE/repos/protocollo/branches/default":
+			fmt.Fprint(w, `{"id": "refs/heads/main", "displayId": "main"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// The same server, known by another name.
+	known := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	c := Crawler{
+		domains:      []Domain{{Host: "localhost", Type: "bitbucket-server"}},
+		repositories: make(chan Repository, 10),
+	}
+
+	var publishers []string
+	publisher := func(repoURL string) PA {
+		publishers = append(publishers, repoURL)
+		return PA{CodiceIPA: "c_h501"}
+	}
+
+	repoURLs := []string{ts.URL + "/projects/COMUNE/repos/unknown", known + "/projects/COMUNE/repos/protocollo"}
+	repoErrors := c.listRepos(context.Background(), repoURLs, publisher)
+	close(c.repositories)
+
+	assert.Len(t, repoErrors, 1)
+	assert.Equal(t, repoURLs[0], repoErrors[0].RepoURL)
+	assert.Contains(t, repoErrors[0].Error(), "unable to detect code hosting platform")
+	assert.Equal(t, repoURLs[1:], publishers)
+
+	repo := <-c.repositories
+	assert.Equal(t, "COMUNE/protocollo", repo.Name)
+	assert.Equal(t, "c_h501", repo.Pa.CodiceIPA)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	repoErrors = c.listRepos(ctx, repoURLs, publisher)
+	assert.Len(t, repoErrors, 2)
+	assert.Equal(t, context.Canceled, repoErrors[1].Err)
+}
@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/viper"
+)
+
+// maxRepoSize returns the size in bytes, MAX_REPO_SIZE_MB, of the largest
+// repository cloned. 0 means no limit.
+func maxRepoSize() int64 {
+	return viper.GetInt64("MAX_REPO_SIZE_MB") * 1024 * 1024
+}
+
+// reportedRepoSize returns the size in bytes of repository reported by the
+// API of the code hosting when listing it, 0 if unknown.
+// GitHub and Gitea report it in KB, Bitbucket and Azure DevOps in bytes.
+// GitLab only reports it in the statistics, not requested, and Bitbucket
+// Server not at all.
+func reportedRepoSize(repository Repository) int64 {
+	var metadata struct {
+		Size int64 `json:"size"`
+	}
+	if len(repository.Metadata) == 0 || json.Unmarshal(repository.Metadata, &metadata) != nil {
+		return 0
+	}
+
+	switch repository.Domain.API() {
+	case "github", "gitea":
+		return metadata.Size * 1024
+	case "bitbucket", "azure":
+		return metadata.Size
+	}
+
+	return 0
+}
+
+// isTooBigToClone returns whether repository is bigger than MAX_REPO_SIZE_MB
+// according to the API of the code hosting, and its size in bytes.
+func isTooBigToClone(repository Repository) (bool, int64) {
+	max := maxRepoSize()
+	if max <= 0 {
+		return false, 0
+	}
+	size := reportedRepoSize(repository)
+
+	return size > max, size
+}
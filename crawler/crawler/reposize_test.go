@@ -0,0 +1,33 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTooBigToClone(t *testing.T) {
+	github := Repository{Domain: Domain{Host: "github.com"}, Metadata: []byte(`{"size": 3072}`)}
+	bitbucket := Repository{Domain: Domain{Host: "bitbucket.org"}, Metadata: []byte(`{"size": 3145728}`)}
+	gitlab := Repository{Domain: Domain{Host: "gitlab.com"}, Metadata: []byte(`{"id": 1}`)}
+
+	assert.Equal(t, int64(3*1024*1024), reportedRepoSize(github))
+	assert.Equal(t, int64(3*1024*1024), reportedRepoSize(bitbucket))
+	assert.Equal(t, int64(0), reportedRepoSize(gitlab))
+	assert.Equal(t, int64(0), reportedRepoSize(Repository{Domain: Domain{Host: "github.com"}}))
+
+	tooBig, _ := isTooBigToClone(github)
+	assert.False(t, tooBig)
+
+	viper.Set("MAX_REPO_SIZE_MB", 2)
+	defer viper.Set("MAX_REPO_SIZE_MB", nil)
+
+	tooBig, size := isTooBigToClone(github)
+	assert.True(t, tooBig)
+	assert.Equal(t, int64(3*1024*1024), size)
+
+	// The repositories of unknown size are cloned.
+	tooBig, _ = isTooBigToClone(gitlab)
+	assert.False(t, tooBig)
+}
@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"github.com/spf13/viper"
+)
+
+// URLMismatch is a publiccode.yml whose url is not the repository it was
+// crawled from, often the upstream of a fork.
+type URLMismatch struct {
+	FileRawURL string `json:"fileRawURL"`
+	URL        string `json:"url"`
+	Repository string `json:"repository"`
+}
+
+// errorURLMismatch is the URLMismatch returned by validateFile.
+type errorURLMismatch URLMismatch
+
+func (e errorURLMismatch) Error() string {
+	return "url for: " + e.FileRawURL + " is " + e.URL + ", which differs from the repository it was crawled from: " + e.Repository
+}
+
+// urlMismatchFatal returns whether a publiccode.yml whose url is not the
+// repository is rejected, URL_MISMATCH_FATAL, or just reported.
+func urlMismatchFatal() bool {
+	return viper.GetBool("URL_MISMATCH_FATAL")
+}
+
+// repositoryURLs returns the URLs of repository its publiccode.yml can
+// declare: the clone one and the web one, when known.
+func repositoryURLs(repository Repository) []string {
+	var urls []string
+	for _, u := range []string{repository.GitCloneURL, repository.WebURL} {
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	return urls
+}
+
+// checkRepositoryURL returns an errorURLMismatch if the url declared in the
+// publiccode.yml at fileRawURL is none of repositoryURLs, as compared by
+// urlMatches. Nothing is checked if the repository URLs are unknown.
+func checkRepositoryURL(declared, fileRawURL string, repositoryURLs []string) error {
+	if len(repositoryURLs) == 0 || urlMatches(declared, repositoryURLs...) {
+		return nil
+	}
+
+	return errorURLMismatch{FileRawURL: fileRawURL, URL: declared, Repository: repositoryURLs[0]}
+}
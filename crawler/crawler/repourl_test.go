@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRepositoryURL(t *testing.T) {
+	fileRawURL := "https://raw.githubusercontent.com/comune/fork/master/publiccode.yml"
+
+	fork := []string{"https://github.com/comune/fork.git"}
+	assert.NoError(t, checkRepositoryURL("https://github.com/Comune/Fork", fileRawURL, fork))
+	assert.NoError(t, checkRepositoryURL("https://github.com/upstream/app", fileRawURL, nil))
+
+	err := checkRepositoryURL("https://github.com/upstream/app", fileRawURL, fork)
+	assert.Equal(t, errorURLMismatch{FileRawURL: fileRawURL, URL: "https://github.com/upstream/app", Repository: "https://github.com/comune/fork.git"}, err)
+	assert.Equal(t, failureURLMismatch, validationFailureReason(err))
+
+	var parser publiccode.Parser
+	parser.PublicCode.URL, _ = url.Parse("https://github.com/upstream/app")
+	parser.PublicCode.It.Riuso.CodiceIPA = "c_h501"
+	err = validateFile(PA{CodiceIPA: "c_h501"}, parser, fileRawURL, fork)
+	assert.IsType(t, errorURLMismatch{}, err)
+
+	// The codiceIPA is checked first.
+	err = validateFile(PA{CodiceIPA: "c_a001"}, parser, fileRawURL, fork)
+	assert.IsType(t, errorIPAMismatch{}, err)
+}
+
+func TestCheckRepositoryURLBitbucketServer(t *testing.T) {
+	// The public url of the repository is not the clone one.
+	repository := Repository{
+		GitCloneURL: "https://admin@git.example.org/scm/comune/app.git",
+		WebURL:      "https://git.example.org/projects/COMUNE/repos/app",
+	}
+	fileRawURL := "https://git.example.org/projects/COMUNE/repos/app/raw/publiccode.yml?at=refs%2Fheads%2Fmaster"
+
+	assert.NoError(t, checkRepositoryURL("https://git.example.org/projects/COMUNE/repos/app", fileRawURL, repositoryURLs(repository)))
+	assert.NoError(t, checkRepositoryURL("https://git.example.org/scm/comune/app", fileRawURL, repositoryURLs(repository)))
+	assert.Error(t, checkRepositoryURL("https://git.example.org/projects/COMUNE/repos/other", fileRawURL, repositoryURLs(repository)))
+}
@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// errorMissingRequired is returned for publiccode.yml files lacking some of
+// the REQUIRED_FIELDS, even if valid for the parser.
+type errorMissingRequired struct {
+	fields []string
+}
+
+func (e errorMissingRequired) Error() string {
+	return "missingRequiredFields: " + strings.Join(e.fields, ", ")
+}
+
+// errorUnreachableURL is returned for publiccode.yml files whose url is
+// required and doesn't respond.
+type errorUnreachableURL struct {
+	url    string
+	reason string
+}
+
+func (e errorUnreachableURL) Error() string {
+	return fmt.Sprintf("unreachableURL: %s: %s", e.url, e.reason)
+}
+
+// checkRequiredFields returns an error if the publiccode.yml lacks any of the
+// REQUIRED_FIELDS. Fields are publiccode.yml keys separated by "/", like in
+// field_stats.json, with "*" matching any key (eg. description/*/shortDescription).
+// No field is required if it's not set.
+func checkRequiredFields(data []byte) error {
+	if !viper.IsSet("REQUIRED_FIELDS") {
+		return nil
+	}
+
+	missing := missingRequiredFields(data, viper.GetStringSlice("REQUIRED_FIELDS"))
+	if len(missing) > 0 {
+		return errorMissingRequired{missing}
+	}
+
+	return nil
+}
+
+// checkRequiredURL returns an error if url is in REQUIRED_FIELDS and the
+// repository in the url of the publiccode.yml doesn't respond.
+func checkRequiredURL(ctx context.Context, data []byte) error {
+	for _, field := range viper.GetStringSlice("REQUIRED_FIELDS") {
+		if strings.Trim(field, "/") == "url" {
+			return probeURL(ctx, publiccodeURL(data))
+		}
+	}
+
+	return nil
+}
+
+// probeURL returns an error unless link responds within HTTP_ASSET_TIMEOUT
+// with a success or redirect status, to a HEAD or, if the server doesn't
+// allow it, to a GET. The probes wait for the rate limits of the host.
+func probeURL(ctx context.Context, link string) error {
+	resp, err := requestURLContext(ctx, requestAsset, http.MethodHead, link, nil)
+	if resp.Status.Code == http.StatusMethodNotAllowed || resp.Status.Code == http.StatusNotImplemented {
+		resp, err = getURLContext(ctx, requestAsset, link, nil)
+	}
+	// No response at all.
+	if resp.Status.Code == -1 {
+		return errorUnreachableURL{link, err.Error()}
+	}
+	if resp.Status.Code >= http.StatusBadRequest {
+		return errorUnreachableURL{link, fmt.Sprintf("status %d", resp.Status.Code)}
+	}
+
+	return nil
+}
+
+// missingRequiredFields returns the fields missing or empty in the publiccode.yml.
+func missingRequiredFields(data []byte, fields []string) []string {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fields
+	}
+
+	var missing []string
+	for _, field := range fields {
+		if !hasField(doc, strings.Split(strings.Trim(field, "/"), "/")) {
+			missing = append(missing, field)
+		}
+	}
+
+	return missing
+}
+
+// hasField returns whether node has a non empty value at the path keys.
+func hasField(node interface{}, keys []string) bool {
+	if len(keys) == 0 {
+		switch v := node.(type) {
+		case nil:
+			return false
+		case string:
+			return strings.TrimSpace(v) != ""
+		case map[interface{}]interface{}:
+			return len(v) > 0
+		case []interface{}:
+			return len(v) > 0
+		default:
+			return true
+		}
+	}
+
+	m, ok := node.(map[interface{}]interface{})
+	if !ok {
+		return false
+	}
+	if keys[0] == "*" {
+		for _, child := range m {
+			if hasField(child, keys[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	for k, child := range m {
+		if fmt.Sprint(k) == keys[0] {
+			return hasField(child, keys[1:])
+		}
+	}
+
+	return false
+}
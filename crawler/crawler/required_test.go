@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// borderlinePubliccode has a name and a license, but no description and an empty url.
+const borderlinePubliccode = `
+name: App
+url: ""
+legal:
+  license: MIT
+description:
+  eng:
+    genericName: App
+`
+
+func TestCheckRequiredFields(t *testing.T) {
+	defer viper.Set("REQUIRED_FIELDS", nil)
+	data := []byte(borderlinePubliccode)
+
+	assert.NoError(t, checkRequiredFields(data))
+
+	viper.Set("REQUIRED_FIELDS", []string{"name", "legal/license", "description/*/genericName"})
+	assert.NoError(t, checkRequiredFields(data))
+
+	viper.Set("REQUIRED_FIELDS", []string{"name", "url", "legal/license", "description/*/shortDescription"})
+	err := checkRequiredFields(data)
+	assert.Equal(t, errorMissingRequired{[]string{"url", "description/*/shortDescription"}}, err)
+	assert.EqualError(t, err, "missingRequiredFields: url, description/*/shortDescription")
+}
+
+func TestCheckRequiredURL(t *testing.T) {
+	defer viper.Set("REQUIRED_FIELDS", nil)
+	viper.Set("REQUIRED_FIELDS", []string{"name", "url"})
+
+	var methods []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		switch r.URL.Path {
+		case "/app":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	publiccode := func(url string) []byte {
+		return []byte("name: App\nurl: " + url + "\n")
+	}
+
+	assert.NoError(t, checkRequiredURL(context.Background(), publiccode(ts.URL+"/app")))
+	assert.Equal(t, []string{http.MethodHead}, methods)
+
+	methods = nil
+	assert.NoError(t, checkRequiredURL(context.Background(), publiccode(ts.URL+"/no-head")))
+	assert.Equal(t, []string{http.MethodHead, http.MethodGet}, methods)
+
+	err := checkRequiredURL(context.Background(), publiccode(ts.URL+"/missing"))
+	assert.Equal(t, errorUnreachableURL{ts.URL + "/missing", "status 404"}, err)
+
+	ts.Close()
+	err = checkRequiredURL(context.Background(), publiccode(ts.URL+"/app"))
+	assert.IsType(t, errorUnreachableURL{}, err)
+}
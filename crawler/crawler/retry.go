@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Defaults of the retries of transient failures, overridden by
+// RETRY_MAX_ATTEMPTS and RETRY_BACKOFF.
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBackoff     = time.Second
+)
+
+// retrySettings returns the maximum number of attempts of an operation and
+// the wait before the first retry.
+func retrySettings() (int, time.Duration) {
+	attempts := defaultRetryMaxAttempts
+	if viper.IsSet("RETRY_MAX_ATTEMPTS") {
+		attempts = viper.GetInt("RETRY_MAX_ATTEMPTS")
+	}
+	backoff := defaultRetryBackoff
+	if viper.IsSet("RETRY_BACKOFF") {
+		backoff = viper.GetDuration("RETRY_BACKOFF")
+	}
+
+	return attempts, backoff
+}
+
+// retry calls fn until it succeeds, returns an error that is not retryable
+// or the attempts are exhausted. The wait between the attempts doubles each
+// time. It gives up when ctx is done and returns the last error.
+func retry(ctx context.Context, what string, fn func() error, retryable func(error) bool) error {
+	attempts, backoff := retrySettings()
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt >= attempts || !retryable(err) {
+			return err
+		}
+
+		log.Warnf("%s failed (attempt %d/%d), retrying in %v: %v", what, attempt, attempts, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"path"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	es "github.com/olivere/elastic"
+)
+
+// Revalidation is the result of parsing again a publiccode.yml stored in Elasticsearch.
+type Revalidation struct {
+	ID         string
+	FileRawURL string
+	// Stored is false for documents indexed before rawPubliccode was saved.
+	Stored bool
+	// Err is the error returned by the current parser, nil if the file is still valid.
+	Err error
+}
+
+// Revalidate parses again the raw publiccode.yml files stored in Elasticsearch
+// with the current parser, without fetching anything from the network.
+// Only valid files get indexed, so every error means a status change.
+func (c *Crawler) Revalidate() ([]Revalidation, error) {
+	type storedSoftware struct {
+		FileRawURL    string `json:"fileRawURL"`
+		RawPubliccode string `json:"rawPubliccode"`
+	}
+
+	searchResult, err := c.es.Search().
+		Index(c.index).
+		Query(es.NewTypeQuery("software")).
+		FetchSourceContext(es.NewFetchSourceContext(true).Include("fileRawURL", "rawPubliccode")).
+		From(0).Size(10000). // get first 10k elements. The limit can be changed in ES.
+		Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Revalidation
+	for _, hit := range searchResult.Hits.Hits {
+		var sw storedSoftware
+		if err := json.Unmarshal(*hit.Source, &sw); err != nil {
+			return nil, err
+		}
+
+		result := Revalidation{
+			ID:         hit.Id,
+			FileRawURL: sw.FileRawURL,
+			Stored:     sw.RawPubliccode != "",
+		}
+		if result.Stored {
+			result.Err = revalidateFile([]byte(sw.RawPubliccode), sw.FileRawURL)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// revalidateFile parses data with network checks disabled.
+func revalidateFile(data []byte, fileRawURL string) error {
+	if err := checkYAML(data); err != nil {
+		return err
+	}
+
+	parser := publiccode.NewParser()
+	parser.Strict = false
+	parser.DisableNetwork = true
+	// The domain of the stored documents is unknown: the crawled file is the
+	// last element of the path, whatever its crawled-filename.
+	if u, err := url.Parse(fileRawURL); err == nil {
+		parser.RemoteBaseURL = remoteBaseURL(fileRawURL, path.Base(u.Path))
+	}
+
+	return parser.Parse(data)
+}
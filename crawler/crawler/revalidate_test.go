@@ -0,0 +1,17 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevalidateFile(t *testing.T) {
+	err := revalidateFile([]byte("publiccodeYmlVersion: \"0.0.1\"\n"), "https://example.org/publiccode.yml")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "version 0.0.1 not supported")
+
+	err = revalidateFile([]byte("name: !include name.txt\n"), "https://example.org/publiccode.yml")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported YAML directive")
+}
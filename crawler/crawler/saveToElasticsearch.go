@@ -5,14 +5,18 @@ import (
 	"crypto/sha1"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/ghodss/yaml"
+	"github.com/italia/developers-italia-backend/crawler/elastic"
 	"github.com/italia/developers-italia-backend/crawler/ipa"
 	"github.com/italia/developers-italia-backend/crawler/metrics"
 	pcode "github.com/italia/publiccode-parser-go"
-	"github.com/olivere/elastic"
+	es "github.com/olivere/elastic"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -24,24 +28,61 @@ type administration struct {
 
 // saveToES save the chosen data []byte in elasticsearch
 // data contains the raw publiccode.yml file
-func (c *Crawler) saveToES(repo Repository, activityIndex float64, vitality []int, data []byte) error {
+// vitality is nil when the activity was not calculated
+// quality is the one ProcessRepo reports in the scorecard
+// stored are the times of the indexed document, see storedTimes
+// The documents are queued in the bulk requests of the crawl, sent by
+// closeBulk at the latest, and nothing is queued once ctx is done.
+func (c *Crawler) saveToES(ctx context.Context, repo Repository, activityIndex float64, vitality []int, quality softwareQuality, stored softwareTimes, data []byte) error {
 	// softwareES represents a software record in Elasticsearch
 	type softwareES struct {
-		FileRawURL            string            `json:"fileRawURL"`
-		ID                    string            `json:"id"`
-		CrawlTime             string            `json:"crawltime"`
-		ItRiusoCodiceIPALabel string            `json:"it-riuso-codiceIPA-label"`
-		Slug                  string            `json:"slug"`
-		PublicCode            interface{}       `json:"publiccode"`
-		VitalityScore         float64           `json:"vitalityScore"`
-		VitalityDataChart     []int             `json:"vitalityDataChart"`
-		OEmbedHTML            map[string]string `json:"oEmbedHTML"`
+		FileRawURL            string                 `json:"fileRawURL"`
+		FileETag              string                 `json:"fileETag,omitempty"`
+		FileLastModified      string                 `json:"fileLastModified,omitempty"`
+		ID                    string                 `json:"id"`
+		CrawlTime             string                 `json:"crawltime"`
+		FirstSeen             string                 `json:"firstSeen"`
+		LastModified          string                 `json:"lastModified"`
+		LastSeen              string                 `json:"lastSeen"`
+		PubliccodeYmlVersion  string                 `json:"publiccodeYmlVersion,omitempty"`
+		ItRiusoCodiceIPALabel string                 `json:"it-riuso-codiceIPA-label"`
+		Slug                  string                 `json:"slug"`
+		PublicCode            interface{}            `json:"publiccode"`
+		VitalityScore         *float64               `json:"vitalityScore,omitempty"`
+		VitalityDataChart     []int                  `json:"vitalityDataChart,omitempty"`
+		VitalityBuckets       *VitalityBuckets       `json:"vitalityBuckets,omitempty"`
+		OEmbedHTML            map[string]string      `json:"oEmbedHTML"`
+		RepoSizeBytes         int64                  `json:"repoSizeBytes,omitempty"`
+		CloneDurationMs       int64                  `json:"cloneDurationMs,omitempty"`
+		RawPubliccode         string                 `json:"rawPubliccode"`
+		PubliccodeHash        string                 `json:"publiccodeHash"`
+		NoSourceDetected      bool                   `json:"noSourceDetected,omitempty"`
+		MaintenanceType       string                 `json:"maintenanceType,omitempty"`
+		MaintenanceUntil      string                 `json:"maintenanceUntil,omitempty"`
+		MaintenanceExpired    bool                   `json:"maintenanceExpired"`
+		DisallowedLicense     bool                   `json:"disallowedLicense,omitempty"`
+		SPDXLicense           string                 `json:"spdxLicense,omitempty"`
+		IsOpenSource          bool                   `json:"isOpenSource"`
+		Dormant               bool                   `json:"dormant,omitempty"`
+		RelatedSoftware       []string               `json:"relatedSoftware,omitempty"`
+		OpenIssues            *int                   `json:"openIssues,omitempty"`
+		OpenPullRequests      *int                   `json:"openPullRequests,omitempty"`
+		Languages             []Language             `json:"languages,omitempty"`
+		CodeHost              string                 `json:"codeHost,omitempty"`
+		LastCommit            *time.Time             `json:"lastCommit,omitempty"`
+		DaysSinceLastCommit   *int                   `json:"daysSinceLastCommit,omitempty"`
+		CommitHistogram       []CommitMonth          `json:"commitHistogram,omitempty"`
+		ComplianceScore       int                    `json:"complianceScore"`
+		Description           *searchableDescription `json:"description,omitempty"`
+		DescriptionLanguage   string                 `json:"descriptionLanguage,omitempty"`
+		DescriptionFallback   bool                   `json:"descriptionFallback,omitempty"`
+		DescriptionLanguages  []string               `json:"descriptionLanguages,omitempty"`
 	}
 
 	// Parse the publiccode.yml file
 	parser := pcode.NewParser()
 	parser.Strict = false
-	parser.RemoteBaseURL = strings.TrimRight(repo.FileRawURL, viper.GetString("CRAWLED_FILENAME"))
+	parser.RemoteBaseURL = remoteBaseURL(repo.FileRawURL, repo.Domain.crawledFilename())
 	err := parser.ParseInDomain(data, repo.Domain.Host, repo.Domain.UseTokenFor, repo.Domain.BasicAuth)
 	if err != nil {
 		log.Errorf("Error parsing publiccode.yml: %v", err)
@@ -50,13 +91,67 @@ func (c *Crawler) saveToES(repo Repository, activityIndex float64, vitality []in
 	// Create a softwareES object and populate it
 	file := softwareES{
 		FileRawURL:            repo.FileRawURL,
+		FileETag:              repo.FileETag,
+		FileLastModified:      repo.FileLastModified,
 		ID:                    repo.generateID(),
 		CrawlTime:             time.Now().Format(time.RFC3339),
+		PubliccodeYmlVersion:  repo.PubliccodeYmlVersion,
 		Slug:                  repo.generateSlug(),
 		ItRiusoCodiceIPALabel: ipa.GetAdministrationName(parser.PublicCode.It.Riuso.CodiceIPA),
-		VitalityScore:         activityIndex,
-		VitalityDataChart:     vitality,
 		OEmbedHTML:            parser.OEmbed,
+		RepoSizeBytes:         repo.RepoSizeBytes,
+		CloneDurationMs:       int64(repo.CloneDuration / time.Millisecond),
+		RawPubliccode:         string(data),
+		PubliccodeHash:        publiccodeHash(data),
+		NoSourceDetected:      repo.NoSourceDetected,
+		MaintenanceType:       parser.PublicCode.Maintenance.Type,
+		DisallowedLicense:     repo.DisallowedLicense,
+		SPDXLicense:           repo.SPDXLicense,
+		IsOpenSource:          repo.IsOpenSource,
+		Dormant:               repo.Dormant,
+		OpenIssues:            repo.OpenIssues,
+		OpenPullRequests:      repo.OpenPullRequests,
+		Languages:             repo.Languages,
+		CodeHost:              codeHost(repo.GitCloneURL),
+		CommitHistogram:       repo.CommitHistogram,
+		DaysSinceLastCommit:   repo.DaysSinceLastCommit,
+		ComplianceScore:       complianceScore(quality, complianceWeightsFromConfig()),
+	}
+
+	if !repo.LastCommit.IsZero() {
+		file.LastCommit = &repo.LastCommit
+	}
+
+	// Keep when the software was first seen and last changed, for the feed.
+	file.FirstSeen, file.LastModified = softwareTimestamps(stored, data, time.Now())
+	file.LastSeen = lastSeen(time.Now())
+
+	// Index the description in the primary language, or in the first
+	// fallback available, as the main searchable one.
+	file.Description, file.DescriptionLanguage, file.DescriptionFallback = mainDescription(
+		parser.PublicCode.Description, descriptionLanguages())
+	// All the localized descriptions are in publiccode.description.<language>,
+	// list their languages to pick the one of the user.
+	file.DescriptionLanguages = availableLanguages(parser.PublicCode.Description)
+
+	until, expired := maintenanceContract(parser.PublicCode, time.Now())
+	if !until.IsZero() {
+		file.MaintenanceUntil = until.Format("2006-01-02")
+	}
+	file.MaintenanceExpired = expired
+
+	// Link the software this one references, when already indexed.
+	file.RelatedSoftware = resolveRelatedSoftware(
+		relatedSoftwareReferences(parser.PublicCode, relatedSoftwareKeys()),
+		c.findSoftwareID,
+	)
+
+	// Activity data is missing if it was not calculated (eg. SKIP_ACTIVITY).
+	if vitality != nil {
+		file.VitalityScore = &activityIndex
+		file.VitalityDataChart = vitality
+		buckets := currentVitalityBuckets()
+		file.VitalityBuckets = &buckets
 	}
 
 	// Convert parser.PublicCode to YAML and parse it again into the softwareES record
@@ -66,32 +161,47 @@ func (c *Crawler) saveToES(repo Repository, activityIndex float64, vitality []in
 	}
 	err = yaml.Unmarshal(yml, &file.PublicCode)
 
-	// Put publiccode data in ES.
-	ctx := context.Background()
-	_, err = c.es.Index().
-		Index(c.index).
-		Type("software").
-		Id(file.ID).
-		BodyJson(file).
-		Do(ctx)
+	// Let the registered processors enrich the document.
+	doc, err := processDocument(repo, file)
 	if err != nil {
 		return err
 	}
 
-	metrics.GetCounter("repository_file_indexed", c.index).Inc()
+	// Another repository may have the same ID in this crawl.
+	doc, collision := c.documentIDs.resolve(file.ID, repo.FileRawURL, doc, duplicateIDPolicy())
+	if collision {
+		metrics.GetCounter("repository_id_collision", c.index).Inc()
+		c.summary.addIDCollision()
+	}
+
+	// The crawl is interrupted, don't queue more documents.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Put publiccode data in ES, the outcome is counted by afterBulk.
+	if doc != nil {
+		err = c.addToBulk(es.NewBulkIndexRequest().
+			Index(c.index).
+			Type("software").
+			Id(file.ID).
+			Doc(doc), file.ID, &repo)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Add administration data.
 	if parser.PublicCode.It.Riuso.CodiceIPA != "" {
 		// Put administrations data in ES.
-		_, err = c.es.Index().
+		err = c.addToBulk(es.NewBulkIndexRequest().
 			Index(viper.GetString("ELASTIC_PUBLISHERS_INDEX")).
 			Type("administration").
 			Id(parser.PublicCode.It.Riuso.CodiceIPA).
-			BodyJson(administration{
+			Doc(administration{
 				Name:      file.ItRiusoCodiceIPALabel,
 				CodiceIPA: parser.PublicCode.It.Riuso.CodiceIPA,
-			}).
-			Do(ctx)
+			}), parser.PublicCode.It.Riuso.CodiceIPA, nil)
 		if err != nil {
 			return err
 		}
@@ -100,10 +210,38 @@ func (c *Crawler) saveToES(repo Repository, activityIndex float64, vitality []in
 	return nil
 }
 
+// retryableElasticError returns whether err is a transient failure of
+// Elasticsearch, like a node restarting or too busy, worth retrying.
+// The documents rejected, eg. because of the mapping, fail the same way
+// again.
+func retryableElasticError(err error) bool {
+	// The node was still down after the retries of the client.
+	if errors.Is(err, elastic.ErrNodeDown) {
+		return true
+	}
+
+	var e *es.Error
+	if errors.As(err, &e) {
+		switch e.Status {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	// The node can't be reached (eg. connection refused).
+	var netErr net.Error
+	return es.IsConnErr(err) || errors.As(err, &netErr)
+}
+
 // generateID generates a hash based on unique git repo URL.
 func (repo *Repository) generateID() string {
 	hash := sha1.New()
-	_, err := hash.Write([]byte(repo.GitCloneURL))
+	id := repo.GitCloneURL
+	if repo.Subpath != "" {
+		id += "#" + repo.Subpath
+	}
+	_, err := hash.Write([]byte(id))
 	if err != nil {
 		log.Errorf("Error generating the repository hash: %+v", err)
 		return ""
@@ -113,7 +251,7 @@ func (repo *Repository) generateID() string {
 
 // generateSlug generates a readable unique string based on repository name.
 func (repo *Repository) generateSlug() string {
-	vendorAndName := strings.Replace(repo.Name, "/", "-", -1)
+	vendorAndName := strings.Replace(path.Join(repo.Name, repo.Subpath), "/", "-", -1)
 	vendorAndName = strings.ReplaceAll(vendorAndName, ".", "_")
 
 	if repo.Pa.CodiceIPA == "" {
@@ -127,8 +265,13 @@ func (repo *Repository) generateSlug() string {
 // DeleteByQueryFromES delete record from elasticsearch
 // that will match search string for publiccode.url field
 func (c *Crawler) DeleteByQueryFromES(search string) error {
+	if c.DryRun {
+		log.Infof("Skipping deletion of %s from ElasticSearch (--dry-run)", search)
+		return nil
+	}
+
 	// Search with a term query
-	termQuery := elastic.NewTermQuery("publiccode.url", search)
+	termQuery := es.NewTermQuery("publiccode.url", search)
 
 	// Put publiccode data in ES.
 	ctx := context.Background()
@@ -150,5 +293,6 @@ func (c *Crawler) DeleteByQueryFromES(search string) error {
 	}
 
 	log.Infof("Deleted %d record from ES linked to %s", searchResult.Deleted, search)
+	c.summary.addRemoved()
 	return nil
 }
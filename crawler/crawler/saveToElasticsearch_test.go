@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	crawlerelastic "github.com/italia/developers-italia-backend/crawler/elastic"
+	"github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryableElasticError(t *testing.T) {
+	assert.True(t, retryableElasticError(&elastic.Error{Status: http.StatusTooManyRequests}))
+	assert.True(t, retryableElasticError(&elastic.Error{Status: http.StatusServiceUnavailable}))
+	assert.True(t, retryableElasticError(elastic.ErrNoClient))
+	assert.True(t, retryableElasticError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+
+	assert.False(t, retryableElasticError(&elastic.Error{Status: http.StatusBadRequest}))
+	assert.False(t, retryableElasticError(errors.New("mapper_parsing_exception")))
+
+	// A real node going away.
+	ts := httptest.NewServer(http.NotFoundHandler())
+	client, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	assert.NoError(t, err)
+	ts.Close()
+
+	_, err = client.Index().Index("publiccode").Type("software").Id("id").BodyJson(map[string]string{}).Do(context.Background())
+	assert.Error(t, err)
+	assert.True(t, retryableElasticError(err), "%v", err)
+
+	// The same with the retrier of the production client, giving up with
+	// ErrNodeDown.
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	ts = httptest.NewServer(http.NotFoundHandler())
+	client, err = crawlerelastic.ClientFactory(ts.URL, "", "")
+	assert.NoError(t, err)
+	ts.Close()
+
+	_, err = client.Index().Index("publiccode").Type("software").Id("id").BodyJson(map[string]string{}).Do(context.Background())
+	assert.True(t, errors.Is(err, crawlerelastic.ErrNodeDown), "%v", err)
+	assert.True(t, retryableElasticError(err))
+}
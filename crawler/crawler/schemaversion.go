@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"gopkg.in/yaml.v2"
+)
+
+// errorMissingVersion is returned for publiccode.yml files not declaring
+// publiccodeYmlVersion.
+type errorMissingVersion struct{}
+
+func (e errorMissingVersion) Error() string {
+	return "publiccodeYmlVersion: missing"
+}
+
+// errorUnsupportedVersion is returned for publiccode.yml files declaring a
+// publiccodeYmlVersion the parser doesn't support, eg. a newer one.
+type errorUnsupportedVersion struct {
+	version string
+}
+
+func (e errorUnsupportedVersion) Error() string {
+	return fmt.Sprintf("publiccodeYmlVersion: %s is not supported (supported versions: %s)",
+		e.version, strings.Join(publiccode.SupportedVersions, ", "))
+}
+
+// checkVersion returns the publiccodeYmlVersion declared in the publiccode.yml,
+// read before parsing the whole file, and an error if it's missing or not in
+// the versions supported by the parser. Files that are not valid YAML are left
+// to the parser.
+func checkVersion(data []byte) (string, error) {
+	var doc struct {
+		Version string `yaml:"publiccodeYmlVersion"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", nil
+	}
+
+	version := strings.TrimSpace(doc.Version)
+	if version == "" {
+		return "", errorMissingVersion{}
+	}
+	for _, supported := range publiccode.SupportedVersions {
+		if version == supported {
+			return version, nil
+		}
+	}
+
+	return version, errorUnsupportedVersion{version}
+}
@@ -0,0 +1,29 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckVersion(t *testing.T) {
+	version, err := checkVersion([]byte("publiccodeYmlVersion: \"0.2\"\nname: app\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.2", version)
+
+	// Unquoted, it's still the version.
+	version, err = checkVersion([]byte("publiccodeYmlVersion: 0.1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.1", version)
+
+	version, err = checkVersion([]byte("publiccodeYmlVersion: \"1.0\"\n"))
+	assert.Equal(t, errorUnsupportedVersion{"1.0"}, err)
+	assert.Equal(t, "1.0", version)
+
+	_, err = checkVersion([]byte("name: app\n"))
+	assert.Equal(t, errorMissingVersion{}, err)
+
+	// Left to the parser.
+	_, err = checkVersion([]byte("name: [app\n"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+)
+
+// assetKeyRegexp matches the publiccode.yml keys pointing to assets (images and videos).
+var assetKeyRegexp = regexp.MustCompile(`^(logo|monochromeLogo|description/[^/]+/(screenshots|videos))(/|$)`)
+
+// softwareQuality holds the quality checks of a single publiccode.yml.
+type softwareQuality struct {
+	completeMetadata bool
+	validLicense     bool
+	reachableAssets  bool
+	recentActivity   bool
+	urlMatch         bool
+}
+
+// qualityFromError returns the quality of a publiccode.yml from its validation error.
+func qualityFromError(err error) softwareQuality {
+	if err == nil {
+		return softwareQuality{completeMetadata: true, validLicense: true, reachableAssets: true}
+	}
+
+	quality := softwareQuality{validLicense: true, reachableAssets: true}
+
+	// Other errors don't refer to specific keys (eg. codiceIPA mismatch).
+	multi, ok := err.(publiccode.ErrorParseMulti)
+	if !ok {
+		return quality
+	}
+
+	for _, e := range multi {
+		var key string
+		switch e := e.(type) {
+		case publiccode.ErrorInvalidValue:
+			key = e.Key
+		case publiccode.ErrorInvalidKey:
+			key = e.Key
+		}
+
+		if key == "legal/license" {
+			quality.validLicense = false
+		}
+		if assetKeyRegexp.MatchString(key) {
+			quality.reachableAssets = false
+		}
+	}
+
+	return quality
+}
+
+// publisherScore is the scorecard entry of a single publisher.
+// Percentages refer to the software with a publiccode.yml file.
+type publisherScore struct {
+	CodiceIPA        string  `json:"codiceIPA"`
+	Name             string  `json:"name"`
+	Software         int     `json:"software"`
+	CompleteMetadata float64 `json:"completeMetadata"`
+	ValidLicense     float64 `json:"validLicense"`
+	ReachableAssets  float64 `json:"reachableAssets"`
+	RecentActivity   float64 `json:"recentActivity"`
+	Score            float64 `json:"score"`
+}
+
+// scorecard aggregates the quality of software by publisher codiceIPA.
+// It's shared by all the ProcessRepositories workers.
+type scorecard struct {
+	mutex sync.Mutex
+
+	names     map[string]string
+	qualities map[string][]softwareQuality
+}
+
+// add records the quality of a software belonging to pa.
+func (s *scorecard) add(pa PA, quality softwareQuality) {
+	// Software of unknown publishers can't be assigned to anyone.
+	if pa.UnknownIPA || pa.CodiceIPA == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.qualities == nil {
+		s.names = make(map[string]string)
+		s.qualities = make(map[string][]softwareQuality)
+	}
+
+	s.names[pa.CodiceIPA] = pa.Name
+	s.qualities[pa.CodiceIPA] = append(s.qualities[pa.CodiceIPA], quality)
+}
+
+// report returns the scores of the publishers, worst first.
+func (s *scorecard) report() []publisherScore {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	scores := []publisherScore{}
+	for codiceIPA, qualities := range s.qualities {
+		var metadata, license, assets, activity int
+		for _, q := range qualities {
+			if q.completeMetadata {
+				metadata++
+			}
+			if q.validLicense {
+				license++
+			}
+			if q.reachableAssets {
+				assets++
+			}
+			if q.recentActivity {
+				activity++
+			}
+		}
+
+		score := publisherScore{
+			CodiceIPA:        codiceIPA,
+			Name:             s.names[codiceIPA],
+			Software:         len(qualities),
+			CompleteMetadata: percentage(metadata, len(qualities)),
+			ValidLicense:     percentage(license, len(qualities)),
+			ReachableAssets:  percentage(assets, len(qualities)),
+			RecentActivity:   percentage(activity, len(qualities)),
+		}
+		score.Score = (score.CompleteMetadata + score.ValidLicense + score.ReachableAssets + score.RecentActivity) / 4
+
+		scores = append(scores, score)
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score < scores[j].Score
+		}
+		return scores[i].CodiceIPA < scores[j].CodiceIPA
+	})
+
+	return scores
+}
+
+// write saves the scorecard report as JSON in fname.
+func (s *scorecard) write(fname string) error {
+	jsonOut, err := json.MarshalIndent(s.report(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, jsonOut, 0644)
+}
+
+// percentage returns n out of total as a percentage.
+func percentage(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(n) * 100 / float64(total)
+}
@@ -0,0 +1,42 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQualityFromError(t *testing.T) {
+	assert.Equal(t, softwareQuality{completeMetadata: true, validLicense: true, reachableAssets: true}, qualityFromError(nil))
+	assert.Equal(t, softwareQuality{validLicense: true, reachableAssets: true}, qualityFromError(errors.New("codiceIPA mismatch")))
+
+	err := publiccode.ErrorParseMulti{
+		publiccode.ErrorInvalidValue{Key: "legal/license", Reason: "invalid license"},
+		publiccode.ErrorInvalidValue{Key: "description/ita/screenshots", Reason: "HTTP GET returned 404"},
+	}
+	assert.Equal(t, softwareQuality{}, qualityFromError(err))
+}
+
+func TestScorecardReport(t *testing.T) {
+	var s scorecard
+
+	good := PA{Name: "Good", CodiceIPA: "good"}
+	bad := PA{Name: "Bad", CodiceIPA: "bad"}
+
+	s.add(good, softwareQuality{true, true, true, true, false})
+	s.add(good, softwareQuality{true, true, true, false, false})
+	s.add(bad, softwareQuality{false, true, false, false, false})
+	s.add(PA{UnknownIPA: true}, softwareQuality{})
+
+	report := s.report()
+
+	assert.Len(t, report, 2)
+	assert.Equal(t, "bad", report[0].CodiceIPA)
+	assert.Equal(t, 25.0, report[0].Score)
+	assert.Equal(t, "good", report[1].CodiceIPA)
+	assert.Equal(t, 2, report[1].Software)
+	assert.Equal(t, 50.0, report[1].RecentActivity)
+	assert.Equal(t, 87.5, report[1].Score)
+}
@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"strings"
+	"sync"
+)
+
+// seenRepositories records the repositories queued in a crawl, so that the
+// ones listed more times, eg. by more publishers or both as organization
+// and repository, are processed only once.
+type seenRepositories struct {
+	mutex sync.Mutex
+
+	keys map[string]bool
+}
+
+// add records repository and returns whether it's the first time.
+func (s *seenRepositories) add(repository Repository) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.keys == nil {
+		s.keys = make(map[string]bool)
+	}
+
+	key := repositoryKey(repository)
+	if s.keys[key] {
+		return false
+	}
+	s.keys[key] = true
+
+	return true
+}
+
+// repositoryKey identifies repository in a crawl: its clone url, or raw file
+// url if unknown, and the directory of the software, as the directories of
+// a monorepo are different software.
+func repositoryKey(repository Repository) string {
+	key := strings.TrimSuffix(strings.ToLower(repository.GitCloneURL), ".git")
+	if key == "" {
+		key = repository.FileRawURL
+	}
+
+	return key + "#" + repository.Subpath
+}
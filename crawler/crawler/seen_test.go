@@ -0,0 +1,24 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeenRepositories(t *testing.T) {
+	var seen seenRepositories
+
+	assert.True(t, seen.add(Repository{GitCloneURL: "https://github.com/italia/repo.git"}))
+	assert.False(t, seen.add(Repository{GitCloneURL: "https://github.com/italia/repo.git"}))
+	assert.False(t, seen.add(Repository{GitCloneURL: "https://github.com/Italia/repo"}))
+
+	// The directories of a monorepo are different software.
+	assert.True(t, seen.add(Repository{GitCloneURL: "https://github.com/italia/repo.git", Subpath: "apps/web"}))
+	assert.False(t, seen.add(Repository{GitCloneURL: "https://github.com/italia/repo.git", Subpath: "apps/web"}))
+
+	// Without the clone url, the raw file url tells them apart.
+	assert.True(t, seen.add(Repository{FileRawURL: "https://bitbucket.org/soft/a/raw/master/publiccode.yml"}))
+	assert.True(t, seen.add(Repository{FileRawURL: "https://bitbucket.org/soft/b/raw/master/publiccode.yml"}))
+	assert.False(t, seen.add(Repository{FileRawURL: "https://bitbucket.org/soft/a/raw/master/publiccode.yml"}))
+}
@@ -0,0 +1,231 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/italia/developers-italia-backend/crawler/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// selfTestPA is the publisher of the self test fixture.
+var selfTestPA = PA{
+	Name:      "Self test",
+	CodiceIPA: "pcm",
+}
+
+// selfTestOrgPath is the path of the repositories list of the self test server.
+const selfTestOrgPath = "/orgs/selftest/repos"
+
+// selfTestPubliccode is the known-good publiccode.yml served by the self
+// test server. %s is replaced with the URL of the repository.
+const selfTestPubliccode = `publiccodeYmlVersion: "0.2"
+
+name: Self test
+url: "%s"
+softwareVersion: "1.0"
+releaseDate: "2020-01-01"
+
+platforms:
+  - web
+
+categories:
+  - cloud-management
+
+developmentStatus: stable
+
+softwareType: "standalone/web"
+
+description:
+  eng:
+    genericName: Self test
+    shortDescription: Software used by the crawler self test
+    longDescription: >
+      This is the software crawled by the self test of the crawler, served
+      by a stub HTTP server. It's used to check that the configuration, the
+      connection to Elasticsearch, the publiccode.yml parser and the indexing
+      are working, without touching the repositories of real publishers.
+      This description must be long enough to be accepted by the parser, so
+      here are some more words about a software that doesn't really exist
+      and it's only useful to run the self test with the "selftest" command,
+      possibly checking a deployment of the crawler.
+    features:
+       - Checking the crawler
+
+legal:
+  license: AGPL-3.0-or-later
+
+maintenance:
+  type: "community"
+
+  contacts:
+    - name: Self test
+
+localisation:
+  localisationReady: no
+  availableLanguages:
+    - eng
+
+it:
+  riuso:
+    codiceIPA: pcm
+`
+
+// newSelfTestServer returns a stub code hosting, serving a single
+// repository with a publiccode.yml through a GitHub-like API.
+func newSelfTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+
+	repoURL := ts.URL + "/selftest/app/"
+
+	mux.HandleFunc(selfTestOrgPath, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{{
+			"full_name":      "selftest/app",
+			"clone_url":      ts.URL + "/selftest/app.git",
+			"default_branch": "master",
+			"contents_url":   ts.URL + "/repos/selftest/app/contents/{+path}",
+		}})
+	})
+	mux.HandleFunc("/repos/selftest/app/contents/", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{{
+			"name":         viper.GetString("CRAWLED_FILENAME"),
+			"download_url": repoURL + viper.GetString("CRAWLED_FILENAME"),
+		}})
+	})
+	mux.HandleFunc("/selftest/app/"+viper.GetString("CRAWLED_FILENAME"), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, selfTestPubliccode, repoURL)
+	})
+	// Make the repository URL look like a git repository.
+	mux.HandleFunc("/selftest/app/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/info/refs") {
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		}
+	})
+
+	return ts
+}
+
+// setScoped sets the config keys to values and returns the function
+// restoring the previous values.
+func setScoped(values map[string]interface{}) func() {
+	previous := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		previous[key] = viper.Get(key)
+		viper.Set(key, value)
+	}
+
+	return func() {
+		for key, value := range previous {
+			viper.Set(key, value)
+		}
+	}
+}
+
+// SelfTest crawls the repository of a stub code hosting into a scratch
+// index, checks the expected document was indexed and cleans up.
+// Real publishers and the live indexes are not touched, nor the config.
+func SelfTest() error {
+	ts := newSelfTestServer()
+	defer ts.Close()
+
+	publishersIndex := viper.GetString("ELASTIC_PUBLISHERS_INDEX") + "_selftest"
+	// The stub code hosting doesn't serve git clones.
+	restore := setScoped(map[string]interface{}{
+		"SKIP_ACTIVITY":            true,
+		"ELASTIC_PUBLISHERS_INDEX": publishersIndex,
+	})
+	defer restore()
+
+	client, err := elastic.ClientFactory(
+		viper.GetString("ELASTIC_URL"),
+		viper.GetString("ELASTIC_USER"),
+		viper.GetString("ELASTIC_PWD"))
+	if err != nil {
+		return err
+	}
+
+	c := Crawler{
+		es:           client,
+		index:        viper.GetString("ELASTIC_PUBLICCODE_INDEX") + "_selftest",
+		repositories: make(chan Repository, 10),
+		runID:        newRunID(),
+	}
+	defer func() {
+		for _, index := range []string{c.index, publishersIndex} {
+			if _, err := c.es.DeleteIndex(index).Do(context.Background()); err != nil {
+				log.Errorf("Can't delete the self test index %s: %v", index, err)
+			}
+		}
+		if err := os.RemoveAll(path.Join(viper.GetString("OUTPUT_DIR"), "127.0.0.1")); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	err = elastic.CreateIndexMapping(c.index, elastic.PubliccodeMapping, c.es)
+	if err != nil {
+		return err
+	}
+	err = elastic.CreateIndexMapping(publishersIndex, elastic.AdministrationsMapping, c.es)
+	if err != nil {
+		return err
+	}
+
+	// List the repositories like a crawl of the publisher would do.
+	domain := Domain{Host: "github.com"}
+	_, _, err = domain.processAndGetNextURL(ts.URL+selfTestOrgPath, c.repositories, selfTestPA)
+	if err != nil {
+		return fmt.Errorf("listing the repositories: %v", err)
+	}
+	close(c.repositories)
+
+	var repositories []Repository
+	for repository := range c.repositories {
+		c.ProcessRepo(context.Background(), repository)
+		repositories = append(repositories, repository)
+	}
+	if len(repositories) != 1 {
+		return fmt.Errorf("%d repositories found, 1 expected", len(repositories))
+	}
+
+	err = c.closeBulk()
+	if err != nil {
+		return err
+	}
+	err = elastic.Flush(c.index, c.es)
+	if err != nil {
+		return err
+	}
+
+	// Check the indexed document.
+	doc, err := c.es.Get().
+		Index(c.index).
+		Type("software").
+		Id(repositories[0].generateID()).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("the document was not indexed: %v", err)
+	}
+
+	var software struct {
+		PublicCode struct {
+			Name string `json:"name"`
+		} `json:"publiccode"`
+	}
+	if err := json.Unmarshal(*doc.Source, &software); err != nil {
+		return err
+	}
+	if software.PublicCode.Name != "Self test" {
+		return errors.New("unexpected name in the indexed document: " + software.PublicCode.Name)
+	}
+
+	return nil
+}
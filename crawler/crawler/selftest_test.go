@@ -0,0 +1,67 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpclient "github.com/italia/httpclient-lib-go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// The self test fixture must be listed and be valid.
+func TestSelfTestFixture(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	defer viper.Set("CRAWLED_FILENAME", nil)
+
+	RegisterClientAPIs()
+
+	ts := newSelfTestServer()
+	defer ts.Close()
+
+	repositories := make(chan Repository, 10)
+	domain := Domain{Host: "github.com"}
+	_, _, err := domain.processAndGetNextURL(ts.URL+selfTestOrgPath, repositories, selfTestPA)
+	assert.NoError(t, err)
+	close(repositories)
+
+	assert.Len(t, repositories, 1)
+	repository := <-repositories
+	assert.Equal(t, "selftest/app", repository.Name)
+
+	resp, err := httpclient.GetURL(repository.FileRawURL, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, checkYAML(resp.Body))
+	assert.NoError(t, validateRemoteFile(resp.Body, repository.FileRawURL, repositoryURLs(repository), repository.Pa, repository.Domain))
+}
+
+// The config changed by the self test is restored, even if it fails.
+func TestSelfTestRestoresConfig(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"type":"illegal_argument_exception","reason":"self test"},"status":400}`)
+	}))
+	defer ts.Close()
+
+	viper.Set("CRAWLED_FILENAME", "publiccode.yml")
+	viper.Set("ELASTIC_URL", ts.URL)
+	viper.Set("ELASTIC_PUBLISHERS_INDEX", "publishers")
+	defer func() {
+		viper.Set("CRAWLED_FILENAME", nil)
+		viper.Set("ELASTIC_URL", nil)
+		viper.Set("ELASTIC_PUBLISHERS_INDEX", nil)
+	}()
+
+	assert.Error(t, SelfTest())
+	assert.False(t, viper.GetBool("SKIP_ACTIVITY"))
+	assert.Equal(t, "publishers", viper.GetString("ELASTIC_PUBLISHERS_INDEX"))
+}
@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// defaultSourceExtensions are the extensions of the files considered source
+// code, overridden by SOURCE_EXTENSIONS.
+var defaultSourceExtensions = []string{
+	".c", ".cc", ".cpp", ".cs", ".css", ".go", ".h", ".hpp", ".html", ".java",
+	".js", ".jsx", ".kt", ".m", ".php", ".pl", ".py", ".r", ".rb", ".rs",
+	".scala", ".sh", ".sql", ".swift", ".ts", ".tsx", ".vue", ".xml",
+}
+
+// errSourceFound stops the walk as soon as a source file is found.
+var errSourceFound = errors.New("source file found")
+
+// sourceExtensions returns the configured source extensions.
+func sourceExtensions() []string {
+	if viper.IsSet("SOURCE_EXTENSIONS") {
+		return viper.GetStringSlice("SOURCE_EXTENSIONS")
+	}
+
+	return defaultSourceExtensions
+}
+
+// hasSourceFiles returns whether there's at least a file with one of the
+// extensions under path, ignoring the .git directory.
+func hasSourceFiles(path string, extensions []string) (bool, error) {
+	exts := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		exts[strings.ToLower(ext)] = true
+	}
+
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if exts[strings.ToLower(filepath.Ext(p))] {
+			return errSourceFound
+		}
+		return nil
+	})
+	if err == errSourceFound {
+		return true, nil
+	}
+
+	return false, err
+}
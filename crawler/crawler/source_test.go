@@ -0,0 +1,21 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasSourceFiles(t *testing.T) {
+	found, err := hasSourceFiles("testdata/binary-only", defaultSourceExtensions)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	found, err = hasSourceFiles("testdata/binary-only", []string{".EXE"})
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = hasSourceFiles(".", defaultSourceExtensions)
+	assert.NoError(t, err)
+	assert.True(t, found)
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ValidationError is a publiccode.yml rejected by the crawler.
+type ValidationError struct {
+	FileRawURL string
+	Err        error
+}
+
+// ValidationErrors are the publiccode.yml files rejected in a crawl,
+// returned with STRICT.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d invalid publiccode.yml (STRICT):", len(e))
+	for _, v := range e {
+		// The parser errors can span multiple lines.
+		fmt.Fprintf(&b, "\n%s:\n  %s", v.FileRawURL, strings.ReplaceAll(v.Err.Error(), "\n", "\n  "))
+	}
+
+	return b.String()
+}
+
+// StrictError is the error of a crawl with STRICT: the invalid
+// publiccode.yml files and the number of the ones that couldn't be fetched
+// and of the repositories that failed to clone. The failures interrupted by
+// a shutdown aren't counted.
+type StrictError struct {
+	Invalid       ValidationErrors
+	FetchFailures int
+	CloneFailures int
+}
+
+func (e StrictError) Error() string {
+	var lines []string
+	if len(e.Invalid) > 0 {
+		lines = append(lines, e.Invalid.Error())
+	}
+	if e.FetchFailures > 0 {
+		lines = append(lines, fmt.Sprintf("%d publiccode.yml couldn't be fetched (STRICT)", e.FetchFailures))
+	}
+	if e.CloneFailures > 0 {
+		lines = append(lines, fmt.Sprintf("%d repositories failed to clone (STRICT)", e.CloneFailures))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the invalid publiccode.yml files, nil if there are none.
+func (e StrictError) Unwrap() error {
+	if len(e.Invalid) == 0 {
+		return nil
+	}
+
+	return e.Invalid
+}
+
+// strictValidation returns whether the crawl fails if any publiccode.yml
+// is invalid, STRICT.
+func strictValidation() bool {
+	return viper.GetBool("STRICT")
+}
+
+// strictError returns the StrictError of the crawl with STRICT, nil if
+// every publiccode.yml was fetched and valid and every repository cloned, or
+// STRICT is not set.
+func (c *Crawler) strictError() error {
+	if !strictValidation() {
+		return nil
+	}
+
+	c.summary.mutex.Lock()
+	defer c.summary.mutex.Unlock()
+
+	if len(c.summary.validationErrors) == 0 && c.summary.fetchFailures == 0 && c.summary.cloneFailures == 0 {
+		return nil
+	}
+
+	invalid := append(ValidationErrors(nil), c.summary.validationErrors...)
+	sort.SliceStable(invalid, func(i, j int) bool { return invalid[i].FileRawURL < invalid[j].FileRawURL })
+
+	return StrictError{
+		Invalid:       invalid,
+		FetchFailures: c.summary.fetchFailures,
+		CloneFailures: c.summary.cloneFailures,
+	}
+}
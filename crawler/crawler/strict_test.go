@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictError(t *testing.T) {
+	var c Crawler
+	c.summary.addInvalid("https://example.org/b/publiccode.yml", errors.New("name: missing\nurl: missing"))
+	c.summary.addInvalid("https://example.org/a/publiccode.yml", errorMissingVersion{})
+
+	assert.NoError(t, c.strictError())
+
+	viper.Set("STRICT", true)
+	defer viper.Set("STRICT", nil)
+
+	err := c.strictError()
+	var invalid ValidationErrors
+	assert.True(t, errors.As(err, &invalid))
+	assert.Len(t, invalid, 2)
+	assert.Equal(t, "2 invalid publiccode.yml (STRICT):\n"+
+		"https://example.org/a/publiccode.yml:\n  publiccodeYmlVersion: missing\n"+
+		"https://example.org/b/publiccode.yml:\n  name: missing\n  url: missing", err.Error())
+
+	var strict StrictError
+	assert.True(t, errors.As(err, &strict))
+	assert.Zero(t, strict.FetchFailures)
+	assert.Zero(t, strict.CloneFailures)
+
+	assert.NoError(t, (&Crawler{}).strictError())
+}
+
+func TestStrictErrorFailures(t *testing.T) {
+	viper.Set("STRICT", true)
+	defer viper.Set("STRICT", nil)
+
+	var c Crawler
+	c.summary.addFetchFailure()
+	c.summary.addCloneFailure(cloneFailureTimeout)
+	c.summary.addCloneFailure(cloneFailureTimeout)
+
+	err := c.strictError()
+	var strict StrictError
+	assert.True(t, errors.As(err, &strict))
+	assert.Equal(t, 1, strict.FetchFailures)
+	assert.Equal(t, 2, strict.CloneFailures)
+	assert.Equal(t, "1 publiccode.yml couldn't be fetched (STRICT)\n"+
+		"2 repositories failed to clone (STRICT)", err.Error())
+
+	// Without invalid files there are no ValidationErrors.
+	var invalid ValidationErrors
+	assert.False(t, errors.As(err, &invalid))
+}
@@ -0,0 +1,461 @@
+package crawler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// crawlSummary collects statistics about the repositories processed in a crawl.
+// It's shared by all the ProcessRepositories workers.
+type crawlSummary struct {
+	mutex sync.Mutex
+
+	cloneDurations []time.Duration
+
+	// Number of repositories processed and of documents indexed.
+	processed int
+	indexed   int
+
+	// Number of documents with the ID of another repository.
+	idCollisions int
+
+	// Number of documents rejected by Elasticsearch and of the ones not
+	// indexed because it kept failing after the retries.
+	indexRejected int
+	indexFailed   int
+
+	// Number of repositories with a valid and an invalid publiccode.yml.
+	valid   int
+	invalid int
+
+	// The invalid publiccode.yml files and their errors.
+	validationErrors ValidationErrors
+
+	// Number of publiccode.yml that couldn't be fetched.
+	fetchFailures int
+
+	// Number of repositories that failed to clone, in total and by the
+	// class of the error (see cloneFailureClass).
+	cloneFailures       int
+	cloneFailureClasses map[string]int
+
+	// Number of blacklisted repositories and of the ones removed from
+	// Elasticsearch.
+	blacklisted int
+	removed     int
+
+	// Number of stale documents pruned from Elasticsearch.
+	pruned int
+
+	// Number of repositories not cloned because of SKIP_ACTIVITY.
+	skippedActivity int
+
+	// Total time of the clones and activity calculations, and their number.
+	activityDuration   time.Duration
+	activityCalculated int
+
+	// Mean time of a clone and activity calculation in the last run, to
+	// estimate the time saved by SKIP_ACTIVITY.
+	lastActivityDuration time.Duration
+
+	// Number of repositories not cloned because bigger than MAX_REPO_SIZE_MB.
+	skippedTooBig int
+
+	// Number of repositories with a license not in ALLOWED_LICENSES,
+	// by license and publisher.
+	disallowedLicenses map[string]map[string]int
+
+	// The publiccode.yml files whose license is not valid SPDX.
+	invalidLicenses []InvalidLicense
+
+	// The publiccode.yml files whose url is not the repository.
+	urlMismatches []URLMismatch
+
+	// Number of dormant repositories by publisher.
+	dormant map[string]int
+
+	// Software that moved to another codiceIPA.
+	transfers []codiceIPATransfer
+}
+
+// addCloneDuration records the time taken by a successful clone.
+func (s *crawlSummary) addCloneDuration(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cloneDurations = append(s.cloneDurations, d)
+}
+
+// addProcessed records a repository being processed.
+func (s *crawlSummary) addProcessed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.processed++
+}
+
+// addIndexed records a document being indexed.
+func (s *crawlSummary) addIndexed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.indexed++
+}
+
+// addIndexFailure records a document not indexed, because Elasticsearch
+// kept failing if transient or rejected it otherwise.
+func (s *crawlSummary) addIndexFailure(transient bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if transient {
+		s.indexFailed++
+	} else {
+		s.indexRejected++
+	}
+}
+
+// addIDCollision records a document with the ID of another repository.
+func (s *crawlSummary) addIDCollision() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.idCollisions++
+}
+
+// addValid records a repository with a valid publiccode.yml.
+func (s *crawlSummary) addValid() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.valid++
+}
+
+// addInvalid records a repository with the invalid publiccode.yml at
+// fileRawURL, rejected because of err.
+func (s *crawlSummary) addInvalid(fileRawURL string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.invalid++
+	s.validationErrors = append(s.validationErrors, ValidationError{FileRawURL: fileRawURL, Err: err})
+}
+
+// addFetchFailure records a publiccode.yml that couldn't be fetched.
+func (s *crawlSummary) addFetchFailure() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.fetchFailures++
+}
+
+// addCloneFailure records a repository that failed to clone with an error
+// of class.
+func (s *crawlSummary) addCloneFailure(class string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cloneFailures++
+	if s.cloneFailureClasses == nil {
+		s.cloneFailureClasses = make(map[string]int)
+	}
+	s.cloneFailureClasses[class]++
+}
+
+// addBlacklisted records n blacklisted repositories.
+func (s *crawlSummary) addBlacklisted(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.blacklisted += n
+}
+
+// addRemoved records a blacklisted repository removed from Elasticsearch.
+func (s *crawlSummary) addRemoved() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.removed++
+}
+
+// addPruned records n stale documents pruned from Elasticsearch.
+func (s *crawlSummary) addPruned(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pruned += n
+}
+
+// addSkippedActivity records a repository whose clone and activity calculation were skipped.
+func (s *crawlSummary) addSkippedActivity() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.skippedActivity++
+}
+
+// addActivityDuration records the time taken by the clone and activity
+// calculation of a repository.
+func (s *crawlSummary) addActivityDuration(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.activityDuration += d
+	s.activityCalculated++
+}
+
+// meanActivityDuration returns the mean time of a clone and activity
+// calculation, the one of the last run if none was done in this one.
+func (s *crawlSummary) meanActivityDuration() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.meanActivityDurationLocked()
+}
+
+func (s *crawlSummary) meanActivityDurationLocked() time.Duration {
+	if s.activityCalculated == 0 {
+		return s.lastActivityDuration
+	}
+
+	return s.activityDuration / time.Duration(s.activityCalculated)
+}
+
+// addSkippedTooBig records a repository not cloned because bigger than
+// MAX_REPO_SIZE_MB.
+func (s *crawlSummary) addSkippedTooBig() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.skippedTooBig++
+}
+
+// addDisallowedLicense records a repository of publisher with a license not in ALLOWED_LICENSES.
+func (s *crawlSummary) addDisallowedLicense(license, publisher string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.disallowedLicenses == nil {
+		s.disallowedLicenses = make(map[string]map[string]int)
+	}
+	if s.disallowedLicenses[license] == nil {
+		s.disallowedLicenses[license] = make(map[string]int)
+	}
+	s.disallowedLicenses[license][publisher]++
+}
+
+// addInvalidLicense records the publiccode.yml at fileRawURL, whose license
+// is not valid SPDX because of err.
+func (s *crawlSummary) addInvalidLicense(fileRawURL, license string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.invalidLicenses = append(s.invalidLicenses, InvalidLicense{FileRawURL: fileRawURL, License: license, Reason: err.Error()})
+}
+
+// addURLMismatch records a publiccode.yml whose url is not the repository
+// and that was indexed anyway.
+func (s *crawlSummary) addURLMismatch(mismatch URLMismatch) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.urlMismatches = append(s.urlMismatches, mismatch)
+}
+
+// addDormant records a dormant repository of publisher.
+func (s *crawlSummary) addDormant(publisher string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.dormant == nil {
+		s.dormant = make(map[string]int)
+	}
+	s.dormant[publisher]++
+}
+
+// addTransfer records software that moved to another codiceIPA.
+func (s *crawlSummary) addTransfer(transfer codiceIPATransfer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.transfers = append(s.transfers, transfer)
+}
+
+// codiceIPATransfers returns the software that moved to another codiceIPA.
+func (s *crawlSummary) codiceIPATransfers() []codiceIPATransfer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	transfers := make([]codiceIPATransfer, len(s.transfers))
+	copy(transfers, s.transfers)
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].Repository < transfers[j].Repository })
+
+	return transfers
+}
+
+// CrawlCounts are the counters of the repositories of a crawl, in the
+// Report and in the status of the last run.
+type CrawlCounts struct {
+	Processed    int `json:"processed"`
+	Valid        int `json:"valid"`
+	Invalid      int `json:"invalid"`
+	Blacklisted  int `json:"blacklisted"`
+	Removed      int `json:"removed"`
+	Pruned       int `json:"pruned"`
+	CloneFailed  int `json:"cloneFailed"`
+	Indexed      int `json:"indexed"`
+	IDCollisions int `json:"idCollisions"`
+
+	// Documents rejected by Elasticsearch (eg. mapping conflicts) and not
+	// indexed because of transient errors lasting beyond the retries.
+	IndexRejected int `json:"indexRejected"`
+	IndexFailed   int `json:"indexFailed"`
+
+	SkippedActivity int `json:"skippedActivity"`
+	Dormant         int `json:"dormant"`
+	Transfers       int `json:"transfers"`
+}
+
+// counts returns the counters of the repositories of the crawl.
+func (s *crawlSummary) counts() CrawlCounts {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.countsLocked()
+}
+
+func (s *crawlSummary) countsLocked() CrawlCounts {
+	dormant := 0
+	for _, n := range s.dormant {
+		dormant += n
+	}
+
+	return CrawlCounts{
+		Processed:       s.processed,
+		Valid:           s.valid,
+		Invalid:         s.invalid,
+		Blacklisted:     s.blacklisted,
+		Removed:         s.removed,
+		Pruned:          s.pruned,
+		CloneFailed:     s.cloneFailures,
+		Indexed:         s.indexed,
+		IDCollisions:    s.idCollisions,
+		IndexRejected:   s.indexRejected,
+		IndexFailed:     s.indexFailed,
+		SkippedActivity: s.skippedActivity,
+		Dormant:         dormant,
+		Transfers:       len(s.transfers),
+	}
+}
+
+// log writes the summary of the crawl to the log.
+func (s *crawlSummary) log() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.cloneDurations) > 0 {
+		log.Infof("Clone duration of %d repositories: p50 %v, p95 %v",
+			len(s.cloneDurations),
+			percentile(s.cloneDurations, 50),
+			percentile(s.cloneDurations, 95),
+		)
+	}
+
+	if s.fetchFailures > 0 {
+		log.Warnf("%d publiccode.yml couldn't be fetched", s.fetchFailures)
+	}
+
+	if s.cloneFailures > 0 {
+		classes := make([]string, 0, len(s.cloneFailureClasses))
+		for class, n := range s.cloneFailureClasses {
+			classes = append(classes, fmt.Sprintf("%s: %d", class, n))
+		}
+		sort.Strings(classes)
+		log.Warnf("%d repositories failed to clone (%s)", s.cloneFailures, strings.Join(classes, ", "))
+	}
+
+	if s.indexRejected > 0 {
+		log.Errorf("%d documents rejected by Elasticsearch", s.indexRejected)
+	}
+	if s.indexFailed > 0 {
+		log.Errorf("%d documents not indexed, Elasticsearch kept failing (RETRY_MAX_ATTEMPTS)", s.indexFailed)
+	}
+
+	if s.skippedActivity > 0 {
+		if mean := s.meanActivityDurationLocked(); mean > 0 {
+			log.Infof("Saved clone and activity calculation of %d repositories (SKIP_ACTIVITY), about %v",
+				s.skippedActivity, (time.Duration(s.skippedActivity) * mean).Round(time.Second))
+		} else {
+			log.Infof("Saved clone and activity calculation of %d repositories (SKIP_ACTIVITY), time unknown: no previous run calculated the activity",
+				s.skippedActivity)
+		}
+	}
+	if s.skippedTooBig > 0 {
+		log.Warnf("%d repositories not cloned, bigger than MAX_REPO_SIZE_MB", s.skippedTooBig)
+	}
+
+	licenses := make([]string, 0, len(s.disallowedLicenses))
+	for license := range s.disallowedLicenses {
+		licenses = append(licenses, license)
+	}
+	sort.Strings(licenses)
+	for _, license := range licenses {
+		publishers := make([]string, 0, len(s.disallowedLicenses[license]))
+		total := 0
+		for publisher, n := range s.disallowedLicenses[license] {
+			publishers = append(publishers, fmt.Sprintf("%s: %d", publisher, n))
+			total += n
+		}
+		sort.Strings(publishers)
+
+		log.Warnf("Disallowed license %q in %d repositories (%s)", license, total, strings.Join(publishers, ", "))
+	}
+
+	if len(s.invalidLicenses) > 0 {
+		log.Warnf("%d publiccode.yml with a license not valid SPDX", len(s.invalidLicenses))
+	}
+
+	if len(s.urlMismatches) > 0 {
+		log.Warnf("%d publiccode.yml with the url of another repository", len(s.urlMismatches))
+	}
+
+	if len(s.dormant) > 0 {
+		publishers := make([]string, 0, len(s.dormant))
+		total := 0
+		for publisher, n := range s.dormant {
+			publishers = append(publishers, fmt.Sprintf("%s: %d", publisher, n))
+			total += n
+		}
+		sort.Strings(publishers)
+
+		log.Warnf("%d dormant repositories (MAX_INACTIVE_DAYS) (%s)", total, strings.Join(publishers, ", "))
+	}
+
+	if len(s.transfers) > 0 {
+		log.Infof("%d repositories moved to another codiceIPA", len(s.transfers))
+	}
+}
+
+// percentile returns the p-th percentile of durations, using the nearest-rank method.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
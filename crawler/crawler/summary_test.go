@@ -0,0 +1,32 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 20; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+
+	assert.Equal(t, 10*time.Second, percentile(durations, 50))
+	assert.Equal(t, 19*time.Second, percentile(durations, 95))
+	assert.Equal(t, 1*time.Second, percentile(durations, 0))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+
+	// The input must be left untouched.
+	assert.Equal(t, 20*time.Second, durations[0])
+}
+
+func TestMeanActivityDuration(t *testing.T) {
+	s := crawlSummary{lastActivityDuration: 5 * time.Second}
+	assert.Equal(t, 5*time.Second, s.meanActivityDuration())
+
+	s.addActivityDuration(2 * time.Second)
+	s.addActivityDuration(4 * time.Second)
+	assert.Equal(t, 3*time.Second, s.meanActivityDuration())
+}
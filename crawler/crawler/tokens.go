@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// tokenRotation is the position of the round robin between the credentials
+// of the API requests, shared by all the workers.
+var tokenRotation uint32
+
+// githubCredentials returns the credentials of the GitHub API requests to
+// host: the basic-auth of the domain and, only for github.com, the comma
+// separated GITHUB_TOKENS, not to send them to GitHub Enterprise or other
+// hosts.
+func githubCredentials(domain Domain, host string) []string {
+	credentials := append([]string{}, domain.BasicAuth...)
+	if host != "github.com" && host != "api.github.com" {
+		return credentials
+	}
+	for _, token := range strings.Split(viper.GetString("GITHUB_TOKENS"), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			credentials = append(credentials, token)
+		}
+	}
+
+	return credentials
+}
+
+// githubAuthorization returns the Authorization header of a GitHub API
+// request to host, rotating between the credentials.
+func githubAuthorization(domain Domain, host string) string {
+	return rotateAuthorization(githubCredentials(domain, host), host, time.Now())
+}
+
+// githubHeaders returns the headers of a GitHub API request to host.
+func githubHeaders(domain Domain, host string) map[string]string {
+	return map[string]string{"Authorization": githubAuthorization(domain, host)}
+}
+
+// authorizationHeader returns the Authorization header of credential:
+// basic authentication for "user:token", the token itself otherwise.
+func authorizationHeader(credential string) string {
+	switch {
+	case credential == "":
+		return ""
+	case strings.Contains(credential, ":"):
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credential))
+	default:
+		return "token " + credential
+	}
+}
+
+// rotateAuthorization returns the Authorization header of the next of
+// credentials, round robin, skipping the ones without requests left on
+// host. If none has requests left, it's the one whose rate limit resets
+// first.
+func rotateAuthorization(credentials []string, host string, now time.Time) string {
+	if len(credentials) == 0 {
+		return ""
+	}
+
+	start := int((atomic.AddUint32(&tokenRotation, 1) - 1) % uint32(len(credentials)))
+
+	var first string
+	var firstReset time.Time
+	for i := range credentials {
+		authorization := authorizationHeader(credentials[(start+i)%len(credentials)])
+
+		reset := rateLimitReset(host, authorization)
+		if !reset.After(now) {
+			return authorization
+		}
+		if first == "" || reset.Before(firstReset) {
+			first, firstReset = authorization, reset
+		}
+	}
+
+	return first
+}
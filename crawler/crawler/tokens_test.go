@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"encoding/base64"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizationHeader(t *testing.T) {
+	assert.Equal(t, "", authorizationHeader(""))
+	assert.Equal(t, "token abc", authorizationHeader("abc"))
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("user:abc")), authorizationHeader("user:abc"))
+}
+
+func TestGithubCredentials(t *testing.T) {
+	viper.Set("GITHUB_TOKENS", " one, ,two ")
+	defer viper.Set("GITHUB_TOKENS", nil)
+
+	domain := Domain{BasicAuth: []string{"user:token"}}
+	assert.Equal(t, []string{"user:token", "one", "two"}, githubCredentials(domain, "api.github.com"))
+	assert.Equal(t, []string{"user:token", "one", "two"}, githubCredentials(domain, "github.com"))
+	assert.Equal(t, []string{"user:token"}, domain.BasicAuth)
+
+	// Not sent to GitHub Enterprise.
+	assert.Equal(t, []string{"user:token"}, githubCredentials(domain, "github.example.org"))
+}
+
+func TestRotateAuthorization(t *testing.T) {
+	atomic.StoreUint32(&tokenRotation, 0)
+	now := time.Now()
+	credentials := []string{"one", "two"}
+
+	assert.Equal(t, "token one", rotateAuthorization(credentials, "api.example.org", now))
+	assert.Equal(t, "token two", rotateAuthorization(credentials, "api.example.org", now))
+	assert.Equal(t, "token one", rotateAuthorization(credentials, "api.example.org", now))
+	assert.Equal(t, "", rotateAuthorization(nil, "api.example.org", now))
+}
+
+func TestRotateAuthorizationRateLimited(t *testing.T) {
+	atomic.StoreUint32(&tokenRotation, 0)
+	now := time.Now()
+	credentials := []string{"one", "two"}
+
+	limited := func(authorization string, reset time.Time) {
+		rateLimitResets.Lock()
+		defer rateLimitResets.Unlock()
+		rateLimitResets.resets[rateLimitKey{"api.example.org", authorization}] = reset
+	}
+	defer func() {
+		rateLimitResets.Lock()
+		defer rateLimitResets.Unlock()
+		delete(rateLimitResets.resets, rateLimitKey{"api.example.org", "token one"})
+		delete(rateLimitResets.resets, rateLimitKey{"api.example.org", "token two"})
+	}()
+
+	limited("token one", now.Add(time.Hour))
+	assert.Equal(t, "token two", rotateAuthorization(credentials, "api.example.org", now))
+	assert.Equal(t, "token two", rotateAuthorization(credentials, "api.example.org", now))
+
+	// All rate limited: the one resetting first.
+	limited("token two", now.Add(2*time.Hour))
+	assert.Equal(t, "token one", rotateAuthorization(credentials, "api.example.org", now))
+
+	// Another host has its own limits.
+	assert.Equal(t, "token two", rotateAuthorization(credentials, "api.other.org", now))
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// codiceIPATransfer is software moved from an administration to another:
+// the repository is the same but the codiceIPA in publiccode.yml changed.
+type codiceIPATransfer struct {
+	Repository string `json:"repository"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+// publiccodeCodiceIPA returns it.riuso.codiceIPA of the raw publiccode.yml.
+func publiccodeCodiceIPA(data []byte) string {
+	var pc struct {
+		It struct {
+			Riuso struct {
+				CodiceIPA string `yaml:"codiceIPA"`
+			} `yaml:"riuso"`
+		} `yaml:"it"`
+	}
+	if err := yaml.Unmarshal(data, &pc); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(pc.It.Riuso.CodiceIPA)
+}
+
+// checkCodiceIPATransfer compares the codiceIPA in data with the one of the
+// stored publiccode.yml and returns the transfer if it changed.
+func checkCodiceIPATransfer(repository Repository, stored softwareTimes, data []byte) *codiceIPATransfer {
+	from := publiccodeCodiceIPA([]byte(stored.RawPubliccode))
+	to := publiccodeCodiceIPA(data)
+	if from == "" || to == "" || strings.EqualFold(from, to) {
+		return nil
+	}
+
+	return &codiceIPATransfer{Repository: repository.Name, From: from, To: to}
+}
+
+// writeTransfers saves the codiceIPA transfers as JSON in fname.
+func writeTransfers(transfers []codiceIPATransfer, fname string) error {
+	if transfers == nil {
+		transfers = []codiceIPATransfer{}
+	}
+
+	jsonOut, err := json.MarshalIndent(transfers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0775); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, jsonOut, 0644)
+}
@@ -0,0 +1,24 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCodiceIPATransfer(t *testing.T) {
+	repository := Repository{Name: "pcm/app", GitCloneURL: "https://github.com/pcm/app.git"}
+
+	// The previously indexed document of repository.
+	stored := softwareTimes{RawPubliccode: "it:\n  riuso:\n    codiceIPA: c_h501\n"}
+
+	transfer := checkCodiceIPATransfer(repository, stored, []byte("it:\n  riuso:\n    codiceIPA: pcm\n"))
+	assert.Equal(t, &codiceIPATransfer{Repository: "pcm/app", From: "c_h501", To: "pcm"}, transfer)
+
+	transfer = checkCodiceIPATransfer(repository, stored, []byte("it:\n  riuso:\n    codiceIPA: C_H501\n"))
+	assert.Nil(t, transfer)
+
+	// Never indexed.
+	transfer = checkCodiceIPATransfer(repository, softwareTimes{}, []byte("it:\n  riuso:\n    codiceIPA: pcm\n"))
+	assert.Nil(t, transfer)
+}
@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+)
+
+// FileValidation is the outcome of the validation of a local publiccode.yml
+// with the checks of the crawl.
+type FileValidation struct {
+	// Errors are the reasons why the crawler would reject the file.
+	Errors []error
+	// Warnings are indexed anyway, but reported in the crawl.
+	Warnings []string
+}
+
+// Valid returns whether the crawler would index the file.
+func (v FileValidation) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// ValidateLocalFile validates the publiccode.yml at fname like the crawl
+// does, so that the publishers can check it before pushing. The codiceIPA
+// isn't matched with the whitelist, as with the `one` command for unknown
+// publishers. The relative paths are checked next to fname and, with
+// offline, the URLs aren't checked at all.
+// It returns an error only if the file can't be read.
+func ValidateLocalFile(fname string, offline bool) (FileValidation, error) {
+	var validation FileValidation
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return validation, err
+	}
+
+	// The checks before the parser reject the file right away in a crawl.
+	if err = checkComplexity(data); err != nil {
+		validation.Errors = append(validation.Errors, err)
+		return validation, nil
+	}
+	if err = checkYAML(data); err != nil {
+		validation.Errors = append(validation.Errors, err)
+		return validation, nil
+	}
+	if _, err = checkVersion(data); err != nil {
+		validation.Errors = append(validation.Errors, err)
+		return validation, nil
+	}
+
+	parser := publiccode.NewParser()
+	parser.Strict = false
+	parser.DisableNetwork = offline
+	parser.LocalBasePath = filepath.Dir(fname)
+	if err = parser.Parse(data); err != nil {
+		// Report each of the parser errors on its own.
+		if multi, ok := err.(publiccode.ErrorParseMulti); ok {
+			validation.Errors = append(validation.Errors, multi...)
+		} else {
+			validation.Errors = append(validation.Errors, err)
+		}
+	}
+
+	if err = checkRequiredFields(data); err != nil {
+		validation.Errors = append(validation.Errors, err)
+	} else if !offline {
+		if err = checkRequiredURL(context.Background(), data); err != nil {
+			validation.Errors = append(validation.Errors, err)
+		}
+	}
+
+	declaredLicense := publiccodeLicense(data)
+	if _, _, err = normalizeLicense(declaredLicense); err != nil {
+		validation.Warnings = append(validation.Warnings, fmt.Sprintf("invalidLicense: %q: %v", declaredLicense, err))
+	}
+	if license, disallowed := checkLicense(data); disallowed {
+		validation.Warnings = append(validation.Warnings, fmt.Sprintf("disallowedLicense: %s is not in ALLOWED_LICENSES", license))
+	}
+
+	return validation, nil
+}
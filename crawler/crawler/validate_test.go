@@ -0,0 +1,43 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLocalFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	valid := fmt.Sprintf(selfTestPubliccode, "https://github.com/italia/example")
+	fname := filepath.Join(dir, "publiccode.yml")
+
+	assert.NoError(t, ioutil.WriteFile(fname, []byte(valid), 0644))
+	validation, err := ValidateLocalFile(fname, true)
+	assert.NoError(t, err)
+	assert.True(t, validation.Valid(), "%v", validation.Errors)
+	assert.Empty(t, validation.Warnings)
+
+	invalid := strings.Replace(valid, "developmentStatus: stable", "developmentStatus: unknown", 1)
+	invalid = strings.Replace(invalid, "AGPL-3.0-or-later", "GPL", 1)
+	assert.NoError(t, ioutil.WriteFile(fname, []byte(invalid), 0644))
+	validation, err = ValidateLocalFile(fname, true)
+	assert.NoError(t, err)
+	assert.False(t, validation.Valid())
+	assert.NotEmpty(t, validation.Warnings)
+
+	assert.NoError(t, ioutil.WriteFile(fname, []byte("name: no version\n"), 0644))
+	validation, err = ValidateLocalFile(fname, true)
+	assert.NoError(t, err)
+	assert.Len(t, validation.Errors, 1)
+
+	_, err = ValidateLocalFile(filepath.Join(dir, "missing.yml"), true)
+	assert.Error(t, err)
+}
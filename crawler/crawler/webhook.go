@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// webhookTimeout is the timeout of each webhook request, and how long the
+// end of the crawl waits for the notifications left.
+const webhookTimeout = 10 * time.Second
+
+// webhookQueueSize is the number of notifications waiting to be sent, the
+// next ones are dropped.
+const webhookQueueSize = 100
+
+// webhookPayload is the notification of newly indexed software. Text makes
+// it readable by the Slack and Mattermost incoming webhooks as it is.
+type webhookPayload struct {
+	Text      string `json:"text"`
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Publisher string `json:"publisher"`
+}
+
+// webhookNotifier posts the notifications to WEBHOOK_URL in the background,
+// so they never slow the crawl down.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+	queue  chan webhookPayload
+	// The notifications queued and not sent yet.
+	pending sync.WaitGroup
+}
+
+// newWebhookNotifier returns the notifier posting to WEBHOOK_URL, nil if
+// it's not set.
+func newWebhookNotifier() *webhookNotifier {
+	url := viper.GetString("WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+
+	w := &webhookNotifier{
+		url: url,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: newTransport(nil, connectTimeout()),
+		},
+		queue: make(chan webhookPayload, webhookQueueSize),
+	}
+	go w.run()
+
+	return w
+}
+
+// notify queues the notification of the newly indexed repository. It never
+// blocks: if the queue is full the notification is dropped.
+func (w *webhookNotifier) notify(repository Repository) {
+	if w == nil {
+		return
+	}
+
+	payload := webhookPayload{
+		Text:      fmt.Sprintf("New software found: %s (%s) by %s", repository.Name, repository.GitCloneURL, repository.Pa.Name),
+		Name:      repository.Name,
+		URL:       repository.GitCloneURL,
+		Publisher: repository.Pa.Name,
+	}
+
+	w.pending.Add(1)
+	select {
+	case w.queue <- payload:
+	default:
+		w.pending.Done()
+		log.WithField(logFieldRepository, repository.Name).Warn("Webhook queue full, notification dropped")
+	}
+}
+
+// run sends the queued notifications.
+func (w *webhookNotifier) run() {
+	for payload := range w.queue {
+		if err := w.post(payload); err != nil {
+			log.WithField(logFieldRepository, payload.Name).Warnf("Webhook notification failed: %v", err)
+		}
+		w.pending.Done()
+	}
+}
+
+// post sends payload to the webhook.
+func (w *webhookNotifier) post(payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// flush waits up to timeout for the queued notifications to be sent.
+func (w *webhookNotifier) flush(timeout time.Duration) {
+	if w == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Warn("Timed out sending the webhook notifications left")
+	}
+}
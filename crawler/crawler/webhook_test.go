@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var mutex sync.Mutex
+	var received []webhookPayload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, payload)
+
+		// Failures are only logged.
+		if payload.Name == "comune/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	assert.Nil(t, newWebhookNotifier())
+
+	viper.Set("WEBHOOK_URL", ts.URL)
+	defer viper.Set("WEBHOOK_URL", nil)
+
+	w := newWebhookNotifier()
+	w.notify(Repository{Name: "comune/broken", GitCloneURL: "https://github.com/comune/broken.git"})
+	w.notify(Repository{
+		Name:        "comune/app",
+		GitCloneURL: "https://github.com/comune/app.git",
+		Pa:          PA{Name: "Comune di Test"},
+	})
+	w.flush(time.Second)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Len(t, received, 2)
+	assert.Equal(t, webhookPayload{
+		Text:      "New software found: comune/app (https://github.com/comune/app.git) by Comune di Test",
+		Name:      "comune/app",
+		URL:       "https://github.com/comune/app.git",
+		Publisher: "Comune di Test",
+	}, received[1])
+
+	// Nothing to do without WEBHOOK_URL.
+	var none *webhookNotifier
+	none.notify(Repository{Name: "comune/app"})
+	none.flush(time.Second)
+}
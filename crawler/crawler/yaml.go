@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Defaults of the publiccode.yml complexity guards, overridden by
+// MAX_PUBLICCODE_SIZE and MAX_PUBLICCODE_DEPTH.
+const (
+	defaultMaxPubliccodeSize  = 1 << 20
+	defaultMaxPubliccodeDepth = 20
+)
+
+// errorTooComplex is returned for publiccode.yml files too big or too
+// nested to be safely parsed.
+type errorTooComplex struct {
+	reason string
+}
+
+func (e errorTooComplex) Error() string {
+	return "tooComplex: " + e.reason
+}
+
+// checkComplexity rejects publiccode.yml files bigger than MAX_PUBLICCODE_SIZE
+// bytes or nested deeper than MAX_PUBLICCODE_DEPTH levels, before they get to
+// the parser.
+func checkComplexity(data []byte) error {
+	maxSize := defaultMaxPubliccodeSize
+	if viper.IsSet("MAX_PUBLICCODE_SIZE") {
+		maxSize = viper.GetInt("MAX_PUBLICCODE_SIZE")
+	}
+	if len(data) > maxSize {
+		return errorTooComplex{fmt.Sprintf("size of %d bytes, max %d", len(data), maxSize)}
+	}
+
+	maxDepth := defaultMaxPubliccodeDepth
+	if viper.IsSet("MAX_PUBLICCODE_DEPTH") {
+		maxDepth = viper.GetInt("MAX_PUBLICCODE_DEPTH")
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if depth := yamlDepth(&doc, maxDepth); depth > maxDepth {
+		return errorTooComplex{fmt.Sprintf("nested more than %d levels", maxDepth)}
+	}
+
+	return nil
+}
+
+// yamlDepth returns the nesting depth of the YAML tree, not looking further
+// than max+1 levels. Aliases are not followed.
+func yamlDepth(node *yaml.Node, max int) int {
+	depth := 0
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		depth = 1
+	}
+	if depth > max {
+		return depth
+	}
+
+	var deepest int
+	for _, child := range node.Content {
+		if d := yamlDepth(child, max-depth); d > deepest {
+			deepest = d
+		}
+		if depth+deepest > max {
+			break
+		}
+	}
+
+	return depth + deepest
+}
+
+// checkYAML looks for YAML constructs we don't want in a publiccode.yml file.
+//
+// Standard anchors, aliases and merge keys are expanded by the parser, but
+// non-standard tags (eg. "!include") would be silently read as plain strings,
+// so they are rejected. Anchors and aliases can also be disallowed altogether
+// setting ALLOW_YAML_ALIASES to false.
+func checkYAML(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	allowAliases := !viper.IsSet("ALLOW_YAML_ALIASES") || viper.GetBool("ALLOW_YAML_ALIASES")
+
+	return checkYAMLNode(&doc, allowAliases)
+}
+
+// checkYAMLNode walks the YAML tree looking for unsupported constructs.
+func checkYAMLNode(node *yaml.Node, allowAliases bool) error {
+	// Standard tags begin with "!!", anything else is an application specific
+	// directive like "!include".
+	if strings.HasPrefix(node.Tag, "!") && !strings.HasPrefix(node.Tag, "!!") {
+		return fmt.Errorf("line %d: unsupported YAML directive %s", node.Line, node.Tag)
+	}
+
+	if !allowAliases && (node.Kind == yaml.AliasNode || node.Anchor != "") {
+		return fmt.Errorf("line %d: YAML anchors and aliases are not allowed", node.Line)
+	}
+
+	// Aliases point to nodes already checked where the anchor was defined.
+	if node.Kind == yaml.AliasNode {
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := checkYAMLNode(child, allowAliases); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
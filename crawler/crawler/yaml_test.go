@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	publiccode "github.com/italia/publiccode-parser-go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+var anchorsPubliccode = `
+publiccodeYmlVersion: "0.2"
+name: Test
+description:
+  en: &description
+    shortDescription: "A short description"
+    features:
+       - A feature
+  it:
+    <<: *description
+    features:
+       - Una funzionalità
+`
+
+func TestCheckYAMLAnchors(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	assert.Nil(t, checkYAML([]byte(anchorsPubliccode)))
+
+	// Make sure the parser sees the expanded document.
+	parser := publiccode.NewParser()
+	parser.Strict = false
+	parser.DisableNetwork = true
+	_ = parser.Parse([]byte(anchorsPubliccode))
+
+	assert.Equal(t, "A short description", parser.PublicCode.Description["it"].ShortDescription)
+	assert.Equal(t, []string{"Una funzionalità"}, parser.PublicCode.Description["it"].Features)
+	assert.Equal(t, []string{"A feature"}, parser.PublicCode.Description["en"].Features)
+}
+
+func TestCheckYAMLAliasesDisallowed(t *testing.T) {
+	viper.Set("ALLOW_YAML_ALIASES", false)
+	defer viper.Set("ALLOW_YAML_ALIASES", true)
+
+	assert.Error(t, checkYAML([]byte(anchorsPubliccode)))
+	assert.Nil(t, checkYAML([]byte("name: Test\n")))
+}
+
+func TestCheckYAMLIncludes(t *testing.T) {
+	data := `
+name: Test
+description: !include description.yml
+`
+	err := checkYAML([]byte(data))
+	assert.EqualError(t, err, "line 3: unsupported YAML directive !include")
+
+	// Standard tags are fine.
+	assert.Nil(t, checkYAML([]byte("name: !!str Test\n")))
+}
+
+func TestCheckComplexity(t *testing.T) {
+	assert.Nil(t, checkComplexity([]byte(anchorsPubliccode)))
+
+	// 25 levels of nested mappings.
+	nested := "publiccodeYmlVersion: \"0.2\"\nname:"
+	for i := 0; i < 25; i++ {
+		nested += "\n" + strings.Repeat("  ", i+1) + "a:"
+	}
+	nested += " 1\n"
+
+	err := checkComplexity([]byte(nested))
+	assert.IsType(t, errorTooComplex{}, err)
+	assert.Contains(t, err.Error(), "tooComplex")
+
+	viper.Set("MAX_PUBLICCODE_DEPTH", 30)
+	assert.Nil(t, checkComplexity([]byte(nested)))
+	viper.Set("MAX_PUBLICCODE_DEPTH", nil)
+
+	viper.Set("MAX_PUBLICCODE_SIZE", 10)
+	assert.IsType(t, errorTooComplex{}, checkComplexity([]byte(anchorsPubliccode)))
+	viper.Set("MAX_PUBLICCODE_SIZE", nil)
+}
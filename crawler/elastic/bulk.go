@@ -0,0 +1,119 @@
+package elastic
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/italia/developers-italia-backend/crawler/metrics"
+	"github.com/olivere/elastic"
+	"github.com/spf13/viper"
+)
+
+// Defaults of the bulk processors, overridden by ELASTIC_BULK_MAX_WORKERS and
+// ELASTIC_BULK_SIZE_MB or ELASTIC_BULK_FLUSH_BYTES.
+const (
+	defaultBulkMaxWorkers = 2
+	defaultBulkFlushBytes = 5 << 20
+)
+
+var registerBulkMetrics sync.Once
+
+// bulkSettings are the settings of a bulk processor.
+type bulkSettings struct {
+	actions       int
+	workers       int
+	flushBytes    int
+	flushInterval time.Duration
+}
+
+// newBulkSettings returns the settings of a bulk processor sending requests
+// of up to actions documents with workers concurrent requests in flight,
+// capped to ELASTIC_BULK_ACTIONS and ELASTIC_BULK_MAX_WORKERS. The requests
+// are also sent once they reach ELASTIC_BULK_SIZE_MB, or ELASTIC_BULK_FLUSH_BYTES
+// if unset, and, if set, every ELASTIC_FLUSH_INTERVAL.
+func newBulkSettings(actions, workers int) bulkSettings {
+	maxWorkers := defaultBulkMaxWorkers
+	if viper.IsSet("ELASTIC_BULK_MAX_WORKERS") {
+		maxWorkers = viper.GetInt("ELASTIC_BULK_MAX_WORKERS")
+	}
+	if workers > maxWorkers {
+		workers = maxWorkers
+	}
+
+	if maxActions := viper.GetInt("ELASTIC_BULK_ACTIONS"); maxActions > 0 && actions > maxActions {
+		actions = maxActions
+	}
+
+	flushBytes := defaultBulkFlushBytes
+	if viper.IsSet("ELASTIC_BULK_FLUSH_BYTES") {
+		flushBytes = viper.GetInt("ELASTIC_BULK_FLUSH_BYTES")
+	}
+	if viper.IsSet("ELASTIC_BULK_SIZE_MB") {
+		flushBytes = viper.GetInt("ELASTIC_BULK_SIZE_MB") << 20
+	}
+
+	return bulkSettings{
+		actions:       actions,
+		workers:       workers,
+		flushBytes:    flushBytes,
+		flushInterval: viper.GetDuration("ELASTIC_FLUSH_INTERVAL"),
+	}
+}
+
+// NewBulkProcessor returns a bulk processor sending requests of up to actions
+// documents with workers concurrent requests in flight, as capped by
+// newBulkSettings.
+// The bulk requests rejected by a busy cluster are counted in the
+// elastic_bulk_rejected metric, so the caps can be tuned.
+// The failed requests are retried as a whole, not item by item: the response
+// of the items retried would replace the one of the first commit, and after
+// would miss the items indexed by it.
+func NewBulkProcessor(name string, actions, workers int, after elastic.BulkAfterFunc, elasticClient *elastic.Client) (*elastic.BulkProcessor, error) {
+	registerBulkMetrics.Do(func() {
+		metrics.RegisterPrometheusCounter("elastic_bulk_rejected", "Number of bulk requests rejected by Elasticsearch with 429.", "elastic")
+	})
+
+	settings := newBulkSettings(actions, workers)
+
+	service := elasticClient.BulkProcessor().
+		Name(name).
+		Workers(settings.workers).
+		BulkActions(settings.actions).
+		BulkSize(settings.flushBytes).
+		RetryItemStatusCodes().
+		After(func(executionID int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
+			if rejected := bulkRejected(response, err); rejected > 0 {
+				metrics.GetCounter("elastic_bulk_rejected", "elastic").Add(float64(rejected))
+			}
+			if after != nil {
+				after(executionID, requests, response, err)
+			}
+		})
+	if settings.flushInterval > 0 {
+		service = service.FlushInterval(settings.flushInterval)
+	}
+
+	return service.Do(context.Background())
+}
+
+// bulkRejected returns the number of requests of a bulk rejected with 429
+// Too Many Requests, either as a whole or item by item.
+func bulkRejected(response *elastic.BulkResponse, err error) int {
+	if e, ok := err.(*elastic.Error); ok && e.Status == http.StatusTooManyRequests {
+		return 1
+	}
+	if response == nil {
+		return 0
+	}
+
+	var rejected int
+	for _, item := range response.Failed() {
+		if item.Status == http.StatusTooManyRequests {
+			rejected++
+		}
+	}
+
+	return rejected
+}
@@ -0,0 +1,53 @@
+package elastic
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkRejected(t *testing.T) {
+	assert.Equal(t, 0, bulkRejected(nil, nil))
+	assert.Equal(t, 0, bulkRejected(nil, errors.New("connection refused")))
+	assert.Equal(t, 1, bulkRejected(nil, &elastic.Error{Status: http.StatusTooManyRequests}))
+
+	response := &elastic.BulkResponse{
+		Items: []map[string]*elastic.BulkResponseItem{
+			{"index": {Status: http.StatusCreated}},
+			{"index": {Status: http.StatusTooManyRequests}},
+			{"index": {Status: http.StatusTooManyRequests}},
+			{"index": {Status: http.StatusBadRequest}},
+		},
+	}
+	assert.Equal(t, 2, bulkRejected(response, nil))
+}
+
+func TestNewBulkSettings(t *testing.T) {
+	settings := newBulkSettings(1000, 4)
+	assert.Equal(t, bulkSettings{actions: 1000, workers: defaultBulkMaxWorkers, flushBytes: defaultBulkFlushBytes}, settings)
+
+	viper.Set("ELASTIC_BULK_ACTIONS", 200)
+	viper.Set("ELASTIC_BULK_FLUSH_BYTES", 1<<20)
+	viper.Set("ELASTIC_FLUSH_INTERVAL", "30s")
+	defer func() {
+		viper.Set("ELASTIC_BULK_ACTIONS", nil)
+		viper.Set("ELASTIC_BULK_FLUSH_BYTES", nil)
+		viper.Set("ELASTIC_FLUSH_INTERVAL", nil)
+	}()
+
+	settings = newBulkSettings(1000, 1)
+	assert.Equal(t, bulkSettings{actions: 200, workers: 1, flushBytes: 1 << 20, flushInterval: 30 * time.Second}, settings)
+
+	// ELASTIC_BULK_ACTIONS is a cap, the smaller batches are left alone.
+	assert.Equal(t, 100, newBulkSettings(100, 1).actions)
+
+	// ELASTIC_BULK_SIZE_MB takes precedence over ELASTIC_BULK_FLUSH_BYTES.
+	viper.Set("ELASTIC_BULK_SIZE_MB", 2)
+	defer viper.Set("ELASTIC_BULK_SIZE_MB", nil)
+	assert.Equal(t, 2<<20, newBulkSettings(1000, 1).flushBytes)
+}
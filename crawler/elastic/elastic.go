@@ -134,6 +134,14 @@ const (
         "type": "keyword",
         "index": true
       },
+      "fileETag": {
+        "type": "keyword",
+        "index": false
+      },
+      "fileLastModified": {
+        "type": "keyword",
+        "index": false
+      },
       "id": {
         "type": "keyword",
         "index": true
@@ -142,6 +150,15 @@ const (
         "type": "date",
         "index": false
       },
+      "firstSeen": {
+        "type": "date"
+      },
+      "lastModified": {
+        "type": "date"
+      },
+      "lastSeen": {
+        "type": "date"
+      },
       "publiccodeYmlVersion": {
         "type": "keyword",
         "index": false
@@ -425,6 +442,135 @@ const (
       },
       "vitalityDataChart": {
         "type": "integer"
+      },
+      "vitalityBuckets": {
+        "properties": {
+          "windowDays": {
+            "type": "integer"
+          },
+          "bucketDays": {
+            "type": "integer"
+          }
+        }
+      },
+      "repoSizeBytes": {
+        "type": "long"
+      },
+      "cloneDurationMs": {
+        "type": "long"
+      },
+      "rawPubliccode": {
+        "type": "text",
+        "index": false
+      },
+      "publiccodeHash": {
+        "type": "keyword"
+      },
+      "noSourceDetected": {
+        "type": "boolean"
+      },
+      "maintenanceType": {
+        "type": "keyword"
+      },
+      "maintenanceUntil": {
+        "type": "date",
+        "format": "strict_date"
+      },
+      "maintenanceExpired": {
+        "type": "boolean"
+      },
+      "disallowedLicense": {
+        "type": "boolean"
+      },
+      "spdxLicense": {
+        "type": "keyword"
+      },
+      "isOpenSource": {
+        "type": "boolean"
+      },
+      "dormant": {
+        "type": "boolean"
+      },
+      "relatedSoftware": {
+        "type": "keyword"
+      },
+      "openIssues": {
+        "type": "integer"
+      },
+      "openPullRequests": {
+        "type": "integer"
+      },
+      "languages": {
+        "properties": {
+          "name": {
+            "type": "keyword"
+          },
+          "percent": {
+            "type": "float"
+          }
+        }
+      },
+      "codeHost": {
+        "type": "keyword"
+      },
+      "lastCommit": {
+        "type": "date"
+      },
+      "mirrors": {
+        "type": "keyword"
+      },
+      "mirrorOf": {
+        "type": "keyword"
+      },
+      "commitHistogram": {
+        "properties": {
+          "month": {
+            "type": "keyword"
+          },
+          "commits": {
+            "type": "integer"
+          }
+        }
+      },
+      "complianceScore": {
+        "type": "integer"
+      },
+      "description": {
+        "properties": {
+          "localisedName": {
+            "type": "text",
+            "analyzer": "autocomplete",
+            "search_analyzer": "autocomplete_search"
+          },
+          "genericName": {
+            "type": "text"
+          },
+          "shortDescription": {
+            "type": "text",
+            "analyzer": "autocomplete",
+            "search_analyzer": "autocomplete_search"
+          },
+          "longDescription": {
+            "type": "text",
+            "analyzer": "autocomplete",
+            "search_analyzer": "autocomplete_search"
+          },
+          "features": {
+            "type": "keyword"
+          }
+        }
+      },
+      "descriptionLanguage": {
+        "type": "keyword"
+      },
+      "descriptionLanguages": {
+        "type": "keyword"
+      },
+      "descriptionFallback": {
+        "type": "boolean"
+      },
+      "daysSinceLastCommit": {
+        "type": "integer"
       }
     }
   }
@@ -546,6 +692,12 @@ const (
           },
           "website": {
             "type": "keyword"
+          },
+          "orgs": {
+            "type": "keyword"
+          },
+          "repos": {
+            "type": "keyword"
           }
         }
       }
@@ -590,6 +742,64 @@ func AliasUpdate(index, alias string, elasticClient *elastic.Client) error {
 	return err
 }
 
+// AliasSwap atomically moves alias from the index from to the index to.
+func AliasSwap(alias, from, to string, elasticClient *elastic.Client) error {
+	log.Debugf("Move alias %s from %s to %s", alias, from, to)
+	_, err := elasticClient.Alias().
+		Remove(from, alias).
+		Add(to, alias).
+		Do(context.Background())
+
+	return err
+}
+
+// AliasReplace atomically points alias to index instead of the indices it
+// points to now, except the ones in keep.
+func AliasReplace(alias, index string, keep []string, elasticClient *elastic.Client) error {
+	current, err := AliasIndices(alias, elasticClient)
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{index: true}
+	for _, k := range keep {
+		kept[k] = true
+	}
+
+	log.Debugf("Replace the indices of alias %s with %s", alias, index)
+	service := elasticClient.Alias().Add(index, alias)
+	for _, old := range current {
+		if !kept[old] {
+			service = service.Remove(old, alias)
+		}
+	}
+	_, err = service.Do(context.Background())
+
+	return err
+}
+
+// AliasIndices returns the indices alias points to, none if it doesn't exist.
+func AliasIndices(alias string, elasticClient *elastic.Client) ([]string, error) {
+	res, err := elasticClient.Aliases().Alias(alias).Do(context.Background())
+	if elastic.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res.IndicesByAlias(alias), nil
+}
+
+// CountDocuments returns the number of documents in index.
+func CountDocuments(index string, elasticClient *elastic.Client) (int64, error) {
+	return elasticClient.Count(index).Do(context.Background())
+}
+
+// ErrNodeDown is returned by the requests failed even after the retries of
+// the Retrier.
+var ErrNodeDown = errors.New("elasticsearch or network down")
+
 // Retrier implements the elastic interface that user can implement to intercept failed requests.
 type Retrier struct {
 	backoff elastic.Backoff
@@ -608,7 +818,7 @@ func (r *Retrier) Retry(ctx context.Context, retry int, req *http.Request, resp
 
 	// Stop after 8 retries: ~2m.
 	if retry >= 8 {
-		return 0, false, errors.New("elasticsearch or network down")
+		return 0, false, ErrNodeDown
 	}
 
 	// Let the backoff strategy decide how long to wait and whether to stop.
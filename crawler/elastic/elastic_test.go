@@ -0,0 +1,40 @@
+package elastic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliasReplace(t *testing.T) {
+	var actions string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/_alias/jekyll":
+			_, _ = w.Write([]byte(`{"publiccodes": {"aliases": {"jekyll": {}}}, "administrations": {"aliases": {"jekyll": {}}}}`))
+		case "/_aliases":
+			body, _ := ioutil.ReadAll(r.Body)
+			actions = string(body)
+			_, _ = w.Write([]byte(`{"acknowledged": true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, AliasReplace("jekyll", "imported", []string{"administrations"}, client))
+	assert.JSONEq(t, `{"actions": [
+		{"add": {"alias": "jekyll", "index": "imported"}},
+		{"remove": {"alias": "jekyll", "index": "publiccodes"}}
+	]}`, actions)
+}
@@ -0,0 +1,103 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/olivere/elastic"
+)
+
+// ReindexStatus is the progress of a reindex task.
+type ReindexStatus struct {
+	Completed bool
+	// Total is the number of documents to copy, Created and Updated the ones
+	// copied and VersionConflicts the ones already in the destination.
+	Total            int64
+	Created          int64
+	Updated          int64
+	VersionConflicts int64
+	// Failures are the reasons of the documents that couldn't be copied.
+	Failures []string
+}
+
+// Done returns the number of documents processed so far.
+func (s ReindexStatus) Done() int64 {
+	return s.Created + s.Updated + s.VersionConflicts
+}
+
+// StartReindex starts a task copying the documents of src into dst,
+// transformed by the painless script if not empty, and returns its ID.
+// The documents already in dst are left as they are, so an interrupted copy
+// can be resumed starting it again.
+func StartReindex(src, dst, script string, elasticClient *elastic.Client) (string, error) {
+	service := elasticClient.Reindex().
+		Source(elastic.NewReindexSource().Index(src)).
+		Destination(elastic.NewReindexDestination().Index(dst).OpType("create")).
+		ProceedOnVersionConflict().
+		Refresh("true")
+	if script != "" {
+		service = service.Script(elastic.NewScript(script))
+	}
+
+	res, err := service.DoAsync(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	return res.TaskId, nil
+}
+
+// ReindexTask returns the status of the reindex task taskID.
+func ReindexTask(taskID string, elasticClient *elastic.Client) (ReindexStatus, error) {
+	res, err := elasticClient.PerformRequest(context.Background(), elastic.PerformRequestOptions{
+		Method: "GET",
+		Path:   "/_tasks/" + url.PathEscape(taskID),
+	})
+	if err != nil {
+		return ReindexStatus{}, err
+	}
+
+	var task struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Status struct {
+				Total            int64 `json:"total"`
+				Created          int64 `json:"created"`
+				Updated          int64 `json:"updated"`
+				VersionConflicts int64 `json:"version_conflicts"`
+			} `json:"status"`
+		} `json:"task"`
+		Response struct {
+			Failures []struct {
+				ID    string `json:"id"`
+				Cause struct {
+					Reason string `json:"reason"`
+				} `json:"cause"`
+			} `json:"failures"`
+		} `json:"response"`
+		Error *struct {
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(res.Body, &task); err != nil {
+		return ReindexStatus{}, err
+	}
+	if task.Error != nil {
+		return ReindexStatus{}, fmt.Errorf("reindex task %s failed: %s", taskID, task.Error.Reason)
+	}
+
+	status := ReindexStatus{
+		Completed:        task.Completed,
+		Total:            task.Task.Status.Total,
+		Created:          task.Task.Status.Created,
+		Updated:          task.Task.Status.Updated,
+		VersionConflicts: task.Task.Status.VersionConflicts,
+	}
+	for _, failure := range task.Response.Failures {
+		status.Failures = append(status.Failures, failure.ID+": "+failure.Cause.Reason)
+	}
+
+	return status, nil
+}
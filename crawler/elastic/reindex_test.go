@@ -0,0 +1,44 @@
+package elastic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReindexTask(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_tasks/node:1":
+			_, _ = w.Write([]byte(`{"completed": false, "task": {"status": {"total": 10, "created": 3, "version_conflicts": 2}}}`))
+		case "/_tasks/node:2":
+			_, _ = w.Write([]byte(`{"completed": true, "task": {"status": {"total": 10}},
+				"response": {"failures": [{"id": "abc", "cause": {"reason": "mapper_parsing_exception"}}]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := ReindexTask("node:1", client)
+	assert.NoError(t, err)
+	assert.False(t, status.Completed)
+	assert.Equal(t, int64(5), status.Done())
+	assert.Equal(t, int64(10), status.Total)
+
+	status, err = ReindexTask("node:2", client)
+	assert.NoError(t, err)
+	assert.True(t, status.Completed)
+	assert.Equal(t, []string{"abc: mapper_parsing_exception"}, status.Failures)
+
+	_, err = ReindexTask("node:3", client)
+	assert.True(t, elastic.IsNotFound(err))
+}
@@ -0,0 +1,115 @@
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// mappingField is a field of an Elasticsearch mapping.
+type mappingField struct {
+	Type       string                  `json:"type"`
+	Properties map[string]mappingField `json:"properties"`
+}
+
+// mappingProperties returns the fields of docType in mapping.
+func mappingProperties(mapping, docType string) (map[string]mappingField, error) {
+	var m struct {
+		Mappings map[string]mappingField `json:"mappings"`
+	}
+	if err := json.Unmarshal([]byte(mapping), &m); err != nil {
+		return nil, err
+	}
+
+	t, ok := m.Mappings[docType]
+	if !ok {
+		return nil, fmt.Errorf("no %s type in the mapping", docType)
+	}
+
+	return t.Properties, nil
+}
+
+// ValidateDocument returns the problems of doc against the fields of docType
+// in mapping: the values that can't be indexed in the type of their field.
+// Fields not in the mapping are left to the dynamic mapping.
+func ValidateDocument(mapping, docType string, doc map[string]interface{}) ([]string, error) {
+	properties, err := mappingProperties(mapping, docType)
+	if err != nil {
+		return nil, err
+	}
+
+	return validateObject("", properties, doc), nil
+}
+
+// validateObject checks the values of obj against the fields in properties.
+func validateObject(prefix string, properties map[string]mappingField, obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		field, ok := properties[key]
+		if !ok {
+			continue
+		}
+		problems = append(problems, validateValue(prefix+key, field, obj[key])...)
+	}
+
+	return problems
+}
+
+// validateValue checks value against field. Arrays are checked item by item.
+func validateValue(name string, field mappingField, value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+	if items, ok := value.([]interface{}); ok {
+		var problems []string
+		for _, item := range items {
+			problems = append(problems, validateValue(name, field, item)...)
+		}
+		return problems
+	}
+
+	var valid bool
+	switch {
+	case field.Properties != nil || field.Type == "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+		return validateObject(name+".", field.Properties, obj)
+	case field.Type == "keyword" || field.Type == "text" || field.Type == "date":
+		_, isString := value.(string)
+		_, isNumber := value.(float64)
+		_, isBool := value.(bool)
+		valid = isString || isNumber || isBool
+	case field.Type == "integer" || field.Type == "long":
+		n, ok := value.(float64)
+		valid = ok && n == float64(int64(n))
+	case field.Type == "float" || field.Type == "double":
+		_, valid = value.(float64)
+	case field.Type == "boolean":
+		_, valid = value.(bool)
+	default:
+		valid = true
+	}
+
+	if !valid {
+		return []string{fmt.Sprintf("%s: %v is not a valid %s", name, value, fieldType(field))}
+	}
+
+	return nil
+}
+
+// fieldType returns the type of field, object for the ones with properties.
+func fieldType(field mappingField) string {
+	if field.Type == "" {
+		return "object"
+	}
+
+	return field.Type
+}
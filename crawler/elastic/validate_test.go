@@ -0,0 +1,39 @@
+package elastic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDocument(t *testing.T) {
+	mapping := `{"mappings": {"software": {"properties": {
+		"score": {"type": "integer"},
+		"tags": {"type": "keyword"},
+		"meta": {"properties": {"active": {"type": "boolean"}}}
+	}}}}`
+
+	problems, err := ValidateDocument(mapping, "software", map[string]interface{}{
+		"score":   42.0,
+		"tags":    []interface{}{"a", "b"},
+		"meta":    map[string]interface{}{"active": true},
+		"dynamic": map[string]interface{}{"any": "thing"},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	problems, err = ValidateDocument(mapping, "software", map[string]interface{}{
+		"score": 4.2,
+		"tags":  []interface{}{"a", map[string]interface{}{}},
+		"meta":  map[string]interface{}{"active": "yes"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"meta.active: yes is not a valid boolean",
+		"score: 4.2 is not a valid integer",
+		"tags: map[] is not a valid keyword",
+	}, problems)
+
+	_, err = ValidateDocument(mapping, "administration", nil)
+	assert.Error(t, err)
+}
@@ -3,8 +3,10 @@ package ipa
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,6 +15,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/italia/developers-italia-backend/crawler/elastic"
@@ -57,12 +60,24 @@ type Amministrazione struct {
 	LivAccessibili    string
 }
 
+// Defaults of the IndicePA bulk import, overridden by INDICEPA_BULK_SIZE
+// and INDICEPA_BULK_WORKERS.
+const (
+	defaultBulkSize    = 1000
+	defaultBulkWorkers = 1
+)
+
 func localIPAFile() string {
 	return path.Join(viper.GetString("CRAWLER_DATADIR"), "indicepa.csv")
 }
 
+// checksumFile is where the checksum of the last imported records is stored.
+func checksumFile() string {
+	return path.Join(viper.GetString("CRAWLER_DATADIR"), "indicepa.sha256")
+}
+
 // UpdateFromIndicePAIfNeeded downloads the amministrazioni.txt file if it's older than 20 days
-// and loads it into Elasticsearch.
+// or if it was never imported, and loads it into Elasticsearch.
 func UpdateFromIndicePAIfNeeded(elasticClient *es.Client) error {
 	file := localIPAFile()
 
@@ -80,24 +95,54 @@ func UpdateFromIndicePAIfNeeded(elasticClient *es.Client) error {
 		}
 	}
 
+	// The file might have been downloaded without being imported.
+	if _, err := os.Stat(checksumFile()); os.IsNotExist(err) {
+		needUpdate = true
+	}
+
 	if needUpdate {
-		return UpdateFromIndicePA(elasticClient)
+		return UpdateFromIndicePA(elasticClient, false)
 	}
 
 	return nil
 }
 
+// lastImport returns the time of the last import of the local copy of
+// amministrazioni.txt, zero if it was never imported.
+func lastImport() time.Time {
+	if _, err := os.Stat(localIPAFile()); err != nil {
+		return time.Time{}
+	}
+	info, err := os.Stat(checksumFile())
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
 // UpdateFromIndicePA downloads the amministrazioni.txt file and loads it into Elasticsearch.
-func UpdateFromIndicePA(elasticClient *es.Client) error {
+// The import is skipped if the file wasn't modified since the last one or the
+// data didn't change, unless force is true.
+func UpdateFromIndicePA(elasticClient *es.Client, force bool) error {
+	var since time.Time
+	if !force {
+		since = lastImport()
+	}
+
 	// Download the main iPA file to disk (TODO: remove this)
 	url := viper.GetString("INDICEPA_URL")
 	log.Infof("Updating our cached copy from IndicePA from %v...", url)
 	file := localIPAFile()
-	err := downloadFile(file, url)
+	modified, err := downloadFile(file, url, since)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	if !modified {
+		log.Info("IndicePA data not modified since the last import, skipping")
+		return nil
+	}
 
 	type amministrazioneES struct {
 		IPA         string `json:"ipa"`
@@ -157,6 +202,21 @@ func UpdateFromIndicePA(elasticClient *es.Client) error {
 		return fmt.Errorf("0 PEC addresses read from IndicePA; aborting")
 	}
 
+	// Skip the import if the records are the same we imported last time.
+	recordsJSON, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(recordsJSON))
+	if !force {
+		lastChecksum, err := ioutil.ReadFile(checksumFile())
+		if err == nil && strings.TrimSpace(string(lastChecksum)) == checksum {
+			log.Info("IndicePA data didn't change since the last import, skipping")
+			// The next download is skipped if not modified since now.
+			return ioutil.WriteFile(checksumFile(), []byte(checksum), 0644)
+		}
+	}
+
 	log.Debugf("inserting %d records into Elasticsearch", len(records))
 
 	// Delete existing index if exists
@@ -173,24 +233,65 @@ func UpdateFromIndicePA(elasticClient *es.Client) error {
 		return err
 	}
 
-	// Perform a bulk request to Elasticsearch
-	bulkRequest := elasticClient.Bulk()
+	bulkSize := defaultBulkSize
+	if viper.IsSet("INDICEPA_BULK_SIZE") {
+		bulkSize = viper.GetInt("INDICEPA_BULK_SIZE")
+	}
+	bulkWorkers := defaultBulkWorkers
+	if viper.IsSet("INDICEPA_BULK_WORKERS") {
+		bulkWorkers = viper.GetInt("INDICEPA_BULK_WORKERS")
+	}
+
+	// Perform bulk requests of bulkSize records to Elasticsearch.
+	// The records rejected one by one are in the response, not in err.
+	var mutex sync.Mutex
+	var indexed, failed int
+	var bulkErr error
+	processor, err := elastic.NewBulkProcessor("indicepa", bulkSize, bulkWorkers,
+		func(_ int64, _ []es.BulkableRequest, response *es.BulkResponse, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil && bulkErr == nil {
+				bulkErr = err
+			}
+			if response == nil {
+				return
+			}
+			indexed += len(response.Indexed())
+			for _, item := range response.Failed() {
+				log.Warnf("Rejected IndicePA record %s: %s", item.Id, item.Error.Reason)
+				failed++
+			}
+		}, elasticClient)
+	if err != nil {
+		return err
+	}
+
 	for n, amm := range records {
 		req := es.NewBulkIndexRequest().
 			Index(viper.GetString("ELASTIC_INDICEPA_INDEX")).
 			Type("pa").
 			Id(strconv.Itoa(n)).
 			Doc(amm)
-		bulkRequest.Add(req)
+		processor.Add(req)
 	}
-	bulkResponse, err := bulkRequest.Do(ctx)
-	if err != nil {
+
+	// Close flushes the pending requests.
+	if err := processor.Close(); err != nil {
 		return err
 	}
+	if bulkErr != nil {
+		return bulkErr
+	}
+	// Not storing the checksum, the next run imports them again.
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records from IndicePA not indexed", failed, len(records))
+	}
 
-	log.Infof("%d records indexed from IndicePA", len(bulkResponse.Indexed()))
+	log.Infof("%d records indexed from IndicePA", indexed)
 
-	return nil
+	return ioutil.WriteFile(checksumFile(), []byte(checksum), 0644)
 }
 
 // GetAdministrationName return the administration name associated to the "codice iPA" asssociated.
@@ -295,22 +396,21 @@ func parseLine(line string) Amministrazione {
 	return amm
 }
 
-func downloadFile(filepath string, url string) error {
-	// Create the file.
-	out, err := os.Create(filepath)
+// downloadFile downloads url to filepath, if modified since since when it's
+// not zero. It returns false, leaving filepath as it is, if it wasn't.
+func downloadFile(filepath string, url string, since time.Time) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if !since.IsZero() {
+		req.Header.Set("If-Modified-Since", since.UTC().Format(http.TimeFormat))
 	}
-	defer func() {
-		if err := out.Close(); err != nil {
-			log.Error(err)
-		}
-	}()
 
 	// Get the data from the url.
-	resp, err := http.Get(url)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -318,8 +418,29 @@ func downloadFile(filepath string, url string) error {
 		}
 	}()
 
-	// Write the body to file.
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return false, nil
+	default:
+		return false, fmt.Errorf("error in downloading %s: status %s", url, resp.Status)
+	}
+
+	// Write the body to a temporary file first, so a failed download
+	// doesn't replace the copy of the last one.
+	tmp := filepath + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
 	_, err = io.Copy(out, resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
 
-	return err
+	return true, os.Rename(tmp, filepath)
 }
@@ -0,0 +1,144 @@
+package ipa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeIndicePA is a fake IndicePA and Elasticsearch answering the bulk
+// requests with bulkResponse.
+type fakeIndicePA struct {
+	*httptest.Server
+	client *elastic.Client
+
+	// Number of downloads of amministrazioni.txt and of bulk requests.
+	downloads, bulkRequests int
+}
+
+func newFakeIndicePA(t *testing.T, bulkResponse string) *fakeIndicePA {
+	amministrazioni := strings.Join([]string{"pcm", "Presidenza del Consiglio", "", "", "", "", "", "", "https://www.governo.it", "", "", "", "Pubbliche Amministrazioni", "", "80188230587"}, "\t")
+	pec := strings.Join([]string{"pcm", "", "", "", "", "", "", "pcm@pec.governo.it", "pec"}, "\t")
+	modified := time.Date(2020, time.July, 15, 12, 0, 0, 0, time.UTC)
+
+	f := &fakeIndicePA{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/amministrazioni.txt":
+			if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			f.downloads++
+			fmt.Fprintln(w, amministrazioni)
+		case r.URL.Path == "/pec.txt":
+			fmt.Fprintln(w, pec)
+		case r.URL.Path == "/_bulk":
+			f.bulkRequests++
+			fmt.Fprint(w, bulkResponse)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		}
+	}))
+
+	viper.Set("INDICEPA_URL", f.URL+"/amministrazioni.txt")
+	viper.Set("INDICEPA_PEC_URL", f.URL+"/pec.txt")
+	viper.Set("ELASTIC_INDICEPA_INDEX", "indicepa_pec")
+
+	client, err := elastic.NewClient(elastic.SetURL(f.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.client = client
+
+	return f
+}
+
+const bulkIndexed = `{"took":1,"errors":false,"items":[{"index":{"_index":"indicepa_pec","_type":"pa","_id":"0","status":201}}]}`
+
+func TestUpdateFromIndicePASkipsUnchangedData(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("CRAWLER_DATADIR", dir)
+
+	ts := newFakeIndicePA(t, bulkIndexed)
+	defer ts.Close()
+
+	assert.NoError(t, UpdateFromIndicePA(ts.client, false))
+	assert.Equal(t, 1, ts.bulkRequests)
+
+	// The data didn't change, so it's not imported again.
+	if err := os.Chtimes(checksumFile(), time.Time{}, time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, UpdateFromIndicePA(ts.client, false))
+	assert.Equal(t, 2, ts.downloads)
+	assert.Equal(t, 1, ts.bulkRequests)
+
+	assert.NoError(t, UpdateFromIndicePA(ts.client, true))
+	assert.Equal(t, 2, ts.bulkRequests)
+}
+
+func TestUpdateFromIndicePANotModified(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("CRAWLER_DATADIR", dir)
+
+	ts := newFakeIndicePA(t, bulkIndexed)
+	defer ts.Close()
+
+	assert.NoError(t, UpdateFromIndicePA(ts.client, false))
+	assert.Equal(t, 1, ts.downloads)
+
+	// Not modified since the last import, it's not downloaded again.
+	assert.NoError(t, UpdateFromIndicePA(ts.client, false))
+	assert.Equal(t, 1, ts.downloads)
+	assert.Equal(t, 1, ts.bulkRequests)
+
+	assert.NoError(t, UpdateFromIndicePA(ts.client, true))
+	assert.Equal(t, 2, ts.downloads)
+}
+
+func TestUpdateFromIndicePABulkFailed(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("CRAWLER_DATADIR", dir)
+
+	ts := newFakeIndicePA(t, `{"took":1,"errors":true,"items":[{"index":{"_index":"indicepa_pec","_type":"pa","_id":"0","status":400,`+
+		`"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [cf]"}}}]}`)
+	defer ts.Close()
+
+	assert.EqualError(t, UpdateFromIndicePA(ts.client, false), "1 of 1 records from IndicePA not indexed")
+
+	// Not imported, so the next run tries again.
+	_, err = os.Stat(checksumFile())
+	assert.True(t, os.IsNotExist(err))
+}
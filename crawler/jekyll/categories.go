@@ -0,0 +1,70 @@
+package jekyll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ghodss/yaml"
+	"github.com/italia/developers-italia-backend/crawler/elastic"
+	es "github.com/olivere/elastic"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// CategoriesSoftware exports, for each of categories, a file in dir with the
+// software in that category, in format "yml" or "json". Categories without
+// software get a file with an empty list.
+func CategoriesSoftware(dir string, categories []string, format string, elasticClient *es.Client) error {
+	if format != "yml" && format != "json" {
+		return fmt.Errorf("unknown export format %s", format)
+	}
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return err
+	}
+
+	for _, category := range categories {
+		destFile := path.Join(dir, path.Base(category)+"."+format)
+		log.Infof("Generating %s", destFile)
+
+		query := elastic.NewBoolQuery("software").
+			Filter(es.NewTermQuery("publiccode.categories", category))
+		searchResult, err := elasticClient.Search().
+			Index(viper.GetString("ELASTIC_PUBLICCODE_INDEX")). // search in index "publiccode"
+			Query(query).                                       // specify the query
+			From(0).Size(10000).                                // get first 10k elements. The limit can be changed in ES.
+			Do(context.Background())                            // execute
+		if err != nil {
+			return err
+		}
+
+		software := []interface{}{}
+		for _, hit := range searchResult.Hits.Hits {
+			var v interface{}
+			if err := json.Unmarshal(*hit.Source, &v); err != nil {
+				log.Error(err)
+				continue
+			}
+			software = append(software, v)
+		}
+
+		var data []byte
+		if format == "json" {
+			data, err = json.MarshalIndent(software, "", "  ")
+		} else {
+			data, err = yaml.Marshal(software)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(destFile, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package jekyll
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	es "github.com/olivere/elastic"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoriesSoftware(t *testing.T) {
+	viper.Set("ELASTIC_PUBLICCODE_INDEX", "publiccode")
+	defer viper.Set("ELASTIC_PUBLICCODE_INDEX", nil)
+
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/publiccode/_search" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		queries = append(queries, string(body))
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(string(body), `"publiccode.categories":"it-services"`) {
+			_, _ = w.Write([]byte(`{"hits": {"total": 1, "hits": [{"_id": "1", "_source": {"name": "App"}}]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"hits": {"total": 0, "hits": []}}`))
+	}))
+	defer ts.Close()
+
+	client, err := es.NewClient(es.SetURL(ts.URL), es.SetSniff(false), es.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "jekyll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, CategoriesSoftware(dir, []string{"it-services", "finance"}, "json", client))
+
+	// The software is filtered by Elasticsearch, one query per category.
+	assert.Len(t, queries, 2)
+	assert.Contains(t, queries[1], `"publiccode.categories":"finance"`)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "it-services.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"name": "App"}]`, string(data))
+
+	// A category without software still gets its file.
+	data, err = ioutil.ReadFile(filepath.Join(dir, "finance.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(data))
+
+	assert.NoError(t, CategoriesSoftware(dir, []string{"it-services", "finance"}, "yml", client))
+	data, err = ioutil.ReadFile(filepath.Join(dir, "it-services.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "- name: App\n", string(data))
+	data, err = ioutil.ReadFile(filepath.Join(dir, "finance.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[]\n", string(data))
+
+	assert.EqualError(t, CategoriesSoftware(dir, []string{"finance"}, "csv", client), "unknown export format csv")
+}
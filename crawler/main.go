@@ -25,6 +25,10 @@ func main() {
 		panic(fmt.Errorf("fatal error reding config file: %s", err))
 	}
 
+	if err := crawler.SetLogFormat(viper.GetString("LOG_FORMAT")); err != nil {
+		log.Fatal(err)
+	}
+
 	// Register client APIs.
 	crawler.RegisterClientAPIs()
 
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// readinessTimeout is the maximum time of a readiness check.
+const readinessTimeout = 5 * time.Second
+
+// readiness is the check run by "/readyz", nil until SetReadinessCheck.
+var readiness = struct {
+	sync.RWMutex
+	check func(ctx context.Context) error
+}{}
+
+// SetReadinessCheck sets the check run by each "/readyz" request: the
+// crawler is ready if it returns nil.
+func SetReadinessCheck(check func(ctx context.Context) error) {
+	readiness.Lock()
+	defer readiness.Unlock()
+
+	readiness.check = check
+}
+
+// healthzHandler returns the handler of "/healthz", 200 OK as long as the
+// process is up.
+func healthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
+
+// readyzHandler returns the handler of "/readyz", 200 OK if the readiness
+// check passes, 503 Service Unavailable with the reason otherwise.
+func readyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readiness.RLock()
+		check := readiness.check
+		readiness.RUnlock()
+
+		if check == nil {
+			http.Error(w, "not ready: starting", http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := check(ctx); err != nil {
+			log.Debugf("Readiness check failed: %v", err)
+			http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthzHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReadyz(t *testing.T) {
+	defer SetReadinessCheck(nil)
+
+	probe := func() (int, string) {
+		w := httptest.NewRecorder()
+		readyzHandler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, _ := probe()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	// The check runs on each request.
+	var err error
+	SetReadinessCheck(func(ctx context.Context) error { return err })
+	code, _ = probe()
+	assert.Equal(t, http.StatusOK, code)
+
+	err = errors.New("elasticsearch unreachable")
+	code, body := probe()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "elasticsearch unreachable")
+}
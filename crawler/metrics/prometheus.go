@@ -3,15 +3,35 @@ package metrics
 import (
 	"net/http"
 	"regexp"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
+// registeredMutex guards the maps of the registered metrics, read and
+// written by the workers of the crawl: the missing metrics are registered on
+// first use.
+var registeredMutex sync.Mutex
+
 // Map of all the registered Counters.
 var registeredCounters = make(map[string]prometheus.Counter)
 
+// Map of all the registered Histograms.
+var registeredHistograms = make(map[string]prometheus.Histogram)
+
+// Map of all the registered Counters with labels.
+var registeredCounterVecs = make(map[string]*prometheus.CounterVec)
+
+// Map of all the registered Gauges.
+var registeredGauges = make(map[string]prometheus.Gauge)
+
+// Map of all the registered Gauges with labels.
+var registeredGaugeVecs = make(map[string]*prometheus.GaugeVec)
+
 // Valid regex for prometheus model name.
 // (Prometheus model reference: https://github.com/prometheus/common)
 const validPrometheusName = "[^a-zA-Z_][^a-zA-Z0-9_]*"
@@ -20,10 +40,14 @@ const validPrometheusName = "[^a-zA-Z_][^a-zA-Z0-9_]*"
 func GetCounter(name, namespace string) prometheus.Counter {
 	// Validate and fix name (replace invalid chars with underscore "_").
 	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+
 	if registeredCounters[name] == nil {
 		log.Errorf("Error in metrics GetCounter: %s does not exist", name)
 		// If registeredCounters[name] does not exists a new counter is created and returned.
-		RegisterPrometheusCounter(name, "Autogenerated counter "+name, namespace)
+		registerPrometheusCounter(name, "Autogenerated counter "+name, namespace)
 		log.Warningf("Autogenerated: %s that does not exist", name)
 	}
 
@@ -35,6 +59,15 @@ func RegisterPrometheusCounter(name, helpText, namespace string) {
 	// Validate and fix name (replace invalid chars with underscore "_").
 	name = validateAndFix(name)
 
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+
+	registerPrometheusCounter(name, helpText, namespace)
+}
+
+// registerPrometheusCounter is RegisterPrometheusCounter with registeredMutex
+// locked and name valid.
+func registerPrometheusCounter(name, helpText, namespace string) {
 	// Add counter in the map.
 	registeredCounters[name] = prometheus.NewCounter(prometheus.CounterOpts{
 		Name:      name,
@@ -48,10 +81,242 @@ func RegisterPrometheusCounter(name, helpText, namespace string) {
 	}
 }
 
+// IncCounterVec increments the prometheus counter of given name with the values
+// of labels.
+func IncCounterVec(name, namespace string, labels prometheus.Labels) {
+	// Validate and fix name (replace invalid chars with underscore "_").
+	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	if registeredCounterVecs[name] == nil {
+		log.Errorf("Error in metrics IncCounterVec: %s does not exist", name)
+		// If registeredCounterVecs[name] does not exists a new counter is created,
+		// with the names of labels.
+		var names []string
+		for label := range labels {
+			names = append(names, label)
+		}
+		registerPrometheusCounterVec(name, "Autogenerated counter "+name, namespace, names...)
+		log.Warningf("Autogenerated: %s that does not exist", name)
+	}
+	counterVec := registeredCounterVecs[name]
+	registeredMutex.Unlock()
+
+	counter, err := counterVec.GetMetricWith(labels)
+	if err != nil {
+		log.Errorf("Error in metrics IncCounterVec: %v", err)
+		return
+	}
+	counter.Inc()
+}
+
+// RegisterPrometheusCounterVec register a new Counter of given name with help
+// text, partitioned by the labels.
+func RegisterPrometheusCounterVec(name, helpText, namespace string, labels ...string) {
+	// Validate and fix name (replace invalid chars with underscore "_").
+	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+
+	registerPrometheusCounterVec(name, helpText, namespace, labels...)
+}
+
+// registerPrometheusCounterVec is RegisterPrometheusCounterVec with
+// registeredMutex locked and name valid.
+func registerPrometheusCounterVec(name, helpText, namespace string, labels ...string) {
+	// Add counter in the map.
+	registeredCounterVecs[name] = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      name,
+		Namespace: "publiccode_crawler_" + namespace,
+		Help:      helpText,
+	}, labels)
+	// Register counter in Prometheus service.
+	err := prometheus.Register(registeredCounterVecs[name])
+	if err != nil {
+		log.Warningf("Error in metrics RegisterPrometheusCounterVec: %v", err)
+	}
+}
+
+// RegisterPrometheusHistogram register a new Histogram of given name with help text,
+// with the default buckets.
+func RegisterPrometheusHistogram(name, helpText, namespace string) {
+	// Validate and fix name (replace invalid chars with underscore "_").
+	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+
+	registerPrometheusHistogram(name, helpText, namespace)
+}
+
+// registerPrometheusHistogram is RegisterPrometheusHistogram with
+// registeredMutex locked and name valid.
+func registerPrometheusHistogram(name, helpText, namespace string) {
+	// Add histogram in the map.
+	registeredHistograms[name] = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:      name,
+		Namespace: "publiccode_crawler_" + namespace,
+		Help:      helpText,
+	})
+	// Register histogram in Prometheus service.
+	err := prometheus.Register(registeredHistograms[name])
+	if err != nil {
+		log.Warningf("Error in metrics RegisterPrometheusHistogram: %v", err)
+	}
+}
+
+// GetGauge return the prometheus gauge of given name.
+func GetGauge(name, namespace string) prometheus.Gauge {
+	// Validate and fix name (replace invalid chars with underscore "_").
+	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+
+	if registeredGauges[name] == nil {
+		log.Errorf("Error in metrics GetGauge: %s does not exist", name)
+		// If registeredGauges[name] does not exists a new gauge is created and returned.
+		registerPrometheusGauge(name, "Autogenerated gauge "+name, namespace)
+		log.Warningf("Autogenerated: %s that does not exist", name)
+	}
+
+	return registeredGauges[name]
+}
+
+// RegisterPrometheusGauge register a new Gauge of given name with help text.
+func RegisterPrometheusGauge(name, helpText, namespace string) {
+	// Validate and fix name (replace invalid chars with underscore "_").
+	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+
+	registerPrometheusGauge(name, helpText, namespace)
+}
+
+// registerPrometheusGauge is RegisterPrometheusGauge with registeredMutex
+// locked and name valid.
+func registerPrometheusGauge(name, helpText, namespace string) {
+	// Add gauge in the map.
+	registeredGauges[name] = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      name,
+		Namespace: "publiccode_crawler_" + namespace,
+		Help:      helpText,
+	})
+	// Register gauge in Prometheus service.
+	err := prometheus.Register(registeredGauges[name])
+	if err != nil {
+		log.Warningf("Error in metrics RegisterPrometheusGauge: %v", err)
+	}
+}
+
+// SetGaugeVec sets the prometheus gauge of given name with the values of labels
+// to value.
+func SetGaugeVec(name, namespace string, labels prometheus.Labels, value float64) {
+	// Validate and fix name (replace invalid chars with underscore "_").
+	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	if registeredGaugeVecs[name] == nil {
+		log.Errorf("Error in metrics SetGaugeVec: %s does not exist", name)
+		// If registeredGaugeVecs[name] does not exists a new gauge is created,
+		// with the names of labels.
+		var names []string
+		for label := range labels {
+			names = append(names, label)
+		}
+		registerPrometheusGaugeVec(name, "Autogenerated gauge "+name, namespace, names...)
+		log.Warningf("Autogenerated: %s that does not exist", name)
+	}
+	gaugeVec := registeredGaugeVecs[name]
+	registeredMutex.Unlock()
+
+	gauge, err := gaugeVec.GetMetricWith(labels)
+	if err != nil {
+		log.Errorf("Error in metrics SetGaugeVec: %v", err)
+		return
+	}
+	gauge.Set(value)
+}
+
+// RegisterPrometheusGaugeVec register a new Gauge of given name with help
+// text, partitioned by the labels.
+func RegisterPrometheusGaugeVec(name, helpText, namespace string, labels ...string) {
+	// Validate and fix name (replace invalid chars with underscore "_").
+	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+
+	registerPrometheusGaugeVec(name, helpText, namespace, labels...)
+}
+
+// registerPrometheusGaugeVec is RegisterPrometheusGaugeVec with
+// registeredMutex locked and name valid.
+func registerPrometheusGaugeVec(name, helpText, namespace string, labels ...string) {
+	// Add gauge in the map.
+	registeredGaugeVecs[name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      name,
+		Namespace: "publiccode_crawler_" + namespace,
+		Help:      helpText,
+	}, labels)
+	// Register gauge in Prometheus service.
+	err := prometheus.Register(registeredGaugeVecs[name])
+	if err != nil {
+		log.Warningf("Error in metrics RegisterPrometheusGaugeVec: %v", err)
+	}
+}
+
+// ObserveWithExemplar adds value to the histogram of given name, attaching
+// the exemplar labels to it. The exemplar is dropped if its labels are too long.
+func ObserveWithExemplar(name, namespace string, value float64, exemplar prometheus.Labels) {
+	name = validateAndFix(name)
+
+	registeredMutex.Lock()
+	if registeredHistograms[name] == nil {
+		log.Errorf("Error in metrics ObserveWithExemplar: %s does not exist", name)
+		// If registeredHistograms[name] does not exists a new histogram is created.
+		registerPrometheusHistogram(name, "Autogenerated histogram "+name, namespace)
+		log.Warningf("Autogenerated: %s that does not exist", name)
+	}
+	histogram := registeredHistograms[name]
+	registeredMutex.Unlock()
+
+	observer, ok := histogram.(prometheus.ExemplarObserver)
+	if !ok || exemplarLength(exemplar) > prometheus.ExemplarMaxRunes {
+		histogram.Observe(value)
+		return
+	}
+	observer.ObserveWithExemplar(value, exemplar)
+}
+
+// exemplarLength returns the number of runes of the exemplar labels.
+func exemplarLength(labels prometheus.Labels) int {
+	n := 0
+	for name, value := range labels {
+		n += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+
+	return n
+}
+
+// handler returns the handler of "/metrics". With METRICS_OPENMETRICS the
+// metrics and their exemplars are exposed in the OpenMetrics format to the
+// scrapers asking for it, the others get the classic Prometheus format.
+func handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics: viper.GetBool("METRICS_OPENMETRICS"),
+	})
+}
+
 // StartPrometheusMetricsServer starts a metric server handling
-// "/metrics" on "localhost:8081" exposing the registered metrics.
+// "/metrics" on "localhost:8081" exposing the registered metrics, and the
+// "/healthz" and "/readyz" probes.
 func StartPrometheusMetricsServer() {
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", handler())
+	http.Handle("/healthz", healthzHandler())
+	http.Handle("/readyz", readyzHandler())
 
 	err := http.ListenAndServe(":8081", nil)
 	if err != nil {
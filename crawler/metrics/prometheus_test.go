@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMetricsHandler(t *testing.T) {
+	RegisterPrometheusHistogram("test_seconds", "Test histogram.", "test")
+	ObserveWithExemplar("test_seconds", "test", 0.3, prometheus.Labels{"run_id": "20201014T120000Z-000001"})
+
+	scrape := func(accept string) (string, string) {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handler().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Header().Get("Content-Type"), w.Body.String()
+	}
+
+	const openMetrics = "application/openmetrics-text; version=0.0.1"
+
+	viper.Set("METRICS_OPENMETRICS", true)
+	defer viper.Set("METRICS_OPENMETRICS", nil)
+
+	contentType, body := scrape(openMetrics)
+	assert.True(t, strings.HasPrefix(contentType, "application/openmetrics-text"), contentType)
+	assert.Contains(t, body, `# {run_id="20201014T120000Z-000001"} 0.3`)
+
+	// Scrapers not asking for OpenMetrics get the classic format.
+	contentType, body = scrape("text/plain")
+	assert.True(t, strings.HasPrefix(contentType, "text/plain"), contentType)
+	assert.NotContains(t, body, "run_id")
+}
+
+func TestGauge(t *testing.T) {
+	RegisterPrometheusGauge("test_queue_depth", "Test gauge.", "test")
+	GetGauge("test_queue_depth", "test").Set(42)
+
+	w := httptest.NewRecorder()
+	handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), "publiccode_crawler_test_test_queue_depth 42")
+}
+
+func TestCounterVec(t *testing.T) {
+	RegisterPrometheusCounterVec("test_failed", "Test counter.", "test", "reason")
+	IncCounterVec("test_failed", "test", prometheus.Labels{"reason": "parse_error"})
+	// Bogus labels are ignored.
+	IncCounterVec("test_failed", "test", prometheus.Labels{"host": "example.org"})
+
+	w := httptest.NewRecorder()
+	handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `publiccode_crawler_test_test_failed{reason="parse_error"} 1`)
+}
+
+func TestGaugeVec(t *testing.T) {
+	RegisterPrometheusGaugeVec("test_remaining", "Test gauge.", "test", "host")
+	SetGaugeVec("test_remaining", "test", prometheus.Labels{"host": "api.github.com"}, 4999)
+	SetGaugeVec("test_remaining", "test", prometheus.Labels{"host": "api.github.com"}, 4998)
+
+	w := httptest.NewRecorder()
+	handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `publiccode_crawler_test_test_remaining{host="api.github.com"} 4998`)
+}
+
+// The metrics used before being registered are registered once, even by
+// concurrent workers (go test -race).
+func TestAutogeneratedConcurrently(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			GetCounter("test_autogenerated", "test").Inc()
+			IncCounterVec("test_autogenerated_vec", "test", prometheus.Labels{"class": "other"})
+		}()
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), "publiccode_crawler_test_test_autogenerated 10")
+	assert.Contains(t, w.Body.String(), `publiccode_crawler_test_test_autogenerated_vec{class="other"} 10`)
+}